@@ -0,0 +1,29 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// The gohttps command combines the HTTPS clients and servers in this
+// repository into a single binary, with each available as a subcommand:
+//
+//	gohttps simple-server -host localhost -srvcert server.crt -srvkey server.key
+//	gohttps client -cacert ca.crt -srvhost localhost
+package main
+
+import (
+	"os"
+
+	"github.com/youngkin/gohttps/internal/cli"
+	"github.com/youngkin/gohttps/internal/cmd/advserver"
+	"github.com/youngkin/gohttps/internal/cmd/client"
+	"github.com/youngkin/gohttps/internal/cmd/simpleserver"
+)
+
+var commands = []cli.Command{
+	{Name: "simple-server", Summary: "Run an HTTPS server with a minimal TLS configuration", Main: simpleserver.Main},
+	{Name: "adv-server", Summary: "Run an HTTPS server with advanced TLS options, including client certificate authentication", Main: advserver.Main},
+	{Name: "client", Summary: "Make an HTTPS request to a server", Main: client.Main},
+}
+
+func main() {
+	cli.Dispatch(commands, os.Args)
+}
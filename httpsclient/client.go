@@ -0,0 +1,474 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package httpsclient contains the HTTPS client used by the 'client' command.
+// It can also be used by other programs that need to make HTTPS requests,
+// optionally authenticating with a client certificate (i.e., mutual TLS):
+//
+//	c, err := httpsclient.NewClient(httpsclient.Config{CACertFile: "ca.crt", ClientCertFile: "client.crt", ClientKeyFile: "client.key"})
+//	...
+//	res, err := httpsclient.Do(ctx, c, httpsclient.Request{URL: "https://localhost"})
+//	...
+//	defer res.Body.Close()
+package httpsclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/certs"
+	"github.com/youngkin/gohttps/internal/dump"
+	"github.com/youngkin/gohttps/internal/logging"
+	"github.com/youngkin/gohttps/internal/tlsutil"
+)
+
+// DefaultTimeout is the overall request timeout used when Config.Timeout isn't set.
+const DefaultTimeout = 15 * time.Second
+
+// The connection pool settings used when the corresponding Config field isn't
+// set. They favor reusing connections, e.g., when making many requests to the
+// same server during a load test.
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 100
+	DefaultIdleConnTimeout     = 90 * time.Second
+)
+
+// Config specifies how the http.Client returned from NewClient is configured.
+type Config struct {
+	// CACertFile is the name of the file containing the certificate(s) of the
+	// CA(s) that signed the server's certificate. Required unless
+	// InsecureSkipVerify or UseSystemRoots is set.
+	//
+	// CACertFile, ClientCertFile, and ClientKeyFile may also name an environment
+	// variable or stdin instead of a file, see certs.ReadSource.
+	CACertFile string
+	// ClientCertFile and ClientKeyFile are the names of the client's certificate
+	// and private key files. Both are optional, but if one is provided the other
+	// must be too.
+	ClientCertFile string
+	ClientKeyFile  string
+	// ClientKeyPassphrase decrypts ClientKeyFile if it's encrypted.
+	ClientKeyPassphrase []byte
+	// RequireClientCertUse, if true, fails handshakes in which the server
+	// requests a client certificate but none is sent, because none was
+	// provided or the server doesn't accept it, with ErrClientCertNotSent,
+	// rather than connecting anonymously. See HandshakeStats.ClientCertRequested.
+	RequireClientCertUse bool
+	// ResumeSessions caches TLS sessions so that new connections to a server
+	// resume them, with a shorter handshake, rather than performing a full
+	// handshake each time.
+	ResumeSessions bool
+	// Timeout is the overall request timeout, defaults to DefaultTimeout.
+	Timeout time.Duration
+	// Profile is the name of the TLS profile, one of modern, intermediate, or
+	// old, that sets the minimum TLS version, cipher suites, and curves. If it's
+	// empty Go's defaults are used.
+	Profile string
+	// CurvePreferences, if not nil, are the curves, or key exchange groups,
+	// the client offers, overriding the profile's, e.g., to test that a server
+	// accepts, or rejects, a particular group.
+	CurvePreferences []tls.CurveID
+	// Renegotiation controls whether the server may request TLS renegotiation,
+	// which only applies to TLS 1.2 and earlier. Defaults to tls.RenegotiateNever.
+	Renegotiation tls.RenegotiationSupport
+	// MaxIdleConns is the maximum number of idle connections kept for reuse
+	// across all hosts, defaults to DefaultMaxIdleConns.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost is the maximum number of idle connections kept for
+	// reuse per host, defaults to DefaultMaxIdleConnsPerHost.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept before it's
+	// closed, defaults to DefaultIdleConnTimeout.
+	IdleConnTimeout time.Duration
+	// DisableKeepAlives, if true, closes each connection after its request,
+	// so every request pays for a new connection and TLS handshake, e.g., to
+	// measure the cost of setting them up.
+	DisableKeepAlives bool
+	// DisableCompression, if true, stops the client asking for, and
+	// transparently decompressing, gzip encoded responses, so bodies are read
+	// exactly as the server sent them.
+	DisableCompression bool
+	// SingleConnection, if true, sends every request over the client's first
+	// connection, one at a time, e.g., to show that requests reuse it without
+	// further handshakes. Once that connection is closed, e.g., by the server,
+	// requests fail with ErrConnectionClosed rather than a new connection
+	// being dialed. It can't be used with DisableKeepAlives or
+	// HTTP2PriorKnowledge.
+	SingleConnection bool
+	// Transferred, if not nil, counts the bytes read and written by all of
+	// the client's TLS connections.
+	Transferred *Transferred
+	// DumpHTTP, if not nil, is written every request and response, as they're
+	// sent on the wire, with the values of sensitive headers redacted, e.g.,
+	// to show the messages exchanged. Each response's body is read, up to
+	// DumpMaxBody bytes, before it's returned.
+	DumpHTTP io.Writer
+	// DumpMaxBody is the maximum number of bytes of each body written to
+	// DumpHTTP, defaults to 4096.
+	DumpMaxBody int
+	// DialContext, if set, is used to create the client's TCP connections,
+	// e.g., to tune TCP options. See http.Transport.DialContext.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// InsecureSkipVerify disables verification of the server's certificate,
+	// e.g., for self-signed certificates. It's only meant for testing.
+	InsecureSkipVerify bool
+	// UseSystemRoots trusts the system's root CAs in addition to CACertFile's,
+	// rather than only CACertFile's. If the system roots aren't available a
+	// warning is logged and only CACertFile's CAs are trusted.
+	UseSystemRoots bool
+	// ServerName, if not empty, is sent as the TLS server name indication,
+	// and the server's certificate is verified against it, instead of the
+	// host the client connects to, e.g., to test a certificate by name while
+	// connecting to a specific address.
+	ServerName string
+	// ClockSkewTolerance, if positive, accepts server certificate chains that
+	// only fail verification because a certificate is at most this far
+	// outside its validity period, e.g., because the local clock is wrong.
+	// Each such acceptance is logged as a warning. Defaults to 0, disabled.
+	ClockSkewTolerance time.Duration
+	// HTTP2PriorKnowledge sends requests using HTTP/2 without TLS, h2c, with
+	// prior knowledge, i.e., without first asking the server to upgrade, e.g.,
+	// to test a backend behind a TLS terminating proxy. Requests must use
+	// http URLs, and CACertFile isn't required.
+	HTTP2PriorKnowledge bool
+}
+
+// Request describes a single request to be issued by Do.
+type Request struct {
+	// Method defaults to GET
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+	// Host, if not empty, is sent as the Host header, :authority with HTTP/2,
+	// instead of URL's host, which is still the host connected to, e.g., to
+	// test a server's virtual hosts.
+	Host string
+	// NoTrace, if true, doesn't trace the request with httptrace, avoiding
+	// its overhead, e.g., when sending many requests. The Result's Reused,
+	// Handshake, SentHost, and Timing, other than Start and FirstByte, are
+	// then zero.
+	NoTrace bool
+}
+
+// Timing contains timing information for a request made by Do. DNS, Connect,
+// and TLSHandshake are zero if an existing connection was reused.
+type Timing struct {
+	// Start is when the request was issued.
+	Start time.Time
+	// DNS is how long it took to resolve the server's host name.
+	DNS time.Duration
+	// Connect is how long it took to establish the TCP connection.
+	Connect time.Duration
+	// TLSHandshake is how long the TLS handshake took.
+	TLSHandshake time.Duration
+	// Send is the time between obtaining a connection and finishing writing the request.
+	Send time.Duration
+	// Wait is the time between finishing writing the request and the first response byte.
+	Wait time.Duration
+	// FirstByte is the time between Start and when the response headers were received.
+	FirstByte time.Duration
+}
+
+// Result contains the server's response to a request made by Do. The caller
+// is responsible for closing Body.
+type Result struct {
+	Status     string
+	StatusCode int
+	// Proto is the protocol of the response, e.g., HTTP/1.1 or HTTP/2.0.
+	Proto  string
+	Header http.Header
+	Body   io.ReadCloser
+	Timing Timing
+	// TLS is the state of the TLS connection the response was received on.
+	TLS *tls.ConnectionState
+	// Reused is true if the request was sent on a previously used connection
+	// from the client's connection pool.
+	Reused bool
+	// Handshake is the cost of the TLS handshake of the connection the
+	// request was sent on, nil if the connection was reused.
+	Handshake *HandshakeStats
+	// SentHost is the Host header, or HTTP/2 :authority, actually written.
+	SentHost string
+	// ContentLength is the response's Content-Length, -1 if it's unknown, e.g.,
+	// because the body was transparently decompressed.
+	ContentLength int64
+	// Uncompressed is true if the body was sent gzip encoded and transparently
+	// decompressed, in which case Content-Encoding and Content-Length are
+	// removed from Header.
+	Uncompressed bool
+}
+
+// NewClient returns an http.Client with a TLS configuration created from cfg.
+func NewClient(cfg Config) (*http.Client, error) {
+	if cfg.SingleConnection && (cfg.DisableKeepAlives || cfg.HTTP2PriorKnowledge) {
+		return nil, errors.New("a single connection can't be used with disabled keep-alives or HTTP/2 prior knowledge")
+	}
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	t := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		DisableKeepAlives:   cfg.DisableKeepAlives,
+		DisableCompression:  cfg.DisableCompression,
+		DialContext:         cfg.DialContext,
+		// The TLS connections are dialed by the client, rather than the
+		// Transport, so the bytes their handshakes cost can be counted.
+		DialTLSContext: dialTLS(cfg.DialContext, tlsConfig, cfg.Transferred, cfg.RequireClientCertUse),
+	}
+	if t.MaxIdleConns == 0 {
+		t.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if t.MaxIdleConnsPerHost == 0 {
+		t.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if t.IdleConnTimeout == 0 {
+		t.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	if cfg.SingleConnection {
+		t.MaxConnsPerHost = 1
+		t.IdleConnTimeout = 0
+		t.DialTLSContext = dialOnce(t.DialTLSContext)
+	}
+	if cfg.HTTP2PriorKnowledge {
+		t.Protocols = new(http.Protocols)
+		t.Protocols.SetUnencryptedHTTP2(true)
+	}
+	if cfg.DumpHTTP != nil {
+		return &http.Client{Transport: &dumpTransport{Transport: t, d: dump.NewWriter(cfg.DumpHTTP, cfg.DumpMaxBody)}, Timeout: timeout}, nil
+	}
+	return &http.Client{Transport: t, Timeout: timeout}, nil
+}
+
+// TLSClientConfig returns the TLS configuration of client, which must have
+// been returned by NewClient.
+func TLSClientConfig(client *http.Client) *tls.Config {
+	switch t := client.Transport.(type) {
+	case *dumpTransport:
+		return t.Transport.TLSClientConfig
+	default:
+		return t.(*http.Transport).TLSClientConfig
+	}
+}
+
+// Do issues req using client. The returned error, if any, is the error returned
+// from http.Client.Do, so callers can inspect it for a *url.Error.
+func Do(ctx context.Context, client *http.Client, req Request) (Result, error) {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var t tracer
+	if !req.NoTrace {
+		ctx = t.withTrace(ctx)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL, bytes.NewBuffer(req.Body))
+	if err != nil {
+		return Result{}, fmt.Errorf("unable to create http request due to error %w", err)
+	}
+	for name, values := range req.Header {
+		for _, v := range values {
+			httpReq.Header.Add(name, v)
+		}
+	}
+	if req.Host != "" {
+		httpReq.Host = req.Host
+	}
+
+	start := time.Now()
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return Result{}, explainVerifyError(err, httpReq.URL.Hostname())
+	}
+
+	return Result{
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		Header:     resp.Header,
+		Body:       resp.Body,
+		Timing:     t.timing(start),
+		TLS:        resp.TLS,
+		Reused:     t.connReused(),
+		Handshake:  t.handshakeStats(),
+		SentHost:   t.host(),
+
+		ContentLength: resp.ContentLength,
+		Uncompressed:  resp.Uncompressed,
+	}, nil
+}
+
+// ChainError is the error, wrapped in the *url.Error returned by Do, when the
+// server's certificate chain fails verification and inspecting the chain
+// finds name constraint or path length violations, or a certificate that
+// isn't valid at the local time, that explain why.
+type ChainError struct {
+	// Err is the verification error returned by crypto/tls.
+	Err error
+	// Problems describes each violation found.
+	Problems []string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("%s (%s)", e.Err, strings.Join(e.Problems, "; "))
+}
+
+func (e *ChainError) Unwrap() error {
+	return e.Err
+}
+
+// explainVerifyError replaces the error wrapped by err, when it's a
+// certificate verification error, with a *ChainError if the presented chain
+// has name constraint or path length violations, or if a certificate in it
+// has expired or isn't valid yet, reporting how far off the local time is.
+func explainVerifyError(err error, host string) error {
+	var urlErr *url.Error
+	var verifyErr *tls.CertificateVerificationError
+	if !errors.As(err, &urlErr) || !errors.As(err, &verifyErr) {
+		return err
+	}
+	problems := certs.ExplainChain(verifyErr.UnverifiedCertificates, host)
+	if validity := certs.ExplainValidity(verifyErr.Err, time.Now()); validity != "" {
+		problems = append(problems, validity)
+	}
+	if len(problems) > 0 {
+		urlErr.Err = &ChainError{Err: urlErr.Err, Problems: problems}
+	}
+	return err
+}
+
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	if cfg.CACertFile == "" && !cfg.InsecureSkipVerify && !cfg.HTTP2PriorKnowledge && !cfg.UseSystemRoots {
+		return nil, errors.New("a CA certificate file is required")
+	}
+	if (cfg.ClientCertFile == "") != (cfg.ClientKeyFile == "") {
+		return nil, errors.New("both or neither of a client certificate and client key file must be provided")
+	}
+	if err := certs.CheckSources(cfg.CACertFile, cfg.ClientCertFile, cfg.ClientKeyFile); err != nil {
+		return nil, err
+	}
+
+	var clientCerts []tls.Certificate
+	if cfg.ClientCertFile != "" {
+		cert, err := certs.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile, cfg.ClientKeyPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		var chain []*x509.Certificate
+		for _, der := range cert.Certificate {
+			if c, err := x509.ParseCertificate(der); err == nil {
+				chain = append(chain, c)
+			}
+		}
+		for _, w := range certs.CheckCompatibility(chain) {
+			logging.Warnf("client certificate: %s", w)
+		}
+		clientCerts = []tls.Certificate{cert}
+	}
+
+	var caCertPool *x509.CertPool
+	var caCert []byte
+	if cfg.CACertFile != "" {
+		var err error
+		caCert, err = certs.ReadSource(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA cert, error: %w", err)
+		}
+		caCertPool, err = certs.NewCertPool(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("error loading CA cert %s: %w", cfg.CACertFile, err)
+		}
+	}
+	if cfg.UseSystemRoots {
+		pool, err := certs.NewSystemCertPool(caCert)
+		switch {
+		case errors.Is(err, certs.ErrNoSystemRoots) && caCertPool != nil:
+			logging.Warnf("%s, only trusting the CA cert %s", err, cfg.CACertFile)
+		case err != nil:
+			return nil, err
+		default:
+			caCertPool = pool
+		}
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates:       clientCerts,
+		RootCAs:            caCertPool,
+		Renegotiation:      cfg.Renegotiation,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ServerName:         cfg.ServerName,
+	}
+	if cfg.ResumeSessions {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+	if cfg.ClockSkewTolerance > 0 && !cfg.InsecureSkipVerify {
+		// The chain is verified by verifySkewed instead, which crypto/tls
+		// only allows when its own verification is skipped.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = verifySkewed(caCertPool, cfg.ClockSkewTolerance)
+	}
+	if cfg.Profile != "" {
+		profile, err := tlsutil.LookupProfile(cfg.Profile)
+		if err != nil {
+			return nil, err
+		}
+		profile.Apply(tlsConfig)
+	}
+	if cfg.CurvePreferences != nil {
+		tlsConfig.CurvePreferences = cfg.CurvePreferences
+	}
+	return tlsConfig, nil
+}
+
+// verifySkewed returns a tls.Config.VerifyConnection function that verifies
+// the server's certificate chain and host name against roots, the system
+// roots if it's nil, allowing for up to tolerance of clock skew. Failures are
+// returned as a *tls.CertificateVerificationError, as crypto/tls does.
+func verifySkewed(roots *x509.CertPool, tolerance time.Duration) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("tls: server didn't provide a certificate")
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		leaf := cs.PeerCertificates[0]
+		_, skew, err := certs.VerifyWithSkew(leaf, x509.VerifyOptions{
+			DNSName:       cs.ServerName,
+			Roots:         roots,
+			Intermediates: intermediates,
+		}, tolerance)
+		if err != nil {
+			return &tls.CertificateVerificationError{UnverifiedCertificates: cs.PeerCertificates, Err: err}
+		}
+		if skew != 0 {
+			logging.Warnf("accepted the server certificate for %s, which is only valid if the local clock is %s, within the clock skew tolerance of %s",
+				cs.ServerName, certs.DescribeSkew(skew), tolerance)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// issue returns a certificate created from tmpl, signed by parent and its
+// key, or self-signed if parent is nil, and the certificate's key. The
+// certificate is valid for an hour either side of now unless tmpl sets its
+// validity period.
+func issue(t *testing.T, tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+	}
+	if tmpl.IsCA {
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// writePEM writes the PEM encoded certs to a temporary file, returning its
+// name.
+func writePEM(t *testing.T, certs ...*x509.Certificate) string {
+	t.Helper()
+	var b []byte
+	for _, c := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	name := filepath.Join(t.TempDir(), "certs.pem")
+	if err := ioutil.WriteFile(name, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestNewTLSConfigProfile(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Config
+		minVersion uint16
+		curves     []tls.CurveID
+	}{
+		{"no profile", Config{InsecureSkipVerify: true}, 0, nil},
+		{"modern", Config{InsecureSkipVerify: true, Profile: "modern"}, tls.VersionTLS13, []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}},
+		{"curves override the profile's", Config{InsecureSkipVerify: true, Profile: "intermediate", CurvePreferences: []tls.CurveID{tls.X25519MLKEM768}}, tls.VersionTLS12, []tls.CurveID{tls.X25519MLKEM768}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := newTLSConfig(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.MinVersion != tc.minVersion {
+				t.Errorf("got the minimum version %x, want %x", got.MinVersion, tc.minVersion)
+			}
+			if !reflect.DeepEqual(got.CurvePreferences, tc.curves) {
+				t.Errorf("got the curves %v, want %v", got.CurvePreferences, tc.curves)
+			}
+		})
+	}
+
+	if _, err := newTLSConfig(Config{InsecureSkipVerify: true, Profile: "strict"}); err == nil {
+		t.Error("an unknown profile was accepted")
+	}
+}
+
+func TestDoExplainsConstrainedChain(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, rootKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test Root"}, IsCA: true}, nil, nil)
+	ca, caKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Corp Intermediate"}, IsCA: true, PermittedIPRanges: []*net.IPNet{subnet}}, root, rootKey)
+	leaf, leafKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "localhost"}, IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}}, ca, caKey)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw, ca.Raw}, PrivateKey: leafKey}}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	client, err := NewClient(Config{CACertFile: writePEM(t, root)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Do(context.Background(), client, Request{URL: ts.URL})
+	var chainErr *ChainError
+	if !errors.As(err, &chainErr) {
+		t.Fatalf("got the error %v, want a *ChainError", err)
+	}
+	want := `intermediate "Corp Intermediate" constrains IP addresses to 10.0.0.0/8, presented address was 127.0.0.1`
+	if len(chainErr.Problems) != 1 || chainErr.Problems[0] != want {
+		t.Errorf("got the problems %q, want %q", chainErr.Problems, want)
+	}
+	var verifyErr *tls.CertificateVerificationError
+	if !errors.As(err, &verifyErr) || !strings.Contains(err.Error(), want) {
+		t.Errorf("got the error %q, want it to wrap the verification error and include the problem", err)
+	}
+
+	// Other errors are returned unchanged
+	_, err = Do(context.Background(), client, Request{URL: "https://127.0.0.1:1"})
+	if errors.As(err, &chainErr) {
+		t.Errorf("got a *ChainError for a refused connection: %s", err)
+	}
+}
+
+func TestClockSkewTolerance(t *testing.T) {
+	var logs bytes.Buffer
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&logs)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	}()
+
+	// The server's certificate isn't valid for another 2 minutes, as if the
+	// local clock were 2 minutes behind
+	root, rootKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test Root"}, IsCA: true}, nil, nil)
+	leaf, leafKey := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:   time.Now().Add(2 * time.Minute),
+		NotAfter:    time.Now().Add(time.Hour),
+	}, root, rootKey)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw}, PrivateKey: leafKey}}}
+	ts.StartTLS()
+	defer ts.Close()
+	caFile := writePEM(t, root)
+
+	tests := []struct {
+		name      string
+		tolerance time.Duration
+		wantErr   string
+	}{
+		{"off", 0, `certificate "localhost" isn't valid until`},
+		{"beyond the tolerance", time.Minute, `certificate "localhost" isn't valid until`},
+		{"within the tolerance", 5 * time.Minute, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logs.Reset()
+			client, err := NewClient(Config{CACertFile: caFile, ClockSkewTolerance: tc.tolerance})
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := Do(context.Background(), client, Request{URL: ts.URL})
+			if tc.wantErr != "" {
+				var chainErr *ChainError
+				if !errors.As(err, &chainErr) || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got the error %v, want a *ChainError containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("the request failed: %s", err)
+			}
+			res.Body.Close()
+			if got := logs.String(); !strings.HasPrefix(got, "WARNING: accepted the server certificate for 127.0.0.1, which is only valid if the local clock is ") ||
+				!strings.Contains(got, "behind, within the clock skew tolerance of 5m0s") {
+				t.Errorf("got the log %q, want a warning that the certificate was accepted", got)
+			}
+		})
+	}
+
+	// The host name is still verified
+	client, err := NewClient(Config{CACertFile: caFile, ClockSkewTolerance: 5 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The certificate is only for 127.0.0.1
+	url := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	if _, err := Do(context.Background(), client, Request{URL: url}); err == nil || !strings.Contains(err.Error(), "localhost") {
+		t.Errorf("got the error %v for a host the certificate isn't for, want one naming the host", err)
+	}
+	// IP addresses aren't sent as the TLS server name, but are verified too
+	other, otherKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "localhost"}, DNSNames: []string{"localhost"}}, root, rootKey)
+	ts.TLS.Certificates = []tls.Certificate{{Certificate: [][]byte{other.Raw}, PrivateKey: otherKey}}
+	client.CloseIdleConnections()
+	if _, err := Do(context.Background(), client, Request{URL: ts.URL}); err == nil || !strings.Contains(err.Error(), "127.0.0.1") {
+		t.Errorf("got the error %v for an IP address the certificate isn't for, want one naming the address", err)
+	}
+}
+
+func TestNewClientKeyPassphrase(t *testing.T) {
+	cert, key := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "client"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, nil, nil)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Legacy PEM encryption, as 'openssl ec -aes256' produces
+	block, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", der, []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "client.key")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{ClientCertFile: writePEM(t, cert), ClientKeyFile: keyFile, InsecureSkipVerify: true}
+
+	if _, err := NewClient(cfg); err == nil {
+		t.Error("creating a client with an encrypted key and no passphrase succeeded")
+	}
+	cfg.ClientKeyPassphrase = []byte("secret")
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("creating a client with the key's passphrase failed: %s", err)
+	}
+
+	// The decrypted key authenticates the client
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+	res, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if body, _ := ioutil.ReadAll(res.Body); string(body) != "client" {
+		t.Errorf("got %q, want the client certificate's CN", body)
+	}
+}
+
+func TestNewClientHTTP2PriorKnowledge(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	defer ts.Close()
+
+	// No CA is required for cleartext requests
+	client, err := NewClient(Config{HTTP2PriorKnowledge: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if body, _ := ioutil.ReadAll(res.Body); string(body) != "HTTP/2.0" {
+		t.Errorf("got the request sent with %s, want HTTP/2.0", body)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsclient
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/youngkin/gohttps/internal/dump"
+)
+
+// dumpTransport is an http.RoundTripper that writes each request, including
+// those following redirects, and its response to d, see Config.DumpHTTP.
+type dumpTransport struct {
+	*http.Transport
+	d        *dump.Writer
+	requests atomic.Uint64
+}
+
+func (t *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := t.requests.Add(1)
+	var body []byte
+	switch {
+	case req.GetBody != nil:
+		if b, err := req.GetBody(); err == nil {
+			body, _ = t.d.Peek(b)
+			b.Close()
+		}
+	case req.Body != nil && req.Body != http.NoBody:
+		// A RoundTripper mustn't modify the request, so the body is read
+		// through a copy of it
+		req = req.Clone(req.Context())
+		body, req.Body = t.d.Peek(req.Body)
+	}
+	t.d.Request(fmt.Sprintf("request %d to %s", n, req.URL.Host), req, true, body)
+
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, resp.Body = t.d.Peek(resp.Body)
+	t.d.Response(fmt.Sprintf("response %d from %s", n, req.URL.Host), resp, body)
+	return resp, nil
+}
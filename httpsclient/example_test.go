@@ -0,0 +1,119 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsclient_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+// writeCAFile writes the certificate ts is served with, which is self-signed,
+// to a temporary file, so a client can trust it, and returns the file's name.
+func writeCAFile(ts *httptest.Server) string {
+	f, err := os.CreateTemp("", "ca-*.pem")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	return f.Name()
+}
+
+func Example() {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Hello, %s", r.URL.Query().Get("name"))
+	}))
+	defer ts.Close()
+	caFile := writeCAFile(ts)
+	defer os.Remove(caFile)
+
+	client, err := httpsclient.NewClient(httpsclient.Config{CACertFile: caFile})
+	if err != nil {
+		log.Fatal(err)
+	}
+	res, err := httpsclient.Do(context.Background(), client, httpsclient.Request{URL: ts.URL + "/?name=gopher"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(res.Status, res.Proto)
+	fmt.Println(string(body))
+	// Output:
+	// 200 OK HTTP/1.1
+	// Hello, gopher
+}
+
+// Requests made with the same client share its connections, so only the
+// first pays for a TLS handshake.
+func ExampleDo() {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.Path)
+	}))
+	defer ts.Close()
+	caFile := writeCAFile(ts)
+	defer os.Remove(caFile)
+
+	client, err := httpsclient.NewClient(httpsclient.Config{CACertFile: caFile})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, req := range []httpsclient.Request{
+		{URL: ts.URL + "/items"},
+		{Method: http.MethodPost, URL: ts.URL + "/items", Body: []byte(`{"name": "widget"}`), Header: http.Header{"Content-Type": {"application/json"}}},
+	} {
+		res, err := httpsclient.Do(context.Background(), client, req)
+		if err != nil {
+			log.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		fmt.Printf("%s: %q, %s, reused connection: %t, new TLS handshake: %t\n",
+			res.Status, body, res.Header.Get("Content-Type"), res.Reused, res.Handshake != nil)
+	}
+	// Output:
+	// 200 OK: "GET /items", text/plain, reused connection: false, new TLS handshake: true
+	// 200 OK: "POST /items", text/plain, reused connection: true, new TLS handshake: false
+}
+
+// The Result includes the state of the TLS connection the response was
+// received on.
+func ExampleResult() {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	caFile := writeCAFile(ts)
+	defer os.Remove(caFile)
+
+	client, err := httpsclient.NewClient(httpsclient.Config{CACertFile: caFile})
+	if err != nil {
+		log.Fatal(err)
+	}
+	res, err := httpsclient.Do(context.Background(), client, httpsclient.Request{URL: ts.URL})
+	if err != nil {
+		log.Fatal(err)
+	}
+	res.Body.Close()
+	fmt.Println(tls.VersionName(res.TLS.Version))
+	fmt.Println(res.TLS.PeerCertificates[0].Subject.Organization)
+	fmt.Println(res.Handshake.ChainCerts, res.Handshake.Resumed)
+	// Output:
+	// TLS 1.3
+	// [Acme Co]
+	// 1 false
+}
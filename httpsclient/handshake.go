@@ -0,0 +1,225 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http/httptrace"
+	"sync/atomic"
+)
+
+// HandshakeStats describes the cost, in bytes, of the TLS handshake of a new
+// connection.
+type HandshakeStats struct {
+	// BytesRead and BytesWritten are the bytes read and written on the TCP
+	// connection during the handshake, i.e., before any HTTP bytes.
+	BytesRead    int64
+	BytesWritten int64
+	// Resumed is true if the handshake resumed a previous session, in which
+	// case the server doesn't send its certificate chain.
+	Resumed bool
+	// ChainSize is the size, in DER encoded bytes, of the ChainCerts
+	// certificates the server presented. Both are zero if Resumed is true.
+	ChainSize  int
+	ChainCerts int
+	// ClientCertRequested is true if the server requested a client
+	// certificate, and ClientCertSent if one was sent in response. A server
+	// that requests one without requiring it accepts the connection either
+	// way, so a client without one is anonymous without noticing.
+	ClientCertRequested bool
+	ClientCertSent      bool
+}
+
+// ErrClientCertNotSent is the handshake error, with
+// Config.RequireClientCertUse, when the server requests a client certificate
+// but none is sent.
+var ErrClientCertNotSent = errors.New("server requested a client certificate; none was sent")
+
+// Total returns the number of bytes the handshake cost in both directions.
+func (s HandshakeStats) Total() int64 {
+	return s.BytesRead + s.BytesWritten
+}
+
+// Transferred counts the bytes read and written by all of a client's TLS
+// connections, including their handshakes, see Config.Transferred. It's safe
+// for concurrent use.
+type Transferred struct {
+	read, written atomic.Int64
+}
+
+// Read returns the number of bytes read so far.
+func (t *Transferred) Read() int64 {
+	return t.read.Load()
+}
+
+// Written returns the number of bytes written so far.
+func (t *Transferred) Written() int64 {
+	return t.written.Load()
+}
+
+// countingConn counts the bytes read from and written to the connection it
+// wraps, and adds them to total if it isn't nil. Once the TLS handshake on it
+// is done its handshake field is set.
+type countingConn struct {
+	net.Conn
+	read, written atomic.Int64
+	handshake     HandshakeStats
+	total         *Transferred
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Add(int64(n))
+	if c.total != nil {
+		c.total.read.Add(int64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(int64(n))
+	if c.total != nil {
+		c.total.written.Add(int64(n))
+	}
+	return n, err
+}
+
+// dialTLS returns an http.Transport.DialTLSContext function that connects
+// using dial, then performs the TLS handshake with config over a connection
+// that counts its bytes, so Do can report each handshake's HandshakeStats.
+// The handshake is reported to httptrace here, since the Transport only
+// reports its own, instant, check that the returned connection's handshake
+// is done, which tracer ignores since it keeps the first times reported. The
+// connections' bytes are added to total if it isn't nil. If requireCert is
+// true handshakes fail with ErrClientCertNotSent if the server requests a
+// client certificate and none is sent.
+func dialTLS(dial func(ctx context.Context, network, addr string) (net.Conn, error), config *tls.Config, total *Transferred, requireCert bool) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		var dialer net.Dialer
+		dial = dialer.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		raw, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		counted := &countingConn{Conn: raw, total: total}
+		cfg := config.Clone()
+		if cfg.ServerName == "" {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+			cfg.ServerName = host
+		}
+		if verify := cfg.VerifyConnection; verify != nil {
+			// The ConnectionState's ServerName is the name sent in the SNI
+			// extension, which IP addresses aren't, it's set to the name the
+			// server's certificate must be for, e.g., for verifySkewed.
+			serverName := cfg.ServerName
+			cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+				if cs.ServerName == "" {
+					cs.ServerName = serverName
+				}
+				return verify(cs)
+			}
+		}
+		var certReq clientCertRequest
+		cfg.GetClientCertificate = certReq.get(cfg.Certificates, requireCert)
+		conn := tls.Client(counted, cfg)
+
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		err = conn.HandshakeContext(ctx)
+		cs := conn.ConnectionState()
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(cs, err)
+		}
+		if err != nil {
+			raw.Close()
+			return nil, err
+		}
+
+		counted.handshake = HandshakeStats{
+			BytesRead:    counted.read.Load(),
+			BytesWritten: counted.written.Load(),
+			Resumed:      cs.DidResume,
+
+			ClientCertRequested: certReq.requested,
+			ClientCertSent:      certReq.sent,
+		}
+		if !cs.DidResume {
+			for _, cert := range cs.PeerCertificates {
+				counted.handshake.ChainSize += len(cert.Raw)
+			}
+			counted.handshake.ChainCerts = len(cs.PeerCertificates)
+		}
+		return conn, nil
+	}
+}
+
+// clientCertRequest records whether a server requested a client certificate
+// during a handshake, and whether one was sent.
+type clientCertRequest struct {
+	requested, sent bool
+}
+
+// get returns a tls.Config.GetClientCertificate function that records the
+// request and, as crypto/tls does without one, sends the first of certs the
+// server accepts, if any. If requireCert is true and none is sent it returns
+// ErrClientCertNotSent, failing the handshake.
+func (r *clientCertRequest) get(certs []tls.Certificate, requireCert bool) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		r.requested = true
+		for i := range certs {
+			if cri.SupportsCertificate(&certs[i]) == nil {
+				r.sent = true
+				return &certs[i], nil
+			}
+		}
+		if requireCert {
+			return nil, ErrClientCertNotSent
+		}
+		return &tls.Certificate{}, nil
+	}
+}
+
+// ErrConnectionClosed is the error of requests sent by a SingleConnection
+// client once its connection is closed.
+var ErrConnectionClosed = errors.New("the single connection was closed, a new one isn't dialed")
+
+// dialOnce returns an http.Transport.DialTLSContext function that connects
+// using dial the first time it's called, and returns ErrConnectionClosed
+// every time after that.
+func dialOnce(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	var dialed atomic.Bool
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if dialed.Swap(true) {
+			return nil, ErrConnectionClosed
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// connHandshake returns the HandshakeStats of conn, a connection created by
+// dialTLS, or nil if it wasn't.
+func connHandshake(conn net.Conn) *HandshakeStats {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	counted, ok := tlsConn.NetConn().(*countingConn)
+	if !ok {
+		return nil
+	}
+	stats := counted.handshake
+	return &stats
+}
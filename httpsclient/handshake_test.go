@@ -0,0 +1,120 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// writeIdentity writes cert, and its key, to temporary files for
+// Config.ClientCertFile and ClientKeyFile.
+func writeIdentity(t *testing.T, cert *x509.Certificate, key interface{}) (certFile, keyFile string) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile = filepath.Join(t.TempDir(), "client.key")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, cert), keyFile
+}
+
+func TestClientCertRequest(t *testing.T) {
+	root, rootKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Client Root"}, IsCA: true}, nil, nil)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(root)
+	trusted, trustedKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "client"}, DNSNames: []string{"client"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, root, rootKey)
+	trustedCert, trustedKeyFile := writeIdentity(t, trusted, trustedKey)
+	untrusted, untrustedKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}, DNSNames: []string{"stranger"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, nil, nil)
+	untrustedCert, untrustedKeyFile := writeIdentity(t, untrusted, untrustedKey)
+
+	tests := []struct {
+		name       string
+		clientAuth tls.ClientAuthType
+		certFile   string
+		keyFile    string
+		// wantSent is whether a certificate is sent, one is always requested
+		wantSent bool
+	}{
+		// certopt 1 requests any certificate without verifying it
+		{"certopt 1 without an identity", tls.RequestClientCert, "", "", false},
+		{"certopt 1 with an identity", tls.RequestClientCert, untrustedCert, untrustedKeyFile, true},
+		// certopt 3 names the CAs it trusts, so other certificates aren't sent
+		{"certopt 3 without an identity", tls.VerifyClientCertIfGiven, "", "", false},
+		{"certopt 3 with an identity", tls.VerifyClientCertIfGiven, trustedCert, trustedKeyFile, true},
+		{"certopt 3 with an untrusted identity", tls.VerifyClientCertIfGiven, untrustedCert, untrustedKeyFile, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+			// As advserver does, the CAs are only set, and named in the
+			// request, if certificates are verified
+			ts.TLS = &tls.Config{ClientAuth: tc.clientAuth}
+			if tc.clientAuth >= tls.VerifyClientCertIfGiven {
+				ts.TLS.ClientCAs = clientCAs
+			}
+			ts.StartTLS()
+			defer ts.Close()
+
+			for _, require := range []bool{false, true} {
+				client, err := NewClient(Config{
+					InsecureSkipVerify:   true,
+					ClientCertFile:       tc.certFile,
+					ClientKeyFile:        tc.keyFile,
+					RequireClientCertUse: require,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				res, err := Do(context.Background(), client, Request{URL: ts.URL})
+				if require && !tc.wantSent {
+					if !errors.Is(err, ErrClientCertNotSent) {
+						t.Errorf("got the error %v with RequireClientCertUse, want ErrClientCertNotSent", err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("the request failed with RequireClientCertUse %t: %s", require, err)
+				}
+				res.Body.Close()
+				if hs := res.Handshake; hs == nil || !hs.ClientCertRequested || hs.ClientCertSent != tc.wantSent {
+					t.Errorf("got the handshake %+v with RequireClientCertUse %t, want a certificate requested and sent %t", hs, require, tc.wantSent)
+				}
+			}
+		})
+	}
+}
+
+func TestClientCertNotRequested(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	// Without a request there's nothing to require
+	client, err := NewClient(Config{InsecureSkipVerify: true, RequireClientCertUse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Do(context.Background(), client, Request{URL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if hs := res.Handshake; hs == nil || hs.ClientCertRequested || hs.ClientCertSent {
+		t.Errorf("got the handshake %+v, want no certificate requested or sent", hs)
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsclient
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/youngkin/gohttps/internal/redact"
+)
+
+// The HAR types are the subset of the HTTP Archive 1.2 format
+// (http://www.softwareishard.com/blog/har-12-spec/) produced by HARRecorder.
+// Fields prefixed with an underscore are custom fields, as allowed by the spec.
+
+// HAR is the top level object of an HTTP Archive.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog contains the recorded entries.
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator identifies the application that created the archive.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single request and its response.
+type HAREntry struct {
+	StartedDateTime string        `json:"startedDateTime"`
+	Time            float64       `json:"time"`
+	Request         HARRequest    `json:"request"`
+	Response        HARResponse   `json:"response"`
+	Cache           struct{}      `json:"cache"`
+	Timings         HARTimings    `json:"timings"`
+	TLSVersion      string        `json:"_tlsVersion,omitempty"`
+	TLSCipherSuite  string        `json:"_tlsCipherSuite,omitempty"`
+	TLSHandshake    *HARHandshake `json:"_tlsHandshake,omitempty"`
+}
+
+// HARHandshake is the cost, in bytes, of the TLS handshake of a new
+// connection, see HandshakeStats.
+type HARHandshake struct {
+	BytesRead    int64 `json:"bytesRead"`
+	BytesWritten int64 `json:"bytesWritten"`
+	Resumed      bool  `json:"resumed"`
+	ChainSize    int   `json:"chainSize"`
+	ChainCerts   int   `json:"chainCerts"`
+}
+
+// HARRequest describes the request that was sent.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse describes the response that was received.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARNameValue is a header, cookie, or query string parameter.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the body of a request.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARContent is the body of a response.
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are the durations, in milliseconds, of the phases of a request.
+// -1 means the phase doesn't apply, e.g., dns when a connection was reused.
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// HARRecorder accumulates entries for an HTTP Archive. It's safe for
+// concurrent use. The values of sensitive headers are redacted.
+type HARRecorder struct {
+	mu      sync.Mutex
+	maxBody int
+	entries []HAREntry
+}
+
+// NewHARRecorder returns a HARRecorder that records at most maxBody bytes of
+// each request and response body.
+func NewHARRecorder(maxBody int) *HARRecorder {
+	return &HARRecorder{maxBody: maxBody}
+}
+
+// Add records req and its result. body is the response body that was read
+// from res.Body, and receive is how long reading it took.
+func (h *HARRecorder) Add(req Request, res Result, body []byte, receive time.Duration) {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	request := HARRequest{
+		Method:      method,
+		URL:         req.URL,
+		HTTPVersion: res.Proto,
+		Cookies:     []HARNameValue{},
+		Headers:     harHeaders(req.Header),
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(req.Body),
+	}
+	if u, err := url.Parse(req.URL); err == nil {
+		request.QueryString = harValues(u.Query())
+	}
+	if len(req.Body) > 0 {
+		text, comment := h.truncate(req.Body)
+		request.PostData = &HARPostData{
+			MimeType: mimeType(req.Header),
+			Text:     string(text),
+			Comment:  comment,
+		}
+	}
+
+	content := HARContent{Size: len(body), MimeType: mimeType(res.Header)}
+	text, comment := h.truncate(body)
+	content.Comment = comment
+	if utf8.Valid(text) {
+		content.Text = string(text)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(text)
+		content.Encoding = "base64"
+	}
+
+	entry := HAREntry{
+		StartedDateTime: res.Timing.Start.Format(time.RFC3339Nano),
+		Request:         request,
+		Response: HARResponse{
+			Status:      res.StatusCode,
+			StatusText:  http.StatusText(res.StatusCode),
+			HTTPVersion: res.Proto,
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(res.Header),
+			Content:     content,
+			HeadersSize: -1,
+			BodySize:    len(body),
+		},
+		Timings: harTimings(res.Timing, receive),
+	}
+	if res.TLS != nil {
+		entry.TLSVersion = tls.VersionName(res.TLS.Version)
+		entry.TLSCipherSuite = tls.CipherSuiteName(res.TLS.CipherSuite)
+	}
+	if hs := res.Handshake; hs != nil {
+		entry.TLSHandshake = &HARHandshake{
+			BytesRead:    hs.BytesRead,
+			BytesWritten: hs.BytesWritten,
+			Resumed:      hs.Resumed,
+			ChainSize:    hs.ChainSize,
+			ChainCerts:   hs.ChainCerts,
+		}
+	}
+	for _, t := range []float64{entry.Timings.Blocked, entry.Timings.DNS, entry.Timings.Connect, entry.Timings.Send, entry.Timings.Wait, entry.Timings.Receive} {
+		if t > 0 {
+			entry.Time += t
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, entry)
+}
+
+// HAR returns the archive containing the entries recorded so far.
+func (h *HARRecorder) HAR() HAR {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "gohttps client", Version: "1.0"},
+		Entries: append([]HAREntry{}, h.entries...),
+	}}
+}
+
+// WriteFile writes the archive containing the entries recorded so far to path.
+func (h *HARRecorder) WriteFile(path string) error {
+	b, err := json.MarshalIndent(h.HAR(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode HAR: %w", err)
+	}
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("unable to write HAR file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (h *HARRecorder) truncate(b []byte) ([]byte, string) {
+	if len(b) <= h.maxBody {
+		return b, ""
+	}
+	return b[:h.maxBody], fmt.Sprintf("truncated to %d of %d bytes", h.maxBody, len(b))
+}
+
+func harHeaders(h http.Header) []HARNameValue {
+	return harValues(url.Values(redact.Header(h)))
+}
+
+func harValues(values map[string][]string) []HARNameValue {
+	nvs := []HARNameValue{}
+	for name, vals := range values {
+		for _, v := range vals {
+			nvs = append(nvs, HARNameValue{Name: name, Value: v})
+		}
+	}
+	// Map iteration order is random, sort so archives are reproducible
+	sort.Slice(nvs, func(i, j int) bool { return nvs[i].Name < nvs[j].Name })
+	return nvs
+}
+
+func harTimings(t Timing, receive time.Duration) HARTimings {
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	// 'connect' includes the TLS handshake according to the spec
+	timings := HARTimings{
+		Blocked: -1,
+		DNS:     ms(t.DNS),
+		Connect: ms(t.Connect + t.TLSHandshake),
+		SSL:     ms(t.TLSHandshake),
+		Send:    ms(t.Send),
+		Wait:    ms(t.Wait),
+		Receive: ms(receive),
+	}
+	if t.DNS == 0 {
+		timings.DNS = -1
+	}
+	if t.Connect == 0 && t.TLSHandshake == 0 {
+		timings.Connect = -1
+		timings.SSL = -1
+	}
+	return timings
+}
+
+func mimeType(h http.Header) string {
+	if ct := h.Get("Content-Type"); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsclient
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// record sends req to ts and records it, and its response, with h.
+func record(t *testing.T, h *HARRecorder, client *http.Client, req Request) {
+	t.Helper()
+	res, err := Do(context.Background(), client, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	start := time.Now()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Add(req, res, body, time.Since(start))
+}
+
+func TestHARRecorder(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret-session"})
+		if r.URL.Path == "/binary" {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0xff, 0xfe, 0x00})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+	client, err := NewClient(Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHARRecorder(8)
+	record(t, h, client, Request{
+		Method: http.MethodPost,
+		URL:    ts.URL + "/echo?q=1&q=2",
+		Header: http.Header{"Authorization": {"Bearer secret-token"}, "Content-Type": {"text/plain"}},
+		Body:   []byte("0123456789"),
+	})
+	record(t, h, client, Request{URL: ts.URL + "/binary"})
+	path := filepath.Join(t.TempDir(), "requests.har")
+	if err := h.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret") {
+		t.Errorf("the HAR includes a sensitive header's value:\n%s", b)
+	}
+	var har HAR
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&har); err != nil {
+		t.Fatalf("the HAR doesn't decode: %s", err)
+	}
+	if har.Log.Version != "1.2" || har.Log.Creator.Name == "" || len(har.Log.Entries) != 2 {
+		t.Fatalf("got the log %+v, want version 1.2, a creator, and 2 entries", har.Log)
+	}
+
+	post := har.Log.Entries[0]
+	if _, err := time.Parse(time.RFC3339Nano, post.StartedDateTime); err != nil {
+		t.Errorf("got the invalid startedDateTime %q: %s", post.StartedDateTime, err)
+	}
+	if post.Time <= 0 || post.Timings.Connect < 0 || post.Timings.SSL < 0 || post.Timings.Wait < 0 {
+		t.Errorf("got the time %f and timings %+v, want the new connection's", post.Time, post.Timings)
+	}
+	if req := post.Request; req.Method != http.MethodPost || req.HTTPVersion != "HTTP/1.1" || req.BodySize != 10 || len(req.QueryString) != 2 {
+		t.Errorf("got the request %+v, want the POST with its body and query string", req)
+	}
+	if pd := post.Request.PostData; pd == nil || pd.Text != "01234567" || pd.MimeType != "text/plain" || pd.Comment == "" {
+		t.Errorf("got the post data %+v, want the body truncated to 8 bytes", pd)
+	}
+	if res := post.Response; res.Status != 200 || res.StatusText != "OK" || res.Content.Text != "01234567" || res.Content.Size != 10 {
+		t.Errorf("got the response %+v, want the echoed body truncated to 8 bytes", res)
+	}
+	if post.TLSVersion != "TLS 1.3" || post.TLSCipherSuite == "" || post.TLSHandshake == nil || post.TLSHandshake.BytesRead == 0 {
+		t.Errorf("got the TLS version %q, cipher suite %q, and handshake %+v, want those of the new connection", post.TLSVersion, post.TLSCipherSuite, post.TLSHandshake)
+	}
+
+	get := har.Log.Entries[1]
+	if get.Request.Method != http.MethodGet || get.Request.PostData != nil {
+		t.Errorf("got the request %+v, want a GET without post data", get.Request)
+	}
+	if c := get.Response.Content; c.Encoding != "base64" || c.Text != base64.StdEncoding.EncodeToString([]byte{0xff, 0xfe, 0x00}) {
+		t.Errorf("got the content %+v, want the binary body base64 encoded", c)
+	}
+	// The connection was reused, so there's no DNS, connect or TLS time
+	if get.Timings.DNS != -1 || get.Timings.Connect != -1 || get.Timings.SSL != -1 || get.TLSHandshake != nil {
+		t.Errorf("got the timings %+v and handshake %+v for a reused connection, want -1 and none", get.Timings, get.TLSHandshake)
+	}
+}
+
+// TestHARRequiredFields checks the fields the spec requires are present, even
+// when they're empty, which the typed structs can't show.
+func TestHARRequiredFields(t *testing.T) {
+	h := NewHARRecorder(1024)
+	h.Add(Request{URL: "https://example.com/"}, Result{StatusCode: 204, Proto: "HTTP/2.0", Timing: Timing{Start: time.Now()}}, nil, 0)
+	b, err := json.Marshal(h.HAR())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Log struct {
+			Entries []map[string]json.RawMessage `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		t.Fatal(err)
+	}
+	entry := raw.Log.Entries[0]
+	for _, field := range []string{"startedDateTime", "time", "request", "response", "cache", "timings"} {
+		if _, ok := entry[field]; !ok {
+			t.Errorf("the entry is missing the required field %s", field)
+		}
+	}
+	required := map[string][]string{
+		"request":  {"method", "url", "httpVersion", "cookies", "headers", "queryString", "headersSize", "bodySize"},
+		"response": {"status", "statusText", "httpVersion", "cookies", "headers", "content", "redirectURL", "headersSize", "bodySize"},
+		"timings":  {"send", "wait", "receive"},
+	}
+	for object, names := range required {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(entry[object], &fields); err != nil {
+			t.Fatalf("the entry's %s isn't an object: %s", object, err)
+		}
+		for _, name := range names {
+			if v, ok := fields[name]; !ok || string(v) == "null" {
+				t.Errorf("the %s is missing the required field %s", object, name)
+			}
+		}
+	}
+}
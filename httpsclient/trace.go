@@ -0,0 +1,117 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// tracer records the times of the events in a request's lifecycle reported
+// by httptrace. Some callbacks may be called concurrently, e.g., when dialing
+// multiple addresses, so access is serialized.
+type tracer struct {
+	mu sync.Mutex
+
+	dnsStart, dnsDone             time.Time
+	connectStart, connectDone     time.Time
+	tlsStart, tlsDone             time.Time
+	gotConn, wroteRequest, gotTTF time.Time
+	reused                        bool
+	handshake                     *HandshakeStats
+	sentHost                      string
+}
+
+func (t *tracer) withTrace(ctx context.Context) context.Context {
+	set := func(f *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if f.IsZero() {
+			*f = time.Now()
+		}
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { set(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { set(&t.dnsDone) },
+		ConnectStart:         func(string, string) { set(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { set(&t.connectDone) },
+		TLSHandshakeStart:    func() { set(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { set(&t.tlsDone) },
+		GotConn:              t.onGotConn,
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(&t.wroteRequest) },
+		GotFirstResponseByte: func() { set(&t.gotTTF) },
+		WroteHeaderField:     t.onWroteHeaderField,
+	})
+}
+
+func (t *tracer) onGotConn(info httptrace.GotConnInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.gotConn.IsZero() {
+		t.gotConn = time.Now()
+		t.reused = info.Reused
+		if !info.Reused {
+			t.handshake = connHandshake(info.Conn)
+		}
+	}
+}
+
+func (t *tracer) onWroteHeaderField(key string, value []string) {
+	if (key == "Host" || key == ":authority") && len(value) > 0 {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.sentHost = value[0]
+	}
+}
+
+// timing returns the Timing of a request started at start.
+func (t *tracer) timing(start time.Time) Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	since := func(from, to time.Time) time.Duration {
+		if from.IsZero() || to.IsZero() {
+			return 0
+		}
+		return to.Sub(from)
+	}
+	firstByte := t.gotTTF
+	if firstByte.IsZero() {
+		firstByte = time.Now()
+	}
+	return Timing{
+		Start:        start,
+		DNS:          since(t.dnsStart, t.dnsDone),
+		Connect:      since(t.connectStart, t.connectDone),
+		TLSHandshake: since(t.tlsStart, t.tlsDone),
+		Send:         since(t.gotConn, t.wroteRequest),
+		Wait:         since(t.wroteRequest, t.gotTTF),
+		FirstByte:    firstByte.Sub(start),
+	}
+}
+
+// connReused returns whether the request was sent on a reused connection.
+func (t *tracer) connReused() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.reused
+}
+
+// handshakeStats returns the stats of the handshake of the request's
+// connection, or nil if the connection was reused.
+func (t *tracer) handshakeStats() *HandshakeStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.handshake
+}
+
+// host returns the Host header, or :authority, the request was sent with.
+func (t *tracer) host() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sentHost
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultMaxBytes is the default maximum size of the /bytes and /drip responses.
+const DefaultMaxBytes = 100 * 1024 * 1024
+
+// maxDripDuration is the longest a /drip response may take.
+const maxDripDuration = 5 * time.Minute
+
+// dripDeadlineSlack is how long before the request's deadline the last chunk
+// of a /drip response cut short by it is due.
+const dripDeadlineSlack = 100 * time.Millisecond
+
+// bytesHandler serves /bytes/{n}, which responds with n bytes of deterministic
+// data, e.g., for bandwidth testing. The data is a repeating pattern, or, if a
+// seed query parameter is provided, pseudo-random bytes generated from it.
+// Range requests are supported. The data is generated as it's written so
+// large responses don't need large buffers.
+func bytesHandler(maxBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.ParseInt(r.PathValue("n"), 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid size %q, it must be a non-negative number of bytes", r.PathValue("n")), http.StatusBadRequest)
+			return
+		}
+		if n > maxBytes {
+			http.Error(w, fmt.Sprintf("size %d exceeds the maximum of %d bytes", n, maxBytes), http.StatusBadRequest)
+			return
+		}
+		data, err := newDataReader(n, r.URL.Query().Get("seed"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, "", time.Time{}, data)
+	}
+}
+
+// dripHandler serves /drip, which writes the number of bytes given by the
+// bytes query parameter, default 10, evenly over the duration given by the
+// duration query parameter, default 2s, e.g., for testing client timeouts
+// and progress reporting. If the request's deadline would pass first, only
+// the bytes due before it are sent, with a PartialResultHeader.
+func dripHandler(maxBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		n := int64(10)
+		if v := q.Get("bytes"); v != "" {
+			var err error
+			n, err = strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 || n > maxBytes {
+				http.Error(w, fmt.Sprintf("invalid bytes %q, it must be between 0 and %d", v, maxBytes), http.StatusBadRequest)
+				return
+			}
+		}
+		duration := 2 * time.Second
+		if v := q.Get("duration"); v != "" {
+			var err error
+			duration, err = time.ParseDuration(v)
+			if err != nil || duration < 0 || duration > maxDripDuration {
+				http.Error(w, fmt.Sprintf("invalid duration %q, it must be between 0s and %s", v, maxDripDuration), http.StatusBadRequest)
+				return
+			}
+		}
+		data, err := newDataReader(n, q.Get("seed"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Write in at most 100 chunks, one per interval, flushing each so the
+		// client sees the data arrive gradually.
+		chunks := n
+		if chunks > 100 {
+			chunks = 100
+		}
+		var interval time.Duration
+		if chunks > 0 {
+			interval = duration / time.Duration(chunks)
+		}
+		rc := http.NewResponseController(w)
+		// The server's write timeout would otherwise cut off long drips
+		rc.SetWriteDeadline(time.Now().Add(duration + 10*time.Second))
+
+		// If the request's deadline passes before the drip would end, only the
+		// chunks due before it are sent, as a complete, shorter, response.
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if remaining, ok := RemainingTime(r); ok && chunks > 0 && remaining < time.Duration(chunks)*interval+dripDeadlineSlack {
+			due := max(int64((remaining-dripDeadlineSlack)/max(interval, time.Millisecond)), 0)
+			partial := n * due / chunks
+			w.Header().Set(PartialResultHeader, fmt.Sprintf("deadline, %d of %d bytes", partial, n))
+			n, chunks = partial, due
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+		w.WriteHeader(http.StatusOK)
+		rc.Flush()
+		ticker := time.NewTicker(max(interval, time.Millisecond))
+		defer ticker.Stop()
+		for i := int64(0); i < chunks; i++ {
+			select {
+			case <-ticker.C:
+			case <-r.Context().Done():
+				return
+			}
+			// Spread any remainder over the first chunks
+			size := n / chunks
+			if i < n%chunks {
+				size++
+			}
+			if _, err := io.CopyN(w, data, size); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+	}
+}
+
+// dataReader is an io.ReadSeeker over size bytes of generated data. Any
+// offset can be generated directly so seeking, e.g., for range requests,
+// is cheap.
+type dataReader struct {
+	size   int64
+	off    int64
+	seeded bool
+	seed   uint64
+}
+
+const pattern = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ\n"
+
+func newDataReader(size int64, seed string) (*dataReader, error) {
+	d := &dataReader{size: size}
+	if seed != "" {
+		s, err := strconv.ParseUint(seed, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid seed %q, it must be a non-negative number", seed)
+		}
+		d.seeded, d.seed = true, s
+	}
+	return d, nil
+}
+
+func (d *dataReader) Read(p []byte) (int, error) {
+	if d.off >= d.size {
+		return 0, io.EOF
+	}
+	if remaining := d.size - d.off; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	if !d.seeded {
+		for i := range p {
+			p[i] = pattern[(d.off+int64(i))%int64(len(pattern))]
+		}
+		d.off += int64(len(p))
+		return len(p), nil
+	}
+
+	// Seeded data is SHA-256 in counter mode, block i of the data is the
+	// hash of the seed and i
+	var in [16]byte
+	binary.BigEndian.PutUint64(in[:8], d.seed)
+	n := 0
+	for n < len(p) {
+		block, within := d.off/sha256.Size, d.off%sha256.Size
+		binary.BigEndian.PutUint64(in[8:], uint64(block))
+		sum := sha256.Sum256(in[:])
+		c := copy(p[n:], sum[within:])
+		n += c
+		d.off += int64(c)
+	}
+	return n, nil
+}
+
+func (d *dataReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.off
+	case io.SeekEnd:
+		offset += d.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	d.off = offset
+	return offset, nil
+}
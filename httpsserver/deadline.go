@@ -0,0 +1,28 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"net/http"
+	"time"
+)
+
+// PartialResultHeader is the header, or trailer, of the responses that are
+// ended early, complete but with less than was asked for, because the
+// request's deadline would otherwise pass while they're written.
+const PartialResultHeader = "X-Partial-Result"
+
+// RemainingTime returns how long the handler of r has left before r's
+// deadline, e.g., set by advserver's -handler-timeout or derived from the
+// server's write timeout, passes, and false if r doesn't have a deadline.
+// Handlers that write for a long time, e.g., streams, can use it to end
+// their response cleanly instead of being cut off mid-write.
+func RemainingTime(r *http.Request) (time.Duration, bool) {
+	deadline, ok := r.Context().Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
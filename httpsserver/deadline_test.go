@@ -0,0 +1,74 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/middleware"
+)
+
+func TestRemainingTime(t *testing.T) {
+	var remaining time.Duration
+	var ok bool
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remaining, ok = RemainingTime(r)
+	})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if ok {
+		t.Errorf("got %s remaining without a deadline, want none", remaining)
+	}
+	middleware.Deadline(2*time.Second, h).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !ok || remaining <= time.Second || remaining > 2*time.Second {
+		t.Errorf("got %s, %v remaining with a 2s deadline, want just under 2s", remaining, ok)
+	}
+}
+
+func TestDripDeadline(t *testing.T) {
+	// The drip takes a second, longer than the deadline
+	tests := []struct {
+		name       string
+		propagated bool
+	}{
+		{"without the deadline", false},
+		{"with the deadline", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var h http.Handler = dripHandler(DefaultMaxBytes)
+			if tc.propagated {
+				h = middleware.Deadline(400*time.Millisecond, h)
+			}
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+			resp, err := http.Get(ts.URL + "/drip?bytes=10&duration=1s")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			// The response is complete, its body matches its Content-Length
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("reading the body failed: %s", err)
+			}
+			if int64(len(body)) != resp.ContentLength {
+				t.Errorf("got %d bytes with a Content-Length of %d", len(body), resp.ContentLength)
+			}
+			// Only the bytes due before the deadline are sent
+			partial := resp.Header.Get(PartialResultHeader)
+			if tc.propagated && (partial == "" || len(body) == 0 || len(body) >= 10) {
+				t.Errorf("got %d bytes and %s %q, want some of the 10 bytes and the header", len(body), PartialResultHeader, partial)
+			}
+			if !tc.propagated && (partial != "" || len(body) != 10) {
+				t.Errorf("got %d bytes and %s %q, want all 10 bytes and no header", len(body), PartialResultHeader, partial)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// DefaultMaxDelay is the default maximum delay of a /delay response.
+const DefaultMaxDelay = time.Minute
+
+// delayHandler serves /delay and /delay/{d}, which respond after the delay
+// given by the path or the d query parameter, e.g., /delay/3s or
+// /delay?d=3s, plus, if a jitter query parameter is given, a random delay of
+// up to that much more, e.g., for testing client timeouts and retries. The
+// total delay is at most maxDelay. If the client goes away, or the request is
+// otherwise canceled, while waiting no response is written.
+func delayHandler(maxDelay time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		v := r.PathValue("d")
+		if v == "" {
+			v = q.Get("d")
+		}
+		if v == "" {
+			http.Error(w, "missing delay, e.g., /delay/3s or /delay?d=3s", http.StatusBadRequest)
+			return
+		}
+		delay, err := time.ParseDuration(v)
+		if err != nil || delay < 0 || delay > maxDelay {
+			http.Error(w, fmt.Sprintf("invalid delay %q, it must be between 0s and %s", v, maxDelay), http.StatusBadRequest)
+			return
+		}
+		if v := q.Get("jitter"); v != "" {
+			jitter, err := time.ParseDuration(v)
+			if err != nil || jitter < 0 || delay+jitter > maxDelay {
+				http.Error(w, fmt.Sprintf("invalid jitter %q, it must be at least 0s and, with the delay, at most %s", v, maxDelay), http.StatusBadRequest)
+				return
+			}
+			if jitter > 0 {
+				delay += rand.N(jitter + 1)
+			}
+		}
+
+		// The server's write timeout would otherwise cut off long delays
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(delay + 10*time.Second))
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Delay", delay.String())
+		fmt.Fprintf(w, "Delayed %s\n", delay)
+	}
+}
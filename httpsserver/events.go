@@ -0,0 +1,74 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/srv"
+)
+
+const (
+	defaultEventInterval = time.Second
+	minEventInterval     = 10 * time.Millisecond
+	maxEventInterval     = time.Minute
+)
+
+// eventsHandler serves /events, a Server-Sent Events stream with an event
+// every ?interval, default 1s. The stream lasts until the client disconnects
+// or longLived signals the server is shutting down, which ends it, with a
+// shutdown event, so it doesn't hold up the server's shutdown.
+func eventsHandler(longLived *srv.LongLived) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		interval := defaultEventInterval
+		if v := r.URL.Query().Get("interval"); v != "" {
+			var err error
+			interval, err = time.ParseDuration(v)
+			if err != nil || interval < minEventInterval || interval > maxEventInterval {
+				http.Error(w, fmt.Sprintf("invalid interval %q, it must be between %s and %s", v, minEventInterval, maxEventInterval), http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx, done := longLived.Register(r.Context(), nil)
+		defer done()
+		rc := http.NewResponseController(w)
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		if r.ProtoMajor == 1 {
+			// Connection is a hop-by-hop header that HTTP/2 doesn't allow
+			h.Set("Connection", "keep-alive")
+		}
+		w.WriteHeader(http.StatusOK)
+		rc.Flush()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for id := 1; ; id++ {
+			select {
+			case now := <-ticker.C:
+				// The server's write timeout is meant for individual responses,
+				// extend it for each event instead.
+				rc.SetWriteDeadline(now.Add(interval + 10*time.Second))
+				_, err := fmt.Fprintf(w, "id: %d\nevent: tick\ndata: {\"seq\":%d,\"time\":%q}\n\n", id, id, now.UTC().Format(time.RFC3339Nano))
+				if err != nil {
+					return
+				}
+				rc.Flush()
+			case <-ctx.Done():
+				if context.Cause(ctx) == srv.ErrShuttingDown {
+					rc.SetWriteDeadline(time.Now().Add(10 * time.Second))
+					fmt.Fprintf(w, "event: shutdown\ndata: server shutting down\n\n")
+					rc.Flush()
+				}
+				return
+			}
+		}
+	}
+}
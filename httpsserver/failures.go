@@ -0,0 +1,186 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// maxPendingHellos bounds the ClientHellos kept for handshakes that haven't
+// completed yet, and pendingHelloTTL is how long they're kept, so clients
+// that never finish their handshakes can't grow them without bound.
+const (
+	maxPendingHellos = 4096
+	pendingHelloTTL  = time.Minute
+)
+
+// HandshakeFailure describes a failed TLS handshake. The ClientHello fields
+// are empty if the handshake failed before the client sent one, e.g., because
+// the client doesn't speak TLS.
+type HandshakeFailure struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	// ServerName is the SNI the client sent.
+	ServerName string `json:"server_name,omitempty"`
+	// Versions are the TLS versions the client offered, e.g., TLS 1.3.
+	Versions []string `json:"versions,omitempty"`
+	// ALPN are the application protocols the client offered, e.g., h2.
+	ALPN []string `json:"alpn,omitempty"`
+	// Reason is the error crypto/tls, or net/http, reported, as it's logged.
+	Reason string `json:"reason"`
+}
+
+// HandshakeFailures records the most recent TLS handshake failures, with
+// what the client offered in its ClientHello, captured by Wrap, and the
+// reason net/http logs, captured by Writer, so they can be inspected with a
+// single request, see Report, rather than by searching the logs. It's safe
+// for concurrent use.
+type HandshakeFailures struct {
+	mu sync.Mutex
+	// failures is a ring buffer, next is where the next failure goes.
+	failures []HandshakeFailure
+	next     int
+	total    uint64
+	// pending are the ClientHellos of the handshakes in progress, by remote
+	// address, removed once the handshake is verified.
+	pending map[string]pendingHello
+}
+
+type pendingHello struct {
+	received time.Time
+	failure  HandshakeFailure
+}
+
+// NewHandshakeFailures returns a HandshakeFailures that keeps the last size
+// failures.
+func NewHandshakeFailures(size int) *HandshakeFailures {
+	return &HandshakeFailures{failures: make([]HandshakeFailure, 0, size), pending: map[string]pendingHello{}}
+}
+
+// Wrap returns a tls.Config.GetConfigForClient function that records the
+// ClientHello of each handshake, returning the configs created by getConfig,
+// which must not be nil, modified to forget it once the handshake succeeds.
+func (f *HandshakeFailures) Wrap(getConfig func(*tls.ClientHelloInfo) (*tls.Config, error)) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		remoteAddr := hello.Conn.RemoteAddr().String()
+		failure := HandshakeFailure{RemoteAddr: remoteAddr, ServerName: hello.ServerName, ALPN: hello.SupportedProtos}
+		for _, v := range hello.SupportedVersions {
+			failure.Versions = append(failure.Versions, tls.VersionName(v))
+		}
+		f.addPending(remoteAddr, failure)
+
+		cfg, err := getConfig(hello)
+		if err != nil || cfg == nil {
+			return cfg, err
+		}
+		cfg = cfg.Clone()
+		verify := cfg.VerifyConnection
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(cs); err != nil {
+					return err
+				}
+			}
+			f.mu.Lock()
+			delete(f.pending, remoteAddr)
+			f.mu.Unlock()
+			return nil
+		}
+		return cfg, nil
+	}
+}
+
+func (f *HandshakeFailures) addPending(remoteAddr string, failure HandshakeFailure) {
+	now := time.Now()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.pending) >= maxPendingHellos {
+		for addr, p := range f.pending {
+			if now.Sub(p.received) > pendingHelloTTL {
+				delete(f.pending, addr)
+			}
+		}
+		if len(f.pending) >= maxPendingHellos {
+			return
+		}
+	}
+	f.pending[remoteAddr] = pendingHello{received: now, failure: failure}
+}
+
+// record adds a failure of the handshake from remoteAddr for reason.
+func (f *HandshakeFailures) record(remoteAddr, reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	failure := HandshakeFailure{RemoteAddr: remoteAddr}
+	if p, ok := f.pending[remoteAddr]; ok {
+		failure = p.failure
+		delete(f.pending, remoteAddr)
+	}
+	failure.Time = time.Now()
+	failure.Reason = reason
+	f.total++
+	if len(f.failures) < cap(f.failures) {
+		f.failures = append(f.failures, failure)
+		return
+	}
+	if cap(f.failures) == 0 {
+		return
+	}
+	f.failures[f.next] = failure
+	f.next = (f.next + 1) % len(f.failures)
+}
+
+// Failures returns the recorded failures, the most recent first, and the
+// total number of failures since the server started.
+func (f *HandshakeFailures) Failures() ([]HandshakeFailure, uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	failures := make([]HandshakeFailure, 0, len(f.failures))
+	for i := len(f.failures) - 1; i >= 0; i-- {
+		failures = append(failures, f.failures[(f.next+i)%len(f.failures)])
+	}
+	return failures, f.total
+}
+
+var tlsHandshakeErr = regexp.MustCompile(`TLS handshake error from (\S+): (.*)$`)
+
+// Writer returns an io.Writer, for use as the output of http.Server.ErrorLog,
+// that writes to out as usual, and records each TLS handshake error logged.
+func (f *HandshakeFailures) Writer(out io.Writer) io.Writer {
+	return &failureLogWriter{failures: f, out: out}
+}
+
+type failureLogWriter struct {
+	failures *HandshakeFailures
+	out      io.Writer
+}
+
+func (w *failureLogWriter) Write(p []byte) (int, error) {
+	if m := tlsHandshakeErr.FindSubmatch(bytes.TrimSpace(p)); m != nil {
+		w.failures.record(string(m[1]), string(m[2]))
+	}
+	return w.out.Write(p)
+}
+
+// HandshakeFailuresReport is a snapshot of a HandshakeFailures, see Report.
+type HandshakeFailuresReport struct {
+	// Capacity is the number of failures kept.
+	Capacity int    `json:"capacity"`
+	Total    uint64 `json:"total"`
+	// Failures are the recorded failures, the most recent first.
+	Failures []HandshakeFailure `json:"failures"`
+}
+
+// Report returns the recorded failures, and the total number of failures
+// since the server started, e.g., to be served as JSON.
+func (f *HandshakeFailures) Report() HandshakeFailuresReport {
+	failures, total := f.Failures()
+	return HandshakeFailuresReport{Capacity: cap(f.failures), Total: total, Failures: failures}
+}
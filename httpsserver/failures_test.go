@@ -0,0 +1,221 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFailuresServer returns a TLS 1.3 only server that requires a client
+// certificate, trusting only trusted, and only speaks http/1.1, with its
+// handshake failures recorded by failures.
+func newFailuresServer(t *testing.T, failures *HandshakeFailures, trusted tls.Certificate) *httptest.Server {
+	t.Helper()
+	leaf, err := x509.ParseCertificate(trusted.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(leaf)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ErrorLog = log.New(failures.Writer(io.Discard), "", 0)
+	var cfg *tls.Config
+	ts.TLS = &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		NextProtos: []string{"http/1.1"},
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		GetConfigForClient: failures.Wrap(func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return cfg, nil
+		}),
+	}
+	ts.StartTLS()
+	cfg = ts.TLS.Clone()
+	cfg.GetConfigForClient = nil
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// handshake performs a handshake with ts using cfg, reading from the
+// connection so rejections the client only learns of afterwards, e.g., of its
+// certificate, are received, then waits for the server to record a failure
+// beyond the want already recorded.
+func handshake(t *testing.T, ts *httptest.Server, failures *HandshakeFailures, cfg *tls.Config, want uint64) {
+	t.Helper()
+	conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), cfg)
+	if err == nil {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, total := failures.Failures(); total > want {
+			return
+		}
+	}
+	t.Fatalf("handshake failure %d wasn't recorded", want+1)
+}
+
+// selfSignedCert returns a self-signed client certificate with its key.
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestHandshakeFailures(t *testing.T) {
+	// The ring keeps 2 of the 3 failures, so the first is overwritten
+	failures := NewHandshakeFailures(2)
+	ts := newFailuresServer(t, failures, selfSignedCert(t))
+
+	handshake(t, ts, failures, &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12}, 0)
+	first, _ := failures.Failures()
+	if len(first) != 1 {
+		t.Fatalf("got %d failures after the wrong version handshake, want 1", len(first))
+	}
+	wrongVersion := first[0]
+
+	handshake(t, ts, failures, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"spdy/3"}}, 1)
+	handshake(t, ts, failures, &tls.Config{InsecureSkipVerify: true, ServerName: "api.example.com", Certificates: []tls.Certificate{selfSignedCert(t)}}, 2)
+
+	got, total := failures.Failures()
+	if total != 3 {
+		t.Errorf("got a total of %d failures, want 3", total)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d failures, want the ring's capacity, 2: %+v", len(got), got)
+	}
+	badCert, noALPN := got[0], got[1]
+
+	if !strings.Contains(wrongVersion.Reason, "unsupported versions") {
+		t.Errorf("got the reason %q for the wrong version, want unsupported versions", wrongVersion.Reason)
+	}
+	if offered := strings.Join(wrongVersion.Versions, ","); !strings.HasPrefix(offered, "TLS 1.2") {
+		t.Errorf("got the offered versions %v for the wrong version, want TLS 1.2 and no later versions", wrongVersion.Versions)
+	}
+
+	if !strings.Contains(noALPN.Reason, "application protocol") {
+		t.Errorf("got the reason %q for the unsupported ALPN protocol, want one about application protocols", noALPN.Reason)
+	}
+	if len(noALPN.ALPN) != 1 || noALPN.ALPN[0] != "spdy/3" {
+		t.Errorf("got the offered ALPN protocols %v, want [spdy/3]", noALPN.ALPN)
+	}
+	if len(noALPN.Versions) == 0 || noALPN.Versions[0] != "TLS 1.3" {
+		t.Errorf("got the offered versions %v, want TLS 1.3 first", noALPN.Versions)
+	}
+
+	if !strings.Contains(badCert.Reason, "certificate") {
+		t.Errorf("got the reason %q for the untrusted client certificate, want a certificate error", badCert.Reason)
+	}
+	if badCert.ServerName != "api.example.com" {
+		t.Errorf("got the SNI %q for the untrusted client certificate, want api.example.com", badCert.ServerName)
+	}
+
+	for _, f := range append(got, wrongVersion) {
+		if f.RemoteAddr == "" || f.Time.IsZero() {
+			t.Errorf("got a failure without a remote address or time: %+v", f)
+		}
+	}
+	if !badCert.Time.After(noALPN.Time) && !badCert.Time.Equal(noALPN.Time) {
+		t.Errorf("got the failures out of order, %s before %s", badCert.Time, noALPN.Time)
+	}
+
+	report := failures.Report()
+	if report.Capacity != 2 || report.Total != 3 || len(report.Failures) != 2 {
+		t.Errorf("got the report %+v, want a capacity of 2, a total of 3, and 2 failures", report)
+	}
+}
+
+func TestHandshakeFailuresSuccessIsNotRecorded(t *testing.T) {
+	failures := NewHandshakeFailures(2)
+	trusted := selfSignedCert(t)
+	ts := newFailuresServer(t, failures, trusted)
+
+	conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{trusted}})
+	if err != nil {
+		t.Fatalf("the handshake with a trusted certificate failed: %s", err)
+	}
+	// A request makes sure the server has finished its side of the handshake
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("no response over the trusted connection: %s", err)
+	}
+	conn.Close()
+
+	// The failure is recorded with its own ClientHello, not the successful
+	// handshake's
+	handshake(t, ts, failures, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"spdy/3"}}, 0)
+	if got, total := failures.Failures(); total != 1 || len(got[0].ALPN) != 1 || got[0].ALPN[0] != "spdy/3" {
+		t.Errorf("got %d failures, %+v, want only the failed handshake", total, got)
+	}
+	failures.mu.Lock()
+	pending := len(failures.pending)
+	failures.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("got %d pending ClientHellos after the handshakes finished, want 0", pending)
+	}
+}
+
+func TestHandshakeFailuresWraparound(t *testing.T) {
+	failures := NewHandshakeFailures(3)
+	w := failures.Writer(io.Discard)
+	for i := 1; i <= 7; i++ {
+		fmt.Fprintf(w, "http: TLS handshake error from 192.0.2.1:%d: failure %d\n", i, i)
+	}
+	// Other errors aren't handshake failures
+	fmt.Fprintf(w, "http: response.WriteHeader on hijacked connection\n")
+
+	got, total := failures.Failures()
+	if total != 7 {
+		t.Errorf("got a total of %d failures, want 7", total)
+	}
+	var reasons []string
+	for _, f := range got {
+		reasons = append(reasons, f.Reason)
+	}
+	if want := "failure 7,failure 6,failure 5"; strings.Join(reasons, ",") != want {
+		t.Errorf("got the failures %q, want %q, the most recent first", strings.Join(reasons, ","), want)
+	}
+	if got[0].RemoteAddr != "192.0.2.1:7" {
+		t.Errorf("got the remote address %s, want 192.0.2.1:7", got[0].RemoteAddr)
+	}
+}
+
+func TestHandshakeFailuresDisabled(t *testing.T) {
+	failures := NewHandshakeFailures(0)
+	fmt.Fprintf(failures.Writer(io.Discard), "http: TLS handshake error from 192.0.2.1:1: EOF\n")
+	if got, total := failures.Failures(); len(got) != 0 || total != 1 {
+		t.Errorf("got %d failures and a total of %d, want none kept and a total of 1", len(got), total)
+	}
+}
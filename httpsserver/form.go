@@ -0,0 +1,144 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// DefaultMaxMultipartMemory is the default maximum size of the non-file
+// fields of a /form request, which, unlike files, are kept in memory.
+const DefaultMaxMultipartMemory = 32 << 20
+
+// formSummary is the /form response.
+type formSummary struct {
+	Fields []formField `json:"fields"`
+	Files  []formFile  `json:"files"`
+}
+
+type formField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Size  int    `json:"size"`
+}
+
+type formFile struct {
+	Field    string `json:"field"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	// ContentType is detected from the file's content, DeclaredType is the
+	// part's Content-Type header, if any.
+	ContentType  string `json:"content_type"`
+	DeclaredType string `json:"declared_content_type,omitempty"`
+	SHA256       string `json:"sha256"`
+}
+
+// sniffer keeps the first bytes written to it, as many as
+// http.DetectContentType considers.
+type sniffer struct {
+	buf []byte
+}
+
+func (s *sniffer) Write(p []byte) (int, error) {
+	if n := 512 - len(s.buf); n > 0 {
+		s.buf = append(s.buf, p[:min(n, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// formHandler serves /form, which parses a multipart/form-data POST or PUT
+// request, responding with a JSON summary of its fields and files: each
+// file's size, detected content type, and SHA-256. Files are streamed
+// through the hash rather than buffered, so their size is only limited by
+// maxBytes, the maximum size of the whole request. The fields are kept in
+// memory, up to maxMemory bytes in total. Requests exceeding either limit
+// get a 413.
+func formHandler(maxBytes, maxMemory int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			w.Header().Set("Allow", "POST, PUT")
+			http.Error(w, "method not allowed, /form requires POST or PUT", http.StatusMethodNotAllowed)
+			return
+		}
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "multipart/form-data" {
+			http.Error(w, "unsupported content type, /form requires multipart/form-data", http.StatusUnsupportedMediaType)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid multipart form: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		summary := formSummary{Fields: []formField{}, Files: []formFile{}}
+		memory := maxMemory
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				formError(w, err, maxBytes)
+				return
+			}
+			if part.FileName() == "" {
+				var value bytes.Buffer
+				n, err := io.CopyN(&value, part, memory+1)
+				if err != nil && err != io.EOF {
+					formError(w, err, maxBytes)
+					return
+				}
+				if n > memory {
+					http.Error(w, fmt.Sprintf("the form's fields exceed the maximum of %d bytes", maxMemory), http.StatusRequestEntityTooLarge)
+					return
+				}
+				memory -= n
+				summary.Fields = append(summary.Fields, formField{Name: part.FormName(), Value: value.String(), Size: value.Len()})
+				continue
+			}
+
+			hash := sha256.New()
+			var sniff sniffer
+			n, err := io.Copy(io.MultiWriter(hash, &sniff), part)
+			if err != nil {
+				formError(w, err, maxBytes)
+				return
+			}
+			summary.Files = append(summary.Files, formFile{
+				Field:        part.FormName(),
+				Filename:     part.FileName(),
+				Size:         n,
+				ContentType:  http.DetectContentType(sniff.buf),
+				DeclaredType: part.Header.Get("Content-Type"),
+				SHA256:       hex.EncodeToString(hash.Sum(nil)),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(summary)
+	}
+}
+
+// formError responds with a 413 if err is because the request exceeded
+// maxBytes, or a 400 otherwise.
+func formError(w http.ResponseWriter, err error, maxBytes int64) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("the form exceeds the maximum of %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, fmt.Sprintf("invalid multipart form: %s", err), http.StatusBadRequest)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// formPart is a field, or a file if filename is set, of a multipart form.
+type formPart struct {
+	name, filename, contentType, content string
+}
+
+// multipartBody returns a multipart/form-data body of parts, and its
+// Content-Type.
+func multipartBody(t *testing.T, parts ...formPart) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, p := range parts {
+		h := textproto.MIMEHeader{}
+		if p.filename == "" {
+			h.Set("Content-Disposition", `form-data; name="`+p.name+`"`)
+		} else {
+			h.Set("Content-Disposition", `form-data; name="`+p.name+`"; filename="`+p.filename+`"`)
+		}
+		if p.contentType != "" {
+			h.Set("Content-Type", p.contentType)
+		}
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(p.content))
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &body, mw.FormDataContentType()
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFormSummary(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 100)
+	body, contentType := multipartBody(t,
+		formPart{name: "name", content: "gopher"},
+		formPart{name: "empty"},
+		formPart{name: "image", filename: "gopher.png", contentType: "application/octet-stream", content: png},
+		formPart{name: "notes", filename: "notes.txt", content: "hello\n"},
+	)
+	r := httptest.NewRequest(http.MethodPost, "/form", body)
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	formHandler(DefaultMaxBytes, DefaultMaxMultipartMemory)(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got the status %d %q, want 200", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got the content type %q, want application/json", ct)
+	}
+	var got formSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("the response %q isn't a JSON summary: %s", w.Body, err)
+	}
+	want := formSummary{
+		Fields: []formField{{Name: "name", Value: "gopher", Size: 6}, {Name: "empty", Value: "", Size: 0}},
+		Files: []formFile{
+			// The content type is detected, not the declared one
+			{Field: "image", Filename: "gopher.png", Size: int64(len(png)), ContentType: "image/png", DeclaredType: "application/octet-stream", SHA256: sha256Hex(png)},
+			{Field: "notes", Filename: "notes.txt", Size: 6, ContentType: "text/plain; charset=utf-8", SHA256: sha256Hex("hello\n")},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got the summary %+v, want %+v", got, want)
+	}
+}
+
+func TestFormRejected(t *testing.T) {
+	large, largeType := multipartBody(t, formPart{name: "file", filename: "large.bin", content: strings.Repeat("x", 4096)})
+	fields, fieldsType := multipartBody(t, formPart{name: "a", content: strings.Repeat("a", 60)}, formPart{name: "b", content: strings.Repeat("b", 60)})
+	tests := []struct {
+		name        string
+		method      string
+		body        *bytes.Buffer
+		contentType string
+		wantStatus  int
+		wantBody    string
+	}{
+		{"request too large", http.MethodPost, large, largeType, http.StatusRequestEntityTooLarge, "the form exceeds the maximum of 1024 bytes"},
+		// Each field fits, but not both
+		{"fields too large", http.MethodPost, fields, fieldsType, http.StatusRequestEntityTooLarge, "the form's fields exceed the maximum of 100 bytes"},
+		{"not multipart", http.MethodPost, bytes.NewBufferString(`{"name": "gopher"}`), "application/json", http.StatusUnsupportedMediaType, "/form requires multipart/form-data"},
+		{"no content type", http.MethodPost, bytes.NewBufferString("name=gopher"), "", http.StatusUnsupportedMediaType, "/form requires multipart/form-data"},
+		{"no boundary", http.MethodPost, bytes.NewBufferString("name=gopher"), "multipart/form-data", http.StatusBadRequest, "invalid multipart form"},
+		{"GET", http.MethodGet, &bytes.Buffer{}, "", http.StatusMethodNotAllowed, "/form requires POST or PUT"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/form", tc.body)
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			formHandler(1024, 100)(w, r)
+			if w.Code != tc.wantStatus || !strings.Contains(w.Body.String(), tc.wantBody) {
+				t.Errorf("got %d %q, want %d and a body containing %q", w.Code, w.Body, tc.wantStatus, tc.wantBody)
+			}
+		})
+	}
+}
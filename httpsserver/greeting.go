@@ -0,0 +1,84 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"text/template"
+
+	"github.com/youngkin/gohttps/internal/bufpool"
+)
+
+// GreetingData is the data a greeting template, see ParseGreeting, is
+// executed with.
+type GreetingData struct {
+	// Body is the request body.
+	Body string
+	// Hostname is the host name of the machine the server is running on.
+	Hostname string
+	// InstanceID identifies the server, e.g., among the instances behind a
+	// load balancer.
+	InstanceID string
+	// Port is the port the server listens on.
+	Port string
+	// TLSVersion is the negotiated TLS version, e.g., TLS 1.3, "" without TLS.
+	TLSVersion string
+	// ClientCN is the Common Name, or another name, see clientName, of the
+	// client's verified certificate, "" if the client didn't present one or
+	// it wasn't verified.
+	ClientCN string
+}
+
+// ParseGreeting parses text as a text/template for the greeting of the /
+// route, e.g.,
+//
+//	Hello{{if .ClientCN}} {{.ClientCN}}{{end}} from {{.InstanceID}}!
+//
+// The template is also executed with empty GreetingData, so references to
+// fields that don't exist fail now rather than on every request.
+func ParseGreeting(text string) (*template.Template, error) {
+	t, err := template.New("greeting").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid greeting template: %w", err)
+	}
+	if err := t.Execute(ioutil.Discard, GreetingData{}); err != nil {
+		return nil, fmt.Errorf("invalid greeting template: %w", err)
+	}
+	return t, nil
+}
+
+// greetingHandler serves / by executing t with the request's GreetingData.
+func greetingHandler(t *template.Template, instanceID, port string) http.HandlerFunc {
+	hostname, _ := os.Hostname()
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := bufpool.Get()
+		defer bufpool.Put(body)
+		if _, err := body.ReadFrom(r.Body); err != nil {
+			http.Error(w, fmt.Sprintf("error reading request body: %s", err), http.StatusBadRequest)
+			return
+		}
+		data := GreetingData{
+			Body:       body.String(),
+			Hostname:   hostname,
+			InstanceID: instanceID,
+			Port:       port,
+			ClientCN:   clientName(r),
+		}
+		if r.TLS != nil {
+			data.TLSVersion = tls.VersionName(r.TLS.Version)
+		}
+		buf := bufpool.Get()
+		defer bufpool.Put(buf)
+		if err := t.Execute(buf, data); err != nil {
+			http.Error(w, fmt.Sprintf("error rendering the greeting: %s", err), http.StatusInternalServerError)
+			return
+		}
+		w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseGreeting(t *testing.T) {
+	tests := []struct {
+		text    string
+		wantErr string
+	}{
+		{text: "Hello{{if .ClientCN}} {{.ClientCN}}{{end}} from {{.InstanceID}}!"},
+		{text: "Hello {{.Body", wantErr: "invalid greeting template"},
+		// Unknown fields fail when the template is parsed, not on each request
+		{text: "Hello {{.Name}}", wantErr: "can't evaluate field Name"},
+	}
+	for _, tc := range tests {
+		_, err := ParseGreeting(tc.text)
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("parsing %q failed: %s", tc.text, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("got the error %v parsing %q, want one containing %q", err, tc.text, tc.wantErr)
+		}
+	}
+}
+
+func TestGreetingHandler(t *testing.T) {
+	greeting, err := ParseGreeting("{{.Body}} {{.InstanceID}} {{.Hostname}}:{{.Port}} {{.TLSVersion}} {{.ClientCN}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostname, _ := os.Hostname()
+	h := Handler(Options{Greeting: greeting, InstanceID: "instance-1", Port: "8443"})
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "gopher"}}
+
+	tests := []struct {
+		name string
+		tls  *tls.ConnectionState
+		want string
+	}{
+		{"cleartext", nil, "Gopher instance-1 " + hostname + ":8443  "},
+		{"TLS", &tls.ConnectionState{Version: tls.VersionTLS13}, "Gopher instance-1 " + hostname + ":8443 TLS 1.3 "},
+		{"client certificate", &tls.ConnectionState{Version: tls.VersionTLS12, PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}},
+			"Gopher instance-1 " + hostname + ":8443 TLS 1.2 gopher"},
+		{"unverified client certificate", &tls.ConnectionState{Version: tls.VersionTLS12, PeerCertificates: []*x509.Certificate{cert}},
+			"Gopher instance-1 " + hostname + ":8443 TLS 1.2 "},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("Gopher"))
+			r.TLS = tc.tls
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusOK || w.Body.String() != tc.want {
+				t.Errorf("got %d %q, want 200 %q", w.Code, w.Body, tc.want)
+			}
+		})
+	}
+}
+
+func TestGreetingHandlerError(t *testing.T) {
+	// The template parses, and executes with empty data, but fails for a
+	// request's
+	greeting, err := ParseGreeting(`{{if .Body}}{{index .Body 10}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	greetingHandler(greeting, "", "")(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("short")))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "error rendering the greeting") {
+		t.Errorf("got %d %q, want 500 and the error", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/logging"
+)
+
+// errTooManyHandshakes aborts the handshakes shed by a HandshakeLimiter.
+var errTooManyHandshakes = errors.New("too many TLS handshakes in progress")
+
+// shedLogInterval is how often a HandshakeLimiter logs the handshakes it
+// shed, so a flood of them doesn't flood the log too.
+const shedLogInterval = time.Second
+
+// HandshakeLimiter limits the number of TLS handshakes in progress at the same
+// time, aborting those that would exceed the limit, so a burst of new
+// connections can't starve the server of the CPU needed for the signatures
+// and key exchanges. It's safe for concurrent use.
+type HandshakeLimiter struct {
+	sem  chan struct{}
+	shed atomic.Uint64
+	// logged is the number of shed handshakes already logged, and lastLog
+	// when, as UnixNano.
+	logged  atomic.Uint64
+	lastLog atomic.Int64
+}
+
+// NewHandshakeLimiter returns a HandshakeLimiter that allows max handshakes
+// at a time.
+func NewHandshakeLimiter(max int) *HandshakeLimiter {
+	return &HandshakeLimiter{sem: make(chan struct{}, max)}
+}
+
+// InProgress returns the number of handshakes in progress.
+func (l *HandshakeLimiter) InProgress() int {
+	return len(l.sem)
+}
+
+// Shed returns the number of handshakes aborted because too many were in
+// progress.
+func (l *HandshakeLimiter) Shed() uint64 {
+	return l.shed.Load()
+}
+
+// Wrap returns a tls.Config.GetConfigForClient function that counts the
+// handshake, from the ClientHello until it completes or fails, against the
+// limit, returning getConfig's config if the limit isn't reached, and
+// otherwise aborting the handshake. Connections that haven't sent their
+// ClientHello yet don't count, they haven't cost any CPU yet.
+func (l *HandshakeLimiter) Wrap(getConfig func(*tls.ClientHelloInfo) (*tls.Config, error)) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			l.reject(hello)
+			return nil, errTooManyHandshakes
+		}
+		// The handshake's context is canceled when it completes, or fails
+		context.AfterFunc(hello.Context(), func() { <-l.sem })
+		return getConfig(hello)
+	}
+}
+
+// reject counts a shed handshake, logging the handshakes shed since the last
+// time it did, at most once per shedLogInterval.
+func (l *HandshakeLimiter) reject(hello *tls.ClientHelloInfo) {
+	shed := l.shed.Add(1)
+	now := time.Now().UnixNano()
+	last := l.lastLog.Load()
+	if now-last < int64(shedLogInterval) || !l.lastLog.CompareAndSwap(last, now) {
+		return
+	}
+	since := shed - l.logged.Swap(shed)
+	logging.Warnf("shed %d TLS handshakes, the latest from %s, because %d were already in progress (-max-handshakes)", since, hello.Conn.RemoteAddr(), cap(l.sem))
+}
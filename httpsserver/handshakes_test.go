@@ -0,0 +1,165 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newLimitedServer returns a server whose handshakes are limited by limiter,
+// with getConfig called for those allowed.
+func newLimitedServer(t testing.TB, limiter *HandshakeLimiter, getConfig func(*tls.ClientHelloInfo)) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	var cfg *tls.Config
+	ts.TLS = &tls.Config{
+		GetConfigForClient: limiter.Wrap(func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			getConfig(hello)
+			return cfg, nil
+		}),
+	}
+	ts.StartTLS()
+	cfg = ts.TLS.Clone()
+	cfg.GetConfigForClient = nil
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// dial performs a TLS handshake with ts, returning its error.
+func dial(ts *httptest.Server) error {
+	conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// waitFor waits for cond to become true.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestHandshakeLimiter(t *testing.T) {
+	limiter := NewHandshakeLimiter(2)
+	release := make(chan struct{})
+	ts := newLimitedServer(t, limiter, func(*tls.ClientHelloInfo) { <-release })
+
+	// Two handshakes stall in GetConfigForClient, using up the limit
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- dial(ts)
+		}()
+	}
+	waitFor(t, "2 handshakes in progress", func() bool { return limiter.InProgress() == 2 })
+
+	if err := dial(ts); err == nil {
+		t.Fatal("the handshake beyond the limit succeeded")
+	}
+	if shed := limiter.Shed(); shed != 1 {
+		t.Errorf("got %d shed handshakes, want 1", shed)
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("a handshake within the limit failed: %s", err)
+		}
+	}
+	waitFor(t, "the completed handshakes to release their slots", func() bool { return limiter.InProgress() == 0 })
+	if err := dial(ts); err != nil {
+		t.Errorf("the handshake after the others completed failed: %s", err)
+	}
+}
+
+func TestHandshakeLimiterReleasesFailedHandshakes(t *testing.T) {
+	limiter := NewHandshakeLimiter(1)
+	ts := newLimitedServer(t, limiter, func(*tls.ClientHelloInfo) {})
+
+	// The client only offers a cipher suite for ECDSA certificates, the
+	// server's is RSA, failing the handshake after the ClientHello
+	for i := 0; i < 3; i++ {
+		conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}})
+		if err == nil {
+			conn.Close()
+		}
+		waitFor(t, "the failed handshake to release its slot", func() bool { return limiter.InProgress() == 0 })
+	}
+	if err := dial(ts); err != nil {
+		t.Errorf("the handshake after the failed ones failed: %s", err)
+	}
+	if shed := limiter.Shed(); shed != 0 {
+		t.Errorf("got %d shed handshakes, want 0", shed)
+	}
+}
+
+// BenchmarkHandshakeBurst opens a burst of connections at once, measuring
+// the latency of a request on an already established keep-alive connection
+// meanwhile, without a limit and with -max-handshakes 8.
+func BenchmarkHandshakeBurst(b *testing.B) {
+	const burst = 256
+	for _, bm := range []struct {
+		name string
+		max  int
+	}{
+		{"unlimited", burst},
+		{"max=8", 8},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			limiter := NewHandshakeLimiter(bm.max)
+			ts := newLimitedServer(b, limiter, func(*tls.ClientHelloInfo) {})
+			client := ts.Client()
+			get := func() time.Duration {
+				start := time.Now()
+				res, err := client.Get(ts.URL)
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(ioutil.Discard, res.Body)
+				res.Body.Close()
+				return time.Since(start)
+			}
+			// Establish the keep-alive connection
+			get()
+
+			var latency time.Duration
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				for j := 0; j < burst; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						dial(ts)
+					}()
+				}
+				latency += get()
+				wg.Wait()
+			}
+			b.ReportMetric(float64(latency.Microseconds())/float64(b.N), "keepalive-us/op")
+			b.ReportMetric(float64(limiter.Shed())/float64(b.N), "shed/op")
+		})
+	}
+}
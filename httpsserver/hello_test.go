@@ -0,0 +1,124 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// discardWriter is a ResponseWriter that discards what's written, so the
+// benchmarks measure the handler's allocations, not the recorder's.
+type discardWriter struct{ h http.Header }
+
+func (w *discardWriter) Header() http.Header         { return w.h }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// unpooledHello is hello as it was before its buffers were pooled, the
+// baseline for BenchmarkHello.
+func unpooledHello(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		body = []byte(fmt.Sprintf("error reading request body: %s", err))
+	}
+	resp := fmt.Sprintf("Hello, %s from Advanced Server!", body)
+	w.Write([]byte(resp))
+}
+
+func BenchmarkHello(b *testing.B) {
+	body := strings.Repeat("gopher ", 100)
+	greeting, err := ParseGreeting("Hello {{.Body}} from {{.InstanceID}} on {{.Hostname}}:{{.Port}}!")
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarks := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"pooled", hello},
+		{"unpooled", unpooledHello},
+		{"greeting", greetingHandler(greeting, "instance-1", "8443")},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			w := &discardWriter{h: http.Header{}}
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			rd := strings.NewReader(body)
+			r.Body = ioutil.NopCloser(rd)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rd.Reset(body)
+				bm.handler(w, r)
+			}
+		})
+	}
+}
+
+// TestHelloConcurrentRequests sends concurrent requests, with bodies of
+// different sizes, checking each response holds only its own request's body,
+// i.e., no pooled buffer is shared by requests or reused while it's still
+// being written.
+func TestHelloConcurrentRequests(t *testing.T) {
+	greeting, err := ParseGreeting("{{.Body}} from {{.InstanceID}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    func(body string) string
+	}{
+		{"hello", hello, func(body string) string { return "Hello, " + body + " from Advanced Server!" }},
+		{"greeting", greetingHandler(greeting, "instance-1", "8443"), func(body string) string { return body + " from instance-1" }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(tc.handler)
+			defer ts.Close()
+			client := ts.Client()
+			client.Transport.(*http.Transport).MaxIdleConnsPerHost = 32
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 32)
+			for g := 0; g < 32; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 50; i++ {
+						body := fmt.Sprintf("request %d-%d %s", g, i, strings.Repeat(string(rune('a'+g%26)), (g*i*37)%4096))
+						res, err := client.Post(ts.URL, "text/plain", strings.NewReader(body))
+						if err != nil {
+							errs <- err
+							return
+						}
+						got, err := ioutil.ReadAll(res.Body)
+						res.Body.Close()
+						if err != nil {
+							errs <- err
+							return
+						}
+						if want := tc.want(body); !bytes.Equal(got, []byte(want)) {
+							errs <- fmt.Errorf("got a %d byte response to request %d-%d, want %d bytes, its own body", len(got), g, i, len(want))
+							return
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The paths browsers, crawlers, and scanners request without being linked to
+// them, which are served from KnownFiles rather than responded to with 404s.
+const (
+	FaviconPath     = "/favicon.ico"
+	RobotsPath      = "/robots.txt"
+	SecurityTxtPath = "/.well-known/security.txt"
+)
+
+// KnownPaths are the paths served from KnownFiles.
+var KnownPaths = []string{FaviconPath, RobotsPath, SecurityTxtPath}
+
+var (
+	//go:embed static/favicon.ico
+	defaultFavicon []byte
+	//go:embed static/robots.txt
+	defaultRobots []byte
+	//go:embed static/security.txt
+	defaultSecurityTxt []byte
+)
+
+// KnownFiles are the contents of the KnownPaths. A nil file is served with
+// the built-in default: a small icon, a robots.txt that disallows crawling
+// everything, and a security.txt pointing to the project's issue tracker.
+type KnownFiles struct {
+	// Favicon is the /favicon.ico icon, in ICO format or, e.g., PNG, its
+	// content type is detected from its contents.
+	Favicon []byte
+	// Robots is the /robots.txt file.
+	Robots []byte
+	// SecurityTxt is the /.well-known/security.txt file, see RFC 9116. The
+	// default's Expires field is a year after the server started.
+	SecurityTxt []byte
+}
+
+// knownFileMaxAge is how long clients may cache the KnownFiles for.
+const knownFileMaxAge = "public, max-age=86400"
+
+// handlers returns the handlers of the KnownPaths, serving f's files, or the
+// defaults, which are considered modified at start.
+func (f KnownFiles) handlers(start time.Time) map[string]http.Handler {
+	favicon := f.Favicon
+	if favicon == nil {
+		favicon = defaultFavicon
+	}
+	faviconType := http.DetectContentType(favicon)
+	if faviconType == "application/octet-stream" {
+		faviconType = "image/x-icon"
+	}
+	robots := f.Robots
+	if robots == nil {
+		robots = defaultRobots
+	}
+	securityTxt := f.SecurityTxt
+	if securityTxt == nil {
+		expires := start.AddDate(1, 0, 0).UTC().Truncate(24 * time.Hour)
+		securityTxt = append(append([]byte{}, defaultSecurityTxt...), "Expires: "+expires.Format(time.RFC3339)+"\n"...)
+	}
+	return map[string]http.Handler{
+		FaviconPath:     knownFileHandler(favicon, faviconType, start),
+		RobotsPath:      knownFileHandler(robots, "text/plain; charset=utf-8", start),
+		SecurityTxtPath: knownFileHandler(securityTxt, "text/plain; charset=utf-8", start),
+	}
+}
+
+// knownFileHandler serves data, with contentType, to GET and HEAD requests,
+// handling conditional and range requests, and responds to other methods with
+// a 405.
+func knownFileHandler(data []byte, contentType string, modTime time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, fmt.Sprintf("method not allowed, %s requires GET or HEAD", r.URL.Path), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", knownFileMaxAge)
+		http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
+	}
+}
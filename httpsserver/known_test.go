@@ -0,0 +1,110 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKnownFiles(t *testing.T) {
+	start := time.Date(2020, 9, 13, 12, 0, 0, 0, time.UTC)
+	png := []byte("\x89PNG\r\n\x1a\nicon")
+	robots := []byte("User-agent: *\nAllow: /\n")
+	securityTxt := []byte("Contact: mailto:security@example.com\n")
+	defaultSecurity := string(defaultSecurityTxt) + "Expires: 2021-09-13T00:00:00Z\n"
+
+	tests := []struct {
+		name  string
+		known KnownFiles
+		// want are the bodies served for the KnownPaths
+		want map[string]string
+		// wantFaviconType is the favicon's content type
+		wantFaviconType string
+	}{
+		{"defaults", KnownFiles{}, map[string]string{
+			FaviconPath:     string(defaultFavicon),
+			RobotsPath:      string(defaultRobots),
+			SecurityTxtPath: defaultSecurity,
+		}, "image/x-icon"},
+		{"favicon overridden", KnownFiles{Favicon: png}, map[string]string{
+			FaviconPath:     string(png),
+			RobotsPath:      string(defaultRobots),
+			SecurityTxtPath: defaultSecurity,
+		}, "image/png"},
+		{"robots.txt overridden", KnownFiles{Robots: robots}, map[string]string{
+			FaviconPath:     string(defaultFavicon),
+			RobotsPath:      string(robots),
+			SecurityTxtPath: defaultSecurity,
+		}, "image/x-icon"},
+		// An override isn't given an Expires field
+		{"security.txt overridden", KnownFiles{SecurityTxt: securityTxt}, map[string]string{
+			FaviconPath:     string(defaultFavicon),
+			RobotsPath:      string(defaultRobots),
+			SecurityTxtPath: string(securityTxt),
+		}, "image/x-icon"},
+		{"all overridden", KnownFiles{Favicon: png, Robots: robots, SecurityTxt: securityTxt}, map[string]string{
+			FaviconPath:     string(png),
+			RobotsPath:      string(robots),
+			SecurityTxtPath: string(securityTxt),
+		}, "image/png"},
+		// An empty file is served, only a nil one is replaced by the default
+		{"empty robots.txt", KnownFiles{Robots: []byte{}}, map[string]string{
+			FaviconPath:     string(defaultFavicon),
+			RobotsPath:      "",
+			SecurityTxtPath: defaultSecurity,
+		}, "image/x-icon"},
+	}
+	for _, tc := range tests {
+		handlers := tc.known.handlers(start)
+		if len(handlers) != len(KnownPaths) {
+			t.Errorf("%s: got %d handlers, want one for each of the %d KnownPaths", tc.name, len(handlers), len(KnownPaths))
+		}
+		for _, path := range KnownPaths {
+			w := httptest.NewRecorder()
+			handlers[path].ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if w.Code != http.StatusOK || w.Body.String() != tc.want[path] {
+				t.Errorf("%s: got %s %d %q, want 200 %q", tc.name, path, w.Code, w.Body.String(), tc.want[path])
+			}
+			if got := w.Header().Get("Cache-Control"); got != knownFileMaxAge {
+				t.Errorf("%s: got %s Cache-Control %q, want %q", tc.name, path, got, knownFileMaxAge)
+			}
+			wantType := "text/plain; charset=utf-8"
+			if path == FaviconPath {
+				wantType = tc.wantFaviconType
+			}
+			if got := w.Header().Get("Content-Type"); got != wantType {
+				t.Errorf("%s: got %s Content-Type %q, want %q", tc.name, path, got, wantType)
+			}
+		}
+	}
+}
+
+func TestKnownFilesServed(t *testing.T) {
+	robots := []byte("User-agent: *\nAllow: /\n")
+	h := Handler(Options{Known: KnownFiles{Robots: robots}})
+
+	get := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	if w := get(http.MethodGet, RobotsPath); w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), robots) {
+		t.Errorf("got %s %d %q, want the override", RobotsPath, w.Code, w.Body.String())
+	}
+	if w := get(http.MethodGet, SecurityTxtPath); w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), string(defaultSecurityTxt)) {
+		t.Errorf("got %s %d %q, want the default", SecurityTxtPath, w.Code, w.Body.String())
+	}
+	if w := get(http.MethodHead, FaviconPath); w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("got HEAD %s %d with a %d byte body, want 200 and no body", FaviconPath, w.Code, w.Body.Len())
+	}
+	if w := get(http.MethodPost, RobotsPath); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("got POST %s %d, Allow %q, want 405 and GET, HEAD allowed", RobotsPath, w.Code, w.Header().Get("Allow"))
+	}
+}
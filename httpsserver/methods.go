@@ -0,0 +1,93 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// methodOrder is the order the methods in an Allow header are listed in,
+// other methods follow them in alphabetical order.
+var methodOrder = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// handle registers handler for pattern, recording methods, the methods it
+// serves, in the route table the server-wide Allow header is derived from,
+// see ServeHTTP. If methods is empty they're taken from pattern's method,
+// e.g., 'POST /items', or default to GET and HEAD.
+func (r *Routes) handle(pattern string, handler http.Handler, methods ...string) {
+	r.mux.Handle(pattern, handler)
+	if len(methods) == 0 {
+		if method, _, found := strings.Cut(pattern, " "); found {
+			methods = []string{method}
+			if method == http.MethodGet {
+				methods = append(methods, http.MethodHead)
+			}
+		} else {
+			methods = []string{http.MethodGet, http.MethodHead}
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range methods {
+		r.methods[m] = true
+	}
+}
+
+// allow returns the Allow header listing every method routed, and OPTIONS.
+func (r *Routes) allow() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var allowed, others []string
+	for _, m := range methodOrder {
+		if r.methods[m] || m == http.MethodOptions {
+			allowed = append(allowed, m)
+		}
+	}
+	for m := range r.methods {
+		if !contains(methodOrder, m) {
+			others = append(others, m)
+		}
+	}
+	sort.Strings(others)
+	return strings.Join(append(allowed, others...), ", ")
+}
+
+// serverWide responds to the requests that are handled the same way whatever
+// their target, rather than by a route, returning false for other requests.
+// 'OPTIONS *', which asks about the server's capabilities rather than a
+// resource's, gets a 204 with an Allow header listing the methods routed.
+// TRACE is rejected with a 405, since echoing requests back can expose
+// credentials, e.g., cookies, to scripts, cross-site tracing. A TRACE
+// request's body is discarded, up to a limit, so the connection can be
+// reused.
+func (r *Routes) serverWide(w http.ResponseWriter, req *http.Request) bool {
+	switch {
+	case req.Method == http.MethodOptions && req.RequestURI == "*":
+		w.Header().Set("Allow", r.allow())
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	case req.Method == http.MethodTrace:
+		io.Copy(io.Discard, io.LimitReader(req.Body, 64*1024))
+		w.Header().Set("Allow", r.allow())
+		http.Error(w, "method not allowed, TRACE isn't supported", http.StatusMethodNotAllowed)
+		return true
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
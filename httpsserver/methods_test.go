@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newMethodsServer returns a server of routes that lets 'OPTIONS *' reach
+// them, and a connection to it.
+func newMethodsServer(t *testing.T, routes *Routes) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(routes)
+	ts.Config.DisableGeneralOptionsHandler = true
+	ts.Start()
+	t.Cleanup(ts.Close)
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+// roundTrip writes the raw request to conn and reads the response, and its
+// body, from br.
+func roundTrip(t *testing.T, conn net.Conn, br *bufio.Reader, request string) (*http.Response, string) {
+	t.Helper()
+	if _, err := io.WriteString(conn, request); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestOptionsAsterisk(t *testing.T) {
+	var routed atomic.Int32
+	routes := NewRoutes(Options{})
+	routes.HandleMethods("/items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routed.Add(1)
+	}), http.MethodPost, http.MethodPut, "PURGE")
+	conn, br := newMethodsServer(t, routes)
+
+	resp, body := roundTrip(t, conn, br, "OPTIONS * HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	if resp.StatusCode != http.StatusNoContent || body != "" {
+		t.Errorf("got %d %q, want 204 and no body", resp.StatusCode, body)
+	}
+	// The routed methods in the usual order, OPTIONS, then the others
+	if got, want := resp.Header.Get("Allow"), "GET, HEAD, POST, PUT, OPTIONS, PURGE"; got != want {
+		t.Errorf("got Allow %q, want %q", got, want)
+	}
+	if n := routed.Load(); n != 0 {
+		t.Errorf("'OPTIONS *' was routed %d times, want it answered by the server", n)
+	}
+
+	// OPTIONS of a resource is routed as usual
+	roundTrip(t, conn, br, "OPTIONS /items HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	if n := routed.Load(); n != 1 {
+		t.Errorf("'OPTIONS /items' was routed %d times, want 1", n)
+	}
+}
+
+func TestTraceRejected(t *testing.T) {
+	var routed atomic.Int32
+	routes := NewRoutes(Options{})
+	routes.HandleMethods("/items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routed.Add(1)
+	}), http.MethodGet, "TRACE")
+	conn, br := newMethodsServer(t, routes)
+
+	for _, path := range []string{"/", "/items"} {
+		resp, body := roundTrip(t, conn, br, "TRACE "+path+" HTTP/1.1\r\nHost: example.com\r\nCookie: session=secret\r\nContent-Length: 6\r\n\r\nGopher")
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("TRACE %s got status %d, want 405", path, resp.StatusCode)
+		}
+		if resp.Header.Get("Allow") == "" {
+			t.Errorf("TRACE %s got no Allow header", path)
+		}
+		// Neither the request's headers nor its body are echoed back
+		if strings.Contains(body, "secret") || strings.Contains(body, "Gopher") {
+			t.Errorf("TRACE %s got the body %q, want the request not echoed", path, body)
+		}
+	}
+	if n := routed.Load(); n != 0 {
+		t.Errorf("TRACE was routed %d times, want it rejected even where a route allows it", n)
+	}
+
+	// The TRACE bodies were discarded, not read as the next request, so the
+	// connection can be reused
+	resp, body := roundTrip(t, conn, br, "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nAgain")
+	if resp.StatusCode != http.StatusOK || body != "Hello, Again from Advanced Server!" {
+		t.Errorf("got %d %q after the TRACE requests, want 200 and the greeting", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// ResponseFile is a fixture file, e.g., a JSON document or a binary blob, the
+// / route responds to GET and HEAD requests with instead of the greeting. The
+// file is read into memory, and is only read again by Reload, so it's served
+// consistently while it's being replaced. It's safe for concurrent use.
+type ResponseFile struct {
+	path        string
+	contentType string
+	current     atomic.Pointer[responseContent]
+}
+
+type responseContent struct {
+	data    []byte
+	modTime time.Time
+	etag    string
+}
+
+// NewResponseFile reads path, to be served with contentType or, if it's
+// empty, the type of path's extension, or of its contents if the extension
+// isn't known.
+func NewResponseFile(path, contentType string) (*ResponseFile, error) {
+	f := &ResponseFile{path: path, contentType: contentType}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload reads the file again. If it can't be read the previous contents
+// continue to be served.
+func (f *ResponseFile) Reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("unable to read the response file: %w", err)
+	}
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("unable to read the response file: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	f.current.Store(&responseContent{
+		data:    data,
+		modTime: info.ModTime(),
+		etag:    `"` + hex.EncodeToString(sum[:16]) + `"`,
+	})
+	return nil
+}
+
+// Path returns the name of the file.
+func (f *ResponseFile) Path() string {
+	return f.path
+}
+
+// Size returns the size, in bytes, of the contents being served.
+func (f *ResponseFile) Size() int {
+	return len(f.current.Load().data)
+}
+
+// Handler returns a handler that serves the file to GET and HEAD requests,
+// honoring conditional, If-None-Match and If-Modified-Since, and Range
+// requests, and calls next for other methods, e.g., so POST still echoes the
+// request body.
+func (f *ResponseFile) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		c := f.current.Load()
+		w.Header().Set("ETag", c.etag)
+		if f.contentType != "" {
+			w.Header().Set("Content-Type", f.contentType)
+		}
+		http.ServeContent(w, r, filepath.Base(f.path), c.modTime, bytes.NewReader(c.data))
+	})
+}
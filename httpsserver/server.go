@@ -0,0 +1,419 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package httpsserver contains the TLS configuration and routes of the
+// 'adv-server' command. TLSConfig and Handler are the supported API for
+// embedding them in other programs, with the caller's own http.Server:
+//
+//	cfg, err := httpsserver.TLSConfig(httpsserver.Options{Host: "localhost", CertFile: "server.crt", KeyFile: "server.key"})
+//	...
+//	srv := &http.Server{Addr: ":8443", TLSConfig: cfg, Handler: httpsserver.Handler(httpsserver.Options{})}
+//	err = srv.ListenAndServeTLS("", "")
+//
+// Use NewRoutes instead of Handler to be able to end the long-lived /events
+// and /ws responses when the server shuts down.
+package httpsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/bufpool"
+	"github.com/youngkin/gohttps/internal/certs"
+	"github.com/youngkin/gohttps/internal/logging"
+	"github.com/youngkin/gohttps/internal/srv"
+	"github.com/youngkin/gohttps/internal/tlsutil"
+)
+
+// Options configure the TLS configuration returned by TLSConfig and the
+// routes served by Handler. Zero values are the defaults.
+type Options struct {
+	// Host is the server's host name.
+	Host string
+
+	// CertFile and KeyFile are the server's certificate and private key. Each
+	// is a file name, 'env:VARNAME' to read PEM content from the VARNAME
+	// environment variable, or '-' to read PEM content from stdin.
+	CertFile string
+	KeyFile  string
+	// KeyPassphrase decrypts KeyFile if it's encrypted.
+	KeyPassphrase []byte
+	// Certificate, if not nil, is used instead of CertFile and KeyFile.
+	Certificate *tls.Certificate
+
+	// ClientAuth is the client certificate policy. A CA is required if it's
+	// tls.VerifyClientCertIfGiven or tls.RequireAndVerifyClientCert.
+	ClientAuth tls.ClientAuthType
+	// CACertFile is the CA that client certificates are verified against, in
+	// the same forms as CertFile.
+	CACertFile string
+	// CACertPEM, if not nil, is used instead of CACertFile.
+	CACertPEM []byte
+	// UseSystemRoots also verifies client certificates against the system's
+	// root CAs, in which case a CA isn't required. If the system roots aren't
+	// available a warning is logged and only the CA is used.
+	UseSystemRoots bool
+	// ClockSkewTolerance, if positive, accepts client certificate chains that
+	// only fail verification because a certificate is at most this far
+	// outside its validity period, e.g., because the local clock is wrong.
+	// Each such acceptance is logged as a warning. Defaults to 0, disabled.
+	ClockSkewTolerance time.Duration
+
+	// Profile is the name of a TLS profile, modern, intermediate, or old.
+	// Without one TLS 1.2 is the minimum version and Go's defaults are used
+	// otherwise.
+	Profile string
+	// CipherSuites and CurvePreferences, if not nil, override the profile's.
+	CipherSuites     []uint16
+	CurvePreferences []tls.CurveID
+	// MinVersion, if not 0, overrides the profile's minimum TLS version, e.g.,
+	// tls.VersionTLS13 to reject clients that don't support TLS 1.3.
+	MinVersion uint16
+	// DisableResumption disables TLS session resumption so every connection
+	// performs a full handshake.
+	DisableResumption bool
+	// SignedCertificateTimestamps are serialized certificate transparency SCTs
+	// for the server's certificate.
+	SignedCertificateTimestamps [][]byte
+
+	// MaxBytes is the maximum size of the /bytes and /drip responses,
+	// defaults to DefaultMaxBytes.
+	MaxBytes int64
+	// MaxFormBytes is the maximum size of /form requests, defaults to
+	// DefaultMaxBytes. MaxMultipartMemory is the maximum size of their
+	// non-file fields, which are kept in memory, defaults to
+	// DefaultMaxMultipartMemory.
+	MaxFormBytes       int64
+	MaxMultipartMemory int64
+	// MaxDelay is the maximum delay of the /delay responses, defaults to
+	// DefaultMaxDelay.
+	MaxDelay time.Duration
+	// FaultRate is the percentage, from 0 to 100, of requests to /, and other
+	// paths without a route of their own, that are responded to with
+	// FaultStatus, defaults to 500, instead of the greeting.
+	// Defaults to 0, no faults are injected.
+	FaultRate   float64
+	FaultStatus int
+	// RetryAfter, if not 0, is the Retry-After of the injected faults that are
+	// 503s or 429s.
+	RetryAfter time.Duration
+	// Greeting, if not nil, is the template, see ParseGreeting, of the
+	// greeting / responds with, instead of the default one. InstanceID and
+	// Port are its .InstanceID and .Port.
+	Greeting   *template.Template
+	InstanceID string
+	Port       string
+	// Response, if not nil, is the file / responds to GET and HEAD requests
+	// with, other methods still get the greeting.
+	Response *ResponseFile
+	// Known overrides the built-in /favicon.ico, /robots.txt, and
+	// /.well-known/security.txt files, see KnownFiles.
+	Known KnownFiles
+}
+
+// TLSConfig returns the server's TLS configuration as specified by opts,
+// suitable for use as an http.Server's TLSConfig.
+func TLSConfig(opts Options) (*tls.Config, error) {
+	var cert tls.Certificate
+	if opts.Certificate != nil {
+		cert = *opts.Certificate
+	} else {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, errors.New("a certificate and key file, or a certificate, must be provided")
+		}
+		var err error
+		cert, err = certs.LoadX509KeyPair(opts.CertFile, opts.KeyFile, opts.KeyPassphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.SignedCertificateTimestamps != nil {
+		cert.SignedCertificateTimestamps = opts.SignedCertificateTimestamps
+	}
+	caCertPool, err := clientCAs(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName: opts.Host,
+		// ClientAuth: tls.NoClientCert,				// Client certificate will not be requested and it is not required
+		// ClientAuth: tls.RequestClientCert,			// Client certificate will be requested, but it is not required
+		// ClientAuth: tls.RequireAnyClientCert,		// Client certificate is required, but any client certificate is acceptable
+		// ClientAuth: tls.VerifyClientCertIfGiven,		// Client certificate will be requested and if present must be in the server's Certificate Pool
+		// ClientAuth: tls.RequireAndVerifyClientCert,	// Client certificate will be required and must be present in the server's Certificate Pool
+		ClientAuth:   opts.ClientAuth,
+		ClientCAs:    caCertPool,
+		MinVersion:   tls.VersionTLS12, // TLS versions below 1.2 are considered insecure - see https://www.rfc-editor.org/rfc/rfc7525.txt for details
+		Certificates: []tls.Certificate{cert},
+	}
+	if opts.Profile != "" {
+		profile, err := tlsutil.LookupProfile(opts.Profile)
+		if err != nil {
+			return nil, err
+		}
+		profile.Apply(tlsConfig)
+	}
+	if opts.CipherSuites != nil {
+		tlsConfig.CipherSuites = opts.CipherSuites
+	}
+	if opts.CurvePreferences != nil {
+		tlsConfig.CurvePreferences = opts.CurvePreferences
+	}
+	if opts.MinVersion != 0 {
+		tlsConfig.MinVersion = opts.MinVersion
+	}
+	if opts.ClockSkewTolerance > 0 && opts.ClientAuth >= tls.VerifyClientCertIfGiven {
+		// crypto/tls can't adjust the verification time, so it only checks
+		// that a certificate is provided, if required, and verifySkewed
+		// verifies it. ClientCAs is still set so the CAs are advertised.
+		if opts.ClientAuth == tls.VerifyClientCertIfGiven {
+			tlsConfig.ClientAuth = tls.RequestClientCert
+		} else {
+			tlsConfig.ClientAuth = tls.RequireAnyClientCert
+		}
+		tlsConfig.VerifyConnection = verifySkewed(caCertPool, opts.ClockSkewTolerance)
+	}
+	// Go servers only resume sessions using tickets, both for TLS 1.2 and
+	// TLS 1.3 PSKs, so disabling tickets disables resumption entirely. No
+	// ticket keys are set so none are rotated either.
+	tlsConfig.SessionTicketsDisabled = opts.DisableResumption
+	return tlsConfig, nil
+}
+
+// clientCAs loads the CA certificates used to verify client certificates.
+// A nil pool is returned if opts.ClientAuth doesn't require verification.
+func clientCAs(opts Options) (*x509.CertPool, error) {
+	if opts.ClientAuth <= tls.RequestClientCert {
+		return nil, nil
+	}
+	caCert := opts.CACertPEM
+	if caCert == nil && opts.CACertFile != "" {
+		var err error
+		caCert, err = certs.ReadSource(opts.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading CA cert: %w", err)
+		}
+	}
+	if opts.UseSystemRoots {
+		pool, err := certs.NewSystemCertPool(caCert)
+		if !errors.Is(err, certs.ErrNoSystemRoots) || caCert == nil {
+			return pool, err
+		}
+		logging.Warnf("%s, only verifying client certificates against the CA", err)
+	}
+	if caCert == nil {
+		return nil, fmt.Errorf("a CA is required to verify client certificates with %s", opts.ClientAuth)
+	}
+	return certs.NewCertPool(caCert)
+}
+
+// verifySkewed returns a tls.Config.VerifyConnection function that verifies
+// the client's certificate chain, if there is one, against roots, allowing for
+// up to tolerance of clock skew.
+func verifySkewed(roots *x509.CertPool, tolerance time.Duration) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return nil
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		leaf := cs.PeerCertificates[0]
+		_, skew, err := certs.VerifyWithSkew(leaf, x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, tolerance)
+		if err != nil {
+			if validity := certs.ExplainValidity(err, time.Now()); validity != "" {
+				return fmt.Errorf("tls: failed to verify certificate: %w (%s)", err, validity)
+			}
+			return fmt.Errorf("tls: failed to verify certificate: %w", err)
+		}
+		if skew != 0 {
+			logging.Warnf("accepted the client certificate for %q, which is only valid if the local clock is %s, within the clock skew tolerance of %s",
+				leaf.Subject.CommonName, certs.DescribeSkew(skew), tolerance)
+		}
+		return nil
+	}
+}
+
+// Handler returns the server's routes as specified by opts:
+//
+//	/           Responds with a greeting of the client's name or the request body,
+//	            or with the Greeting template
+//	/bytes/{n}  Responds with n bytes of data
+//	/drip       Responds with data written gradually
+//	/delay      Responds after a delay
+//	/status/{code} Responds with the status code
+//	/form       Responds with a summary of a multipart form's fields and files
+//	/events     A Server-Sent Events stream
+//	/ws         A WebSocket echo endpoint
+//	/favicon.ico, /robots.txt, /.well-known/security.txt
+//	            The KnownFiles, so browsers and crawlers don't get 404s
+//
+// 'OPTIONS *' is answered with the methods routed, and TRACE is rejected,
+// see Routes.ServeHTTP.
+func Handler(opts Options) http.Handler {
+	return NewRoutes(opts)
+}
+
+// Routes are the server's routes, see Handler.
+type Routes struct {
+	mux       *http.ServeMux
+	longLived *srv.LongLived
+	mu        sync.Mutex
+	// methods are the methods routed, see handle.
+	methods map[string]bool
+}
+
+// NewRoutes returns the server's routes as specified by opts.
+func NewRoutes(opts Options) *Routes {
+	maxBytes := opts.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	maxFormBytes := opts.MaxFormBytes
+	if maxFormBytes == 0 {
+		maxFormBytes = DefaultMaxBytes
+	}
+	maxMultipartMemory := opts.MaxMultipartMemory
+	if maxMultipartMemory == 0 {
+		maxMultipartMemory = DefaultMaxMultipartMemory
+	}
+	maxDelay := opts.MaxDelay
+	if maxDelay == 0 {
+		maxDelay = DefaultMaxDelay
+	}
+	r := &Routes{
+		mux:       http.NewServeMux(),
+		longLived: srv.NewLongLived(),
+		methods:   map[string]bool{},
+	}
+	r.handle("/bytes/{n}", bytesHandler(maxBytes))
+	r.handle("/drip", dripHandler(maxBytes))
+	r.handle("/delay", delayHandler(maxDelay))
+	r.handle("/delay/{d}", delayHandler(maxDelay))
+	r.handle("/status/{code}", http.HandlerFunc(statusHandler))
+	r.handle("/form", formHandler(maxFormBytes, maxMultipartMemory), http.MethodPost, http.MethodPut)
+	r.handle("/events", eventsHandler(r.longLived))
+	r.handle("/ws", newWSEcho(r.longLived), http.MethodGet)
+	for path, h := range opts.Known.handlers(time.Now()) {
+		r.handle(path, h)
+	}
+	var root http.Handler = http.HandlerFunc(hello)
+	if opts.Greeting != nil {
+		root = greetingHandler(opts.Greeting, opts.InstanceID, opts.Port)
+	}
+	if opts.Response != nil {
+		root = opts.Response.Handler(root)
+	}
+	if opts.FaultRate > 0 {
+		status := opts.FaultStatus
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		root = injectFaults(opts.FaultRate, status, opts.RetryAfter, root)
+	}
+	r.handle("/", root, http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut)
+	return r
+}
+
+// Handle registers an additional route, as http.ServeMux.Handle does. The
+// route serves GET and HEAD requests, as far as the server-wide Allow header
+// is concerned, unless pattern has a method, e.g., 'POST /items', see
+// HandleMethods.
+func (r *Routes) Handle(pattern string, handler http.Handler) {
+	r.handle(pattern, handler)
+}
+
+// HandleMethods registers an additional route, as Handle does, that serves
+// methods.
+func (r *Routes) HandleMethods(pattern string, handler http.Handler, methods ...string) {
+	r.handle(pattern, handler, methods...)
+}
+
+// ServeHTTP responds to 'OPTIONS *', and rejects TRACE requests, itself,
+// before routing the request. Servers must set
+// http.Server.DisableGeneralOptionsHandler for 'OPTIONS *' to reach it.
+func (r *Routes) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.serverWide(w, req) {
+		return
+	}
+	r.mux.ServeHTTP(w, req)
+}
+
+// LongLived returns the coordinator the long-lived /events and /ws handlers
+// are registered with, e.g., for srv.Options.LongLived, so they're signaled
+// to wrap up when the server shuts down. Other long-lived handlers, e.g.,
+// added with Handle, may register with it too.
+func (r *Routes) LongLived() *srv.LongLived {
+	return r.longLived
+}
+
+// Shutdown ends the /events streams and closes the /ws connections, which
+// http.Server.Shutdown doesn't wait for, or track, respectively. It waits
+// until they've wrapped up, e.g., the WebSocket clients respond, or ctx is
+// done, when the remaining WebSocket connections are closed. It should be
+// called while, or after, the http.Server shuts down, unless LongLived is
+// passed to srv.RunWithGracefulShutdown, which calls it itself.
+func (r *Routes) Shutdown(ctx context.Context) {
+	if err := r.longLived.Shutdown(ctx); err != nil {
+		log.Printf("Closing the connections of long-lived handlers: %s", err)
+	}
+}
+
+// hello serves /, responding with a greeting that includes the request body
+// or, if the client authenticated with a verified certificate, the client's
+// name.
+func hello(w http.ResponseWriter, r *http.Request) {
+	// The response is built in a pooled buffer, reading the request body
+	// directly into it, to avoid allocating on every request.
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+	if name := clientName(r); name != "" {
+		fmt.Fprintf(buf, "Hello %s, authenticated from Advanced Server!", name)
+		w.Write(buf.Bytes())
+		return
+	}
+	buf.WriteString("Hello, ")
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		buf.Reset()
+		fmt.Fprintf(buf, "Hello, error reading request body: %s", err)
+	}
+	buf.WriteString(" from Advanced Server!")
+	w.Write(buf.Bytes())
+}
+
+// clientName returns the Common Name of the client's certificate, or, if it
+// has none, its first DNS name, email address, or URI, or "" if the client
+// didn't present a certificate or it wasn't verified. A certificate accepted
+// without verification, e.g., with tls.RequestClientCert, could name anyone.
+func clientName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return ""
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	}
+	return cert.Subject.String()
+}
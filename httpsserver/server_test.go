@@ -0,0 +1,320 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTLSConfigProfile(t *testing.T) {
+	cert := selfSignedCert(t)
+	modernCurves := []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}
+	tests := []struct {
+		name       string
+		opts       Options
+		minVersion uint16
+		ciphers    []uint16
+		curves     []tls.CurveID
+	}{
+		{"no profile", Options{}, tls.VersionTLS12, nil, nil},
+		{"modern", Options{Profile: "modern"}, tls.VersionTLS13, nil, modernCurves},
+		{"ciphers override the profile's", Options{Profile: "intermediate", CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}},
+			tls.VersionTLS12, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, modernCurves},
+		{"curves override the profile's", Options{Profile: "old", CurvePreferences: []tls.CurveID{tls.CurveP521}}, tls.VersionTLS10, nil, []tls.CurveID{tls.CurveP521}},
+		{"the minimum version overrides the profile's", Options{Profile: "intermediate", MinVersion: tls.VersionTLS13}, tls.VersionTLS13, nil, modernCurves},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.Certificate = &cert
+			cfg, err := TLSConfig(tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.MinVersion != tc.minVersion {
+				t.Errorf("got the minimum version %s, want %s", tls.VersionName(cfg.MinVersion), tls.VersionName(tc.minVersion))
+			}
+			if tc.ciphers != nil && !reflect.DeepEqual(cfg.CipherSuites, tc.ciphers) {
+				t.Errorf("got the cipher suites %v, want %v", cfg.CipherSuites, tc.ciphers)
+			}
+			if !reflect.DeepEqual(cfg.CurvePreferences, tc.curves) {
+				t.Errorf("got the curves %v, want %v", cfg.CurvePreferences, tc.curves)
+			}
+		})
+	}
+
+	if _, err := TLSConfig(Options{Certificate: &cert, Profile: "strict"}); err == nil {
+		t.Error("an unknown profile was accepted")
+	}
+}
+
+// resumed makes three requests to a server configured by opts, each on a new
+// connection from a client that caches sessions, returning whether each
+// connection resumed a session, for TLS 1.2 and 1.3.
+func resumed(t *testing.T, opts Options, version uint16) []bool {
+	t.Helper()
+	cfg, err := TLSConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = cfg
+	ts.StartTLS()
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			MaxVersion:         version,
+			ClientSessionCache: tls.NewLRUClientSessionCache(0),
+		},
+	}}
+	var got []bool
+	for i := 0; i < 3; i++ {
+		res, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		got = append(got, res.TLS.DidResume)
+	}
+	return got
+}
+
+func TestTLSConfigDisableResumption(t *testing.T) {
+	cert := selfSignedCert(t)
+	for _, version := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		t.Run(tls.VersionName(version), func(t *testing.T) {
+			if got := resumed(t, Options{Certificate: &cert}, version); !reflect.DeepEqual(got, []bool{false, true, true}) {
+				t.Fatalf("got the resumptions %v with resumption enabled, want all but the first connection to resume", got)
+			}
+			if got := resumed(t, Options{Certificate: &cert, DisableResumption: true}, version); !reflect.DeepEqual(got, []bool{false, false, false}) {
+				t.Errorf("got the resumptions %v with resumption disabled, want a full handshake each time", got)
+			}
+		})
+	}
+}
+
+// clientCertFrom returns a self-signed client certificate that's valid for
+// an hour from start, an offset from now.
+func clientCertFrom(t *testing.T, start time.Duration) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Certificate times are in whole seconds
+	now := time.Now().Truncate(time.Second)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "skewed"},
+		NotBefore:    now.Add(start),
+		NotAfter:     now.Add(start + time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestTLSConfigClockSkewTolerance(t *testing.T) {
+	cert := selfSignedCert(t)
+	ca := clientCertFrom(t, 2*time.Minute)
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+
+	tests := []struct {
+		name       string
+		opts       Options
+		clientAuth tls.ClientAuthType
+		verifies   bool
+	}{
+		{"off", Options{ClientAuth: tls.RequireAndVerifyClientCert}, tls.RequireAndVerifyClientCert, false},
+		{"required", Options{ClientAuth: tls.RequireAndVerifyClientCert, ClockSkewTolerance: 5 * time.Minute}, tls.RequireAnyClientCert, true},
+		{"if given", Options{ClientAuth: tls.VerifyClientCertIfGiven, ClockSkewTolerance: 5 * time.Minute}, tls.RequestClientCert, true},
+		{"not verified", Options{ClientAuth: tls.RequestClientCert, ClockSkewTolerance: 5 * time.Minute}, tls.RequestClientCert, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.Certificate = &cert
+			tc.opts.CACertPEM = caPEM
+			cfg, err := TLSConfig(tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.ClientAuth != tc.clientAuth {
+				t.Errorf("got the client auth type %s, want %s", cfg.ClientAuth, tc.clientAuth)
+			}
+			if (cfg.VerifyConnection != nil) != tc.verifies {
+				t.Errorf("got a VerifyConnection function %t, want %t", cfg.VerifyConnection != nil, tc.verifies)
+			}
+			if tc.opts.ClientAuth >= tls.VerifyClientCertIfGiven && cfg.ClientCAs == nil {
+				t.Error("got no client CAs, want them advertised")
+			}
+		})
+	}
+}
+
+func TestVerifySkewed(t *testing.T) {
+	var logs bytes.Buffer
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&logs)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	}()
+
+	tests := []struct {
+		name      string
+		start     time.Duration
+		tolerance time.Duration
+		wantErr   string
+		wantLog   string
+	}{
+		{"valid", -time.Minute, time.Minute, "", "^$"},
+		// The certificates' validity is in whole seconds, the current time isn't
+		{"not yet valid, within the tolerance", 2 * time.Minute, 5 * time.Minute, "", `^WARNING: accepted the client certificate for "skewed", which is only valid if the local clock is (2m0s|1m59s) behind, within the clock skew tolerance of 5m0s$`},
+		{"expired, within the tolerance", -time.Hour - 3*time.Minute, 5 * time.Minute, "", `^WARNING: accepted the client certificate for "skewed", which is only valid if the local clock is (3m0s|3m1s) ahead, within the clock skew tolerance of 5m0s$`},
+		{"beyond the tolerance", 10 * time.Minute, 5 * time.Minute, `certificate "skewed" isn't valid until`, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logs.Reset()
+			cert := clientCertFrom(t, tc.start)
+			roots := x509.NewCertPool()
+			roots.AddCert(cert)
+			err := verifySkewed(roots, tc.tolerance)(tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("got the error %v, want one containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verification failed: %s", err)
+			}
+			if got := strings.TrimSpace(logs.String()); !regexp.MustCompile(tc.wantLog).MatchString(got) {
+				t.Errorf("got the log %q, want it to match %q", got, tc.wantLog)
+			}
+		})
+	}
+
+	// Without a certificate there's nothing to verify, crypto/tls decides
+	// whether one is required
+	if err := verifySkewed(x509.NewCertPool(), time.Minute)(tls.ConnectionState{}); err != nil {
+		t.Errorf("got the error %s without a client certificate, want nil", err)
+	}
+}
+
+func TestHelloGreetsClient(t *testing.T) {
+	spiffe, err := url.Parse("spiffe://example.com/client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		tls  *tls.ConnectionState
+		want string
+	}{
+		{"no TLS", nil, "Hello, Gopher from Advanced Server!"},
+		{"no certificate", &tls.ConnectionState{}, "Hello, Gopher from Advanced Server!"},
+		{"unverified certificate", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "gopher"}}}}, "Hello, Gopher from Advanced Server!"},
+		{"Common Name", peer(&x509.Certificate{Subject: pkix.Name{CommonName: "gopher"}, DNSNames: []string{"client.example.com"}}), "Hello gopher, authenticated from Advanced Server!"},
+		{"DNS name", peer(&x509.Certificate{DNSNames: []string{"client.example.com"}, EmailAddresses: []string{"gopher@example.com"}}), "Hello client.example.com, authenticated from Advanced Server!"},
+		{"email address", peer(&x509.Certificate{EmailAddresses: []string{"gopher@example.com"}}), "Hello gopher@example.com, authenticated from Advanced Server!"},
+		{"URI", peer(&x509.Certificate{URIs: []*url.URL{spiffe}}), "Hello spiffe://example.com/client, authenticated from Advanced Server!"},
+		{"Subject", peer(&x509.Certificate{Subject: pkix.Name{Organization: []string{"Gophers"}}}), "Hello O=Gophers, authenticated from Advanced Server!"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("Gopher"))
+			r.TLS = tc.tls
+			w := httptest.NewRecorder()
+			hello(w, r)
+			if w.Body.String() != tc.want {
+				t.Errorf("got %q, want %q", w.Body, tc.want)
+			}
+		})
+	}
+}
+
+// peer returns the connection state of a client that authenticated with
+// cert.
+func peer(cert *x509.Certificate) *tls.ConnectionState {
+	return &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+}
+
+func TestHelloUnverifiedClientCert(t *testing.T) {
+	serverCert := selfSignedCert(t)
+	clientCert := selfSignedCert(t)
+	clientCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCert.Certificate[0]})
+	tests := []struct {
+		name       string
+		clientAuth tls.ClientAuthType
+		want       string
+	}{
+		// certopt 1 and 2 accept any certificate, so its name can't be trusted
+		{"request", tls.RequestClientCert, "Hello, Gopher from Advanced Server!"},
+		{"require any", tls.RequireAnyClientCert, "Hello, Gopher from Advanced Server!"},
+		{"verify if given", tls.VerifyClientCertIfGiven, "Hello client, authenticated from Advanced Server!"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := TLSConfig(Options{Certificate: &serverCert, ClientAuth: tc.clientAuth, CACertPEM: clientCA})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts := httptest.NewUnstartedServer(Handler(Options{}))
+			ts.TLS = cfg
+			ts.StartTLS()
+			defer ts.Close()
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				Certificates:       []tls.Certificate{clientCert},
+			}}}
+			resp, err := client.Post(ts.URL, "text/plain", strings.NewReader("Gopher"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tc.want {
+				t.Errorf("got %q, want %q", body, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+
+	"github.com/youngkin/gohttps/internal/logging"
+)
+
+// StrictSNI returns a tls.Config.GetConfigForClient function that aborts
+// the handshakes of clients whose ClientHello has no server name indication,
+// or one that doesn't match any of hosts, logging each rejection, and
+// otherwise returns getConfig's config. hosts may include wildcards, e.g.,
+// *.example.com, which match a single label. Clients connecting by IP
+// address don't send SNI, so they're always rejected.
+func StrictSNI(hosts []string, getConfig func(*tls.ClientHelloInfo) (*tls.Config, error)) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	allowed := strings.Join(hosts, ", ")
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		name := hello.ServerName
+		for _, h := range hosts {
+			if name != "" && matchSNI(name, h) {
+				return getConfig(hello)
+			}
+		}
+		if name == "" {
+			logging.Warnf("rejected the TLS handshake from %s without SNI, -strict-sni only allows %s", hello.Conn.RemoteAddr(), allowed)
+			return nil, fmt.Errorf("no server name indication, only %s are allowed", allowed)
+		}
+		logging.Warnf("rejected the TLS handshake from %s for SNI %q, -strict-sni only allows %s", hello.Conn.RemoteAddr(), name, allowed)
+		return nil, fmt.Errorf("unexpected server name %q, only %s are allowed", name, allowed)
+	}
+}
+
+// matchSNI returns true if name matches pattern, ignoring case and a
+// trailing dot. A leading "*." in pattern matches exactly one label.
+func matchSNI(name, pattern string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok && strings.HasPrefix(suffix, ".") {
+		label, rest, found := strings.Cut(name, ".")
+		return found && label != "" && "."+rest == suffix
+	}
+	return name == pattern
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatchSNI(t *testing.T) {
+	tests := []struct {
+		name, pattern string
+		want          bool
+	}{
+		{"localhost", "localhost", true},
+		{"LocalHost.", "localhost", true},
+		{"localhost", "LOCALHOST.", true},
+		{"api.example.com", "*.example.com", true},
+		{"API.Example.com.", "*.example.com", true},
+		{"example.com", "*.example.com", false},
+		{"a.b.example.com", "*.example.com", false},
+		{".example.com", "*.example.com", false},
+		{"www.example.org", "*.example.com", false},
+		{"example.com", "www.example.com", false},
+		{"*example.com", "*example.com", true},
+	}
+	for _, tc := range tests {
+		if got := matchSNI(tc.name, tc.pattern); got != tc.want {
+			t.Errorf("got %v matching %q against %q, want %v", got, tc.name, tc.pattern, tc.want)
+		}
+	}
+}
+
+func TestStrictSNI(t *testing.T) {
+	var cfg *tls.Config
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.TLS = &tls.Config{
+		GetConfigForClient: StrictSNI([]string{"localhost", "*.example.com"}, func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return cfg, nil
+		}),
+	}
+	ts.StartTLS()
+	defer ts.Close()
+	cfg = ts.TLS.Clone()
+	cfg.GetConfigForClient = nil
+
+	var out bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&out)
+
+	tests := []struct {
+		serverName string
+		wantLog    string
+	}{
+		{"localhost", ""},
+		{"api.example.com", ""},
+		{"other.example.org", `rejected the TLS handshake from 127.0.0.1:`},
+		{"", "without SNI, -strict-sni only allows localhost, *.example.com"},
+	}
+	for _, tc := range tests {
+		out.Reset()
+		conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), &tls.Config{ServerName: tc.serverName, InsecureSkipVerify: true})
+		if err == nil {
+			conn.Close()
+		}
+		if tc.wantLog == "" {
+			if err != nil {
+				t.Errorf("the handshake for %q failed: %s", tc.serverName, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("the handshake for %q succeeded, want it rejected", tc.serverName)
+			continue
+		}
+		if !strings.Contains(out.String(), tc.wantLog) || !strings.Contains(out.String(), "WARNING: ") {
+			t.Errorf("got the log %q for %q, want a warning including %q", out.String(), tc.serverName, tc.wantLog)
+		}
+		if tc.serverName != "" && !strings.Contains(out.String(), `for SNI "`+tc.serverName+`"`) {
+			t.Errorf("got the log %q, want it to name the rejected server name", out.String())
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/logging"
+	"github.com/youngkin/gohttps/internal/retryafter"
+)
+
+// HeaderFaultInjected is the response header set on responses that are
+// injected faults, see Options.FaultRate.
+const HeaderFaultInjected = "X-Fault-Injected"
+
+// statusHandler serves /status/{code}, which responds with the HTTP status
+// code, between 200 and 599, and its status text as the body, e.g., for
+// testing how clients handle errors. Informational, 1xx, codes can't be the
+// final status of a response so they're rejected.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	code, err := strconv.Atoi(r.PathValue("code"))
+	if err != nil || code < 200 || code > 599 {
+		http.Error(w, fmt.Sprintf("invalid status code %q, it must be between 200 and 599", r.PathValue("code")), http.StatusBadRequest)
+		return
+	}
+	writeStatus(w, code)
+}
+
+// writeStatus writes a response with the status code and, unless the code
+// doesn't allow one, a body of the code and its status text.
+func writeStatus(w http.ResponseWriter, code int) {
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		w.WriteHeader(code)
+		return
+	}
+	text := http.StatusText(code)
+	if text == "" {
+		text = "Unknown Status"
+	}
+	http.Error(w, fmt.Sprintf("%d %s", code, text), code)
+}
+
+// injectFaults returns a handler that responds to rate percent of requests
+// with status, instead of calling next, logging each injected fault, e.g., to
+// exercise clients' retry logic. 503s and 429s have a Retry-After of
+// retryAfter, unless it's 0.
+func injectFaults(rate float64, status int, retryAfter time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64()*100 >= rate {
+			next.ServeHTTP(w, r)
+			return
+		}
+		logging.Warnf("Injected fault: responded with %d to %s %s from %s", status, r.Method, r.URL.Path, r.RemoteAddr)
+		w.Header().Set(HeaderFaultInjected, "true")
+		if retryafter.Applies(status) {
+			retryafter.Set(w.Header(), retryAfter)
+		}
+		writeStatus(w, status)
+	})
+}
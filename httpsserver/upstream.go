@@ -0,0 +1,69 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxUpstreamBody limits the size of the request body forwarded by Upstream.
+const maxUpstreamBody = 1 << 20
+
+// Upstream returns an example handler that forwards each request's method and
+// body to upstreamURL using client, and responds with the upstream's status,
+// content type, and body. It demonstrates propagating a request's deadline,
+// and cancellation, to the calls made while handling it: the outbound request
+// is created with r.Context(), so it's canceled when the request's deadline,
+// e.g., set by advserver's -handler-timeout, passes or the client goes
+// away. If the deadline passes before the upstream responds the response is
+// a 504, if it passes while the body is being copied the response ends
+// early, with a PartialResultHeader trailer. The time left before the
+// deadline when the request arrived is reported in the X-Deadline-Remaining
+// response header.
+func Upstream(client *http.Client, upstreamURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		remaining, hasDeadline := RemainingTime(r)
+		if hasDeadline {
+			w.Header().Set("X-Deadline-Remaining", remaining.Round(time.Millisecond).String())
+		}
+		// The outbound request uses the incoming request's context, this is
+		// what propagates the deadline and cancellation.
+		out, err := http.NewRequestWithContext(ctx, r.Method, upstreamURL, io.LimitReader(r.Body, maxUpstreamBody))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to create the upstream request: %s", err), http.StatusInternalServerError)
+			return
+		}
+		res, err := client.Do(out)
+		if err != nil {
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				http.Error(w, "the request's deadline passed before the upstream responded", http.StatusGatewayTimeout)
+			case errors.Is(err, context.Canceled):
+				// The client went away, there's no one to respond to
+			default:
+				http.Error(w, fmt.Sprintf("upstream request failed: %s", err), http.StatusBadGateway)
+			}
+			return
+		}
+		defer res.Body.Close()
+		if ct := res.Header.Get("Content-Type"); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		if hasDeadline {
+			w.Header().Set("Trailer", PartialResultHeader)
+		}
+		w.WriteHeader(res.StatusCode)
+		n, err := io.Copy(w, res.Body)
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			w.Header().Set(PartialResultHeader, fmt.Sprintf("deadline, %d bytes of the upstream's response", n))
+		}
+	})
+}
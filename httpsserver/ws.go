@@ -0,0 +1,78 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/youngkin/gohttps/internal/logging"
+	"github.com/youngkin/gohttps/internal/srv"
+)
+
+const (
+	// wsIdleTimeout is how long a WebSocket connection may go without
+	// receiving a message before it's closed. It replaces the server's read
+	// timeout, which is meant for individual requests, once the connection
+	// has been upgraded.
+	wsIdleTimeout = 2 * time.Minute
+	// wsWriteTimeout is how long writing each message may take.
+	wsWriteTimeout = 10 * time.Second
+)
+
+// wsEcho serves the /ws WebSocket endpoint, echoing every message it
+// receives. Its connections are registered with longLived, since
+// http.Server.Shutdown doesn't track upgraded connections, and are closed
+// with a going away close message when the server shuts down.
+type wsEcho struct {
+	upgrader  websocket.Upgrader
+	longLived *srv.LongLived
+}
+
+func newWSEcho(longLived *srv.LongLived) *wsEcho {
+	return &wsEcho{longLived: longLived}
+}
+
+func (e *wsEcho) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The upgrade request is an ordinary request on the TLS connection, so the
+	// client's certificate has already been checked as specified by -certopt.
+	// Upgrade responds with an error itself if the request isn't an upgrade.
+	conn, err := e.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logging.Debugf("WebSocket upgrade from %s failed: %s", r.RemoteAddr, err)
+		return
+	}
+	defer conn.Close()
+	ctx, done := e.longLived.Register(r.Context(), func() { conn.Close() })
+	defer done()
+	// When the server starts shutting down the client is sent a going away
+	// close message, the echo loop ends when it responds with its own
+	stop := context.AfterFunc(ctx, func() {
+		if context.Cause(ctx) == srv.ErrShuttingDown {
+			msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout))
+		}
+	})
+	defer stop()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(wsIdleTimeout))
+		kind, msg, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logging.Debugf("WebSocket connection from %s closed: %s", r.RemoteAddr, err)
+			}
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := conn.WriteMessage(kind, msg); err != nil {
+			logging.Debugf("Unable to echo WebSocket message to %s: %s", r.RemoteAddr, err)
+			return
+		}
+	}
+}
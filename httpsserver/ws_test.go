@@ -0,0 +1,155 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package httpsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/youngkin/gohttps/internal/middleware"
+)
+
+// newWSServer returns a server for the routes that requires a client
+// certificate, with the status recorded for each request sent to statuses.
+func newWSServer(t *testing.T, routes *Routes, statuses chan<- int) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := middleware.NewResponseRecorder(w)
+		routes.ServeHTTP(rec, r)
+		statuses <- rec.StatusCode()
+	}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// dialWS opens a WebSocket connection to ts's /ws with the client
+// certificates.
+func dialWS(ts *httptest.Server, certs ...tls.Certificate) (*websocket.Conn, *http.Response, error) {
+	dialer := websocket.Dialer{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, Certificates: certs}}
+	return dialer.Dial("wss"+strings.TrimPrefix(ts.URL, "https")+"/ws", nil)
+}
+
+func TestWSEcho(t *testing.T) {
+	statuses := make(chan int, 10)
+	ts := newWSServer(t, NewRoutes(Options{}), statuses)
+
+	conn, _, err := dialWS(ts, selfSignedCert(t))
+	if err != nil {
+		t.Fatalf("the upgrade failed: %s", err)
+	}
+	defer conn.Close()
+	messages := []struct {
+		kind int
+		msg  string
+	}{
+		{websocket.TextMessage, "hello"},
+		{websocket.BinaryMessage, "\x00\x01\x02"},
+		{websocket.TextMessage, strings.Repeat("gopher ", 10000)},
+	}
+	for _, m := range messages {
+		if err := conn.WriteMessage(m.kind, []byte(m.msg)); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		kind, got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kind != m.kind || string(got) != m.msg {
+			t.Errorf("got the %d byte message of type %d echoed, want the %d byte one of type %d", len(got), kind, len(m.msg), m.kind)
+		}
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	select {
+	case status := <-statuses:
+		if status != http.StatusSwitchingProtocols {
+			t.Errorf("got the recorded status %d, want 101", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler didn't return once the client closed the connection")
+	}
+}
+
+func TestWSEchoRequiresClientCert(t *testing.T) {
+	ts := newWSServer(t, NewRoutes(Options{}), make(chan int, 10))
+	if conn, _, err := dialWS(ts); err == nil {
+		conn.Close()
+		t.Error("the upgrade without a client certificate succeeded")
+	}
+}
+
+func TestWSEchoNotUpgrade(t *testing.T) {
+	statuses := make(chan int, 10)
+	ts := newWSServer(t, NewRoutes(Options{}), statuses)
+	client := ts.Client()
+	client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{selfSignedCert(t)}
+	res, err := client.Get(ts.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("got the status %d for a request that isn't an upgrade, want 400", res.StatusCode)
+	}
+}
+
+func TestWSEchoShutdown(t *testing.T) {
+	routes := NewRoutes(Options{})
+	ts := newWSServer(t, routes, make(chan int, 10))
+	conn, _, err := dialWS(ts, selfSignedCert(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The connection is registered once the echo loop starts
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		routes.Shutdown(ctx)
+	}()
+	// ReadMessage responds to the close message with the client's own
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("got the error %v, want a going away close message", err)
+	}
+	select {
+	case <-shutdown:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the shutdown didn't complete once the client closed the connection")
+	}
+
+	// Connections upgraded after the shutdown started are closed at once
+	late, _, err := dialWS(ts, selfSignedCert(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer late.Close()
+	late.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := late.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("got the error %v on a connection upgraded after the shutdown, want a going away close message", err)
+	}
+}
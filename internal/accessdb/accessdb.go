@@ -0,0 +1,223 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package accessdb records the server's access log in a SQLite database so it
+// can be queried, e.g., to find which client certificates accessed which
+// routes. Records are written in batches by a background goroutine so
+// requests aren't slowed down by the database.
+package accessdb
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/logging"
+	"github.com/youngkin/gohttps/internal/middleware"
+
+	// Registers the cgo free "sqlite" database/sql driver
+	_ "modernc.org/sqlite"
+)
+
+const (
+	// queueSize is the number of records buffered for the writer. Records are
+	// dropped, rather than delaying requests, if it's full.
+	queueSize = 1024
+	// batchSize and flushInterval bound how many records are written in one
+	// transaction and how long a record waits to be written.
+	batchSize     = 100
+	flushInterval = time.Second
+)
+
+const schema = `CREATE TABLE IF NOT EXISTS access_log (
+	timestamp   TEXT NOT NULL,
+	method      TEXT NOT NULL,
+	path        TEXT NOT NULL,
+	status      INTEGER NOT NULL,
+	latency_ms  REAL NOT NULL,
+	bytes       INTEGER NOT NULL,
+	remote_ip   TEXT NOT NULL,
+	client_cn   TEXT NOT NULL,
+	tls_version TEXT NOT NULL,
+	request_id  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS access_log_timestamp ON access_log (timestamp);`
+
+// Record is a single access log entry.
+type Record struct {
+	Time       time.Time
+	Method     string
+	Path       string
+	Status     int
+	Latency    time.Duration
+	Bytes      int64
+	RemoteIP   string
+	ClientCN   string
+	TLSVersion string
+	// RequestID is the value of the request's X-Request-Id header, if any.
+	RequestID string
+}
+
+// DB writes records to the access_log table of a SQLite database. A nil *DB
+// discards records, so callers don't need to check whether it's enabled.
+type DB struct {
+	db      *sql.DB
+	records chan Record
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+// Open opens, creating if necessary, the database at path and starts the
+// background writer. If retention is greater than 0 records older than
+// retention are deleted first.
+func Open(path string, retention time.Duration) (*DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open access database %s: %w", path, err)
+	}
+	// SQLite allows only one writer at a time
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to create the access_log table in %s: %w", path, err)
+	}
+	if retention > 0 {
+		cutoff := time.Now().Add(-retention).UTC().Format(time.RFC3339Nano)
+		res, err := db.Exec("DELETE FROM access_log WHERE timestamp < ?", cutoff)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("unable to prune the access database %s: %w", path, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			log.Printf("Pruned %d access database records older than %s", n, retention)
+		}
+	}
+
+	d := &DB{db: db, records: make(chan Record, queueSize), done: make(chan struct{})}
+	go d.write()
+	return d, nil
+}
+
+// Add queues r to be written. If the queue is full r is dropped.
+func (d *DB) Add(r Record) {
+	if d == nil {
+		return
+	}
+	select {
+	case d.records <- r:
+	default:
+		if d.dropped.Add(1) == 1 {
+			logging.Warnf("The access database writer is falling behind, records are being dropped")
+		}
+	}
+}
+
+// Close writes any queued records and closes the database. Add must not be
+// called after Close.
+func (d *DB) Close() error {
+	if d == nil {
+		return nil
+	}
+	close(d.records)
+	<-d.done
+	if n := d.dropped.Load(); n > 0 {
+		logging.Warnf("%d access database records were dropped", n)
+	}
+	return d.db.Close()
+}
+
+// Handler returns a handler that calls next and then adds a record of the
+// request. If d is nil it returns next.
+func (d *DB) Handler(next http.Handler) http.Handler {
+	if d == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := middleware.NewResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remoteIP = r.RemoteAddr
+		}
+		record := Record{
+			Time:      start,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Status:    rec.StatusCode(),
+			Latency:   time.Since(start),
+			Bytes:     rec.Bytes,
+			RemoteIP:  remoteIP,
+			RequestID: r.Header.Get("X-Request-Id"),
+		}
+		if r.TLS != nil {
+			record.TLSVersion = tls.VersionName(r.TLS.Version)
+			if len(r.TLS.PeerCertificates) > 0 {
+				record.ClientCN = r.TLS.PeerCertificates[0].Subject.CommonName
+			}
+		}
+		d.Add(record)
+	})
+}
+
+// write writes the queued records in batches until the queue is closed.
+func (d *DB) write() {
+	defer close(d.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Record, 0, batchSize)
+	for {
+		select {
+		case r, ok := <-d.records:
+			if !ok {
+				d.insert(batch)
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		d.insert(batch)
+		batch = batch[:0]
+	}
+}
+
+func (d *DB) insert(batch []Record) {
+	if len(batch) == 0 {
+		return
+	}
+	err := func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		stmt, err := tx.Prepare(`INSERT INTO access_log (timestamp, method, path, status, latency_ms, bytes, remote_ip, client_cn, tls_version, request_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, r := range batch {
+			_, err := stmt.Exec(r.Time.UTC().Format(time.RFC3339Nano), r.Method, r.Path, r.Status,
+				float64(r.Latency)/float64(time.Millisecond), r.Bytes, r.RemoteIP, r.ClientCN, r.TLSVersion, r.RequestID)
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		logging.Errorf("Unable to write %d records to the access database: %s", len(batch), err)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package accessdb
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+var teapot = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusTeapot)
+	w.Write([]byte("short and stout"))
+})
+
+func TestNilDB(t *testing.T) {
+	var d *DB
+	// The handler isn't wrapped, so nothing is recorded
+	h := d.Handler(teapot)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("got the status %d from a nil DB's handler, want next's %d", w.Code, http.StatusTeapot)
+	}
+	d.Add(Record{Path: "/"})
+	if err := d.Close(); err != nil {
+		t.Errorf("closing a nil DB returned %s", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.db")
+	d, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/items", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Request-Id", "abc")
+	d.Handler(teapot).ServeHTTP(httptest.NewRecorder(), r)
+	// Close writes the queued record
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var method, urlPath, remoteIP, requestID string
+	var status, bytes int
+	err = db.QueryRow("SELECT method, path, status, bytes, remote_ip, request_id FROM access_log").
+		Scan(&method, &urlPath, &status, &bytes, &remoteIP, &requestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPost || urlPath != "/items" || status != http.StatusTeapot || bytes != len("short and stout") ||
+		remoteIP != "192.0.2.1" || requestID != "abc" {
+		t.Errorf("got the record %s %s %d %d %s %s, want POST /items 418 15 192.0.2.1 abc", method, urlPath, status, bytes, remoteIP, requestID)
+	}
+}
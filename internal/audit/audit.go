@@ -0,0 +1,197 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package audit writes an append-only log of the server's authentication
+// decisions. The audit log is separate from, and unaffected by the
+// configuration of, the server's regular log output.
+package audit
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes of an authentication decision.
+const (
+	Accepted = "accepted"
+	Rejected = "rejected"
+)
+
+// Reasons a client certificate was rejected.
+const (
+	ReasonExpired          = "expired"
+	ReasonUnknownAuthority = "unknown_authority"
+	ReasonMissing          = "missing"
+	ReasonInvalid          = "invalid"
+)
+
+// EventClientCert is the type of events recording client certificate decisions.
+const EventClientCert = "client_cert"
+
+// Event is a single audit log entry, written as one line of JSON.
+type Event struct {
+	// Seq is a sequence number that increases by one on every event, gaps
+	// indicate lost events.
+	Seq        uint64    `json:"seq"`
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	Outcome    string    `json:"outcome"`
+	Reason     string    `json:"reason,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	CN         string    `json:"cn,omitempty"`
+	Serial     string    `json:"serial,omitempty"`
+	Issuer     string    `json:"issuer,omitempty"`
+}
+
+// Logger writes events to an audit log file. A nil *Logger discards events,
+// so callers don't need to check whether auditing is enabled.
+type Logger struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	seq uint64
+}
+
+// Open opens, creating if necessary, the audit log file at path for appending.
+func Open(path string) (*Logger, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audit log %s: %w", path, err)
+	}
+	return &Logger{w: f}, nil
+}
+
+// Log writes e to the audit log, setting its sequence number and time. Each
+// event is written with a single unbuffered write so nothing is lost if the
+// server exits.
+func (l *Logger) Log(e Event) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	e.Seq = l.seq
+	e.Time = time.Now().UTC()
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Unable to encode audit event: %s", err)
+		return
+	}
+	if _, err := l.w.Write(append(b, '\n')); err != nil {
+		log.Printf("Unable to write audit event: %s", err)
+	}
+}
+
+// Close closes the audit log file.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.w.Close()
+}
+
+// WrapConfigForClient returns a tls.Config.GetConfigForClient function that
+// returns the configs created by getConfig, modified to log an accepted event
+// for each client certificate that passes verification. getConfig must not be
+// nil. Rejections are logged by the *log.Logger returned from ErrorLog instead,
+// because crypto/tls aborts the handshake before any callback sees them. If l
+// is nil the configs are returned unmodified.
+func (l *Logger) WrapConfigForClient(getConfig func(*tls.ClientHelloInfo) (*tls.Config, error)) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg, err := getConfig(hello)
+		if err != nil || cfg == nil || l == nil {
+			return cfg, err
+		}
+		remoteAddr := hello.Conn.RemoteAddr().String()
+		cfg = cfg.Clone()
+		verify := cfg.VerifyConnection
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(cs); err != nil {
+					return err
+				}
+			}
+			if len(cs.PeerCertificates) == 0 {
+				return nil
+			}
+			leaf := cs.PeerCertificates[0]
+			l.Log(Event{
+				Type:       EventClientCert,
+				Outcome:    Accepted,
+				RemoteAddr: remoteAddr,
+				CN:         leaf.Subject.CommonName,
+				Serial:     leaf.SerialNumber.Text(16),
+				Issuer:     leaf.Issuer.CommonName,
+			})
+			return nil
+		}
+		return cfg, nil
+	}
+}
+
+var handshakeErr = regexp.MustCompile(`TLS handshake error from (\S+): (.*)$`)
+
+// ErrorLog returns a *log.Logger, for use as http.Server.ErrorLog, that writes
+// to out as usual, using the standard logger's flags, and also logs a rejected
+// event for each TLS handshake failure caused by the client's certificate. If
+// l is nil it only writes to out.
+func (l *Logger) ErrorLog(out io.Writer) *log.Logger {
+	return log.New(&errorLogWriter{audit: l, out: out}, "", log.Flags())
+}
+
+type errorLogWriter struct {
+	audit *Logger
+	out   io.Writer
+}
+
+func (w *errorLogWriter) Write(p []byte) (int, error) {
+	m := handshakeErr.FindSubmatch(bytes.TrimSpace(p))
+	if m != nil {
+		if reason, ok := rejectionReason(string(m[2])); ok {
+			w.audit.Log(Event{
+				Type:       EventClientCert,
+				Outcome:    Rejected,
+				Reason:     reason,
+				Detail:     string(m[2]),
+				RemoteAddr: string(m[1]),
+			})
+		}
+	}
+	return w.out.Write(p)
+}
+
+// rejectionReason classifies a handshake error message, returning false if
+// the error isn't the server rejecting the client's certificate. Remote
+// errors, e.g., 'remote error: tls: bad certificate', are alerts sent by the
+// client, usually because it rejected the server's certificate, so they
+// aren't.
+func rejectionReason(msg string) (string, bool) {
+	switch {
+	case strings.Contains(msg, "remote error"):
+		return "", false
+	case strings.Contains(msg, "didn't provide a certificate"):
+		return ReasonMissing, true
+	case !strings.Contains(msg, "failed to verify certificate") && !strings.Contains(msg, "client certificate"):
+		// Only the server's verification of the client's certificate, and
+		// its parsing and signature checks, e.g., 'tls: failed to parse
+		// client certificate', are rejections
+		return "", false
+	case strings.Contains(msg, "expired or is not yet valid"):
+		return ReasonExpired, true
+	case strings.Contains(msg, "unknown authority"):
+		return ReasonUnknownAuthority, true
+	}
+	return ReasonInvalid, true
+}
@@ -0,0 +1,299 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a concurrency safe buffer, the audit log's file.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) Close() error { return nil }
+
+func (b *syncBuffer) events(t *testing.T) []Event {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSpace(b.b.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid audit event %q: %s", line, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// lineSignal is the server's regular error log output, it signals each line
+// written, which is after the line's audit event, if any, is logged.
+type lineSignal chan string
+
+func (s lineSignal) Write(p []byte) (int, error) {
+	s <- string(p)
+	return len(p), nil
+}
+
+// testCA is a CA that issues client certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T, cn string) testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCA{cert, key}
+}
+
+// issue returns a client certificate for cn, valid until notAfter.
+func (ca testCA) issue(t *testing.T, cn string, notAfter time.Time) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(0xbeef),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-2 * time.Hour),
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newServer returns a server that requires client certificates issued by ca,
+// auditing its decisions to the returned buffer. lines receives each line of
+// its error log.
+func newServer(t *testing.T, ca testCA) (*httptest.Server, *syncBuffer, lineSignal) {
+	t.Helper()
+	buf := &syncBuffer{}
+	l := &Logger{w: buf}
+	lines := make(lineSignal, 10)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ErrorLog = l.ErrorLog(lines)
+	var cfg *tls.Config
+	ts.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		GetConfigForClient: l.WrapConfigForClient(func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return cfg, nil
+		}),
+	}
+	ts.StartTLS()
+	cfg = ts.TLS.Clone()
+	cfg.GetConfigForClient = nil
+	t.Cleanup(ts.Close)
+	return ts, buf, lines
+}
+
+// request sends a request to ts using cfg, returning whether it succeeded.
+func request(ts *httptest.Server, cfg *tls.Config) bool {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}, Timeout: 5 * time.Second}
+	defer client.CloseIdleConnections()
+	res, err := client.Get(ts.URL)
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return true
+}
+
+// waitForLine waits for the server to log a handshake error.
+func waitForLine(t *testing.T, lines lineSignal) string {
+	t.Helper()
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server didn't log the handshake error")
+	}
+	return ""
+}
+
+func TestWrongCAProducesOneEvent(t *testing.T) {
+	trusted := newCA(t, "Trusted CA")
+	ts, buf, lines := newServer(t, trusted)
+
+	// A certificate with the trusted CA's name, issued by another CA, i.e., a
+	// forged issuer
+	forged := newCA(t, "Trusted CA")
+	cert := forged.issue(t, "mallory", time.Now().Add(time.Hour))
+	if request(ts, &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{cert}}) {
+		t.Fatal("the request with a certificate from the wrong CA succeeded")
+	}
+	line := waitForLine(t, lines)
+
+	// Give any other path that could audit the handshake time to do so
+	time.Sleep(100 * time.Millisecond)
+	events := buf.events(t)
+	if len(events) != 1 {
+		t.Fatalf("got %d audit events, want exactly 1: %+v (error log %q)", len(events), events, line)
+	}
+	e := events[0]
+	if e.Type != EventClientCert || e.Outcome != Rejected || e.Reason != ReasonUnknownAuthority {
+		t.Errorf("got the event %+v, want a client_cert rejection for an unknown authority", e)
+	}
+	if e.Seq != 1 || e.RemoteAddr == "" || e.Detail == "" || e.Time.IsZero() {
+		t.Errorf("got the event %+v, want sequence number 1, a remote address, detail, and time", e)
+	}
+}
+
+func TestAcceptedAndRejectedEvents(t *testing.T) {
+	ca := newCA(t, "Test CA")
+	ts, buf, lines := newServer(t, ca)
+
+	valid := ca.issue(t, "alice", time.Now().Add(time.Hour))
+	if !request(ts, &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{valid}}) {
+		t.Fatal("the request with a valid certificate failed")
+	}
+	expired := ca.issue(t, "bob", time.Now().Add(-time.Hour))
+	request(ts, &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{expired}})
+	waitForLine(t, lines)
+	request(ts, &tls.Config{InsecureSkipVerify: true})
+	waitForLine(t, lines)
+
+	events := buf.events(t)
+	if len(events) != 3 {
+		t.Fatalf("got %d audit events, want 3: %+v", len(events), events)
+	}
+	want := []struct{ outcome, reason, cn string }{
+		{Accepted, "", "alice"},
+		{Rejected, ReasonExpired, ""},
+		{Rejected, ReasonMissing, ""},
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.Outcome != w.outcome || e.Reason != w.reason || e.CN != w.cn || e.Seq != uint64(i+1) {
+			t.Errorf("got event %d %+v, want the outcome %q, reason %q, CN %q, and sequence number %d", i+1, e, w.outcome, w.reason, w.cn, i+1)
+		}
+	}
+	if events[0].Serial != "beef" || events[0].Issuer != "Test CA" {
+		t.Errorf("got the serial %q and issuer %q, want beef and Test CA", events[0].Serial, events[0].Issuer)
+	}
+}
+
+func TestClientRejectingServerIsNotAudited(t *testing.T) {
+	ca := newCA(t, "Test CA")
+	ts, buf, lines := newServer(t, ca)
+
+	// The client doesn't trust the server's certificate, and tells it so
+	cert := ca.issue(t, "alice", time.Now().Add(time.Hour))
+	if request(ts, &tls.Config{RootCAs: x509.NewCertPool(), Certificates: []tls.Certificate{cert}}) {
+		t.Fatal("the request to an untrusted server succeeded")
+	}
+	line := waitForLine(t, lines)
+	if !strings.Contains(line, "remote error") {
+		t.Fatalf("got the error %q, want a remote error", line)
+	}
+	if events := buf.events(t); len(events) != 0 {
+		t.Errorf("got the audit events %+v for the client rejecting the server, want none", events)
+	}
+}
+
+func TestRejectionReason(t *testing.T) {
+	tests := []struct {
+		msg    string
+		reason string
+		ok     bool
+	}{
+		{"tls: client didn't provide a certificate", ReasonMissing, true},
+		{"tls: failed to verify certificate: x509: certificate has expired or is not yet valid: current time is after", ReasonExpired, true},
+		{"tls: failed to verify certificate: x509: certificate signed by unknown authority", ReasonUnknownAuthority, true},
+		{"tls: failed to verify certificate: x509: certificate specifies an incompatible key usage", ReasonInvalid, true},
+		{"tls: failed to parse client certificate: x509: malformed certificate", ReasonInvalid, true},
+		{"tls: invalid signature by the client certificate: ECDSA verification failure", ReasonInvalid, true},
+		{"remote error: tls: bad certificate", "", false},
+		{"remote error: tls: unknown certificate authority", "", false},
+		{"remote error: tls: certificate expired", "", false},
+		{"tls: no certificates configured", "", false},
+		{"tls: client offered only unsupported versions: [303]", "", false},
+		{"EOF", "", false},
+	}
+	for _, tc := range tests {
+		reason, ok := rejectionReason(tc.msg)
+		if reason != tc.reason || ok != tc.ok {
+			t.Errorf("rejectionReason(%q) = %q, %t, want %q, %t", tc.msg, reason, ok, tc.reason, tc.ok)
+		}
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	l.Log(Event{Type: EventClientCert})
+	if err := l.Close(); err != nil {
+		t.Errorf("closing a nil Logger returned %s", err)
+	}
+
+	// The configs are returned as they are, without the accepted events'
+	// VerifyConnection
+	cfg := &tls.Config{}
+	getConfig := l.WrapConfigForClient(func(*tls.ClientHelloInfo) (*tls.Config, error) { return cfg, nil })
+	if got, err := getConfig(&tls.ClientHelloInfo{}); got != cfg || err != nil || got.VerifyConnection != nil {
+		t.Errorf("got the config %p, error %v, from a nil Logger's GetConfigForClient, want %p unmodified", got, err, cfg)
+	}
+
+	// Handshake errors are only written to the server's error log
+	var out bytes.Buffer
+	l.ErrorLog(&out).Print("http: TLS handshake error from 127.0.0.1:1234: tls: failed to verify certificate: x509: certificate signed by unknown authority")
+	if !strings.Contains(out.String(), "TLS handshake error from 127.0.0.1:1234") {
+		t.Errorf("got the error log %q from a nil Logger, want the handshake error", out.String())
+	}
+}
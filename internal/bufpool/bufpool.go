@@ -0,0 +1,35 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package bufpool provides a pool of byte buffers used to build response
+// bodies without allocating new buffers for every request.
+package bufpool
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxSize is the capacity above which buffers aren't returned to the pool, so
+// an occasional large response doesn't pin a large buffer in memory.
+const maxSize = 64 * 1024
+
+var pool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// Get returns an empty buffer from the pool. It must be returned with Put
+// once it's no longer used, and must not be used after that.
+func Get() *bytes.Buffer {
+	return pool.Get().(*bytes.Buffer)
+}
+
+// Put resets b and returns it to the pool.
+func Put(b *bytes.Buffer) {
+	if b.Cap() > maxSize {
+		return
+	}
+	b.Reset()
+	pool.Put(b)
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bufpool
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestGetReturnsEmptyBuffer(t *testing.T) {
+	b := Get()
+	b.WriteString("left over")
+	Put(b)
+	for i := 0; i < 10; i++ {
+		b := Get()
+		if b.Len() != 0 {
+			t.Fatalf("got a buffer holding %q, want an empty one", b)
+		}
+		Put(b)
+	}
+}
+
+func TestPutDropsLargeBuffers(t *testing.T) {
+	large := bytes.NewBuffer(make([]byte, 0, maxSize+1))
+	Put(large)
+	for i := 0; i < 10; i++ {
+		if b := Get(); b == large {
+			t.Fatal("got the buffer larger than maxSize back from the pool")
+		}
+	}
+}
+
+// TestConcurrentUse checks that a buffer is never handed to two users at
+// once: each writes its own content, yields, and checks it's unchanged.
+func TestConcurrentUse(t *testing.T) {
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for g := 0; g < 64; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				want := fmt.Sprintf("goroutine %d, iteration %d, %s", g, i, bytes.Repeat([]byte{'x'}, (g*i)%512))
+				b := Get()
+				b.WriteString(want)
+				runtime.Gosched()
+				if got := b.String(); got != want {
+					errs <- fmt.Errorf("got %q in the buffer, want %q, it was shared", got, want)
+					return
+				}
+				Put(b)
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
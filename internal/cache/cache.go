@@ -0,0 +1,334 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package cache is an in-memory LRU cache of GET responses, used by advserver
+// to serve repeated requests for responses that are expensive to produce,
+// e.g., large /bytes responses, without calling their handlers:
+//
+//	c := cache.New(cache.Config{TTL: time.Minute, MaxEntries: 1000})
+//	srv := &http.Server{Handler: c.Handler(h)}
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxBodySize is the size of the largest response body cached, by
+// default.
+const DefaultMaxBodySize = 1 << 20
+
+// HeaderCache is the response header saying whether the response was served
+// from the cache, HIT, or by the handler, MISS.
+const HeaderCache = "X-Cache"
+
+// keyHeaders are the request headers, besides the method, path, and query,
+// that responses are commonly varied by and so are part of the cache key.
+var keyHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language"}
+
+// Config configures a Cache.
+type Config struct {
+	// TTL is how long responses are cached for.
+	TTL time.Duration
+	// MaxEntries is the maximum number of responses cached, once it's reached
+	// the least recently used response is evicted.
+	MaxEntries int
+	// MaxBodySize is the size of the largest response body cached, defaults
+	// to DefaultMaxBodySize.
+	MaxBodySize int
+	// Authenticated allows caching the responses to requests with a client
+	// certificate, separately for each certificate so one client's response
+	// is never served to another. By default they aren't cached.
+	Authenticated bool
+	// Exclude are the path prefixes of routes that are never cached, e.g.,
+	// those that stream their responses or report the server's state.
+	Exclude []string
+}
+
+// Cache caches the responses of the handlers wrapped by Handler. It's safe
+// for concurrent use.
+type Cache struct {
+	cfg Config
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // of *entry, most recently used first
+	pending map[string]*fill
+
+	hits, misses atomic.Uint64
+}
+
+// entry is a cached response.
+type entry struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// fill is a request being handled for a key that isn't cached. Requests for
+// the same key wait for it rather than calling the handler too, so a burst
+// of requests for a cold key only calls the handler once.
+type fill struct {
+	done  chan struct{}
+	entry *entry // nil if the response couldn't be cached
+}
+
+// New returns a Cache configured by cfg.
+func New(cfg Config) *Cache {
+	if cfg.MaxBodySize == 0 {
+		cfg.MaxBodySize = DefaultMaxBodySize
+	}
+	return &Cache{cfg: cfg, entries: map[string]*list.Element{}, lru: list.New(), pending: map[string]*fill{}}
+}
+
+// Hits returns the number of requests served from the cache.
+func (c *Cache) Hits() uint64 {
+	return c.hits.Load()
+}
+
+// Misses returns the number of cacheable requests that weren't in the cache.
+func (c *Cache) Misses() uint64 {
+	return c.misses.Load()
+}
+
+// Len returns the number of cached responses, including expired ones that
+// haven't been requested since they expired.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Handler returns a handler that serves cached responses, with an X-Cache:
+// HIT header and their Age, and otherwise calls next, caching its response
+// if possible. Only GET requests without a body or Range header are cached,
+// and only 200 responses, without Set-Cookie, a Vary header naming headers
+// other than those the cache is keyed by, or Cache-Control: no-store,
+// private, or no-cache, whose body is at most MaxBodySize bytes.
+func (c *Cache) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := c.key(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		for {
+			c.mu.Lock()
+			if e := c.lookup(key); e != nil {
+				c.mu.Unlock()
+				c.hits.Add(1)
+				serve(w, e)
+				return
+			}
+			f, filling := c.pending[key]
+			if !filling {
+				f = &fill{done: make(chan struct{})}
+				c.pending[key] = f
+				c.mu.Unlock()
+				break
+			}
+			c.mu.Unlock()
+
+			select {
+			case <-f.done:
+			case <-r.Context().Done():
+				return
+			}
+			if f.entry == nil {
+				// The response couldn't be cached, so it's not shared either
+				c.misses.Add(1)
+				w.Header().Set(HeaderCache, "MISS")
+				next.ServeHTTP(w, r)
+				return
+			}
+			// Loop to look the entry up, rather than serving f.entry, in
+			// case it was evicted or expired in the meantime
+		}
+
+		c.misses.Add(1)
+		w.Header().Set(HeaderCache, "MISS")
+		rec := &recorder{ResponseWriter: w, max: c.cfg.MaxBodySize}
+		var e *entry
+		defer func() {
+			// Waiters must be released even if next panics
+			c.mu.Lock()
+			f := c.pending[key]
+			delete(c.pending, key)
+			c.mu.Unlock()
+			f.entry = e
+			close(f.done)
+		}()
+		next.ServeHTTP(rec, r)
+		e = c.store(key, rec)
+	})
+}
+
+// key returns the cache key of r, and false if r's response can't be cached.
+func (c *Cache) key(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet || r.ContentLength != 0 || r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+		return "", false
+	}
+	for _, prefix := range c.cfg.Exclude {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return "", false
+		}
+	}
+	var b strings.Builder
+	b.WriteString(r.Method + " " + r.Host + " " + r.URL.RequestURI())
+	for _, name := range keyHeaders {
+		b.WriteString("\n" + name + ": " + strings.Join(r.Header.Values(name), ", "))
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		if !c.cfg.Authenticated {
+			return "", false
+		}
+		sum := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+		b.Write(append([]byte("\nclient: "), sum[:]...))
+	}
+	return b.String(), true
+}
+
+// lookup returns the unexpired entry for key, if any, marking it as the most
+// recently used. It must be called with mu held.
+func (c *Cache) lookup(key string) *entry {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := elem.Value.(*entry)
+	if time.Now().After(e.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return e
+}
+
+// store caches the response recorded by rec for key, if it's cacheable,
+// evicting the least recently used entries if the cache is full, and returns
+// the new entry, or nil if the response wasn't cached.
+func (c *Cache) store(key string, rec *recorder) *entry {
+	if !rec.cacheable() {
+		return nil
+	}
+	now := time.Now()
+	e := &entry{key: key, status: rec.status, header: rec.header, body: rec.body.Bytes(), stored: now, expires: now.Add(c.cfg.TTL)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.lru.Remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.cfg.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+	}
+	return e
+}
+
+// serve writes the cached response e to w.
+func serve(w http.ResponseWriter, e *entry) {
+	h := w.Header()
+	for name, values := range e.header {
+		h[name] = values
+	}
+	h.Set(HeaderCache, "HIT")
+	h.Set("Age", strconv.Itoa(int(time.Since(e.stored).Seconds())))
+	h.Set("Content-Length", strconv.Itoa(len(e.body)))
+	w.WriteHeader(e.status)
+	w.Write(e.body)
+}
+
+// recorder passes a response through to the wrapped http.ResponseWriter
+// while keeping a copy of it, up to max body bytes, for the cache.
+type recorder struct {
+	http.ResponseWriter
+	max    int
+	status int
+	header http.Header
+	body   bytes.Buffer
+	// failed is true if the body was too large to cache or couldn't be
+	// written in full, e.g., because the client went away.
+	failed bool
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+		r.header = r.ResponseWriter.Header().Clone()
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	n, err := r.ResponseWriter.Write(b)
+	switch {
+	case r.failed:
+	case err != nil || r.body.Len()+n > r.max:
+		r.failed = true
+		r.body = bytes.Buffer{}
+	default:
+		r.body.Write(b[:n])
+	}
+	return n, err
+}
+
+// Flush flushes the wrapped http.ResponseWriter if it supports flushing.
+func (r *recorder) Flush() {
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, for use by
+// http.ResponseController.
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// cacheable returns true if the recorded response may be cached.
+func (r *recorder) cacheable() bool {
+	if r.status != http.StatusOK || r.failed || r.header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, directive := range strings.Split(r.header.Get("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-store", "private", "no-cache":
+			return false
+		}
+	}
+	for _, vary := range r.header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			if !isKeyHeader(strings.TrimSpace(name)) {
+				return false
+			}
+		}
+	}
+	r.header.Del(HeaderCache)
+	return true
+}
+
+func isKeyHeader(name string) bool {
+	for _, h := range keyHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,306 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// counter is a handler that counts its calls, responding with the request's
+// path and the headers set by header.
+type counter struct {
+	calls  atomic.Int32
+	header http.Header
+	status int
+}
+
+func (h *counter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls.Add(1)
+	for name, values := range h.header {
+		w.Header()[name] = values
+	}
+	if h.status != 0 {
+		w.WriteHeader(h.status)
+	}
+	w.Write([]byte("response to " + r.URL.RequestURI()))
+}
+
+// get sends a request for target, modified by modify if it isn't nil, to h.
+func get(h http.Handler, target string, modify func(r *http.Request)) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if modify != nil {
+		modify(r)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestCache(t *testing.T) {
+	c := New(Config{TTL: time.Minute, MaxEntries: 10})
+	next := &counter{header: http.Header{"Content-Type": {"text/plain"}}}
+	h := c.Handler(next)
+
+	miss := get(h, "/bytes/100", nil)
+	if miss.Header().Get(HeaderCache) != "MISS" {
+		t.Errorf("got %s %q for the first request, want MISS", HeaderCache, miss.Header().Get(HeaderCache))
+	}
+	hit := get(h, "/bytes/100", nil)
+	if hit.Header().Get(HeaderCache) != "HIT" || hit.Header().Get("Age") != "0" {
+		t.Errorf("got %s %q and Age %q for the second request, want HIT and 0", HeaderCache, hit.Header().Get(HeaderCache), hit.Header().Get("Age"))
+	}
+	if hit.Code != http.StatusOK || hit.Body.String() != miss.Body.String() || hit.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("got the cached response %d %v %q, want the handler's", hit.Code, hit.Header(), hit.Body)
+	}
+	if n := next.calls.Load(); n != 1 {
+		t.Errorf("got %d handler calls, want 1", n)
+	}
+	if c.Hits() != 1 || c.Misses() != 1 || c.Len() != 1 {
+		t.Errorf("got %d hits, %d misses, and %d entries, want 1 of each", c.Hits(), c.Misses(), c.Len())
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	c := New(Config{TTL: time.Minute, MaxEntries: 10, Exclude: []string{"/metrics"}})
+	next := &counter{}
+	h := c.Handler(next)
+
+	tests := []struct {
+		name   string
+		target string
+		modify func(r *http.Request)
+		cached bool
+	}{
+		{"query", "/?a=1", nil, true},
+		{"Accept", "/", func(r *http.Request) { r.Header.Set("Accept", "text/html") }, true},
+		{"Host", "/", func(r *http.Request) { r.Host = "other.example.com" }, true},
+		{"HEAD", "/", func(r *http.Request) { r.Method = http.MethodHead }, false},
+		{"body", "/", func(r *http.Request) { r.ContentLength = 1 }, false},
+		{"Range", "/", func(r *http.Request) { r.Header.Set("Range", "bytes=0-1") }, false},
+		{"Upgrade", "/", func(r *http.Request) { r.Header.Set("Upgrade", "websocket") }, false},
+		{"excluded", "/metrics", nil, false},
+	}
+	get(h, "/", nil)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Each request is a miss, it's different from the cached one,
+			// and is a hit when repeated if it's cacheable
+			calls := next.calls.Load()
+			get(h, tc.target, tc.modify)
+			res := get(h, tc.target, tc.modify)
+			if got := next.calls.Load() - calls; got != map[bool]int32{true: 1, false: 2}[tc.cached] {
+				t.Errorf("got %d handler calls for 2 requests, want the response cached %v", got, tc.cached)
+			}
+			if !tc.cached && res.Header().Get(HeaderCache) != "" {
+				t.Errorf("got %s %q for a request that isn't cacheable, want none", HeaderCache, res.Header().Get(HeaderCache))
+			}
+		})
+	}
+}
+
+func TestCacheNotCacheable(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		cached bool
+	}{
+		{"404", http.StatusNotFound, nil, false},
+		{"Set-Cookie", 0, http.Header{"Set-Cookie": {"session=1"}}, false},
+		{"no-store", 0, http.Header{"Cache-Control": {"max-age=60, No-Store"}}, false},
+		{"private", 0, http.Header{"Cache-Control": {"private"}}, false},
+		{"no-cache", 0, http.Header{"Cache-Control": {"no-cache"}}, false},
+		{"Vary: Cookie", 0, http.Header{"Vary": {"Accept, Cookie"}}, false},
+		{"Vary: Accept-Encoding", 0, http.Header{"Vary": {"accept-encoding"}}, true},
+		{"max-age", 0, http.Header{"Cache-Control": {"max-age=60"}}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := New(Config{TTL: time.Minute, MaxEntries: 10})
+			next := &counter{header: tc.header, status: tc.status}
+			h := c.Handler(next)
+			get(h, "/", nil)
+			get(h, "/", nil)
+			if cached := next.calls.Load() == 1; cached != tc.cached {
+				t.Errorf("got the response cached %v, want %v", cached, tc.cached)
+			}
+		})
+	}
+}
+
+func TestCacheMaxBodySize(t *testing.T) {
+	c := New(Config{TTL: time.Minute, MaxEntries: 10, MaxBodySize: 16})
+	next := &counter{}
+	h := c.Handler(next)
+	for _, target := range []string{"/short", "/a-longer-path"} {
+		get(h, target, nil)
+		res := get(h, target, nil)
+		// "response to /short" is 18 bytes, both are too large
+		if res.Body.String() != "response to "+target {
+			t.Errorf("got the body %q, want the whole response", res.Body)
+		}
+	}
+	if n := next.calls.Load(); n != 4 || c.Len() != 0 {
+		t.Errorf("got %d handler calls and %d entries, want 4 and none cached", n, c.Len())
+	}
+
+	c = New(Config{TTL: time.Minute, MaxEntries: 10, MaxBodySize: 18})
+	next = &counter{}
+	h = c.Handler(next)
+	get(h, "/short", nil)
+	get(h, "/short", nil)
+	if n := next.calls.Load(); n != 1 {
+		t.Errorf("got %d handler calls for a response of MaxBodySize, want 1", n)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := New(Config{TTL: 20 * time.Millisecond, MaxEntries: 10})
+	next := &counter{}
+	h := c.Handler(next)
+	get(h, "/", nil)
+	time.Sleep(40 * time.Millisecond)
+	if res := get(h, "/", nil); res.Header().Get(HeaderCache) != "MISS" {
+		t.Errorf("got %s %q after the TTL, want MISS", HeaderCache, res.Header().Get(HeaderCache))
+	}
+	if n := next.calls.Load(); n != 2 || c.Len() != 1 {
+		t.Errorf("got %d handler calls and %d entries, want 2 and the expired entry replaced", n, c.Len())
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New(Config{TTL: time.Minute, MaxEntries: 2})
+	next := &counter{}
+	h := c.Handler(next)
+	get(h, "/a", nil)
+	get(h, "/b", nil)
+	get(h, "/a", nil) // /b is now the least recently used
+	get(h, "/c", nil)
+	if c.Len() != 2 {
+		t.Errorf("got %d entries, want 2", c.Len())
+	}
+	for _, tc := range []struct{ target, want string }{{"/a", "HIT"}, {"/c", "HIT"}, {"/b", "MISS"}} {
+		if got := get(h, tc.target, nil).Header().Get(HeaderCache); got != tc.want {
+			t.Errorf("got %s %q for %s, want %s", HeaderCache, got, tc.target, tc.want)
+		}
+	}
+}
+
+func TestCacheAuthenticated(t *testing.T) {
+	withCert := func(raw string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Raw: []byte(raw)}}}
+		}
+	}
+
+	c := New(Config{TTL: time.Minute, MaxEntries: 10})
+	next := &counter{}
+	h := c.Handler(next)
+	get(h, "/", withCert("client 1"))
+	get(h, "/", withCert("client 1"))
+	if n := next.calls.Load(); n != 2 {
+		t.Errorf("got %d handler calls for authenticated requests, want them not cached", n)
+	}
+
+	c = New(Config{TTL: time.Minute, MaxEntries: 10, Authenticated: true})
+	next = &counter{}
+	h = c.Handler(next)
+	get(h, "/", withCert("client 1"))
+	get(h, "/", withCert("client 1"))
+	// Another client, or a request without a certificate, never gets the
+	// first client's response
+	get(h, "/", withCert("client 2"))
+	get(h, "/", nil)
+	if n := next.calls.Load(); n != 3 || c.Len() != 3 {
+		t.Errorf("got %d handler calls and %d entries, want 3 of each, one per client", n, c.Len())
+	}
+}
+
+// TestCacheCoalesces checks concurrent requests for a key that isn't cached
+// only call the handler once if its response is cacheable.
+func TestCacheCoalesces(t *testing.T) {
+	for _, cacheable := range []bool{true, false} {
+		t.Run(map[bool]string{true: "cacheable", false: "not cacheable"}[cacheable], func(t *testing.T) {
+			c := New(Config{TTL: time.Minute, MaxEntries: 10})
+			var calls atomic.Int32
+			release := make(chan struct{})
+			h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					<-release
+				}
+				if !cacheable {
+					w.Header().Set("Cache-Control", "no-store")
+				}
+				w.Write([]byte("Hello"))
+			}))
+
+			const n = 10
+			var wg sync.WaitGroup
+			bodies := make(chan string, n)
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					bodies <- get(h, "/", nil).Body.String()
+				}()
+			}
+			for deadline := time.Now().Add(5 * time.Second); calls.Load() == 0 && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+			// Give the other requests time to wait for the first one
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			close(bodies)
+			for body := range bodies {
+				if body != "Hello" {
+					t.Errorf("got the body %q, want Hello", body)
+				}
+			}
+			want := int32(1)
+			if !cacheable {
+				want = n
+			}
+			if got := calls.Load(); got != want {
+				t.Errorf("got %d handler calls for %d concurrent requests, want %d", got, n, want)
+			}
+		})
+	}
+}
+
+func TestCacheHandlerPanic(t *testing.T) {
+	c := New(Config{TTL: time.Minute, MaxEntries: 10})
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "panic") {
+			panic(http.ErrAbortHandler)
+		}
+	}))
+	func() {
+		defer func() { recover() }()
+		get(h, "/panic", nil)
+	}()
+	// The key isn't left pending, later requests aren't blocked
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		func() {
+			defer func() { recover() }()
+			get(h, "/panic", nil)
+		}()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a request after the handler panicked blocked")
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package certs contains the certificate and private key loading helpers
+// shared by the clients and servers in this repository.
+package certs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrNoSystemRoots is returned by NewSystemCertPool when the system's root CA
+// certificates aren't available, e.g., on a platform Go can't read them on.
+var ErrNoSystemRoots = errors.New("the system root CA certificates aren't available")
+
+// ErrIncorrectPassphrase is returned when an encrypted private key can't be
+// decrypted with the supplied passphrase.
+var ErrIncorrectPassphrase = errors.New("incorrect passphrase for encrypted private key")
+
+// LoadX509KeyPair reads a certificate and private key from the named sources
+// (see ReadSource) and returns the resulting tls.Certificate. If the private
+// key is encrypted it is
+// decrypted with passphrase first. Both legacy encrypted PEM blocks (those with
+// 'Proc-Type: 4,ENCRYPTED' headers) and PKCS#8 'ENCRYPTED PRIVATE KEY' blocks
+// are supported.
+func LoadX509KeyPair(certFile, keyFile string, passphrase []byte) (tls.Certificate, error) {
+	certPEM, err := ReadSource(certFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error reading certificate: %w", err)
+	}
+	keyPEM, err := ReadSource(keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error reading private key: %w", err)
+	}
+	cert, err := X509KeyPair(certPEM, keyPEM, passphrase)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error creating x509 keypair from cert %s and key %s: %w", sourceName(certFile), sourceName(keyFile), err)
+	}
+	return cert, nil
+}
+
+// X509KeyPair is like tls.X509KeyPair except that keyPEM is decrypted with
+// passphrase if it's encrypted, and any line endings are accepted. See
+// LoadX509KeyPair for the supported encryption formats and ParsePrivateKey
+// for the supported key encodings.
+func X509KeyPair(certPEM, keyPEM, passphrase []byte) (tls.Certificate, error) {
+	certPEM = normalizeLineEndings(certPEM)
+	keyPEM, err := DecryptKeyPEM(normalizeLineEndings(keyPEM), passphrase)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error decrypting private key: %w", err)
+	}
+	keyPEM, err = normalizeKeyPEM(keyPEM)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// StdinSource is the source name, used in place of a file name, that
+// indicates PEM content should be read from stdin.
+const StdinSource = "-"
+
+// EnvSourcePrefix is the prefix of a source name, used in place of a file
+// name, that indicates PEM content should be read from the named environment
+// variable, e.g., 'env:GOHTTPS_SRVCERT'.
+const EnvSourcePrefix = "env:"
+
+// stdin is read at most once, with the content kept so a source can be read
+// again when certificates are reloaded. CheckSources ensures only one source
+// uses it.
+var (
+	stdinOnce    sync.Once
+	stdinContent []byte
+	stdinErr     error
+)
+
+// ReadSource returns the PEM encoded content identified by src, which may be
+// a file name, EnvSourcePrefix followed by the name of an environment variable,
+// or StdinSource. The content is validated to be PEM encoded, and is never
+// logged or included in returned errors.
+func ReadSource(src string) ([]byte, error) {
+	var b []byte
+	switch {
+	case src == StdinSource:
+		stdinOnce.Do(func() {
+			stdinContent, stdinErr = ioutil.ReadAll(os.Stdin)
+		})
+		if stdinErr != nil {
+			return nil, fmt.Errorf("error reading stdin: %w", stdinErr)
+		}
+		b = stdinContent
+	case strings.HasPrefix(src, EnvSourcePrefix):
+		return readEnv(strings.TrimPrefix(src, EnvSourcePrefix))
+	default:
+		var err error
+		b, err = ioutil.ReadFile(src)
+		if err != nil {
+			return nil, fmt.Errorf("error reading file %s: %w", src, err)
+		}
+	}
+
+	b = normalizeLineEndings(b)
+	if block, _ := pem.Decode(b); block == nil {
+		if hint := explainNotPEM(b); hint != "" {
+			return nil, fmt.Errorf("%s doesn't contain PEM encoded content, %s", sourceName(src), hint)
+		}
+		return nil, fmt.Errorf("%s doesn't contain PEM encoded content", sourceName(src))
+	}
+	return b, nil
+}
+
+// CheckSources returns an error if more than one of srcs is StdinSource.
+func CheckSources(srcs ...string) error {
+	n := 0
+	for _, src := range srcs {
+		if src == StdinSource {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("only one certificate, key, or CA flag may use '-' to read from stdin")
+	}
+	return nil
+}
+
+// ReadPEM returns the PEM encoded content of the source file (see ReadSource)
+// or, if file is empty, the content of the environment variable envVar. The
+// environment variable may contain the PEM content itself or its base64
+// encoding, the latter being easier to inject on most container platforms.
+func ReadPEM(file, envVar string) ([]byte, error) {
+	if file != "" {
+		return ReadSource(file)
+	}
+	return readEnv(envVar)
+}
+
+func readEnv(envVar string) ([]byte, error) {
+	val := strings.TrimSpace(os.Getenv(envVar))
+	if val == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", envVar)
+	}
+	if strings.HasPrefix(val, "-----BEGIN") {
+		if block, _ := pem.Decode([]byte(val)); block == nil {
+			return nil, fmt.Errorf("environment variable %s doesn't contain valid PEM encoded content", envVar)
+		}
+		return []byte(val), nil
+	}
+	// Line breaks are commonly inserted by tools like 'base64', remove them
+	// before decoding.
+	b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(val), ""))
+	if err != nil {
+		return nil, fmt.Errorf("environment variable %s must contain PEM content or base64 encoded PEM content", envVar)
+	}
+	if block, _ := pem.Decode(b); block == nil {
+		return nil, fmt.Errorf("environment variable %s doesn't contain valid PEM encoded content", envVar)
+	}
+	return b, nil
+}
+
+func sourceName(src string) string {
+	switch {
+	case src == StdinSource:
+		return "stdin"
+	case strings.HasPrefix(src, EnvSourcePrefix):
+		return "environment variable " + strings.TrimPrefix(src, EnvSourcePrefix)
+	}
+	return "file " + src
+}
+
+// NewCertPool returns a certificate pool containing the certificates in caPEM.
+// It's an error if caPEM doesn't contain any certificates.
+func NewCertPool(caPEM []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no PEM encoded certificates found")
+	}
+	return pool, nil
+}
+
+// NewSystemCertPool returns a copy of the system's root CA pool with the
+// certificates in caPEM, if any, added. It returns an error wrapping
+// ErrNoSystemRoots if the system pool isn't available, and an error if caPEM
+// isn't empty but doesn't contain any certificates.
+func NewSystemCertPool(caPEM []byte) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoSystemRoots, err)
+	}
+	if len(caPEM) > 0 && !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no PEM encoded certificates found")
+	}
+	return pool, nil
+}
+
+// ParseCertificates returns the certificates in the CERTIFICATE blocks of
+// certPEM. It's an error if there aren't any or one doesn't parse.
+func ParseCertificates(certPEM []byte) ([]*x509.Certificate, error) {
+	var parsed []*x509.Certificate
+	for rest := certPEM; len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse certificate %d: %w", len(parsed)+1, err)
+		}
+		parsed = append(parsed, cert)
+	}
+	if len(parsed) == 0 {
+		return nil, errors.New("no PEM encoded certificates found")
+	}
+	return parsed, nil
+}
+
+// DecryptKeyPEM returns keyPEM with any encrypted private key blocks replaced
+// by their decrypted equivalent. Unencrypted blocks are returned unchanged, so
+// it's safe to call on any key file. An error is returned if an encrypted block
+// is found and no passphrase was provided, or if the passphrase is wrong.
+func DecryptKeyPEM(keyPEM, passphrase []byte) ([]byte, error) {
+	var out bytes.Buffer
+	rest := keyPEM
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			if len(passphrase) == 0 {
+				return nil, errors.New("private key is encrypted but no passphrase was provided")
+			}
+			der, err := decryptPKCS8(block.Bytes, passphrase)
+			if err != nil {
+				return nil, err
+			}
+			block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		case x509.IsEncryptedPEMBlock(block):
+			// Legacy PEM encryption is deprecated due to its weak design but
+			// is still produced by 'openssl rsa -aes256 -traditional'.
+			if len(passphrase) == 0 {
+				return nil, errors.New("private key is encrypted but no passphrase was provided")
+			}
+			der, err := x509.DecryptPEMBlock(block, passphrase)
+			if err != nil {
+				if errors.Is(err, x509.IncorrectPasswordError) {
+					return nil, ErrIncorrectPassphrase
+				}
+				return nil, err
+			}
+			// A PEM block that decrypts with the wrong passphrase will
+			// occasionally have valid padding, so confirm the result parses.
+			if _, err := ParsePrivateKey(&pem.Block{Type: block.Type, Bytes: der}); err != nil {
+				return nil, ErrIncorrectPassphrase
+			}
+			block = &pem.Block{Type: block.Type, Bytes: der}
+		}
+
+		if err := pem.Encode(&out, block); err != nil {
+			return nil, err
+		}
+	}
+
+	if out.Len() == 0 {
+		// Nothing PEM-like was found, let tls.X509KeyPair produce its usual
+		// error for the original content.
+		return keyPEM, nil
+	}
+	return out.Bytes(), nil
+}
+
+// ReadPassphrase returns the passphrase to use for an encrypted private key.
+// If passFile is set, the passphrase is read from that file with any trailing
+// newline removed, otherwise pass is returned as is. It's an error to set both.
+func ReadPassphrase(pass, passFile string) ([]byte, error) {
+	if pass != "" && passFile != "" {
+		return nil, errors.New("only one of a passphrase or a passphrase file may be provided")
+	}
+	if passFile == "" {
+		return []byte(pass), nil
+	}
+	b, err := ioutil.ReadFile(passFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading passphrase file %s: %w", passFile, err)
+	}
+	return bytes.TrimRight(b, "\r\n"), nil
+}
@@ -0,0 +1,270 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newKeyPair returns the PEM encoded self-signed certificate for cn, and its
+// SEC 1 encoded ECDSA private key.
+func newKeyPair(t *testing.T, cn string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes b to the named file in a temporary directory, returning
+// its path.
+func writeFile(t *testing.T, name string, b []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadPEM(t *testing.T) {
+	certPEM, _ := newKeyPair(t, "localhost")
+	file := writeFile(t, "cert.pem", certPEM)
+	wrapped := base64.StdEncoding.EncodeToString(certPEM)
+	for i := 64; i < len(wrapped); i += 65 {
+		wrapped = wrapped[:i] + "\n" + wrapped[i:]
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		env     string
+		wantErr string
+	}{
+		{name: "file", file: file, env: "not used"},
+		{name: "PEM", env: string(certPEM)},
+		{name: "PEM surrounded by white space", env: "\n  " + string(certPEM) + "\n\n"},
+		{name: "base64", env: base64.StdEncoding.EncodeToString(certPEM)},
+		{name: "base64 with line breaks", env: wrapped},
+		{name: "unset", wantErr: "GOHTTPS_TEST_PEM is not set"},
+		{name: "invalid PEM", env: "-----BEGIN CERTIFICATE-----\nsecret", wantErr: "doesn't contain valid PEM encoded content"},
+		{name: "not base64", env: "secret!", wantErr: "must contain PEM content or base64 encoded PEM content"},
+		{name: "base64 but not PEM", env: base64.StdEncoding.EncodeToString([]byte("secret")), wantErr: "doesn't contain valid PEM encoded content"},
+		{name: "missing file", file: filepath.Join(t.TempDir(), "missing.pem"), wantErr: "error reading file"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("GOHTTPS_TEST_PEM", tc.env)
+			got, err := ReadPEM(tc.file, "GOHTTPS_TEST_PEM")
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got the error %v, want one containing %q", err, tc.wantErr)
+				}
+				// The content may be a private key, so it's never included
+				if tc.env != "" && strings.Contains(err.Error(), "secret") {
+					t.Errorf("the error %q includes the environment variable's content", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got the error %s, want the certificate", err)
+			}
+			if _, err := ParseCertificates(got); err != nil {
+				t.Errorf("got %q, want the PEM encoded certificate: %s", got, err)
+			}
+		})
+	}
+}
+
+func TestX509KeyPairFromEnvironment(t *testing.T) {
+	certPEM, keyPEM := newKeyPair(t, "localhost")
+	t.Setenv("GOHTTPS_TEST_CERT", base64.StdEncoding.EncodeToString(certPEM))
+	t.Setenv("GOHTTPS_TEST_KEY", string(keyPEM))
+
+	certPEM, err := ReadPEM("", "GOHTTPS_TEST_CERT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err = ReadPEM("", "GOHTTPS_TEST_KEY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := X509KeyPair(certPEM, keyPEM, nil)
+	if err != nil {
+		t.Fatalf("creating the key pair from the environment failed: %s", err)
+	}
+	if cert.Leaf == nil || cert.Leaf.Subject.CommonName != "localhost" {
+		t.Errorf("got the certificate %+v, want the one for localhost", cert.Leaf)
+	}
+}
+
+func TestNewCertPool(t *testing.T) {
+	certPEM, _ := newKeyPair(t, "Test CA")
+	if _, err := NewCertPool(certPEM); err != nil {
+		t.Errorf("creating a pool from a certificate failed: %s", err)
+	}
+	_, keyPEM := newKeyPair(t, "Test CA")
+	if _, err := NewCertPool(keyPEM); err == nil {
+		t.Error("creating a pool from a private key succeeded")
+	}
+}
+
+func TestReadSource(t *testing.T) {
+	certPEM, _ := newKeyPair(t, "localhost")
+	file := writeFile(t, "cert.pem", certPEM)
+	t.Setenv("GOHTTPS_TEST_PEM", base64.StdEncoding.EncodeToString(certPEM))
+	t.Setenv("GOHTTPS_TEST_EMPTY", "")
+
+	tests := []struct {
+		src     string
+		wantErr string
+	}{
+		{src: file},
+		{src: "env:GOHTTPS_TEST_PEM"},
+		{src: "env:GOHTTPS_TEST_EMPTY", wantErr: "environment variable GOHTTPS_TEST_EMPTY is not set"},
+		{src: writeFile(t, "empty.pem", nil), wantErr: "doesn't contain PEM encoded content"},
+		{src: writeFile(t, "id_ed25519.pub", []byte("ssh-ed25519 AAAA secret")), wantErr: "it's an OpenSSH public key"},
+		{src: filepath.Join(t.TempDir(), "missing.pem"), wantErr: "error reading file"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.src, func(t *testing.T) {
+			got, err := ReadSource(tc.src)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got the error %v, want one containing %q", err, tc.wantErr)
+				}
+				if strings.Contains(err.Error(), "secret") {
+					t.Errorf("the error %q includes the source's content", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got the error %s, want the certificate", err)
+			}
+			if _, err := ParseCertificates(got); err != nil {
+				t.Errorf("got %q, want the PEM encoded certificate: %s", got, err)
+			}
+		})
+	}
+}
+
+func TestReadSourceStdin(t *testing.T) {
+	certPEM, _ := newKeyPair(t, "localhost")
+	f, err := os.Open(writeFile(t, "stdin", certPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	os.Stdin = f
+
+	// stdin is read once, and its content returned again, e.g., on a reload
+	for i := 0; i < 2; i++ {
+		got, err := ReadSource(StdinSource)
+		if err != nil {
+			t.Fatalf("reading stdin failed: %s", err)
+		}
+		if string(got) != string(certPEM) {
+			t.Fatalf("got %q from stdin on read %d, want %q", got, i+1, certPEM)
+		}
+	}
+}
+
+func TestCheckSources(t *testing.T) {
+	if err := CheckSources("cert.pem", StdinSource, "env:KEY", ""); err != nil {
+		t.Errorf("one stdin source was rejected: %s", err)
+	}
+	if err := CheckSources(StdinSource, "ca.pem", StdinSource); err == nil {
+		t.Error("two stdin sources were accepted")
+	}
+}
+
+func TestLoadX509KeyPairSources(t *testing.T) {
+	certPEM, keyPEM := newKeyPair(t, "localhost")
+	t.Setenv("GOHTTPS_TEST_KEY", string(keyPEM))
+	if _, err := LoadX509KeyPair(writeFile(t, "cert.pem", certPEM), "env:GOHTTPS_TEST_KEY", nil); err != nil {
+		t.Errorf("loading the key pair from a file and an environment variable failed: %s", err)
+	}
+
+	// The error names the sources, not their content
+	_, otherKey := newKeyPair(t, "localhost")
+	t.Setenv("GOHTTPS_TEST_KEY", string(otherKey))
+	_, err := LoadX509KeyPair(writeFile(t, "cert.pem", certPEM), "env:GOHTTPS_TEST_KEY", nil)
+	if err == nil || !strings.Contains(err.Error(), "environment variable GOHTTPS_TEST_KEY") {
+		t.Fatalf("got the error %v for a mismatched key, want one naming the key's environment variable", err)
+	}
+	if strings.Contains(err.Error(), "PRIVATE KEY") {
+		t.Errorf("the error %q includes the key", err)
+	}
+}
+
+func TestParseCertificates(t *testing.T) {
+	certPEM, keyPEM := newKeyPair(t, "localhost")
+	otherPEM, _ := newKeyPair(t, "other")
+
+	// Blocks other than certificates, e.g., the key, are skipped
+	got, err := ParseCertificates(append(append(append([]byte{}, certPEM...), keyPEM...), otherPEM...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Subject.CommonName != "localhost" || got[1].Subject.CommonName != "other" {
+		t.Errorf("got %d certificates, want the ones for localhost and other in order", len(got))
+	}
+	if _, err := ParseCertificates(keyPEM); err == nil || err.Error() != "no PEM encoded certificates found" {
+		t.Errorf("got the error %v for only a key, want no certificates found", err)
+	}
+	invalid := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("not a certificate")})
+	if _, err := ParseCertificates(append(append([]byte{}, certPEM...), invalid...)); err == nil || !strings.Contains(err.Error(), "certificate 2") {
+		t.Errorf("got the error %v, want one naming the invalid certificate 2", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	certPEM, _ := newKeyPair(t, "localhost")
+	parsed, err := ParseCertificates(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := parsed[0]
+	got := Fingerprint(cert)
+	// The format 'openssl x509 -fingerprint -sha256' shows
+	sum := sha256.Sum256(cert.Raw)
+	want := strings.ToUpper(hex.EncodeToString(sum[:]))
+	if strings.ReplaceAll(got, ":", "") != want || len(got) != 32*3-1 {
+		t.Errorf("got the fingerprint %s, want %s with colon separated bytes", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CheckChain returns a warning for each problem with chain, the certificate
+// chain a server presents, leaf first, that stops clients building a path
+// from the leaf to a root they trust: certificates that aren't followed by
+// their issuer, and a chain that ends with a certificate issued by a
+// publicly trusted intermediate that's missing. Browsers fetch a missing
+// intermediate from the URL in the certificate that needs it, but most
+// other clients, e.g., curl and Go, don't, so the chain works in a browser
+// but fails elsewhere.
+//
+// Whether a chain ending with a certificate issued by a private CA is
+// complete can't be told, it is if the CA is the root clients trust, see
+// DescribeChain.
+func CheckChain(chain []*x509.Certificate) []string {
+	if len(chain) == 0 {
+		return nil
+	}
+	var warnings []string
+	for i, cert := range chain[:len(chain)-1] {
+		next := chain[i+1]
+		if !bytes.Equal(cert.RawIssuer, next.RawSubject) || cert.CheckSignatureFrom(next) != nil {
+			warnings = append(warnings, fmt.Sprintf("certificate %d of the chain, %q, isn't followed by its issuer, %q follows it instead. Clients may fail to verify the chain, it must be in order, from the leaf to the root",
+				i+1, cert.Subject, next.Subject))
+		}
+	}
+
+	last := chain[len(chain)-1]
+	if bytes.Equal(last.RawIssuer, last.RawSubject) || len(last.IssuingCertificateURL) == 0 {
+		return warnings
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		return warnings
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	var unknown x509.UnknownAuthorityError
+	if errors.As(err, &unknown) {
+		warnings = append(warnings, fmt.Sprintf("the chain is incomplete, the issuer of %q, %q, isn't in it or the system's roots. Browsers fetch it from %s, but other clients, e.g., curl and Go, fail to verify the chain. Add the issuer's certificate, an intermediate, to the chain",
+			last.Subject, last.Issuer, strings.Join(last.IssuingCertificateURL, ", ")))
+	}
+	return warnings
+}
+
+// DescribeChain returns a description of chain, leaf first, listing the
+// subject of each certificate and, if the last certificate isn't a root,
+// its issuer, which clients must trust, e.g., "CN=a, issued by CN=b, issued
+// by CN=c (not in the chain)". A certificate that doesn't follow its issuer
+// is followed by ", then" instead.
+func DescribeChain(chain []*x509.Certificate) string {
+	var b strings.Builder
+	for i, cert := range chain {
+		switch {
+		case i == 0:
+		case bytes.Equal(chain[i-1].RawIssuer, cert.RawSubject):
+			b.WriteString(", issued by ")
+		default:
+			b.WriteString(", then ")
+		}
+		b.WriteString(cert.Subject.String())
+	}
+	if len(chain) > 0 {
+		last := chain[len(chain)-1]
+		if !bytes.Equal(last.RawIssuer, last.RawSubject) {
+			fmt.Fprintf(&b, ", issued by %s (not in the chain)", last.Issuer)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"strings"
+	"testing"
+)
+
+func TestCheckChain(t *testing.T) {
+	if _, err := x509.SystemCertPool(); err != nil {
+		t.Skipf("the system's roots are unavailable: %s", err)
+	}
+	root, rootKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test Root"}, IsCA: true}, nil, nil)
+	ca, caKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test Intermediate"}, IsCA: true}, root, rootKey)
+	leaf, _ := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "localhost"}, IssuingCertificateURL: []string{"http://ca.example.com/intermediate.crt"}}, ca, caKey)
+	private, _ := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "localhost"}}, root, rootKey)
+
+	tests := []struct {
+		name  string
+		chain []*x509.Certificate
+		// want are the substrings of each warning
+		want         []string
+		wantDescribe string
+	}{
+		{"complete", []*x509.Certificate{leaf, ca, root}, nil,
+			"CN=localhost, issued by CN=Test Intermediate, issued by CN=Test Root"},
+		{"without the root", []*x509.Certificate{leaf, ca}, nil,
+			"CN=localhost, issued by CN=Test Intermediate, issued by CN=Test Root (not in the chain)"},
+		{"missing the intermediate", []*x509.Certificate{leaf}, []string{"the chain is incomplete, the issuer of \"CN=localhost\", \"CN=Test Intermediate\", isn't in it or the system's roots. Browsers fetch it from http://ca.example.com/intermediate.crt"},
+			"CN=localhost, issued by CN=Test Intermediate (not in the chain)"},
+		{"out of order", []*x509.Certificate{leaf, root, ca}, []string{
+			"certificate 1 of the chain, \"CN=localhost\", isn't followed by its issuer, \"CN=Test Root\" follows it instead",
+			"certificate 2 of the chain, \"CN=Test Root\", isn't followed by its issuer, \"CN=Test Intermediate\" follows it instead",
+		}, "CN=localhost, then CN=Test Root, then CN=Test Intermediate, issued by CN=Test Root (not in the chain)"},
+		// The private CA may be the root clients trust
+		{"issued by a private CA", []*x509.Certificate{private}, nil,
+			"CN=localhost, issued by CN=Test Root (not in the chain)"},
+		{"empty", nil, nil, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := CheckChain(tc.chain)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got the warnings %q, want %d", got, len(tc.want))
+			}
+			for i, want := range tc.want {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("got the warning %q, want %q", got[i], want)
+				}
+			}
+			if got := DescribeChain(tc.chain); got != tc.wantDescribe {
+				t.Errorf("got the description %q, want %q", got, tc.wantDescribe)
+			}
+		})
+	}
+}
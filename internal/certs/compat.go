@@ -0,0 +1,139 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"go/version"
+	"runtime"
+	"strings"
+)
+
+// compatRule is a certificate pitfall whose consequences depend on the Go
+// version of the peer verifying, or parsing, the certificate.
+type compatRule struct {
+	// since is the Go release that started rejecting such certificates, ""
+	// if none does yet.
+	since string
+	// check returns the problem with cert, "" if it doesn't have it. role is
+	// the certificate's place in its chain: leaf, intermediate, or root.
+	check func(cert *x509.Certificate, role string) string
+	// fix is how to fix the problem.
+	fix string
+}
+
+// compatRules are checked by CheckCompatibility, new pitfalls only need an
+// entry here.
+var compatRules = []compatRule{
+	{
+		since: "go1.15",
+		check: func(cert *x509.Certificate, role string) string {
+			if role != "leaf" || hasSANs(cert) || cert.Subject.CommonName == "" {
+				return ""
+			}
+			return "only has a Common Name, which isn't used as a host name, and no Subject Alternative Names"
+		},
+		fix: "reissue it with its host names as DNS SANs",
+	},
+	{
+		since: "go1.15",
+		check: func(cert *x509.Certificate, role string) string {
+			cn := cert.Subject.CommonName
+			if role != "leaf" || !hasSANs(cert) || !strings.Contains(cn, ".") && cn != "localhost" {
+				return ""
+			}
+			if cert.VerifyHostname(cn) == nil {
+				return ""
+			}
+			return fmt.Sprintf("has a Common Name, %s, that isn't one of its Subject Alternative Names, so connecting to it by that name fails", cn)
+		},
+		fix: "reissue it with the Common Name as a DNS SAN too",
+	},
+	{
+		since: "go1.18",
+		check: func(cert *x509.Certificate, role string) string {
+			switch cert.SignatureAlgorithm {
+			case x509.SHA1WithRSA, x509.ECDSAWithSHA1, x509.DSAWithSHA1:
+			default:
+				return ""
+			}
+			if role == "root" {
+				// Roots are trusted as is, their signature isn't verified
+				return ""
+			}
+			return fmt.Sprintf("has a SHA-1 signature, %s", cert.SignatureAlgorithm)
+		},
+		fix: "reissue it signed with SHA-256",
+	},
+	{
+		since: "go1.24",
+		check: func(cert *x509.Certificate, role string) string {
+			if k, ok := cert.PublicKey.(*rsa.PublicKey); ok && k.N.BitLen() < 1024 {
+				return fmt.Sprintf("has a %d bit RSA key, smaller than 1024 bits", k.N.BitLen())
+			}
+			return ""
+		},
+		fix: fmt.Sprintf("reissue it with a key of at least %d bits", MinRSAKeySize),
+	},
+	{
+		check: func(cert *x509.Certificate, role string) string {
+			k, ok := cert.PublicKey.(*rsa.PublicKey)
+			if !ok || k.N.BitLen() < 1024 || k.N.BitLen() >= MinRSAKeySize {
+				return ""
+			}
+			return fmt.Sprintf("has a %d bit RSA key, smaller than the recommended minimum of %d bits, which other TLS stacks, e.g., OpenSSL at its default security level, reject", k.N.BitLen(), MinRSAKeySize)
+		},
+		fix: fmt.Sprintf("reissue it with a key of at least %d bits", MinRSAKeySize),
+	},
+	{
+		since: "go1.23",
+		check: func(cert *x509.Certificate, role string) string {
+			if cert.SerialNumber == nil || cert.SerialNumber.Sign() >= 0 {
+				return ""
+			}
+			return "has a negative serial number, which fails to parse"
+		},
+		fix: "reissue it with a positive serial number",
+	},
+}
+
+// CheckCompatibility returns a warning for each of the problems, known to
+// break verification by some Go versions, of the certificates in chain, the
+// leaf first. Each warning names the Go release that started rejecting it,
+// and whether the running Go version is affected.
+func CheckCompatibility(chain []*x509.Certificate) []string {
+	var warnings []string
+	for i, cert := range chain {
+		role := "intermediate"
+		switch {
+		case i == 0:
+			role = "leaf"
+		case bytes.Equal(cert.RawIssuer, cert.RawSubject):
+			role = "root"
+		}
+		for _, rule := range compatRules {
+			problem := rule.check(cert, role)
+			if problem == "" {
+				continue
+			}
+			when := "Go doesn't reject it yet"
+			if rule.since != "" {
+				when = fmt.Sprintf("Go %s and later reject it", strings.TrimPrefix(rule.since, "go"))
+				if version.Compare(runtime.Version(), rule.since) >= 0 {
+					when += ", including this binary's " + runtime.Version()
+				}
+			}
+			warnings = append(warnings, fmt.Sprintf("the %s certificate %q %s. %s, %s", role, cert.Subject, problem, when, rule.fix))
+		}
+	}
+	return warnings
+}
+
+func hasSANs(cert *x509.Certificate) bool {
+	return len(cert.DNSNames) > 0 || len(cert.IPAddresses) > 0 || len(cert.EmailAddresses) > 0 || len(cert.URIs) > 0
+}
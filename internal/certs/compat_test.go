@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	rsaKey := func(bits int) *rsa.PublicKey {
+		return &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), uint(bits-1)), E: 65537}
+	}
+	// cert returns a leaf or CA certificate without any of the problems,
+	// modified by modify
+	cert := func(cn string, modify func(c *x509.Certificate)) *x509.Certificate {
+		c := &x509.Certificate{
+			Subject:            pkix.Name{CommonName: cn},
+			DNSNames:           []string{cn},
+			SerialNumber:       big.NewInt(1),
+			SignatureAlgorithm: x509.SHA256WithRSA,
+			PublicKey:          rsaKey(2048),
+			RawSubject:         []byte(cn),
+			RawIssuer:          []byte("Test Root"),
+		}
+		if modify != nil {
+			modify(c)
+		}
+		return c
+	}
+	root := cert("Test Root", nil)
+	intermediate := cert("Test Intermediate", nil)
+
+	tests := []struct {
+		name  string
+		chain []*x509.Certificate
+		want  []string
+	}{
+		{"valid", []*x509.Certificate{cert("localhost", nil), intermediate, root}, nil},
+		{"IP SAN", []*x509.Certificate{cert("server", func(c *x509.Certificate) {
+			c.DNSNames, c.IPAddresses = nil, []net.IP{net.IPv4(127, 0, 0, 1)}
+		})}, nil},
+		{"Common Name only", []*x509.Certificate{cert("localhost", func(c *x509.Certificate) { c.DNSNames = nil })},
+			[]string{`the leaf certificate "CN=localhost" only has a Common Name`, "Go 1.15 and later reject it", "reissue it with its host names as DNS SANs"}},
+		{"Common Name not a SAN", []*x509.Certificate{cert("www.example.com", func(c *x509.Certificate) { c.DNSNames = []string{"example.com"} })},
+			[]string{"has a Common Name, www.example.com, that isn't one of its Subject Alternative Names"}},
+		{"SHA-1 leaf", []*x509.Certificate{cert("localhost", func(c *x509.Certificate) { c.SignatureAlgorithm = x509.SHA1WithRSA })},
+			[]string{"has a SHA-1 signature, SHA1-RSA", "Go 1.18 and later reject it"}},
+		{"SHA-1 intermediate", []*x509.Certificate{cert("localhost", nil), cert("Test Intermediate", func(c *x509.Certificate) { c.SignatureAlgorithm = x509.ECDSAWithSHA1 })},
+			[]string{`the intermediate certificate "CN=Test Intermediate" has a SHA-1 signature`}},
+		{"SHA-1 root", []*x509.Certificate{cert("localhost", nil), cert("Test Root", func(c *x509.Certificate) { c.SignatureAlgorithm = x509.SHA1WithRSA })}, nil},
+		{"512 bit key", []*x509.Certificate{cert("localhost", func(c *x509.Certificate) { c.PublicKey = rsaKey(512) })},
+			[]string{"has a 512 bit RSA key, smaller than 1024 bits", "Go 1.24 and later reject it", "at least 2048 bits"}},
+		{"1024 bit root key", []*x509.Certificate{cert("localhost", nil), cert("Test Root", func(c *x509.Certificate) { c.PublicKey = rsaKey(1024) })},
+			[]string{`the root certificate "CN=Test Root" has a 1024 bit RSA key, smaller than the recommended minimum of 2048 bits`, "Go doesn't reject it yet"}},
+		{"negative serial number", []*x509.Certificate{cert("localhost", func(c *x509.Certificate) { c.SerialNumber = big.NewInt(-1) })},
+			[]string{"has a negative serial number", "Go 1.23 and later reject it"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			warnings := CheckCompatibility(tc.chain)
+			if len(tc.want) == 0 {
+				if len(warnings) != 0 {
+					t.Errorf("got the warnings %q, want none", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 {
+				t.Fatalf("got the warnings %q, want one", warnings)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(warnings[0], want) {
+					t.Errorf("got the warning %q, want it to include %q", warnings[0], want)
+				}
+			}
+			// This binary is built with a Go version that rejects all of the
+			// problems that are rejected by some version
+			if rejected := !strings.Contains(warnings[0], "doesn't reject it yet"); rejected != strings.Contains(warnings[0], "including this binary's "+runtime.Version()) {
+				t.Errorf("got the warning %q, want it to say whether %s is affected", warnings[0], runtime.Version())
+			}
+		})
+	}
+}
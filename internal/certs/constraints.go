@@ -0,0 +1,128 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ExplainChain inspects a certificate chain that failed verification, leaf
+// first, for name constraint and path length violations, which x509 otherwise
+// often reports as a generic error, e.g., an unknown authority. name is the
+// host name the leaf was presented for, or "" if there isn't one, e.g., for a
+// client certificate. It returns a description of each violation found.
+func ExplainChain(chain []*x509.Certificate, name string) []string {
+	if len(chain) == 0 {
+		return nil
+	}
+	leaf := chain[0]
+	dnsNames := append([]string{}, leaf.DNSNames...)
+	var ips []net.IP
+	ips = append(ips, leaf.IPAddresses...)
+	if ip := net.ParseIP(name); ip != nil {
+		if !hasIP(ips, ip) {
+			ips = append(ips, ip)
+		}
+	} else if name != "" && !hasName(dnsNames, name) {
+		dnsNames = append(dnsNames, name)
+	}
+
+	var problems []string
+	for i, ca := range chain[1:] {
+		desc := describeCA(ca)
+		if !ca.BasicConstraintsValid || !ca.IsCA {
+			problems = append(problems, fmt.Sprintf("%s isn't a CA, but issued %q", desc, chain[i].Subject.CommonName))
+			continue
+		}
+		// i is the number of intermediates between ca and the leaf
+		if ca.MaxPathLen >= 0 && (ca.MaxPathLen > 0 || ca.MaxPathLenZero) && i > ca.MaxPathLen {
+			problems = append(problems, fmt.Sprintf("%s limits the path length to %d intermediates, but %d follow it", desc, ca.MaxPathLen, i))
+		}
+		for _, n := range dnsNames {
+			if len(ca.PermittedDNSDomains) > 0 && !matchesAnyDomain(n, ca.PermittedDNSDomains) {
+				problems = append(problems, fmt.Sprintf("%s constrains DNS names to %s, presented name was %s", desc, strings.Join(ca.PermittedDNSDomains, ", "), n))
+			}
+			if matchesAnyDomain(n, ca.ExcludedDNSDomains) {
+				problems = append(problems, fmt.Sprintf("%s excludes the DNS names %s, presented name was %s", desc, strings.Join(ca.ExcludedDNSDomains, ", "), n))
+			}
+		}
+		for _, ip := range ips {
+			if len(ca.PermittedIPRanges) > 0 && !containsIP(ca.PermittedIPRanges, ip) {
+				problems = append(problems, fmt.Sprintf("%s constrains IP addresses to %s, presented address was %s", desc, joinNets(ca.PermittedIPRanges), ip))
+			}
+			if containsIP(ca.ExcludedIPRanges, ip) {
+				problems = append(problems, fmt.Sprintf("%s excludes the IP addresses %s, presented address was %s", desc, joinNets(ca.ExcludedIPRanges), ip))
+			}
+		}
+	}
+	return problems
+}
+
+func describeCA(ca *x509.Certificate) string {
+	kind := "intermediate"
+	if string(ca.RawSubject) == string(ca.RawIssuer) {
+		kind = "root"
+	}
+	return fmt.Sprintf("%s %q", kind, ca.Subject.CommonName)
+}
+
+// matchesAnyDomain returns true if name is within any of the name constraint
+// domains. As in RFC 5280, 'example.com' matches example.com and any of its
+// subdomains, and '.example.com' matches only its subdomains.
+func matchesAnyDomain(name string, domains []string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		switch {
+		case d == "":
+			return true
+		case strings.HasPrefix(d, "."):
+			if strings.HasSuffix(name, d) {
+				return true
+			}
+		case name == d || strings.HasSuffix(name, "."+d):
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinNets(nets []*net.IPNet) string {
+	s := make([]string, len(nets))
+	for i, n := range nets {
+		s[i] = n.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+func hasName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// issue returns a certificate created from tmpl, signed by parent and its
+// key, or self-signed if parent is nil, and the certificate's key. The
+// certificate is valid for an hour either side of now unless tmpl sets its
+// validity period.
+func issue(t *testing.T, tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+	}
+	if tmpl.IsCA {
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// constrainedChain returns a chain, leaf first, of a leaf for leafTmpl issued
+// by an intermediate created from caTmpl, issued by a root.
+func constrainedChain(t *testing.T, caTmpl, leafTmpl *x509.Certificate) []*x509.Certificate {
+	t.Helper()
+	root, rootKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test Root"}, IsCA: true}, nil, nil)
+	caTmpl.Subject = pkix.Name{CommonName: "Corp Intermediate"}
+	ca, caKey := issue(t, caTmpl, root, rootKey)
+	leaf, _ := issue(t, leafTmpl, ca, caKey)
+	return []*x509.Certificate{leaf, ca, root}
+}
+
+func TestExplainChain(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		ca   *x509.Certificate
+		leaf *x509.Certificate
+		host string
+		want []string
+	}{
+		{
+			name: "permitted DNS names",
+			ca:   &x509.Certificate{IsCA: true, PermittedDNSDomains: []string{"corp.example"}},
+			leaf: &x509.Certificate{Subject: pkix.Name{CommonName: "api"}, DNSNames: []string{"api.corp.example"}},
+			host: "api.other.org",
+			want: []string{`intermediate "Corp Intermediate" constrains DNS names to corp.example, presented name was api.other.org`},
+		},
+		{
+			name: "excluded DNS names",
+			ca:   &x509.Certificate{IsCA: true, ExcludedDNSDomains: []string{".internal.example"}},
+			leaf: &x509.Certificate{Subject: pkix.Name{CommonName: "db"}, DNSNames: []string{"db.internal.example"}},
+			host: "db.internal.example",
+			want: []string{`intermediate "Corp Intermediate" excludes the DNS names .internal.example, presented name was db.internal.example`},
+		},
+		{
+			name: "permitted IP addresses",
+			ca:   &x509.Certificate{IsCA: true, PermittedIPRanges: []*net.IPNet{subnet}},
+			leaf: &x509.Certificate{Subject: pkix.Name{CommonName: "ip"}, IPAddresses: []net.IP{net.ParseIP("192.168.1.1")}},
+			host: "192.168.1.1",
+			want: []string{`intermediate "Corp Intermediate" constrains IP addresses to 10.0.0.0/8, presented address was 192.168.1.1`},
+		},
+		{
+			name: "no host, e.g., a client certificate",
+			ca:   &x509.Certificate{IsCA: true, PermittedDNSDomains: []string{"corp.example"}},
+			leaf: &x509.Certificate{Subject: pkix.Name{CommonName: "client"}, DNSNames: []string{"client.other.org"}},
+			want: []string{`intermediate "Corp Intermediate" constrains DNS names to corp.example, presented name was client.other.org`},
+		},
+		{
+			name: "issuer isn't a CA",
+			ca:   &x509.Certificate{BasicConstraintsValid: true},
+			leaf: &x509.Certificate{Subject: pkix.Name{CommonName: "api"}, DNSNames: []string{"api.corp.example"}},
+			host: "api.corp.example",
+			want: []string{`intermediate "Corp Intermediate" isn't a CA, but issued "api"`},
+		},
+		{
+			name: "within the constraints",
+			ca:   &x509.Certificate{IsCA: true, PermittedDNSDomains: []string{"corp.example"}, PermittedIPRanges: []*net.IPNet{subnet}},
+			leaf: &x509.Certificate{Subject: pkix.Name{CommonName: "api"}, DNSNames: []string{"api.corp.example"}, IPAddresses: []net.IP{net.ParseIP("10.1.2.3")}},
+			host: "API.corp.example.",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			chain := constrainedChain(t, tc.ca, tc.leaf)
+			got := ExplainChain(chain, tc.host)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got the problems %q, want %q", got, tc.want)
+			}
+
+			// The problems explain why x509 rejects the chain
+			roots := x509.NewCertPool()
+			roots.AddCert(chain[2])
+			intermediates := x509.NewCertPool()
+			intermediates.AddCert(chain[1])
+			_, err := chain[0].Verify(x509.VerifyOptions{DNSName: tc.host, Roots: roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+			if (err != nil) != (len(tc.want) > 0) {
+				t.Errorf("got the verification error %v, with the problems %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestExplainChainPathLength(t *testing.T) {
+	root, rootKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test Root"}, IsCA: true, MaxPathLenZero: true}, nil, nil)
+	ca, caKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Corp Intermediate"}, IsCA: true}, root, rootKey)
+	leaf, _ := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "api"}, DNSNames: []string{"api.corp.example"}}, ca, caKey)
+
+	got := ExplainChain([]*x509.Certificate{leaf, ca, root}, "api.corp.example")
+	want := []string{`root "Test Root" limits the path length to 0 intermediates, but 1 follow it`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got the problems %q, want %q", got, want)
+	}
+	if got := ExplainChain(nil, "api.corp.example"); got != nil {
+		t.Errorf("got the problems %q for an empty chain, want none", got)
+	}
+}
+
+func TestMatchesAnyDomain(t *testing.T) {
+	tests := []struct {
+		name    string
+		domains []string
+		want    bool
+	}{
+		{"example.com", []string{"example.com"}, true},
+		{"api.example.com", []string{"example.com"}, true},
+		{"API.Example.com.", []string{"example.com"}, true},
+		{"badexample.com", []string{"example.com"}, false},
+		{"example.com", []string{".example.com"}, false},
+		{"api.example.com", []string{".example.com"}, true},
+		{"api.other.org", []string{"corp.example", "other.org"}, true},
+		{"api.other.org", []string{""}, true},
+		{"api.other.org", nil, false},
+	}
+	for _, tc := range tests {
+		if got := matchesAnyDomain(tc.name, tc.domains); got != tc.want {
+			t.Errorf("got %t matching %s against %q, want %t", got, tc.name, tc.domains, tc.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// DirReport describes the certificates ReadDir loaded from a directory.
+type DirReport struct {
+	// Added is the number of distinct certificates loaded, certificates that
+	// are in more than one file, e.g., a bundle and the individual certificate
+	// files of a system trust store, are only counted once.
+	Added int
+	// Files is the number of certificate files read.
+	Files int
+	// Failed describes each of the certificate files that couldn't be read or
+	// parsed, e.g., "bad.pem: no PEM encoded certificates found".
+	Failed []string
+}
+
+// ReadDir walks dir, and its subdirectories, and returns the PEM encoded
+// certificates of every .pem and .crt file in it, in the layout of a system
+// trust store such as /etc/ssl/certs. Other files are skipped, as are the
+// certificate files that don't parse, which are listed in the returned
+// DirReport instead. It's an error if dir can't be walked or doesn't contain
+// any certificates.
+func ReadDir(dir string) ([]byte, DirReport, error) {
+	var report DirReport
+	var out bytes.Buffer
+	seen := map[string]bool{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".pem", ".crt":
+		default:
+			return nil
+		}
+		name, _ := filepath.Rel(dir, path)
+		report.Files++
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %s", name, err))
+			return nil
+		}
+		parsed, err := ParseCertificates(normalizeLineEndings(b))
+		if err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %s", name, err))
+			return nil
+		}
+		for _, cert := range parsed {
+			if seen[string(cert.Raw)] {
+				continue
+			}
+			seen[string(cert.Raw)] = true
+			report.Added++
+			pem.Encode(&out, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, report, fmt.Errorf("unable to read the CA directory %s: %w", dir, err)
+	}
+	if report.Added == 0 {
+		return nil, report, fmt.Errorf("the CA directory %s doesn't contain any certificates", dir)
+	}
+	return out.Bytes(), report, nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadDir(t *testing.T) {
+	ca1, _ := newKeyPair(t, "ca1")
+	ca2, _ := newKeyPair(t, "ca2")
+	ca3, _ := newKeyPair(t, "ca3")
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"ca1.pem":         ca1,
+		"bundle.crt":      append(append([]byte{}, ca1...), ca2...),
+		"sub/ca3.PEM":     []byte(strings.ReplaceAll(string(ca3), "\n", "\r\n")),
+		"bad.pem":         []byte("not a certificate"),
+		"ca2.der":         ca2,
+		"README":          []byte("certificates"),
+		"sub/deeper/.pem": ca1,
+	}
+	for name, b := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pemCerts, report, err := ReadDir(dir)
+	if err != nil {
+		t.Fatalf("got the error %s, want nil", err)
+	}
+	if report.Added != 3 || report.Files != 5 {
+		t.Errorf("got %d certificates added from %d files, want 3 from 5", report.Added, report.Files)
+	}
+	if len(report.Failed) != 1 || !strings.HasPrefix(report.Failed[0], "bad.pem: ") {
+		t.Errorf("got the failed files %q, want bad.pem", report.Failed)
+	}
+	certs, err := ParseCertificates(pemCerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, cert := range certs {
+		got = append(got, cert.Subject.CommonName)
+	}
+	if want := []string{"ca1", "ca2", "ca3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got the certificates %q, want %q", got, want)
+	}
+}
+
+func TestReadDirErrors(t *testing.T) {
+	noCerts := filepath.Dir(writeFile(t, "bad.pem", []byte("not a certificate")))
+	tests := []struct {
+		name string
+		dir  string
+		want string
+	}{
+		{"missing", filepath.Join(noCerts, "missing"), "unable to read the CA directory"},
+		{"no certificates", noCerts, "doesn't contain any certificates"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := ReadDir(tc.dir)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got the error %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// keyFormats names the formats of the private key PEM block types.
+var keyFormats = map[string]string{
+	"RSA PRIVATE KEY":       "PKCS#1 RSA",
+	"EC PRIVATE KEY":        "SEC 1 EC",
+	"PRIVATE KEY":           "PKCS#8",
+	"ENCRYPTED PRIVATE KEY": "encrypted PKCS#8",
+	"OPENSSH PRIVATE KEY":   "OpenSSH",
+	"DSA PRIVATE KEY":       "DSA",
+}
+
+// unsupportedKeys are the hints for the private key PEM block types that are
+// recognized but can't be used.
+var unsupportedKeys = map[string]string{
+	"OPENSSH PRIVATE KEY": "convert an RSA or ECDSA key to PKCS#8, in place, with 'ssh-keygen -p -m PKCS8 -f <keyFile>'. " +
+		"ssh-keygen can't convert Ed25519 keys, create a new key with 'openssl genpkey -algorithm ed25519 -out <keyFile>' instead",
+	"DSA PRIVATE KEY": "DSA keys can't be used for TLS, create an ECDSA key with " +
+		"'openssl ecparam -genkey -name prime256v1 -noout -out <keyFile>' and a certificate for it",
+}
+
+// KeyFormat returns the name of the private key format of block, e.g.,
+// 'PKCS#1 RSA', or the block type if it isn't a private key format.
+func KeyFormat(block *pem.Block) string {
+	if format, ok := keyFormats[block.Type]; ok {
+		return format
+	}
+	return fmt.Sprintf("%q", block.Type)
+}
+
+// KeyFormatError is the error returned when a private key is in a format
+// that's recognized but can't be used, or doesn't parse as the format it
+// claims.
+type KeyFormatError struct {
+	// Format is the detected format, see KeyFormat.
+	Format string
+	// Err is the parsing error, if any.
+	Err error
+	// Hint suggests how to convert the key to a supported format.
+	Hint string
+}
+
+func (e *KeyFormatError) Error() string {
+	msg := fmt.Sprintf("%s private keys aren't supported", e.Format)
+	if e.Err != nil {
+		msg = fmt.Sprintf("unable to parse the %s private key: %s", e.Format, e.Err)
+	}
+	if e.Hint != "" {
+		msg += ", " + e.Hint
+	}
+	return msg
+}
+
+func (e *KeyFormatError) Unwrap() error {
+	return e.Err
+}
+
+// normalizeLineEndings replaces Windows, '\r\n', and classic Mac OS, '\r',
+// line endings by '\n'. encoding/pem handles the former, but not the latter
+// or a mix of them, e.g., '\r\r\n' from a file converted twice.
+func normalizeLineEndings(b []byte) []byte {
+	if !bytes.ContainsRune(b, '\r') {
+		return b
+	}
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(b, []byte("\r"), []byte("\n"))
+}
+
+// explainNotPEM returns a description of b, which doesn't contain PEM
+// encoded content, and how to convert it to PEM, or "" if its format isn't
+// recognized.
+func explainNotPEM(b []byte) string {
+	b = bytes.TrimSpace(b)
+	switch {
+	case bytes.HasPrefix(b, []byte("PuTTY-User-Key-File")):
+		return "it's a PuTTY private key, convert it with 'puttygen <key.ppk> -O private-openssh -o <keyFile>'"
+	case bytes.HasPrefix(b, []byte("ssh-")), bytes.HasPrefix(b, []byte("ecdsa-sha2-")):
+		return "it's an OpenSSH public key, a PEM encoded certificate or private key is required"
+	case len(b) > 0 && b[0] == 0x30:
+		// DER encodings of certificates and keys start with an ASN.1 SEQUENCE
+		return "it appears to be DER encoded, convert it to PEM with 'openssl x509 -inform DER -in <file> -out <file.pem>' " +
+			"for a certificate, or 'openssl pkey -inform DER -in <file> -out <file.pem>' for a private key"
+	}
+	return ""
+}
+
+// explainNoKey returns an error explaining why keyPEM, which doesn't contain a
+// private key block, isn't a private key.
+func explainNoKey(keyPEM []byte) error {
+	for rest := keyPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return errors.New("no PEM encoded private key found")
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			return errors.New("no PEM encoded private key found, the key contains a certificate, were the certificate and key swapped?")
+		case "PUBLIC KEY", "RSA PUBLIC KEY":
+			return fmt.Errorf("no PEM encoded private key found, the key contains a %q block, the private key is required", block.Type)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestX509KeyPairLineEndings(t *testing.T) {
+	certPEM, keyPEM := newKeyPair(t, "localhost")
+	for name, eol := range map[string]string{"Windows": "\r\n", "classic Mac OS": "\r", "converted twice": "\r\r\n"} {
+		t.Run(name, func(t *testing.T) {
+			convert := func(b []byte) []byte { return bytes.ReplaceAll(b, []byte("\n"), []byte(eol)) }
+			if _, err := X509KeyPair(convert(certPEM), convert(keyPEM), nil); err != nil {
+				t.Errorf("creating the key pair failed: %s", err)
+			}
+		})
+	}
+}
+
+func TestX509KeyPairExplained(t *testing.T) {
+	certPEM, keyPEM := newKeyPair(t, "localhost")
+	x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519DER, err := x509.MarshalPKCS8PrivateKey(x25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := func(typ string, b []byte) []byte { return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}) }
+
+	tests := []struct {
+		name    string
+		keyPEM  []byte
+		format  string
+		wantErr string
+	}{
+		{"OpenSSH", block("OPENSSH PRIVATE KEY", []byte("key")), "OpenSSH", "ssh-keygen -p -m PKCS8"},
+		{"DSA", block("DSA PRIVATE KEY", []byte("key")), "DSA", "DSA keys can't be used for TLS"},
+		{"X25519", block("PRIVATE KEY", x25519DER), "PKCS#8", "only RSA, ECDSA, and Ed25519 PKCS#8 keys are supported"},
+		{"invalid", block("RSA PRIVATE KEY", []byte("key")), "PKCS#1 RSA", "unable to parse the PKCS#1 RSA private key"},
+		{"swapped", certPEM, "", "were the certificate and key swapped?"},
+		{"public key", block("PUBLIC KEY", []byte("key")), "", `contains a "PUBLIC KEY" block, the private key is required`},
+		{"no key", []byte("key"), "", "no PEM encoded private key found"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := X509KeyPair(certPEM, tc.keyPEM, nil)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("got the error %v, want one containing %q", err, tc.wantErr)
+			}
+			var keyErr *KeyFormatError
+			if errors.As(err, &keyErr) != (tc.format != "") || (keyErr != nil && keyErr.Format != tc.format) {
+				t.Errorf("got the error %#v, want a *KeyFormatError for the %q format", err, tc.format)
+			}
+		})
+	}
+	if _, err := X509KeyPair(certPEM, keyPEM, nil); err != nil {
+		t.Errorf("creating the key pair with the valid key failed: %s", err)
+	}
+}
+
+func TestReadSourceNotPEM(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr string
+	}{
+		{"PuTTY", []byte("PuTTY-User-Key-File-3: ssh-ed25519\n"), "it's a PuTTY private key, convert it with 'puttygen"},
+		{"OpenSSH public key", []byte("ecdsa-sha2-nistp256 AAAA"), "it's an OpenSSH public key"},
+		{"DER", []byte{0x30, 0x82, 0x01, 0x0a}, "it appears to be DER encoded"},
+		{"unknown", []byte("key"), "doesn't contain PEM encoded content"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ReadSource(writeFile(t, "key", tc.content))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got the error %v, want one containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
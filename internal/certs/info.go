@@ -0,0 +1,86 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MinRSAKeySize is the smallest RSA key size, in bits, that isn't considered weak.
+const MinRSAKeySize = 2048
+
+// KeyInfo describes the key and signature algorithms of a certificate.
+type KeyInfo struct {
+	// Algorithm is the public key algorithm, e.g., RSA, ECDSA, or Ed25519.
+	Algorithm string
+	// Size is the key size in bits.
+	Size int
+	// Curve is the name of the elliptic curve for ECDSA keys.
+	Curve string
+	// SignatureAlgorithm is the algorithm the issuer used to sign the certificate.
+	SignatureAlgorithm string
+}
+
+// String returns a human readable representation of k, suitable for logging.
+func (k KeyInfo) String() string {
+	key := fmt.Sprintf("%s %d bit", k.Algorithm, k.Size)
+	if k.Curve != "" {
+		key = fmt.Sprintf("%s %s", k.Algorithm, k.Curve)
+	}
+	return fmt.Sprintf("%s public key, %s signature", key, k.SignatureAlgorithm)
+}
+
+// Weak returns true if k is an RSA key smaller than MinRSAKeySize bits.
+func (k KeyInfo) Weak() bool {
+	return k.Algorithm == x509.RSA.String() && k.Size < MinRSAKeySize
+}
+
+// Leaf returns the parsed leaf certificate of cert.
+func Leaf(cert tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return x509.ParseCertificate(cert.Certificate[0])
+}
+
+// Fingerprint returns the SHA-256 fingerprint of cert in the colon separated
+// hex format shown by browsers and 'openssl x509 -fingerprint -sha256'.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hex, ":")
+}
+
+// DescribeKey returns the key and signature algorithm information for cert.
+func DescribeKey(cert *x509.Certificate) KeyInfo {
+	info := KeyInfo{
+		Algorithm:          cert.PublicKeyAlgorithm.String(),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+	}
+	switch k := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		info.Size = k.N.BitLen()
+	case *ecdsa.PublicKey:
+		info.Size = k.Curve.Params().BitSize
+		info.Curve = k.Curve.Params().Name
+	case ed25519.PublicKey:
+		info.Size = len(k) * 8
+	}
+	return info
+}
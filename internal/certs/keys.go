@@ -0,0 +1,109 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// ParsePrivateKey parses the private key contained in block. The encoding is
+// chosen based on the block type:
+//
+//	RSA PRIVATE KEY - PKCS#1
+//	EC PRIVATE KEY  - SEC 1
+//	PRIVATE KEY     - PKCS#8, which may contain an RSA, ECDSA, or Ed25519 key
+//
+// Not every tool labels its blocks correctly, so if the key can't be parsed
+// using the encoding implied by the type the other encodings are tried too.
+// A *KeyFormatError naming the format is returned if the key can't be parsed,
+// or is in a recognized but unsupported format, e.g., an OpenSSH key.
+func ParsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	parsers := []func([]byte) (crypto.Signer, error){parsePKCS8, parsePKCS1, parseSEC1}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsers = []func([]byte) (crypto.Signer, error){parsePKCS1, parsePKCS8, parseSEC1}
+	case "EC PRIVATE KEY":
+		parsers = []func([]byte) (crypto.Signer, error){parseSEC1, parsePKCS8, parsePKCS1}
+	}
+
+	if hint, ok := unsupportedKeys[block.Type]; ok {
+		return nil, &KeyFormatError{Format: KeyFormat(block), Hint: hint}
+	}
+
+	var firstErr error
+	for _, parse := range parsers {
+		key, err := parse(block.Bytes)
+		if err == nil {
+			return key, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	keyErr := &KeyFormatError{Format: KeyFormat(block), Err: firstErr}
+	if block.Type == "PRIVATE KEY" {
+		// e.g., DSA or X25519 keys, which can't be used for TLS
+		keyErr.Hint = "only RSA, ECDSA, and Ed25519 PKCS#8 keys are supported, check the key's algorithm with 'openssl pkey -noout -text -in <keyFile>'"
+	}
+	return nil, keyErr
+}
+
+// normalizeKeyPEM returns the first private key found in keyPEM re-encoded as
+// an unencrypted PKCS#8 'PRIVATE KEY' PEM block.
+func normalizeKeyPEM(keyPEM []byte) ([]byte, error) {
+	rest := keyPEM
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, explainNoKey(keyPEM)
+		}
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			// e.g., 'EC PARAMETERS' blocks that 'openssl ecparam' emits
+			continue
+		}
+
+		key, err := ParsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to re-encode private key: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+}
+
+func parsePKCS1(der []byte) (crypto.Signer, error) {
+	return x509.ParsePKCS1PrivateKey(der)
+}
+
+func parseSEC1(der []byte) (crypto.Signer, error) {
+	return x509.ParseECPrivateKey(der)
+}
+
+func parsePKCS8(der []byte) (crypto.Signer, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("unsupported PKCS#8 private key type %T", key)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// selfSigned returns the PEM encoded self-signed certificate for key.
+func selfSigned(t *testing.T, key crypto.Signer) []byte {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8 := func(key crypto.Signer) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		block *pem.Block
+		key   crypto.Signer
+	}{
+		{"PKCS#1 RSA", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}, rsaKey},
+		{"SEC 1 EC", &pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}, ecKey},
+		{"PKCS#8 RSA", &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8(rsaKey)}, rsaKey},
+		{"PKCS#8 ECDSA", &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8(ecKey)}, ecKey},
+		{"PKCS#8 Ed25519", &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8(edKey)}, edKey},
+		{"PKCS#8 labelled as PKCS#1", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: pkcs8(rsaKey)}, rsaKey},
+		{"PKCS#8 labelled as SEC 1", &pem.Block{Type: "EC PRIVATE KEY", Bytes: pkcs8(ecKey)}, ecKey},
+		{"SEC 1 labelled as PKCS#8", &pem.Block{Type: "PRIVATE KEY", Bytes: sec1}, ecKey},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := ParsePrivateKey(tc.block)
+			if err != nil {
+				t.Fatalf("parsing the key failed: %s", err)
+			}
+			if !key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(tc.key.Public()) {
+				t.Errorf("got a different key than the one encoded")
+			}
+
+			// The key pair is usable whatever the key's encoding
+			keyPEM := pem.EncodeToMemory(tc.block)
+			if _, err := X509KeyPair(selfSigned(t, tc.key), keyPEM, nil); err != nil {
+				t.Errorf("creating the key pair failed: %s", err)
+			}
+		})
+	}
+}
+
+func TestParsePrivateKeyInvalid(t *testing.T) {
+	_, err := ParsePrivateKey(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("not a key")})
+	keyErr, ok := err.(*KeyFormatError)
+	if !ok {
+		t.Fatalf("got the error %v, want a *KeyFormatError", err)
+	}
+	if keyErr.Format != "SEC 1 EC" || keyErr.Err == nil {
+		t.Errorf("got the error %+v, want the SEC 1 EC format and the parsing error", keyErr)
+	}
+}
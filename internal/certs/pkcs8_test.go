@@ -0,0 +1,205 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	// oidHMACWithSM3 is a PRF that isn't supported.
+	oidHMACWithSM3 = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 401, 2}
+	// oidRC2CBC is a cipher that isn't supported.
+	oidRC2CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 2}
+)
+
+// encryptKey returns der, a PKCS#8 private key, as an 'ENCRYPTED PRIVATE
+// KEY' PEM block, encrypted with PBES2 using PBKDF2 with prf, HMAC-SHA1 if
+// it's nil, and AES-CBC with a key of keyLen bytes identified as scheme, as
+// e.g. 'openssl pkcs8 -topk8 -v2 aes-256-cbc' does.
+func encryptKey(t *testing.T, der, passphrase []byte, prf, scheme asn1.ObjectIdentifier, keyLen int) []byte {
+	t.Helper()
+	h := map[string]func() hash.Hash{oidHMACWithSHA256.String(): sha256.New}[prf.String()]
+	if h == nil {
+		h = sha1.New
+	}
+	salt, iv := make([]byte, 8), make([]byte, aes.BlockSize)
+	rand.Read(salt)
+	rand.Read(iv)
+	key, err := pbkdf2.Key(h, string(passphrase), salt, 2048, keyLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := aes.BlockSize - len(der)%aes.BlockSize
+	data := append(append([]byte(nil), der...), bytes.Repeat([]byte{byte(n)}, n)...)
+	cipher.NewCBCEncrypter(c, iv).CryptBlocks(data, data)
+
+	marshal := func(v interface{}) asn1.RawValue {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return asn1.RawValue{FullBytes: b}
+	}
+	kdf := pbkdf2Params{Salt: salt, IterationCount: 2048}
+	if prf != nil {
+		kdf.PRF = pkix.AlgorithmIdentifier{Algorithm: prf, Parameters: asn1.NullRawValue}
+	}
+	params := pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: marshal(kdf)},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: scheme, Parameters: marshal(iv)},
+	}
+	b, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		EncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: marshal(params)},
+		EncryptedData:       data,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: b})
+}
+
+// newPKCS8Key returns a new ECDSA private key's PKCS#8 DER.
+func newPKCS8Key(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, der
+}
+
+func TestDecryptKeyPEM(t *testing.T) {
+	_, der := newPKCS8Key(t)
+	pass := []byte("secret")
+	tests := []struct {
+		name       string
+		keyPEM     []byte
+		passphrase []byte
+		wantErr    string
+	}{
+		{"AES-256 with HMAC-SHA256", encryptKey(t, der, pass, oidHMACWithSHA256, oidAES256CBC, 32), pass, ""},
+		{"AES-128 with the default HMAC-SHA1", encryptKey(t, der, pass, nil, oidAES128CBC, 16), pass, ""},
+		{"wrong passphrase", encryptKey(t, der, pass, oidHMACWithSHA256, oidAES256CBC, 32), []byte("wrong"), ErrIncorrectPassphrase.Error()},
+		{"no passphrase", encryptKey(t, der, pass, oidHMACWithSHA256, oidAES256CBC, 32), nil, "no passphrase was provided"},
+		{"unsupported PRF", encryptKey(t, der, pass, oidHMACWithSM3, oidAES256CBC, 32), pass, "unsupported PBKDF2 pseudo-random function 1.2.156.10197.1.401.2"},
+		{"unsupported cipher", encryptKey(t, der, pass, oidHMACWithSHA256, oidRC2CBC, 16), pass, "unsupported PBES2 encryption scheme 1.2.840.113549.3.2"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := DecryptKeyPEM(tc.keyPEM, tc.passphrase)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got the error %v, want one containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			block, _ := pem.Decode(got)
+			if block == nil || block.Type != "PRIVATE KEY" || !bytes.Equal(block.Bytes, der) {
+				t.Errorf("got the key\n%s\nwant the decrypted PKCS#8 key", got)
+			}
+		})
+	}
+}
+
+func TestDecryptKeyPEMLegacy(t *testing.T) {
+	key, _ := newPKCS8Key(t)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", der, []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := pem.EncodeToMemory(block)
+
+	got, err := DecryptKeyPEM(encrypted, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := pem.Decode(got); b == nil || b.Type != "EC PRIVATE KEY" || len(b.Headers) != 0 || !bytes.Equal(b.Bytes, der) {
+		t.Errorf("got the key\n%s\nwant the decrypted SEC 1 key", got)
+	}
+	if _, err := DecryptKeyPEM(encrypted, []byte("wrong")); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("got the error %v for the wrong passphrase, want %v", err, ErrIncorrectPassphrase)
+	}
+}
+
+func TestDecryptKeyPEMUnencrypted(t *testing.T) {
+	_, der := newPKCS8Key(t)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	// Unencrypted keys are returned as is, with or without a passphrase
+	for _, pass := range [][]byte{nil, []byte("secret")} {
+		if got, err := DecryptKeyPEM(keyPEM, pass); err != nil || !bytes.Equal(got, keyPEM) {
+			t.Errorf("got the key\n%s\nand the error %v, want the key unchanged", got, err)
+		}
+	}
+	if got, err := DecryptKeyPEM([]byte("not PEM"), nil); err != nil || string(got) != "not PEM" {
+		t.Errorf("got %q and the error %v for content that isn't PEM, want it unchanged", got, err)
+	}
+}
+
+func TestReadPassphrase(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pass")
+	if err := ioutil.WriteFile(file, []byte("secret\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name           string
+		pass, passFile string
+		want           string
+		wantErr        string
+	}{
+		{name: "passphrase", pass: "secret", want: "secret"},
+		{name: "file without its trailing newline", passFile: file, want: "secret"},
+		{name: "none"},
+		{name: "both", pass: "secret", passFile: file, wantErr: "only one of"},
+		{name: "missing file", passFile: file + ".missing", wantErr: "error reading passphrase file"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ReadPassphrase(tc.pass, tc.passFile)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("got the error %v, want one containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || string(got) != tc.want {
+				t.Errorf("got the passphrase %q and the error %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"crypto/tls"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// Reloader provides a server tls.Config whose certificates and CAs can be
+// reloaded while the server is running. Reloading reuses the same load
+// function that created the initial configuration, so a reloaded config can't
+// differ from a freshly started server's.
+type Reloader struct {
+	load   func() (*tls.Config, error)
+	mu     sync.Mutex // serializes calls to Reload
+	config atomic.Pointer[tls.Config]
+}
+
+// NewReloader returns a Reloader whose configuration is created by load. The
+// initial configuration is loaded before returning.
+func NewReloader(load func() (*tls.Config, error)) (*Reloader, error) {
+	r := &Reloader{load: load}
+	cfg, err := r.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	r.config.Store(cfg)
+	return r, nil
+}
+
+// TLSConfig returns a tls.Config, suitable for use in an http.Server, that
+// uses the most recently loaded configuration for each new handshake.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.config.Load(), nil
+		},
+	}
+}
+
+// Current returns the most recently loaded configuration. It must not be modified.
+func (r *Reloader) Current() *tls.Config {
+	return r.config.Load()
+}
+
+// Reload loads a new configuration. If loading fails the current configuration
+// remains in use and the error is returned. The serial numbers of the old and
+// new server certificates are logged on success.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.loadConfig()
+	if err != nil {
+		return err
+	}
+	old := r.config.Swap(cfg)
+	log.Printf("Reloaded TLS configuration, server certificate serial %s replaced by %s", serial(old), serial(cfg))
+	return nil
+}
+
+func (r *Reloader) loadConfig() (*tls.Config, error) {
+	cfg, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.NextProtos) == 0 {
+		// http.Server only adds its ALPN protocols to the top level config, so
+		// they have to be provided here for HTTP/2 to be negotiated.
+		cfg.NextProtos = []string{"h2", "http/1.1"}
+	}
+	return cfg, nil
+}
+
+func serial(cfg *tls.Config) string {
+	if cfg == nil || len(cfg.Certificates) == 0 {
+		return "<none>"
+	}
+	leaf, err := Leaf(cfg.Certificates[0])
+	if err != nil {
+		return "<unknown>"
+	}
+	return leaf.SerialNumber.Text(16)
+}
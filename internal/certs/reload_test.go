@@ -0,0 +1,74 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+)
+
+func TestReloader(t *testing.T) {
+	var cert tls.Certificate
+	var loadErr error
+	load := func() (*tls.Config, error) {
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	}
+	loadCert := func(cn string) {
+		t.Helper()
+		certPEM, keyPEM := newKeyPair(t, cn)
+		var err error
+		if cert, err = X509KeyPair(certPEM, keyPEM, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	served := func(r *Reloader) string {
+		t.Helper()
+		cfg, err := r.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg.Certificates[0].Leaf.Subject.CommonName
+	}
+
+	loadCert("first")
+	r, err := NewReloader(load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := served(r); got != "first" {
+		t.Errorf("got the certificate for %s, want first", got)
+	}
+	if got := r.Current().NextProtos; len(got) != 2 || got[0] != "h2" {
+		t.Errorf("got the ALPN protocols %v, want h2 and http/1.1", got)
+	}
+
+	loadCert("second")
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := served(r); got != "second" {
+		t.Errorf("got the certificate for %s after the reload, want second", got)
+	}
+
+	// A failed reload keeps the current configuration
+	loadErr = errors.New("invalid certificate")
+	if err := r.Reload(); err != loadErr {
+		t.Errorf("got the error %v, want the load function's", err)
+	}
+	if got := served(r); got != "second" {
+		t.Errorf("got the certificate for %s after the failed reload, want second", got)
+	}
+}
+
+func TestNewReloaderError(t *testing.T) {
+	loadErr := errors.New("no certificate")
+	if _, err := NewReloader(func() (*tls.Config, error) { return nil, loadErr }); err != loadErr {
+		t.Errorf("got the error %v, want the load function's", err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ValidityGap returns how far t is outside cert's validity period: negative if
+// t is before NotBefore, positive if it's after NotAfter, and 0 if t is within
+// the period.
+func ValidityGap(cert *x509.Certificate, t time.Time) time.Duration {
+	switch {
+	case t.Before(cert.NotBefore):
+		return t.Sub(cert.NotBefore)
+	case t.After(cert.NotAfter):
+		return t.Sub(cert.NotAfter)
+	}
+	return 0
+}
+
+// ExplainValidity returns a description of how far now is outside the
+// validity period of the certificate that err, an x509.CertificateInvalidError
+// possibly wrapped in other errors, reports as expired or not yet valid. A
+// small gap usually means the local clock is wrong rather than the
+// certificate. It returns "" for any other error.
+func ExplainValidity(err error, now time.Time) string {
+	var invalid x509.CertificateInvalidError
+	if !errors.As(err, &invalid) || invalid.Reason != x509.Expired || invalid.Cert == nil {
+		return ""
+	}
+	cert := invalid.Cert
+	gap := ValidityGap(cert, now)
+	switch {
+	case gap < 0:
+		return fmt.Sprintf("certificate %q isn't valid until %s, %s from now, check this host's clock if that's unexpected",
+			cert.Subject.CommonName, cert.NotBefore.UTC().Format(time.RFC3339), (-gap).Round(time.Second))
+	case gap > 0:
+		return fmt.Sprintf("certificate %q expired at %s, %s ago, check this host's clock if that's unexpected",
+			cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339), gap.Round(time.Second))
+	}
+	return ""
+}
+
+// maxSkewRetries limits how often VerifyWithSkew adjusts the verification time.
+const maxSkewRetries = 4
+
+// VerifyWithSkew verifies leaf as leaf.Verify(opts) does except that, if
+// verification fails only because a certificate in the chain is at most
+// tolerance outside its validity period, it's verified again as of the
+// nearest time within that period. The verification time is opts.CurrentTime,
+// or the current time if it's zero. skew is how far the verification time was
+// adjusted, 0 if it wasn't. A tolerance of 0 disables the adjustment.
+func VerifyWithSkew(leaf *x509.Certificate, opts x509.VerifyOptions, tolerance time.Duration) (chains [][]*x509.Certificate, skew time.Duration, err error) {
+	now := opts.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+	opts.CurrentTime = now
+	chains, err = leaf.Verify(opts)
+	if err == nil || tolerance <= 0 {
+		return chains, 0, err
+	}
+	// Each retry moves the time into the validity period of the certificate
+	// that failed, a few retries cover the leaf, intermediates, and root.
+	retryErr := err
+	for i := 0; i < maxSkewRetries; i++ {
+		var invalid x509.CertificateInvalidError
+		if !errors.As(retryErr, &invalid) || invalid.Reason != x509.Expired || invalid.Cert == nil {
+			break
+		}
+		t := opts.CurrentTime
+		if t.Before(invalid.Cert.NotBefore) {
+			t = invalid.Cert.NotBefore
+		} else {
+			t = invalid.Cert.NotAfter
+		}
+		adjusted := t.Sub(now)
+		if adjusted < -tolerance || adjusted > tolerance {
+			break
+		}
+		opts.CurrentTime = t
+		chains, retryErr = leaf.Verify(opts)
+		if retryErr == nil {
+			return chains, adjusted, nil
+		}
+	}
+	// The original error reports the actual time rather than an adjusted one
+	return nil, 0, err
+}
+
+// DescribeSkew describes a verification time adjustment returned by
+// VerifyWithSkew in terms of the local clock, e.g., '3m0s behind'.
+func DescribeSkew(skew time.Duration) string {
+	if skew < 0 {
+		return fmt.Sprintf("%s ahead", (-skew).Round(time.Second))
+	}
+	return fmt.Sprintf("%s behind", skew.Round(time.Second))
+}
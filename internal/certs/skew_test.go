@@ -0,0 +1,143 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidityGap(t *testing.T) {
+	now := time.Now()
+	cert := &x509.Certificate{NotBefore: now, NotAfter: now.Add(time.Hour)}
+	tests := []struct {
+		t    time.Time
+		want time.Duration
+	}{
+		{now.Add(-time.Minute), -time.Minute},
+		{now, 0},
+		{now.Add(30 * time.Minute), 0},
+		{now.Add(time.Hour), 0},
+		{now.Add(time.Hour + time.Second), time.Second},
+	}
+	for _, tc := range tests {
+		if got := ValidityGap(cert, tc.t); got != tc.want {
+			t.Errorf("got the gap %s at %s, want %s", got, tc.t.Sub(now), tc.want)
+		}
+	}
+}
+
+// skewedChain returns a root, an intermediate, and a leaf issued by it, with
+// the leaf and intermediate valid for an hour starting at the given offsets
+// from now, and the options verifying the leaf as of now.
+func skewedChain(t *testing.T, leafStart, caStart time.Duration) (leaf *x509.Certificate, opts x509.VerifyOptions) {
+	t.Helper()
+	// Certificate times are in whole seconds
+	now := time.Now().Truncate(time.Second)
+	root, rootKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test Root"}, IsCA: true}, nil, nil)
+	ca, caKey := issue(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "Test Intermediate"},
+		IsCA:      true,
+		NotBefore: now.Add(caStart),
+		NotAfter:  now.Add(caStart + time.Hour),
+	}, root, rootKey)
+	leaf, _ = issue(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "localhost"},
+		DNSNames:  []string{"localhost"},
+		NotBefore: now.Add(leafStart),
+		NotAfter:  now.Add(leafStart + time.Hour),
+	}, ca, caKey)
+	opts = x509.VerifyOptions{DNSName: "localhost", Roots: x509.NewCertPool(), Intermediates: x509.NewCertPool(), CurrentTime: now}
+	opts.Roots.AddCert(root)
+	opts.Intermediates.AddCert(ca)
+	return leaf, opts
+}
+
+func TestVerifyWithSkew(t *testing.T) {
+	tests := []struct {
+		name      string
+		leafStart time.Duration
+		caStart   time.Duration
+		tolerance time.Duration
+		wantSkew  time.Duration
+		wantErr   bool
+	}{
+		{"valid", -time.Minute, -time.Minute, time.Minute, 0, false},
+		{"leaf not yet valid, off", 2 * time.Minute, -time.Minute, 0, 0, true},
+		{"leaf not yet valid, within the tolerance", 2 * time.Minute, -time.Minute, 5 * time.Minute, 2 * time.Minute, false},
+		{"leaf not yet valid, beyond the tolerance", 10 * time.Minute, -time.Minute, 5 * time.Minute, 0, true},
+		{"leaf expired, within the tolerance", -time.Hour - 3*time.Minute, -time.Hour - 3*time.Minute, 5 * time.Minute, -3 * time.Minute, false},
+		// The intermediate's period ends before the leaf's starts, no single
+		// time is within both
+		{"disjoint periods", 2 * time.Minute, -time.Hour + time.Minute, 5 * time.Minute, 0, true},
+		// Each retry moves into the period of the next certificate that fails
+		{"leaf and intermediate not yet valid", 2 * time.Minute, 3 * time.Minute, 5 * time.Minute, 3 * time.Minute, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			leaf, opts := skewedChain(t, tc.leafStart, tc.caStart)
+			now := opts.CurrentTime
+			chains, skew, err := VerifyWithSkew(leaf, opts, tc.tolerance)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("verification succeeded with the skew %s", skew)
+				}
+				// The error is reported at the actual time
+				if _, origErr := leaf.Verify(opts); origErr == nil || err.Error() != origErr.Error() {
+					t.Errorf("got the error %q, want the unadjusted verification's %v", err, origErr)
+				}
+				if skew != 0 || chains != nil {
+					t.Errorf("got the skew %s and %d chains with the error, want none", skew, len(chains))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verification failed: %s", err)
+			}
+			if len(chains) != 1 {
+				t.Errorf("got %d chains, want 1", len(chains))
+			}
+			if skew != tc.wantSkew {
+				t.Errorf("got the skew %s, want %s", skew, tc.wantSkew)
+			}
+			if !opts.CurrentTime.Equal(now) {
+				t.Error("the caller's verification options were modified")
+			}
+		})
+	}
+}
+
+func TestExplainValidity(t *testing.T) {
+	leaf, opts := skewedChain(t, 2*time.Minute, -time.Minute)
+	_, err := leaf.Verify(opts)
+	got := ExplainValidity(fmt.Errorf("wrapped: %w", err), opts.CurrentTime)
+	if !strings.HasPrefix(got, `certificate "localhost" isn't valid until `) || !strings.Contains(got, ", 2m0s from now, check this host's clock") {
+		t.Errorf("got %q for a certificate that isn't valid yet", got)
+	}
+
+	leaf, opts = skewedChain(t, -time.Minute, -time.Hour-90*time.Second)
+	_, err = leaf.Verify(opts)
+	got = ExplainValidity(err, opts.CurrentTime)
+	if !strings.HasPrefix(got, `certificate "Test Intermediate" expired at `) || !strings.Contains(got, ", 1m30s ago, check this host's clock") {
+		t.Errorf("got %q for an expired intermediate", got)
+	}
+
+	if got := ExplainValidity(x509.UnknownAuthorityError{}, time.Now()); got != "" {
+		t.Errorf("got %q for an unknown authority, want none", got)
+	}
+}
+
+func TestDescribeSkew(t *testing.T) {
+	if got := DescribeSkew(3 * time.Minute); got != "3m0s behind" {
+		t.Errorf("got %q for 3m, want 3m0s behind", got)
+	}
+	if got := DescribeSkew(-90 * time.Second); got != "1m30s ahead" {
+		t.Errorf("got %q for -90s, want 1m30s ahead", got)
+	}
+}
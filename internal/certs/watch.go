@@ -0,0 +1,95 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchDebounce is how long Watch waits for file events to stop before
+// calling onChange.
+const DefaultWatchDebounce = 500 * time.Millisecond
+
+// Watch calls onChange whenever any of files changes, until ctx is done. Files
+// that are really environment variables or stdin (see ReadSource) are ignored.
+//
+// Rather than the files themselves, the directories containing them are
+// watched. This handles the atomic update pattern used for Kubernetes secret
+// and configmap volumes, where each file is a symlink into a '..data'
+// directory that is itself a symlink swapped on every update. Watching the
+// file directly would follow the original symlink target and stop seeing
+// changes after the first update.
+//
+// Editors and deployment tools often produce several events for a single
+// logical change, so onChange is only called once no events have been seen
+// for debounce.
+func Watch(ctx context.Context, files []string, debounce time.Duration, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("unable to create file watcher: %w", err)
+	}
+
+	names := map[string]bool{}
+	dirs := map[string]bool{}
+	for _, f := range files {
+		if f == "" || f == StdinSource || strings.HasPrefix(f, EnvSourcePrefix) {
+			continue
+		}
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			watcher.Close()
+			return fmt.Errorf("unable to resolve path %s: %w", f, err)
+		}
+		names[filepath.Base(abs)] = true
+		dirs[filepath.Dir(abs)] = true
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("unable to watch directory %s: %w", dir, err)
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				base := filepath.Base(ev.Name)
+				// '..data' and its temporary siblings are the Kubernetes
+				// atomic writer's symlinks
+				if names[base] || strings.HasPrefix(base, "..") {
+					timer.Reset(debounce)
+				}
+			case <-timer.C:
+				onChange()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				// Errors here are typically event queue overflows, which
+				// are best handled by assuming something changed.
+				log.Printf("Certificate file watcher error: %s", err)
+				timer.Reset(debounce)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package certs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testDebounce = 50 * time.Millisecond
+
+// watch watches files, returning a channel that receives each call to
+// onChange.
+func watch(t *testing.T, files ...string) <-chan struct{} {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	changes := make(chan struct{}, 10)
+	if err := Watch(ctx, files, testDebounce, func() { changes <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+	return changes
+}
+
+// expectChanges checks onChange is called want times within a second.
+func expectChanges(t *testing.T, changes <-chan struct{}, want int) {
+	t.Helper()
+	got := 0
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case <-changes:
+			got++
+		case <-timeout:
+			if got != want {
+				t.Errorf("got %d changes, want %d", got, want)
+			}
+			return
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(cert, []byte("first"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	changes := watch(t, cert, "env:GOHTTPS_KEY", StdinSource)
+
+	// Several writes in quick succession are one change
+	for i := 0; i < 3; i++ {
+		if err := os.WriteFile(cert, []byte("second"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectChanges(t, changes, 1)
+
+	// Other files in the directory aren't watched
+	if err := os.WriteFile(filepath.Join(dir, "other.pem"), []byte("other"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expectChanges(t, changes, 0)
+}
+
+// TestWatchKubernetesVolume updates a file the way Kubernetes updates secret
+// volumes, by swapping the '..data' symlink the file's symlink points through.
+func TestWatchKubernetesVolume(t *testing.T) {
+	dir := t.TempDir()
+	for _, version := range []string{"..v1", "..v2"} {
+		if err := os.Mkdir(filepath.Join(dir, version), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, version, "cert.pem"), []byte(version), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("..v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	cert := filepath.Join(dir, "cert.pem")
+	if err := os.Symlink(filepath.Join("..data", "cert.pem"), cert); err != nil {
+		t.Fatal(err)
+	}
+	changes := watch(t, cert)
+
+	for _, version := range []string{"..v2", "..v1"} {
+		tmp := filepath.Join(dir, "..data_tmp")
+		if err := os.Symlink(version, tmp); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+			t.Fatal(err)
+		}
+		expectChanges(t, changes, 1)
+		if b, err := os.ReadFile(cert); err != nil || string(b) != version {
+			t.Fatalf("got %q, %v, want the content of %s", b, err, version)
+		}
+	}
+}
+
+func TestWatchStops(t *testing.T) {
+	cert := filepath.Join(t.TempDir(), "cert.pem")
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 10)
+	if err := Watch(ctx, []string{cert}, testDebounce, func() { changes <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	time.Sleep(testDebounce)
+	if err := os.WriteFile(cert, []byte("cert"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expectChanges(t, changes, 0)
+}
+
+func TestWatchMissingDirectory(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing", "cert.pem")
+	if err := Watch(context.Background(), []string{missing}, testDebounce, func() {}); err == nil {
+		t.Error("watching a file in a missing directory succeeded")
+	}
+}
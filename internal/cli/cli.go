@@ -0,0 +1,313 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package cli contains the flag handling shared by the commands in this
+// repository, and the subcommand dispatching used by the 'gohttps' command.
+package cli
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/certs"
+	"github.com/youngkin/gohttps/internal/dump"
+	"github.com/youngkin/gohttps/internal/logging"
+	"github.com/youngkin/gohttps/internal/redact"
+	"github.com/youngkin/gohttps/internal/tcpopt"
+)
+
+// ServerCertUsage is the usage text for the flags registered by ServerCertFlags.
+const ServerCertUsage = `  -srvcert    Required unless -srvcert-env is used, the name the server's certificate file
+  -srvkey     Required unless -srvkey-env is used, the name the server's key certificate file.
+              PKCS#1 RSA, SEC 1 EC, and PKCS#8 keys, optionally encrypted, are supported
+  -chain      Optional, the name of a file of intermediate CA certificates to serve after
+              the -srvcert certificates, for when -srvcert doesn't include them. Clients
+              other than browsers, e.g., curl and Go, fail to verify a chain missing an
+              intermediate. The chain served is logged, with a warning if it's incomplete
+              or out of order
+  -srvkey-pass
+              Optional, the passphrase used to decrypt an encrypted server private key
+  -srvkey-pass-file
+              Optional, the name of a file containing the passphrase used to decrypt an
+              encrypted server private key
+  -srvcert-env
+              Optional, the name of an environment variable containing the server's PEM, or
+              base64 encoded PEM, certificate. Used when -srvcert isn't provided, defaults
+              to GOHTTPS_SRVCERT
+  -srvkey-env
+              Optional, the name of an environment variable containing the server's PEM, or
+              base64 encoded PEM, private key. Used when -srvkey isn't provided, defaults
+              to GOHTTPS_SRVKEY`
+
+// SourceUsage describes the values accepted by certificate, key, and CA flags.
+const SourceUsage = `Certificate, key, and CA options accept a file name, 'env:VARNAME' to read PEM content
+from the VARNAME environment variable, or '-' to read PEM content from stdin. Only one
+option may read from stdin.`
+
+// ServerCertFlags are the flags, common to all servers, that specify the
+// server's certificate and private key.
+type ServerCertFlags struct {
+	Cert        string
+	CertEnv     string
+	Chain       string
+	Key         string
+	KeyEnv      string
+	KeyPass     string
+	KeyPassFile string
+}
+
+// Register defines the flags in fs.
+func (f *ServerCertFlags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Cert, "srvcert", "", "Required, the name of the server's certificate file")
+	fs.StringVar(&f.Key, "srvkey", "", "Required, the file name of the server's private key file")
+	fs.StringVar(&f.Chain, "chain", "", "Optional, the name of a file of intermediate CA certificates served after the -srvcert certificates")
+	fs.StringVar(&f.CertEnv, "srvcert-env", "GOHTTPS_SRVCERT", "Optional, the environment variable containing the server's PEM or base64 encoded PEM certificate, used when -srvcert isn't provided")
+	fs.StringVar(&f.KeyEnv, "srvkey-env", "GOHTTPS_SRVKEY", "Optional, the environment variable containing the server's PEM or base64 encoded PEM private key, used when -srvkey isn't provided")
+	fs.StringVar(&f.KeyPass, "srvkey-pass", "", "Optional, the passphrase for an encrypted server private key")
+	fs.StringVar(&f.KeyPassFile, "srvkey-pass-file", "", "Optional, the name of a file containing the passphrase for an encrypted server private key")
+}
+
+// Loader returns a function that loads the server's certificate and private
+// key as specified by the flags. The passphrase, if any, is read once when
+// Loader is called so the returned function can be called again to reload
+// the certificate. Each load logs the certificate's key details and the chain
+// served, and warns of any problems with the chain that some Go versions fail
+// to verify it because of, see certs.CheckCompatibility, or that stop clients
+// verifying it at all, see certs.CheckChain.
+func (f *ServerCertFlags) Loader() (func() (tls.Certificate, error), error) {
+	passphrase, err := certs.ReadPassphrase(f.KeyPass, f.KeyPassFile)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Go runtime %s on %s/%s", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return func() (tls.Certificate, error) {
+		return f.load(passphrase)
+	}, nil
+}
+
+func (f *ServerCertFlags) load(passphrase []byte) (tls.Certificate, error) {
+	certPEM, err := certs.ReadPEM(f.Cert, f.CertEnv)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to load the server certificate (-srvcert or -srvcert-env): %w", err)
+	}
+	keyPEM, err := certs.ReadPEM(f.Key, f.KeyEnv)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to load the server private key (-srvkey or -srvkey-env): %w", err)
+	}
+	cert, err := certs.X509KeyPair(certPEM, keyPEM, passphrase)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error creating x509 keypair from the server certificate and private key: %w", err)
+	}
+	if f.Chain != "" {
+		if err := appendChain(&cert, f.Chain); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	leaf, err := certs.Leaf(cert)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error parsing the server certificate: %w", err)
+	}
+	log.Printf("Server certificate for %s: %s", leaf.Subject.CommonName, certs.DescribeKey(leaf))
+	chain := []*x509.Certificate{leaf}
+	for _, der := range cert.Certificate[1:] {
+		if c, err := x509.ParseCertificate(der); err == nil {
+			chain = append(chain, c)
+		}
+	}
+	for _, w := range certs.CheckCompatibility(chain) {
+		logging.Warnf("%s", w)
+	}
+	served := fmt.Sprintf("%d certificate", len(cert.Certificate))
+	if len(cert.Certificate) != 1 {
+		served += "s"
+	}
+	log.Printf("Serving a certificate chain of %s: %s", served, certs.DescribeChain(chain))
+	for _, w := range certs.CheckChain(chain) {
+		logging.Warnf("%s", w)
+	}
+	return cert, nil
+}
+
+// appendChain appends the certificates in chainFile to cert's chain, other
+// than those it already has, e.g., because -srvcert includes them.
+func appendChain(cert *tls.Certificate, chainFile string) error {
+	chainPEM, err := certs.ReadSource(chainFile)
+	if err != nil {
+		return fmt.Errorf("unable to read the -chain certificates: %w", err)
+	}
+	intermediates, err := certs.ParseCertificates(chainPEM)
+	if err != nil {
+		return fmt.Errorf("invalid -chain certificates in %s: %w", chainFile, err)
+	}
+	have := map[string]bool{}
+	for _, der := range cert.Certificate {
+		have[string(der)] = true
+	}
+	for _, c := range intermediates {
+		if have[string(c.Raw)] {
+			logging.Debugf("Skipping the -chain certificate %q, -srvcert already includes it", c.Subject)
+			continue
+		}
+		have[string(c.Raw)] = true
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	return nil
+}
+
+// ListenExitUsage describes the exit statuses of servers that can't listen,
+// see listen.Explain.
+const ListenExitUsage = `If the server can't listen on its port it explains why, and how to fix it, then exits with
+status 10 if the port is already in use, or 11 if permission to listen on it is denied,
+e.g., for ports below 1024 without privileges.`
+
+// TCPUsage is the usage text for the flags registered by TCPFlags.
+const TCPUsage = `  -tcp-keepalive
+              Optional, the TCP keep-alive period, e.g., 30s. Defaults to 0, Go's default of
+              15s, a negative value disables keep-alives
+  -tcp-nodelay
+              Optional, set TCP_NODELAY, disabling Nagle's algorithm. Defaults to true,
+              -tcp-nodelay=false enables Nagle's algorithm
+  -so-rcvbuf  Optional, the socket receive buffer size (SO_RCVBUF) in bytes. Defaults to the
+              system's default. Only supported on Linux and the BSDs, including macOS, where
+              the system may adjust the size, e.g., Linux doubles it
+  -so-sndbuf  Optional, the socket send buffer size (SO_SNDBUF) in bytes, with the same
+              defaults and limitations as -so-rcvbuf`
+
+// TCPFlags are the TCP tuning flags shared by the client and servers.
+type TCPFlags struct {
+	KeepAlive  time.Duration
+	NoDelay    bool
+	RecvBuffer int
+	SendBuffer int
+}
+
+// Register defines the flags in fs.
+func (f *TCPFlags) Register(fs *flag.FlagSet) {
+	fs.DurationVar(&f.KeepAlive, "tcp-keepalive", 0, "Optional, the TCP keep-alive period, 0 is Go's default and a negative value disables keep-alives")
+	fs.BoolVar(&f.NoDelay, "tcp-nodelay", true, "Optional, set TCP_NODELAY, false enables Nagle's algorithm")
+	fs.IntVar(&f.RecvBuffer, "so-rcvbuf", 0, "Optional, the socket receive buffer size in bytes, 0 is the system default")
+	fs.IntVar(&f.SendBuffer, "so-sndbuf", 0, "Optional, the socket send buffer size in bytes, 0 is the system default")
+}
+
+// Options returns the tcpopt.Options specified by the flags.
+func (f *TCPFlags) Options() (tcpopt.Options, error) {
+	if f.RecvBuffer < 0 || f.SendBuffer < 0 {
+		return tcpopt.Options{}, fmt.Errorf("-so-rcvbuf and -so-sndbuf must not be negative")
+	}
+	return tcpopt.Options{
+		KeepAlive:  f.KeepAlive,
+		Nagle:      !f.NoDelay,
+		RecvBuffer: f.RecvBuffer,
+		SendBuffer: f.SendBuffer,
+	}, nil
+}
+
+// LogUsage is the usage text for the flags registered by LogFlags.
+const LogUsage = `  -log-level  Optional, the minimum level of the messages logged, one of debug, info, warn,
+              or error, defaults to info. Individual requests are logged at debug
+  -verbose    Optional, the same as -log-level debug
+  -quiet      Optional, the same as -log-level warn
+  -log-format Optional, the log format, text or json, defaults to text
+  -log-color  Optional, whether text logs are colorized, auto, always, or never. Defaults to
+              auto, which colorizes only if stderr is a terminal and NO_COLOR isn't set`
+
+// LogFlags are the logging flags shared by all commands.
+type LogFlags struct {
+	Level   string
+	Verbose bool
+	Quiet   bool
+	Format  string
+	Color   string
+}
+
+// Register defines the flags in fs.
+func (f *LogFlags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Level, "log-level", "info", "Optional, the minimum level of the messages logged, one of debug, info, warn, or error")
+	fs.BoolVar(&f.Verbose, "verbose", false, "Optional, the same as -log-level debug")
+	fs.BoolVar(&f.Quiet, "quiet", false, "Optional, the same as -log-level warn")
+	fs.StringVar(&f.Format, "log-format", logging.FormatText, "Optional, the log format, text or json")
+	fs.StringVar(&f.Color, "log-color", logging.ColorAuto, "Optional, whether text logs are colorized, auto, always, or never")
+}
+
+// Setup configures logging to stderr as specified by the flags.
+func (f *LogFlags) Setup() error {
+	if f.Verbose && f.Quiet {
+		return fmt.Errorf("only one of -verbose and -quiet may be used")
+	}
+	level, err := logging.ParseLevel(f.Level)
+	if err != nil {
+		return err
+	}
+	switch {
+	case f.Verbose:
+		level = logging.Debug
+	case f.Quiet:
+		level = logging.Warn
+	}
+	return logging.Setup(os.Stderr, f.Format, f.Color, level)
+}
+
+// DumpUsage is the usage text for the flags registered by DumpFlags.
+const DumpUsage = `  -dump-http  Optional, write every HTTP request and response, as sent on the wire, to stderr,
+              e.g., to show the messages exchanged. The values of sensitive headers, e.g.,
+              Authorization and Cookie, are redacted, and compressed and binary bodies are
+              labeled rather than written. The client's requests are shown in HTTP/1.1
+              form, even if they're sent using HTTP/2, and the servers' responses without
+              the headers, e.g., Date, net/http adds as they're sent
+  -dump-http-max-body
+              Optional, with -dump-http, the maximum number of bytes of each body written,
+              defaults to 4096. Longer bodies are truncated`
+
+// DumpFlags are the -dump-http flags shared by all commands.
+type DumpFlags struct {
+	Enabled bool
+	MaxBody int
+}
+
+// Register defines the flags in fs.
+func (f *DumpFlags) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.Enabled, "dump-http", false, "Optional, write every HTTP request and response, as sent on the wire, to stderr")
+	fs.IntVar(&f.MaxBody, "dump-http-max-body", dump.DefaultMaxBody, "Optional, with -dump-http, the maximum number of bytes of each body written")
+}
+
+// Writer returns the dump.Writer, writing to stderr, specified by the flags,
+// nil if -dump-http isn't set.
+func (f *DumpFlags) Writer() (*dump.Writer, error) {
+	if f.MaxBody < 1 {
+		return nil, fmt.Errorf("-dump-http-max-body must be greater than 0")
+	}
+	if !f.Enabled {
+		return nil, nil
+	}
+	return dump.NewWriter(os.Stderr, f.MaxBody), nil
+}
+
+// secretFlags are the flags whose values LogConfig doesn't log.
+var secretFlags = map[string]bool{
+	"srvkey-pass": true,
+}
+
+// LogConfig logs the name and value of every flag in fs, e.g., to show the
+// configuration a command is actually using. The values of flags containing
+// secrets, e.g., passphrases, are redacted. notes, keyed by flag name, are
+// appended to the corresponding values, e.g., to explain what they mean.
+func LogConfig(fs *flag.FlagSet, notes map[string]string) {
+	log.Printf("Configuration:")
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = redact.Placeholder
+		}
+		if note := notes[f.Name]; note != "" {
+			value += " (" + note + ")"
+		}
+		log.Printf("  -%s = %s", f.Name, value)
+	})
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cli
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/dump"
+	"github.com/youngkin/gohttps/internal/tcpopt"
+)
+
+func TestTCPFlags(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    tcpopt.Options
+		wantErr bool
+	}{
+		{args: nil, want: tcpopt.Options{}},
+		{
+			args: []string{"-tcp-keepalive", "30s", "-tcp-nodelay=false", "-so-rcvbuf", "65536", "-so-sndbuf", "32768"},
+			want: tcpopt.Options{KeepAlive: 30 * time.Second, Nagle: true, RecvBuffer: 65536, SendBuffer: 32768},
+		},
+		{args: []string{"-tcp-keepalive", "-1s"}, want: tcpopt.Options{KeepAlive: -time.Second}},
+		{args: []string{"-so-rcvbuf", "-1"}, wantErr: true},
+		{args: []string{"-so-sndbuf", "-1"}, wantErr: true},
+	}
+	for _, tc := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		var f TCPFlags
+		f.Register(fs)
+		if err := fs.Parse(tc.args); err != nil {
+			t.Fatalf("parsing %q failed: %s", tc.args, err)
+		}
+		got, err := f.Options()
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("got the options %+v for %q, want an error", got, tc.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("got the error %s for %q, want the options", err, tc.args)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("got the options %+v for %q, want %+v", got, tc.args, tc.want)
+		}
+	}
+}
+
+func TestDumpFlags(t *testing.T) {
+	tests := []struct {
+		args    []string
+		enabled bool
+		maxBody int
+		wantErr bool
+	}{
+		{nil, false, 0, false},
+		{[]string{"-dump-http"}, true, dump.DefaultMaxBody, false},
+		{[]string{"-dump-http", "-dump-http-max-body", "16"}, true, 16, false},
+		{[]string{"-dump-http", "-dump-http-max-body", "0"}, false, 0, true},
+	}
+	for _, tc := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var f DumpFlags
+		f.Register(fs)
+		if err := fs.Parse(tc.args); err != nil {
+			t.Fatal(err)
+		}
+		d, err := f.Writer()
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("got no error for %q, want one", tc.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("got the error %s for %q", err, tc.args)
+			continue
+		}
+		if (d != nil) != tc.enabled || d != nil && d.MaxBody() != tc.maxBody {
+			t.Errorf("got the writer %+v for %q, want one with a maximum body of %d bytes %v", d, tc.args, tc.maxBody, tc.enabled)
+		}
+	}
+}
+
+func TestLogFlagsConflict(t *testing.T) {
+	f := LogFlags{Level: "info", Verbose: true, Quiet: true, Format: "text", Color: "never"}
+	if err := f.Setup(); err == nil {
+		t.Error("setting up logging with -verbose and -quiet succeeded")
+	}
+	f = LogFlags{Level: "trace", Format: "text", Color: "never"}
+	if err := f.Setup(); err == nil {
+		t.Error("setting up logging with -log-level trace succeeded")
+	}
+}
+
+// TestServerCertLoaderWarns checks loading a certificate with a problem
+// some Go versions reject it for logs a warning.
+func TestServerCertLoaderWarns(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The certificate only has a Common Name, no SANs
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	f := ServerCertFlags{Cert: filepath.Join(dir, "cert.pem"), Key: filepath.Join(dir, "key.pem")}
+	if err := ioutil.WriteFile(f.Cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(f.Key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&out)
+	load, err := f.Loader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Go runtime ", `WARNING: the leaf certificate "CN=localhost" only has a Common Name`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("got the log %q, want it to include %q", out.String(), want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Command is a subcommand of the 'gohttps' command.
+type Command struct {
+	// Name is the name used to invoke the command, e.g., 'gohttps client'.
+	Name string
+	// Summary is a one line description of the command.
+	Summary string
+	// Main runs the command. name is the name the command was invoked as, for
+	// use in usage messages, and args are its arguments, not including name.
+	Main func(name string, args []string)
+}
+
+// Dispatch runs the command named by args[1], or prints the list of commands
+// if there isn't one. It exits with a non-zero status if the command is unknown.
+func Dispatch(commands []Command, args []string) {
+	prog := "gohttps"
+	if len(args) < 2 || args[1] == "-help" || args[1] == "--help" || args[1] == "-h" || args[1] == "help" {
+		fmt.Println(commandUsage(prog, commands))
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.Name == args[1] {
+			cmd.Main(prog+" "+cmd.Name, args[2:])
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n%s\n", args[1], commandUsage(prog, commands))
+	os.Exit(2)
+}
+
+func commandUsage(prog string, commands []Command) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "usage:\n\n%s <command> [options]\n\nCommands:\n", prog)
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "  %-16s%s\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Fprintf(&b, "\nRun '%s <command> -help' for a command's options.", prog)
+	return b.String()
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigUsage is the usage text for the -config and -config-profile flags
+// whose values ApplyConfig is called with.
+const ConfigUsage = `  -config     Optional, the name of a JSON file of option values, keyed by option name
+              without the '-', e.g., {"srvhost": "staging:8443", "cacert": "ca.pem", "n": 5}.
+              Repeatable options take a list, e.g., "srvhost": ["a:8443", "b:8443"], and
+              durations a string, e.g., "5s". Options given on the command line override
+              the file's. The file may also have named "profiles", objects of option values
+              that override the file's top level ones, e.g.,
+              {"cacert": "ca.pem", "profiles": {"prod": {"srvhost": "prod:8443"}}}
+  -config-profile
+              Optional, with -config, the name of the profile in the file to use, e.g., to
+              switch between staging and production`
+
+// profilesKey is the key of the named profiles in a configuration file.
+const profilesKey = "profiles"
+
+// ApplyConfig sets the flags of fs, which must already be parsed, that
+// weren't set on the command line to their values in the JSON configuration
+// file path, see ConfigUsage, and, if profile isn't empty, the values of the
+// named profile in it. It's an error if the file, or the profile, has a value
+// for a flag fs doesn't define, or that isn't valid for its flag.
+func ApplyConfig(fs *flag.FlagSet, path, profile string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read the configuration file: %w", err)
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+	var profiles map[string]map[string]json.RawMessage
+	if raw, ok := values[profilesKey]; ok {
+		if err := json.Unmarshal(raw, &profiles); err != nil {
+			return fmt.Errorf("invalid %q in the configuration file %s: %w", profilesKey, path, err)
+		}
+		delete(values, profilesKey)
+	}
+	if profile != "" {
+		p, ok := profiles[profile]
+		if !ok {
+			names := make([]string, 0, len(profiles))
+			for name := range profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("the configuration file %s doesn't have a profile %q, its profiles are [%s]", path, profile, strings.Join(names, ", "))
+		}
+		for name, v := range p {
+			values[name] = v
+		}
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fs.Lookup(name) == nil || name == "config" || name == "config-profile" {
+			return fmt.Errorf("the configuration file %s has a value for %q, which isn't an option", path, name)
+		}
+		if set[name] {
+			continue
+		}
+		args, err := configArgs(values[name])
+		if err != nil {
+			return fmt.Errorf("invalid value for %q in the configuration file %s: %w", name, path, err)
+		}
+		for _, arg := range args {
+			if err := fs.Set(name, arg); err != nil {
+				return fmt.Errorf("invalid value for %q in the configuration file %s: %w", name, path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configArgs returns the command line arguments equivalent to raw, a string,
+// number, or boolean, or a list of them for a repeatable flag.
+func configArgs(raw json.RawMessage) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		list = []interface{}{v}
+	}
+	args := make([]string, 0, len(list))
+	for _, v := range list {
+		switch v := v.(type) {
+		case string:
+			args = append(args, v)
+		case json.Number:
+			args = append(args, v.String())
+		case bool:
+			args = append(args, strconv.FormatBool(v))
+		default:
+			return nil, fmt.Errorf("%s isn't a string, number, or boolean", raw)
+		}
+	}
+	return args, nil
+}
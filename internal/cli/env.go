@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvName returns the name of the environment variable for the flag name,
+// prefix followed by the name in upper case with '-' replaced by '_', e.g.,
+// GOHTTPS_CLIENT_CLIENTKEY_PASS for clientkey-pass.
+func EnvName(prefix, name string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// EnvUsage returns the usage text describing the environment variables
+// ApplyEnv reads with prefix, with examples for the names.
+func EnvUsage(prefix string, names ...string) string {
+	examples := make([]string, len(names))
+	for i, name := range names {
+		examples[i] = fmt.Sprintf("%s for -%s", EnvName(prefix, name), name)
+	}
+	return fmt.Sprintf(`Every option can also be set by an environment variable named %s followed by the
+option's name in upper case, with '-' replaced by '_', e.g.,
+  %s
+Options given on the command line take precedence over environment variables, which take
+precedence over -config and the defaults. Repeatable options take a single value from the
+environment, and boolean options true or false.`, prefix, strings.Join(examples, "\n  "))
+}
+
+// ApplyEnv sets the flags of fs, which must already be parsed, that weren't
+// set on the command line to the values of their environment variables, see
+// EnvName, if they're set. -help and -version aren't read from the
+// environment. It's an error if a variable's value isn't valid for its flag.
+func ApplyEnv(fs *flag.FlagSet, prefix string) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] || f.Name == "help" || f.Name == "version" {
+			return
+		}
+		env := EnvName(prefix, f.Name)
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			return
+		}
+		if e := fs.Set(f.Name, value); e != nil {
+			err = fmt.Errorf("invalid value %q for -%s in the %s environment variable: %w", value, f.Name, env, e)
+		}
+	})
+	return err
+}
@@ -0,0 +1,1333 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package advserver implements the advanced server command, an HTTPS server
+// that demonstrates a wider range of TLS configuration options, including
+// client certificate authentication.
+package advserver
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/youngkin/gohttps/httpsclient"
+	"github.com/youngkin/gohttps/httpsserver"
+	"github.com/youngkin/gohttps/internal/accessdb"
+	"github.com/youngkin/gohttps/internal/audit"
+	"github.com/youngkin/gohttps/internal/cache"
+	"github.com/youngkin/gohttps/internal/certs"
+	"github.com/youngkin/gohttps/internal/cli"
+	"github.com/youngkin/gohttps/internal/health"
+	"github.com/youngkin/gohttps/internal/inflight"
+	"github.com/youngkin/gohttps/internal/listen"
+	"github.com/youngkin/gohttps/internal/logging"
+	"github.com/youngkin/gohttps/internal/metrics"
+	"github.com/youngkin/gohttps/internal/middleware"
+	"github.com/youngkin/gohttps/internal/sct"
+	"github.com/youngkin/gohttps/internal/srv"
+	"github.com/youngkin/gohttps/internal/tlsutil"
+	"github.com/youngkin/gohttps/internal/version"
+)
+
+// writeTimeout is the server's WriteTimeout, how long a response has to be
+// written once the request's headers are read.
+const writeTimeout = 10 * time.Second
+
+// Main runs the advanced server. name is the name the command was invoked as
+// and args are the command line arguments following it.
+func Main(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	help := fs.Bool("help", false, "Optional, prints usage info")
+	showVersion := fs.Bool("version", false, "Optional, prints the build version and exits")
+	host := fs.String("host", "", "Required flag, must be the hostname that is resolvable via DNS, or 'localhost'")
+	port := fs.String("port", "443", "The https port, defaults to 443")
+	portFile := fs.String("port-file", "", "Optional, the name of a file to write the port the server is listening on to, e.g., with -port 0")
+	caCert := fs.String("cacert", "", "Required, the name of the CA that signed the client's certificate")
+	caCertEnv := fs.String("cacert-env", "GOHTTPS_CACERT", "Optional, the environment variable containing the PEM or base64 encoded PEM CA certificate, used when -cacert isn't provided")
+	caCertDir := fs.String("cacert-dir", "", "Optional, the name of a directory, e.g., /etc/ssl/certs, whose .pem and .crt files are also loaded as CA certificates")
+	useSystemRoots := fs.Bool("use-system-roots", false, "Optional, also verify client certificates against the system's root CAs")
+	expiryHardStop := fs.Duration("cert-expiry-hard-stop", 0, "Optional, report not ready once the server certificate is within this long of expiring, e.g., 1h, 0 disables")
+	expiryReject := fs.Bool("cert-expiry-reject", false, "Optional, with -cert-expiry-hard-stop, also respond to new requests with 503 within the window")
+	watchCerts := fs.Bool("watch-certs", false, "Optional, reload the server's certificate, key, and CA when their files change")
+	curves := fs.String("curves", "", "Optional, a comma separated list of the elliptic curves the server supports, e.g., 'X25519,P-256'")
+	fs.StringVar(curves, "kex", "", "Optional, the same as -curves, the key exchange groups the server supports, e.g., 'X25519MLKEM768'")
+	requireTLS13 := fs.Bool("require-tls13", false, "Optional, reject clients that don't support TLS 1.3, overrides -profile")
+	profileName := fs.String("profile", "", "Optional, the TLS profile, one of modern, intermediate, or old, that sets the minimum TLS version, cipher suites, and curves")
+	ciphers := fs.String("ciphers", "", "Optional, a comma separated list of the cipher suites the server supports, overrides -profile")
+	clockSkewTolerance := fs.Duration("clock-skew-tolerance", 0, "Optional, accept a client certificate that has expired, or isn't valid yet, by at most this much, e.g., 5m, 0 disables")
+	auditLogFile := fs.String("audit-log", "", "Optional, the name of a file to append a JSON audit trail of client authentication decisions to")
+	strictSNI := fs.Bool("strict-sni", false, "Optional, abort TLS handshakes whose SNI server name isn't -host or a -sni-host")
+	var sniHosts []string
+	fs.Func("sni-host", "Optional, repeatable, with -strict-sni, another server name, e.g., *.example.com, that clients may request", func(v string) error {
+		sniHosts = append(sniHosts, v)
+		return nil
+	})
+	closeConns := fs.Bool("close-connections", false, "Optional, close each connection after its response, with 'Connection: close', instead of keeping it alive")
+	noResumption := fs.Bool("no-resumption", false, "Optional, disable TLS session resumption so every connection performs a full handshake")
+	logResumption := fs.Bool("log-resumption", false, "Optional, log whether each TLS connection's handshake resumed a session")
+	var sctFiles []string
+	fs.Func("sct-file", "Optional, repeatable, a file containing a serialized certificate transparency SCT for the server certificate", func(v string) error {
+		sctFiles = append(sctFiles, v)
+		return nil
+	})
+	preStopDelay := fs.Duration("pre-stop-delay", 0, "Optional, how long to keep serving, while /readyz reports not ready, after a SIGTERM before shutting down, e.g., 10s")
+	longLivedDrainTimeout := fs.Duration("long-lived-drain-timeout", 0, "Optional, how long the /events and /ws connections are given to wrap up when the server shuts down, 0 is the 30s request drain")
+	drainAnnounce := fs.Duration("drain-announce", 5*time.Second, "Optional, how often the number of connections remaining is logged while shutting down, 0 disables")
+	serveCA := fs.Bool("serve-ca", false, "Optional, serve the -cacert CA certificates at /ca.pem and /ca.der so clients can bootstrap trust, e.g., with 'client -fetch-ca'")
+	debugHeaders := fs.Bool("debug-headers", false, "Optional, add the negotiated TLS parameters to every response as X-TLS-* headers")
+	enableGRPC := fs.Bool("grpc", false, "Optional, also serve gRPC requests, over HTTP/2 on the same port and TLS configuration")
+	enableHTTP3 := fs.Bool("http3", false, "Optional, experimental, also serve HTTP/3 over QUIC on the same UDP port")
+	reusePort := fs.Bool("reuseport", false, "Optional, set SO_REUSEPORT on the listener so another server process can listen on the same port, Linux and BSD only")
+	logSampleRate := fs.Uint64("log-sample-rate", 1, "Optional, log 1 in every N successful requests, failed and slow requests are always logged")
+	accessLogFormat := fs.String("access-log-format", "", "Optional, the format of the access log lines, a template such as '{method} {path} {status} {latency} {ip} {cn}', or common, combined, or json")
+	accessLogFile := fs.String("access-log-file", "", "Optional, the name of a file every request is appended to, in -access-log-format, combined by default, without the log's prefix, '-' is stdout")
+	logSlowThreshold := fs.Duration("log-slow-threshold", time.Second, "Optional, requests taking longer than this are always logged, 0 disables")
+	metricsMaxPaths := fs.Int("metrics-max-paths", metrics.DefaultMaxPaths, "Optional, the maximum number of distinct request paths tracked by /metrics")
+	healthcheckBypass := fs.String("healthcheck-bypass", "", "Optional, an address, e.g., 127.0.0.1:8081, on which /healthz and /readyz are served over plain HTTP without client certificates")
+	adminAddr := fs.String("admin", "", "Optional, an address, e.g., 127.0.0.1:9090, on which the /status and /constraints admin routes are served over plain HTTP")
+	maxHandlers := fs.Int("max-concurrent-handlers", 0, "Optional, the maximum number of requests handled at the same time, further requests get a 503, 0 is unlimited")
+	maxHandshakes := fs.Int("max-handshakes", 0, "Optional, the maximum number of TLS handshakes in progress at the same time, further handshakes are aborted, 0 is unlimited")
+	failureHistory := fs.Int("handshake-failures", 50, "Optional, the number of recent TLS handshake failures the -admin listener's /status reports, 0 disables")
+	retryAfter := fs.Duration("retry-after", 5*time.Second, "Optional, the Retry-After of the server's 503 and 429 responses, 0 omits it")
+	maxHandlersWait := fs.Duration("max-concurrent-wait", middleware.DefaultConcurrencyWait, "Optional, how long a request waits for one of the -max-concurrent-handlers to become available")
+	writeDeadlineMargin := fs.Duration("write-deadline-margin", 0, "Optional, give each request's context a deadline this long before the server's 10s write timeout, e.g., 1s, 0 is no such deadline")
+	handlerTimeout := fs.Duration("handler-timeout", 0, "Optional, the deadline of each request's context, which outbound calls made with it inherit, e.g., 5s, 0 is no deadline")
+	upstream := fs.String("upstream", "", "Optional, an https URL that /upstream forwards requests to, demonstrating deadline propagation")
+	enableCache := fs.Bool("cache", false, "Optional, cache the responses to GET requests, e.g., for /bytes, in memory")
+	cacheTTL := fs.Duration("cache-ttl", time.Minute, "Optional, with -cache, how long responses are cached for")
+	cacheMaxEntries := fs.Int("cache-max-entries", 1000, "Optional, with -cache, the maximum number of responses cached, the least recently used are evicted first")
+	cacheAuthenticated := fs.Bool("cache-authenticated", false, "Optional, with -cache, also cache the responses to requests with a client certificate, separately for each certificate")
+	headers := headerFlag{}
+	fs.Var(headers, "header", "Optional, repeatable, a 'Name: value' header added to every response, 'Name:' removes the header")
+	headerConfigFile := fs.String("header-config", "", "Optional, the name of a JSON file of headers added to every response and to the responses of given path prefixes")
+	greeting := fs.String("greeting", "", "Optional, a text/template for the greeting / responds with, e.g., 'Hello {{.Body}} from {{.InstanceID}}'")
+	responseFile := fs.String("response-file", "", "Optional, the name of a file / responds to GET requests with instead of the greeting")
+	responseContentType := fs.String("response-content-type", "", "Optional, with -response-file, its Content-Type, defaults to the type of its extension")
+	watchResponse := fs.Bool("watch-response", false, "Optional, with -response-file, reload it when it changes")
+	faviconFile := fs.String("favicon", "", "Optional, the name of an icon file served at /favicon.ico instead of the built-in one")
+	robotsFile := fs.String("robots", "", "Optional, the name of a file served at /robots.txt instead of the built-in one")
+	securityTxtFile := fs.String("security-txt", "", "Optional, the name of a file served at /.well-known/security.txt instead of the built-in one")
+	quietKnownPaths := fs.Bool("quiet-known-paths", false, "Optional, only log the requests for /favicon.ico, /robots.txt, and /.well-known/security.txt at the debug level")
+	instanceID := fs.String("instance-id", "", "Optional, an identifier of this server, e.g., among the instances behind a load balancer, for -greeting, the logs, and /status")
+	routeConfigFile := fs.String("route-config", "", "Optional, the name of a JSON file of the methods, content types, body sizes, and headers allowed for requests to given path prefixes")
+	maxDelay := fs.Duration("max-delay", httpsserver.DefaultMaxDelay, "Optional, the maximum delay of the /delay route")
+	maxFormBytes := fs.Int64("max-form-bytes", httpsserver.DefaultMaxBytes, "Optional, the maximum size of the requests to the /form route")
+	maxMultipartMemory := fs.Int64("max-multipart-memory", httpsserver.DefaultMaxMultipartMemory, "Optional, the maximum size of the non-file fields of the requests to the /form route")
+	faultRate := fs.Float64("fault-rate", 0, "Optional, the percentage of requests to / that fail with the -fault-status, e.g., 10")
+	faultStatus := fs.Int("fault-status", http.StatusInternalServerError, "Optional, with -fault-rate, the status code of the injected faults")
+	maxBytesRoute := fs.Int64("max-bytes-route", httpsserver.DefaultMaxBytes, "Optional, the maximum number of bytes the /bytes and /drip routes respond with")
+	accessDBFile := fs.String("access-db", "", "Optional, the name of a SQLite database file to record every request in")
+	accessDBRetention := fs.Int("access-db-retention", 0, "Optional, delete -access-db records older than this many days at startup, 0 keeps all records")
+	printConfig := fs.Bool("print-config", false, "Optional, log the value of every option at startup")
+	healthcheckMode := fs.Bool("healthcheck", false, "Optional, request /healthz from the server running on this host's loopback interface and exit with 0 if it's healthy, 1 if it isn't")
+	insecure := fs.Bool("insecure", false, "Optional, with -healthcheck, don't verify the server's certificate, e.g., if it's self-signed")
+	dryRun := fs.Bool("check", false, "Optional, validate the configuration, certificates, and listen addresses, then exit without serving")
+	certOpt := fs.Int("certopt", 0, "Optional, specifies the option for authenticating a client via certificate")
+	var certFlags cli.ServerCertFlags
+	certFlags.Register(fs)
+	var tcpFlags cli.TCPFlags
+	tcpFlags.Register(fs)
+	var logFlags cli.LogFlags
+	logFlags.Register(fs)
+	var dumpFlags cli.DumpFlags
+	dumpFlags.Register(fs)
+	fs.Parse(args)
+
+	usage := fmt.Sprintf(`usage:
+	
+%s -host <hostname> -srvcert <serverCertFile> -cacert <caCertFile> -srvkey <serverPrivateKeyFile> [-chain <chainFile> -cacert-dir <dir> -use-system-roots -cert-expiry-hard-stop <duration> -cert-expiry-reject -port <port> -port-file <file> -certopt <certopt> -curves, -kex <groups> -require-tls13 -strict-sni -sni-host <name>... -close-connections -log-resumption -reuseport -serve-ca -debug-headers -grpc -http3 -sct-file <sctFile>...
+	-drain-announce <duration> -long-lived-drain-timeout <duration> -log-sample-rate <n> -log-slow-threshold <duration> -access-log-format <format> -access-log-file <file> -metrics-max-paths <n> -healthcheck-bypass <address> -admin <address>
+	-max-concurrent-handlers <n> -max-concurrent-wait <duration> -max-handshakes <n> -handshake-failures <n> -handler-timeout <duration> -write-deadline-margin <duration> -upstream <url> -max-bytes-route <bytes> -max-delay <duration> -max-form-bytes <bytes> -max-multipart-memory <bytes>
+	-fault-rate <percent> -fault-status <code> -retry-after <duration> -greeting <template> -instance-id <id>
+	-response-file <file> -response-content-type <type> -watch-response -favicon <file> -robots <file> -security-txt <file> -quiet-known-paths
+	-header <header>... -header-config <file> -route-config <file> -cache -cache-ttl <duration> -cache-max-entries <n> -cache-authenticated
+	-access-db <dbFile> -access-db-retention <days> -clock-skew-tolerance <duration> -print-config -check
+	-tcp-keepalive <duration> -tcp-nodelay=<bool> -so-rcvbuf <bytes> -so-sndbuf <bytes>
+	-log-level <level> -verbose -quiet -log-format <format> -log-color <mode> -dump-http -dump-http-max-body <bytes> -version -help]
+	
+Options:
+  -help       Prints this message
+  -version    Optional, prints the build version, commit, date, and Go version and exits
+  -host       Required, a DNS resolvable host name
+  -port       Optional, the https port for the server to listen on. 0 listens on a free port
+              chosen by the system, which is logged, e.g., for tests. Can't be used with
+              -http3
+  -port-file  Optional, the name of a file to write the port the server is listening on to,
+              followed by a newline, once it's listening, e.g., for a test harness using
+              -port 0 to read. The file is replaced, not partially written, so it can be
+              polled for
+  -cacert     Required unless -cacert-env is used, the name of the CA that signed the client's certificate
+%s
+  -cacert-env
+              Optional, the name of an environment variable containing the PEM, or base64
+              encoded PEM, CA certificate. Used when -cacert isn't provided, defaults to
+              GOHTTPS_CACERT
+  -cacert-dir Optional, the name of a directory, laid out like a system trust store, e.g.,
+              /etc/ssl/certs, whose .pem and .crt files, including those in subdirectories,
+              are loaded as CA certificates in addition to -cacert's. Other files are
+              skipped. The number of certificates loaded, and the files that failed to
+              parse, are logged whenever the CA is loaded
+  -use-system-roots
+              Optional, verify client certificates against the system's root CAs as well
+              as -cacert's, e.g., for clients with publicly issued certificates. Without it
+              only -cacert's CAs are trusted. With it -cacert isn't required, and if the
+              system's roots aren't available on this platform only -cacert's are used
+  -cert-expiry-hard-stop
+              Optional, once the server certificate is within this long of its expiry,
+              e.g., 1h, /readyz reports not ready, so load balancers stop sending it new
+              connections, and a countdown to the expiry is logged, until a reload, e.g.,
+              by SIGHUP or -watch-certs, replaces the certificate. Requests in flight are
+              unaffected. Defaults to 0, disabled
+  -cert-expiry-reject
+              Optional, with -cert-expiry-hard-stop, also respond to new requests, other than
+              /healthz and /readyz, with 503 while the certificate is within the window
+  -watch-certs
+              Optional, watch the -srvcert, -srvkey, -chain, and -cacert files and reload
+              them when they change. Sending the server a SIGHUP also reloads them. If
+              reloading fails the current certificates remain in use
+  -curves, -kex
+              Optional, a comma separated list of the elliptic curves, or key exchange
+              groups, that the server supports. Valid names are X25519, P-256, P-384, P-521,
+              and X25519MLKEM768, the post-quantum hybrid. Defaults to Go's supported
+              curves. Go chooses among the listed curves using its own preference order,
+              regardless of the order given, and clients that support none of them fail
+              the handshake. Names of groups this build of Go doesn't support, e.g.,
+              X25519Kyber768Draft00, are a startup error naming the Go version required.
+              With either flag, or -require-tls13, each connection's negotiated TLS
+              version and group is logged
+  -require-tls13
+              Optional, reject clients that don't support TLS 1.3, e.g., with
+              '-require-tls13 -kex X25519MLKEM768' for a post-quantum readiness check.
+              Overrides the -profile's minimum version
+  -profile    Optional, a TLS profile, modeled on Mozilla's server side TLS recommendations,
+              that sets the minimum TLS version, cipher suites, and curves together:
+              modern       - TLS 1.3 only
+              intermediate - TLS 1.2 and later with AEAD/forward secret cipher suites
+              old          - TLS 1.0 and later with legacy cipher suites, for old clients only
+              If not provided TLS 1.2 is the minimum version and Go's defaults are used
+              otherwise. -ciphers and -curves override the profile's settings
+  -ciphers    Optional, a comma separated list of the TLS 1.0-1.2 cipher suites the server
+              supports, e.g., TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. TLS 1.3 cipher suites
+              aren't configurable
+  -audit-log  Optional, the name of a file that a JSON line is appended to for every client
+              certificate accepted or rejected by the server. Each line includes a sequence
+              number and timestamp
+  -clock-skew-tolerance
+              Optional, accept a client certificate chain that only fails verification
+              because a certificate expired, or isn't valid yet, at most this long ago or
+              from now, e.g., 5m, for hosts whose clocks are known to be wrong. Only applies
+              when -certopt is 3 or 4. Each time a certificate is accepted this way a warning
+              saying how far off the local clock would have to be is logged, and rejections
+              report how far outside the certificate's validity period the local time is.
+              Defaults to 0, disabled
+  -no-resumption
+              Optional, disable TLS session resumption, both TLS 1.2 session tickets and
+              TLS 1.3 PSK resumption, so every connection performs a full handshake
+  -log-resumption
+              Optional, log whether the TLS handshake of each connection resumed a session,
+              when its first request arrives. The number of full and resumed handshakes is
+              always counted by gohttps_tls_handshakes_total in /metrics, e.g., to tune the
+              session ticket rotation
+  -strict-sni Optional, abort the TLS handshake of clients whose server name indication
+              (SNI) isn't -host or one of the -sni-host names, or that don't send SNI, e.g.,
+              because they connect by IP address, so the server doesn't answer for
+              unexpected host names. Each rejection is logged as a warning. Defaults to
+              false
+  -sni-host   Optional, repeatable, with -strict-sni, another server name clients may
+              request, e.g., an alias in the server certificate. A leading '*.' matches a
+              single label, e.g., *.example.com matches www.example.com
+  -close-connections
+              Optional, close every HTTP/1.1 connection after its response, which says so
+              with 'Connection: close', and send HTTP/2 clients a GOAWAY once their
+              requests complete, so no connection is reused. For reproducing connection
+              churn and testing clients that mishandle keep-alive. Defaults to false
+  -reuseport  Optional, create the listener with SO_REUSEPORT so a new server process can
+              listen on the same port before the old one exits, e.g., for zero downtime
+              restarts: start the new server with -reuseport, then send the old one, also
+              started with -reuseport, a SIGTERM. The old server stops accepting connections
+              and lets in-flight requests finish. Only supported on Linux and the BSDs,
+              including macOS. On Linux both processes must run as the same user
+  -drain-announce
+              Optional, how often, while the server is shutting down and draining in-flight
+              requests, the number of connections remaining is logged, e.g., 1s. Defaults to
+              5s, 0 disables. The drain lasts at most 30s, then the remaining connections are
+              closed and their remote addresses logged. While draining, /readyz on the
+              -healthcheck-bypass listener responds 503 with the number remaining
+  -long-lived-drain-timeout
+              Optional, how long the long-lived /events streams and /ws connections are
+              given to wrap up when the server shuts down. They're signaled as the drain
+              starts: streams end with a 'shutdown' event and WebSocket clients are sent a
+              going away close message, which they're expected to respond to. Those that
+              haven't finished in time are closed. E.g., 2m keeps streaming clients from
+              being disconnected abruptly during deploys, at the cost of a longer shutdown,
+              which lasts at most the longer of it and the 30s request drain. Defaults to
+              0, the request drain's 30s
+  -pre-stop-delay
+              Optional, how long the server keeps serving after receiving a SIGTERM or
+              SIGINT, with /readyz responding 503, before it starts shutting down, e.g.,
+              10s. In Kubernetes it gives the load balancers time to stop routing new
+              requests to the pod, which happens concurrently with its termination, so no
+              requests are dropped during rolling updates. The delay must be shorter than
+              the pod's terminationGracePeriodSeconds less the 30s drain. A second signal
+              ends the delay early. Defaults to 0, no delay
+  -serve-ca   Optional, serve the -cacert CA certificates at /ca.pem, PEM encoded, and the
+              first of them at /ca.der, DER encoded, so clients can bootstrap trust in the
+              server, e.g., with 'client -fetch-ca'. Only useful if the -cacert CA also
+              issued the server's certificate. The download itself can't be verified, so
+              clients must check the certificate's fingerprint out of band. The routes are
+              subject to -certopt like any other
+  -debug-headers
+              Optional, add the TLS parameters negotiated for each request's connection to
+              its response, for debugging with any client, e.g., curl -v. The headers are
+              X-TLS-Version, e.g., TLS1.3, X-TLS-Cipher, e.g., TLS_AES_128_GCM_SHA256,
+              X-TLS-Resumed, X-ALPN, and, if the client presented a certificate,
+              X-Client-Cert-CN. Off by default because it reveals the server's configuration
+  -grpc       Optional, also serve gRPC on the same port, using the same TLS configuration,
+              including client certificate verification. HTTP/2 requests with an
+              application/grpc content type are routed to the gRPC server, all others to the
+              routes below. The standard grpc.health.v1 health service is registered, other
+              services can be added with advserver.RegisterGRPCService and can get the
+              client's certificate with advserver.ClientCertificate. Streams are limited by
+              the 10s write timeout
+  -http3      Optional, experimental, also serve the same routes over HTTP/3 (QUIC), using
+              the same certificates, on the UDP port with the same number as -port. TCP
+              responses include an Alt-Svc header advertising it. HTTP/3 is provided by the
+              github.com/quic-go/quic-go module. -reuseport, the TCP options, and
+              -max-concurrent-handlers don't apply to it
+  -sct-file   Optional, a file containing a binary serialized certificate transparency Signed
+              Certificate Timestamp (SCT), as defined by RFC 6962, for the server
+              certificate. SCTs are sent to clients that request them in the TLS handshake.
+              May be repeated, the files are reread when the certificate is reloaded
+  -log-sample-rate
+              Optional, log only 1 in every N successful requests, e.g., to keep the log from
+              becoming a bottleneck during load tests. Failed (4xx and 5xx) requests and slow
+              requests are always logged. Defaults to 1, logging every request
+  -log-slow-threshold
+              Optional, requests that take longer than this, e.g., 500ms, are always logged
+              regardless of -log-sample-rate. Defaults to 1s, 0 disables
+  -access-log-format
+              Optional, the format of the access log lines, instead of the default sentence,
+              so they can be ingested without a transform. Either a preset, common or
+              combined, Apache's log formats with the client certificate's Common Name as
+              the user, or json, or a template of {field} placeholders, e.g., '{method}
+              {path} {status} {latency} {ip} {cn}'. The fields are method, path, query,
+              uri, proto, host, status, bytes, bytes_clf, latency, latency_ms, ip,
+              remote_addr, xff, cn, user_agent, referer, time, and instance. The log level, timestamp prefix,
+              and -log-sample-rate apply as with the default format
+  -access-log-file
+              Optional, the name of a file, '-' for stdout, every request is appended to,
+              one line each in -access-log-format, which defaults to combined, without the
+              log's timestamp and level prefix and regardless of -log-sample-rate, so log
+              analyzers such as GoAccess can read it as is, e.g., 'goaccess access.log
+              --log-format=COMBINED'. Missing fields are logged as '-'. The file is opened
+              for appending, so it can be rotated with copytruncate
+  -metrics-max-paths
+              Optional, the maximum number of distinct request paths the request metrics,
+              served at /metrics in Prometheus format, are kept for. Requests for further
+              paths are counted under the path "other". Defaults to 100
+  -healthcheck-bypass
+              Optional, an address, e.g., 127.0.0.1:8081 or :8081, of a second listener that
+              serves only /healthz and /readyz, over plain HTTP, for load balancer health
+              checks that can't present a client certificate, e.g., when -certopt is 4. No
+              other route is reachable on it. /readyz returns 503 once the server starts
+              shutting down. Use a loopback address unless the probes come from elsewhere
+  -admin
+              Optional, an address, e.g., 127.0.0.1:9090, of a listener that serves the
+              admin routes, over plain HTTP, without client certificates:
+                /status  The most recent -handshake-failures TLS handshake failures, the
+                         most recent first, and the total number since the server
+                         started, and the -instance-id, as JSON
+                /constraints
+                         The -route-config constraints of each path prefix, as JSON
+              They include other clients' addresses and ClientHellos, and the server's
+              configuration, so use a loopback address, or one only operators can reach.
+              Nothing else is served on it
+  -max-concurrent-handlers
+              Optional, the maximum number of requests handled at the same time regardless of
+              the number of connections, e.g., to protect downstream resources. A request
+              that has to wait longer than -max-concurrent-wait to be handled gets a 503.
+              Defaults to 0, no limit
+  -max-concurrent-wait
+              Optional, how long a request waits to be handled when -max-concurrent-handlers
+              requests are already being handled, defaults to 100ms
+  -max-handshakes
+              Optional, the maximum number of TLS handshakes in progress at the same time,
+              from the ClientHello until the handshake completes. Further handshakes are
+              aborted, and their connections closed, so a burst of new connections can't
+              starve the server, and the requests on its existing connections, of CPU.
+              Shed handshakes are logged at most once a second, and counted in /metrics.
+              Defaults to 0, no limit
+  -handshake-failures
+              Optional, the number of the most recent TLS handshake failures the -admin
+              listener's /status reports, with the time, remote address, the SNI, TLS
+              versions, and ALPN protocols the client offered, if it got as far as its
+              ClientHello, and the reason, as logged. Failures are only recorded with
+              -admin. Defaults to 50, 0 disables
+  -handler-timeout
+              Optional, the deadline of each request's context, r.Context(), e.g., 5s.
+              Handlers should make outbound calls, e.g., with http.NewRequestWithContext,
+              using it, so the calls are canceled once the deadline passes or the client
+              goes away. The deadline also ends /drip, /events, and /ws responses. See
+              httpsserver.Upstream for an example. Defaults to 0, no deadline
+  -write-deadline-margin
+              Optional, give each request's context a deadline this long, e.g., 1s, before
+              the server's 10s write timeout would cut the response off mid-write, or
+              -handler-timeout's if that's earlier. Handlers can check the time left with
+              httpsserver.RemainingTime: /drip then only sends the bytes due before the
+              deadline, and /upstream ends the copy of the upstream's response, both
+              marking the response with an X-Partial-Result header, or trailer, instead of
+              the connection being closed mid-write. It must be less than 10s. Defaults to
+              0, no deadline
+  -upstream   Optional, an https URL, e.g., of another server's /drip route, that requests
+              to /upstream are forwarded to, to demonstrate deadline propagation. The
+              upstream server's certificate is verified against -cacert. If the deadline
+              set by -handler-timeout passes first /upstream responds with a 504
+  -cache      Optional, cache the responses to GET requests in memory, serving repeated
+              requests without calling the handler, with an 'X-Cache: HIT' header and the
+              response's Age. Responses are keyed by path, query, host, and the Accept,
+              Accept-Encoding, and Accept-Language headers. Only 200 responses of at most
+              1MiB, without Set-Cookie or 'Cache-Control: no-store', are cached, and never
+              for requests with a body or a Range header, or for /metrics, /healthz,
+              /readyz, /version, /drip, /delay, /events, /ws, and /upstream.
+              Concurrent requests for a response that isn't cached yet wait for the first
+              one's response. Hits and misses are counted in /metrics. Defaults to false
+  -cache-ttl  Optional, with -cache, how long responses are cached for, defaults to 1m
+  -cache-max-entries
+              Optional, with -cache, the maximum number of responses cached. Once reached
+              the least recently used response is evicted. Defaults to 1000
+  -cache-authenticated
+              Optional, with -cache, also cache the responses to requests with a client
+              certificate, which aren't cached by default. They're cached separately for
+              each certificate, so one client's response is never served to another
+  -header     Optional, a 'Name: value' header added to every response, e.g., for a cache
+              policy. May be repeated. An empty value, e.g., 'Server:', removes the header,
+              including headers the server adds automatically such as Date. Handlers can
+              still override the headers
+  -header-config
+              Optional, the name of a JSON file of headers, with a "headers" object of the
+              headers added to every response, and a "routes" object mapping path prefixes
+              to the headers added to responses to matching requests, e.g.,
+              {"routes": {"/": {"Content-Security-Policy": "default-src 'self'"}}}
+              Route headers take precedence over -header and global headers, and headers of
+              longer prefixes over shorter ones. Empty values remove headers, like -header
+  -route-config
+              Optional, the name of a JSON file with a "routes" object mapping path prefixes
+              to the constraints on matching requests, checked before they're handled, e.g.,
+              {"routes": {"/form": {"methods": ["POST"], "content_types": ["multipart/form-data"],
+              "max_body_bytes": 1048576, "required_headers": ["X-Request-ID"]}}}
+              Requests with other methods get a 405, bodies of other content types a 415,
+              larger bodies a 413, and requests missing a required header a 400. Only the
+              constraints of the longest matching prefix apply. GET allows HEAD too. The
+              constraints are reported by the -admin listener's /constraints route
+  -greeting   Optional, a Go text/template for the greeting the / route responds with,
+              with the fields .Body, the request body, .Hostname, .InstanceID, .Port,
+              .TLSVersion, e.g., TLS 1.3, and .ClientCN, the client certificate's Common
+              Name, or "" without one, e.g.,
+              'Hello{{if .ClientCN}} {{.ClientCN}}{{end}} from {{.InstanceID}}!'
+              Defaults to 'Hello, <body> from Advanced Server!', or, for clients with a
+              certificate, 'Hello <CN>, authenticated from Advanced Server!'. The template
+              is validated at startup
+  -instance-id
+              Optional, an identifier of this server, e.g., to tell which of the instances
+              behind a load balancer responded. It's the -greeting template's .InstanceID,
+              and it's included in the access logs, the configuration summary, and the
+              -admin listener's /status
+  -response-file
+              Optional, the name of a file, e.g., a JSON or XML fixture or a binary blob,
+              that the / route responds to GET and HEAD requests with, byte for byte,
+              instead of the greeting. Other methods, e.g., POST, still get the greeting.
+              The response has an ETag, and conditional, If-None-Match and
+              If-Modified-Since, and Range requests are honored. The file is read into
+              memory, and read again on SIGHUP, or when it changes with -watch-response.
+              If it can't be read again the previous contents continue to be served
+  -response-content-type
+              Optional, with -response-file, the Content-Type of the response, e.g.,
+              application/json. Defaults to the type of the file's extension, or of its
+              contents if the extension isn't known
+  -watch-response
+              Optional, with -response-file, watch the file and reload it when it changes
+  -favicon    Optional, the name of an icon file, e.g., in ICO or PNG format, served at
+              /favicon.ico instead of the built-in icon. /favicon.ico, /robots.txt, and
+              /.well-known/security.txt are always served, so the browsers and crawlers
+              that request them don't fill the access log with 404s. They're cacheable
+              for a day
+  -robots     Optional, the name of a file served at /robots.txt instead of the built-in
+              one, which disallows crawling the whole server
+  -security-txt
+              Optional, the name of a file, see RFC 9116, served at /.well-known/security.txt
+              instead of the built-in one, which points to the project's issue tracker and
+              expires a year after the server started
+  -quiet-known-paths
+              Optional, log the requests for /favicon.ico, /robots.txt, and
+              /.well-known/security.txt only at the debug level, whatever their status, and
+              leave them out of -log-sample-rate's count
+  -max-bytes-route
+              Optional, the maximum size of the responses from the /bytes and /drip routes,
+              defaults to 104857600 (100MiB)
+  -max-delay  Optional, the maximum delay, including jitter, of the /delay route, defaults
+              to 1m
+  -max-form-bytes
+              Optional, the maximum size of the requests to the /form route, larger requests
+              get a 413. Defaults to 104857600 (100MiB)
+  -max-multipart-memory
+              Optional, the maximum total size of the fields, other than files, of the
+              requests to the /form route, which are kept in memory while files are only
+              hashed. Requests with larger fields get a 413. Defaults to 33554432 (32MiB)
+  -fault-rate Optional, the percentage, from 0 to 100, of requests to /, and to other paths
+              without a route of their own, that fail with the -fault-status instead of the
+              greeting, e.g., 10, to exercise clients' retry logic. Each injected fault is
+              logged as a warning starting 'Injected fault', and has an X-Fault-Injected
+              header. Defaults to 0, no faults
+  -fault-status
+              Optional, with -fault-rate, the status code, between 200 and 599, of the
+              injected faults, defaults to 500
+  -retry-after
+              Optional, the Retry-After, in seconds, of the 503 and 429 responses the server
+              produces, -max-concurrent-handlers', -cert-expiry-reject's, and -fault-status
+              503s and 429s, advising clients how long to wait before retrying. Defaults to
+              5s, 0 omits the header
+  -access-db  Optional, the name of a SQLite database file, created if necessary, that every
+              request is recorded in, in the access_log table, for ad-hoc queries. E.g.,
+              sqlite3 <dbFile> 'SELECT client_cn, path, count(*) FROM access_log GROUP BY 1, 2'
+              Columns are timestamp, method, path, status, latency_ms, bytes, remote_ip,
+              client_cn, tls_version, and request_id, the request's X-Request-Id header.
+              Records are written in the background, and flushed when the server stops
+  -access-db-retention
+              Optional, the number of days -access-db records are kept for. Older records are
+              deleted when the server starts. Defaults to 0, records are kept forever
+%s
+%s
+%s
+  -print-config
+              Optional, log the value of every option, including defaults, at startup, with
+              secrets such as -srvkey-pass redacted. A one line summary of the configuration
+              is always logged
+  -check      Optional, a dry run that validates the options, loads the certificates, keys,
+              and CA, verifies the server certificate's chain, against the system's root CAs
+              and -cacert, and host name, and checks that -port and -healthcheck-bypass can
+              be listened on, then exits without serving. The exit status is 0 if no
+              problems are found, otherwise the problems are logged and the status is 1
+  -healthcheck
+              Optional, instead of serving, request /healthz over HTTPS from the server
+              already listening on -port on the loopback interface, e.g., as a container's
+              HEALTHCHECK command, and exit with status 0 if it responds with 200, otherwise
+              1. The server's certificate is verified against -cacert for -host, or
+              localhost, unless -insecure is used. If -certopt is 2 or higher the server's
+              certificate and key, which must not be encrypted, are presented as the client
+              certificate. The request times out after 2s
+  -insecure   Optional, with -healthcheck, don't verify the server's certificate, e.g., if
+              it's self-signed
+  -certopt    Optional, specifies the option for authenticating a client via certificate:
+			  0 - certificate not required, 
+			  1 - request a certificate but it's not required,
+			  2 - require any client certificate
+			  3 - if provided, verify the client certificate is authorized
+			  4 - require certificate and verify it's authorized
+
+%s
+
+TLS renegotiation is never accepted, Go's TLS server doesn't support it. Clients that
+require it, e.g., to present a certificate after the initial handshake, must be
+configured to present certificates during the handshake.
+
+Plain HTTP requests sent to the port, e.g., using http:// instead of https://, receive a 400
+response explaining that the port expects HTTPS.
+
+%s
+
+Routes:
+  /           Responds with a greeting that includes the request body or, if the client
+              authenticated with a certificate, its Common Name. With -response-file, GET
+              and HEAD requests get the file instead
+  /metrics    Request metrics in Prometheus format: counts, durations, and request and
+              response body size histograms by path
+  /upstream   With -upstream, forwards the request to the -upstream URL
+  /ca.pem     With -serve-ca, the -cacert CA certificates, PEM encoded
+  /ca.der     With -serve-ca, the first -cacert CA certificate, DER encoded
+  /healthz    Responds with 200 while the server is running
+  /readyz     Responds with 200 while the server is ready, 503 once it starts shutting down
+  /version    The build version, commit, date, and Go version, as JSON or, if the Accept
+              header prefers text/plain, as text
+  /bytes/{n}  Responds with n bytes of data, a repeating pattern or, with ?seed=<number>,
+              pseudo-random data generated from the seed. Range requests are supported
+  /drip       Responds with ?bytes=<n> bytes, default 10, written gradually over
+              ?duration=<duration>, default 2s, e.g., for testing client timeouts
+  /delay/{d}  Responds after the delay d, e.g., /delay/3s, or /delay?d=3s, plus, with
+              ?jitter=<duration>, a random delay of up to jitter more, e.g., for testing
+              client timeouts and retries. The X-Delay header is the actual delay
+  /status/{code}
+              Responds with the status code, between 200 and 599, e.g., /status/503, and a
+              body of the code and its status text
+  /form       Parses a multipart/form-data POST or PUT request, e.g., from the client's
+              -form and -form-file flags, and responds with a JSON summary of its fields,
+              and of its files: their size, content type, detected from their content, and
+              SHA-256
+  /events     A Server-Sent Events (text/event-stream) stream with a 'tick' event every
+              ?interval=<duration>, default 1s, until the client disconnects. Streams end
+              with a 'shutdown' event when the server shuts down
+  /ws         A WebSocket endpoint, over HTTP/1.1, that echoes every message it receives.
+              The upgrade request is subject to -certopt like any other. Connections are
+              closed after 2m without a message, and with a going away close message when
+              the server shuts down
+
+Signals:
+  SIGHUP      Reloads the certificates, key, and CA, and the -response-file
+  SIGUSR1     Logs diagnostics: the number of open and active connections, goroutines, the
+              server certificate's expiry, the configuration summary, and request counts
+  SIGTERM, SIGINT
+              Shuts down gracefully, after the -pre-stop-delay, letting in-flight requests
+              finish
+`, name, cli.ServerCertUsage, cli.TCPUsage, cli.LogUsage, cli.DumpUsage, cli.SourceUsage, cli.ListenExitUsage)
+
+	if *help == true {
+		fmt.Println(usage)
+		return
+	}
+	if *showVersion {
+		fmt.Printf("%s %s\n", name, version.Get())
+		return
+	}
+	if err := logFlags.Setup(); err != nil {
+		log.Fatalf("%s\n%s", err, usage)
+	}
+	if *healthcheckMode {
+		hc := healthcheckConfig{host: *host, port: *port, caCert: *caCert, insecure: *insecure}
+		if hc.caCert == "" && os.Getenv(*caCertEnv) != "" {
+			hc.caCert = certs.EnvSourcePrefix + *caCertEnv
+		}
+		if *certOpt >= int(tls.RequireAnyClientCert) {
+			hc.clientCert, hc.clientKey = certFlags.Cert, certFlags.Key
+			if hc.clientCert == "" {
+				hc.clientCert = certs.EnvSourcePrefix + certFlags.CertEnv
+			}
+			if hc.clientKey == "" {
+				hc.clientKey = certs.EnvSourcePrefix + certFlags.KeyEnv
+			}
+			passphrase, err := certs.ReadPassphrase(certFlags.KeyPass, certFlags.KeyPassFile)
+			if err != nil {
+				logging.Fatalf("%s", err)
+			}
+			hc.clientKeyPass = passphrase
+		}
+		if err := healthcheck(hc); err != nil {
+			fmt.Fprintf(os.Stderr, "Unhealthy: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *host == "" || (*caCert == "" && os.Getenv(*caCertEnv) == "" && *caCertDir == "" && !*useSystemRoots) {
+		logging.Fatalf("One or more required fields missing:\n%s", usage)
+	}
+
+	if *certOpt < 0 || *certOpt > 4 {
+		logging.Fatalf("Invalid value %d, provided for 'certopt' flag. It must be a number between 0 and 4 inclusive.\n%s", *certOpt, usage)
+	}
+
+	if *maxHandshakes < 0 {
+		logging.Fatalf("Invalid value %d, provided for 'max-handshakes' flag. It must not be negative.\n%s", *maxHandshakes, usage)
+	}
+	if *failureHistory < 0 {
+		logging.Fatalf("Invalid value %d, provided for 'handshake-failures' flag. It must not be negative.\n%s", *failureHistory, usage)
+	}
+	if *maxHandlers < 0 {
+		logging.Fatalf("Invalid value %d, provided for 'max-concurrent-handlers' flag. It must not be negative.\n%s", *maxHandlers, usage)
+	}
+	if *longLivedDrainTimeout < 0 {
+		logging.Fatalf("Invalid value %s, provided for 'long-lived-drain-timeout' flag. It must not be negative.\n%s", *longLivedDrainTimeout, usage)
+	}
+	if *enableHTTP3 && *port == "0" {
+		logging.Fatalf("-http3 can't be used with -port 0, HTTP/3's UDP port must be the same as the TCP port:\n%s", usage)
+	}
+	tcpOpts, err := tcpFlags.Options()
+	if err != nil {
+		logging.Fatalf("%s\n%s", err, usage)
+	}
+	dumper, err := dumpFlags.Writer()
+	if err != nil {
+		logging.Fatalf("%s\n%s", err, usage)
+	}
+	if *accessDBRetention < 0 {
+		logging.Fatalf("Invalid value %d, provided for 'access-db-retention' flag. It must not be negative.\n%s", *accessDBRetention, usage)
+	}
+	if *clockSkewTolerance < 0 {
+		logging.Fatalf("Invalid value %s, provided for 'clock-skew-tolerance' flag. It must not be negative.\n%s", *clockSkewTolerance, usage)
+	}
+	if *expiryHardStop < 0 {
+		logging.Fatalf("Invalid value %s, provided for 'cert-expiry-hard-stop' flag. It must not be negative.\n%s", *expiryHardStop, usage)
+	}
+	if *expiryReject && *expiryHardStop == 0 {
+		logging.Fatalf("-cert-expiry-reject requires -cert-expiry-hard-stop.\n%s", usage)
+	}
+	if *retryAfter < 0 {
+		logging.Fatalf("Invalid value %s, provided for 'retry-after' flag. It must not be negative.\n%s", *retryAfter, usage)
+	}
+	if *writeDeadlineMargin < 0 || *writeDeadlineMargin >= writeTimeout {
+		logging.Fatalf("Invalid value %s, provided for 'write-deadline-margin' flag. It must be at least 0 and less than the %s write timeout.\n%s", *writeDeadlineMargin, writeTimeout, usage)
+	}
+	if *handlerTimeout < 0 {
+		logging.Fatalf("Invalid value %s, provided for 'handler-timeout' flag. It must not be negative.\n%s", *handlerTimeout, usage)
+	}
+	headerRules := middleware.HeaderRules{Global: http.Header{}}
+	if *headerConfigFile != "" {
+		var global http.Header
+		global, headerRules.Routes, err = loadHeaderConfig(*headerConfigFile)
+		if err != nil {
+			logging.Fatalf("%s", err)
+		}
+		for name, values := range global {
+			headerRules.Global[name] = values
+		}
+	}
+	// -header flags take precedence over the configuration file's global headers
+	for name, values := range headers {
+		headerRules.Global[name] = values
+	}
+	var greetingTemplate *template.Template
+	if *greeting != "" {
+		if greetingTemplate, err = httpsserver.ParseGreeting(*greeting); err != nil {
+			logging.Fatalf("Invalid value provided for 'greeting' flag: %s\n%s", err, usage)
+		}
+	}
+	var response *httpsserver.ResponseFile
+	if *responseFile != "" {
+		if response, err = httpsserver.NewResponseFile(*responseFile, *responseContentType); err != nil {
+			logging.Fatalf("%s", err)
+		}
+	} else if *responseContentType != "" || *watchResponse {
+		logging.Fatalf("-response-content-type and -watch-response require -response-file.\n%s", usage)
+	}
+	var accessLogFmt *middleware.AccessLogFormat
+	if *accessLogFormat != "" {
+		if accessLogFmt, err = middleware.ParseAccessLogFormat(*accessLogFormat); err != nil {
+			logging.Fatalf("Invalid value %q provided for 'access-log-format' flag: %s\n%s", *accessLogFormat, err, usage)
+		}
+	}
+	var accessLogOut *log.Logger
+	if *accessLogFile != "" {
+		if accessLogFmt == nil {
+			accessLogFmt, _ = middleware.ParseAccessLogFormat("combined")
+		}
+		out := os.Stdout
+		if *accessLogFile != "-" {
+			if out, err = os.OpenFile(*accessLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+				logging.Fatalf("Unable to open the access log file: %s", err)
+			}
+		}
+		accessLogOut = log.New(out, "", 0)
+	}
+	var known httpsserver.KnownFiles
+	for _, f := range []struct {
+		name, flag string
+		data       *[]byte
+	}{
+		{*faviconFile, "favicon", &known.Favicon},
+		{*robotsFile, "robots", &known.Robots},
+		{*securityTxtFile, "security-txt", &known.SecurityTxt},
+	} {
+		if f.name == "" {
+			continue
+		}
+		if *f.data, err = ioutil.ReadFile(f.name); err != nil {
+			logging.Fatalf("Unable to read the '%s' flag's file: %s", f.flag, err)
+		}
+	}
+	routeConstraints := middleware.RouteConstraints{}
+	if *routeConfigFile != "" {
+		routeConstraints, err = loadRouteConfig(*routeConfigFile)
+		if err != nil {
+			logging.Fatalf("%s", err)
+		}
+	}
+	if *enableCache && (*cacheTTL <= 0 || *cacheMaxEntries <= 0) {
+		logging.Fatalf("-cache-ttl and -cache-max-entries must be greater than 0.\n%s", usage)
+	}
+	if *maxFormBytes <= 0 || *maxMultipartMemory <= 0 {
+		logging.Fatalf("-max-form-bytes and -max-multipart-memory must be greater than 0.\n%s", usage)
+	}
+	if *faultRate < 0 || *faultRate > 100 {
+		logging.Fatalf("Invalid value %g, provided for 'fault-rate' flag. It must be between 0 and 100.\n%s", *faultRate, usage)
+	}
+	if len(sniHosts) > 0 && !*strictSNI {
+		logging.Fatalf("-sni-host requires -strict-sni.\n%s", usage)
+	}
+	if *faultStatus < 200 || *faultStatus > 599 {
+		logging.Fatalf("Invalid value %d, provided for 'fault-status' flag. It must be between 200 and 599.\n%s", *faultStatus, usage)
+	}
+	if *maxDelay <= 0 {
+		logging.Fatalf("Invalid value %s, provided for 'max-delay' flag. It must be greater than 0.\n%s", *maxDelay, usage)
+	}
+	if *preStopDelay < 0 {
+		logging.Fatalf("Invalid value %s, provided for 'pre-stop-delay' flag. It must not be negative.\n%s", *preStopDelay, usage)
+	}
+	if *metricsMaxPaths < 1 {
+		logging.Fatalf("Invalid value %d, provided for 'metrics-max-paths' flag. It must be at least 1.\n%s", *metricsMaxPaths, usage)
+	}
+
+	if err := certs.CheckSources(certFlags.Cert, certFlags.Key, certFlags.Chain, *caCert); err != nil {
+		logging.Fatalf("%s\n%s", err, usage)
+	}
+	var profile tlsutil.Profile
+	if *profileName != "" {
+		var err error
+		profile, err = tlsutil.LookupProfile(*profileName)
+		if err != nil {
+			logging.Fatalf("Invalid value %q provided for 'profile' flag: %s\n%s", *profileName, err, usage)
+		}
+	}
+	cipherSuites, err := tlsutil.ParseCipherSuites(*ciphers)
+	if err != nil {
+		logging.Fatalf("Invalid value %q provided for 'ciphers' flag: %s\n%s", *ciphers, err, usage)
+	}
+	curvePrefs, err := tlsutil.ParseCurves(*curves)
+	if err != nil {
+		logging.Fatalf("Invalid value %q provided for 'curves' or 'kex' flag: %s\n%s", *curves, err, usage)
+	}
+	if profile.Name != "" && cipherSuites != nil {
+		logging.Warnf("-ciphers overrides the cipher suites of the %s TLS profile", profile.Name)
+	}
+	if profile.Name != "" && curvePrefs != nil {
+		logging.Warnf("-curves overrides the curves of the %s TLS profile", profile.Name)
+	}
+	var minVersion uint16
+	if *requireTLS13 {
+		minVersion = tls.VersionTLS13
+	}
+
+	loadCert, err := certFlags.Loader()
+	if err != nil {
+		logging.Fatalf("%s\n%s", err, usage)
+	}
+	var ca servedCA
+	reloader, err := certs.NewReloader(func() (*tls.Config, error) {
+		cert, err := loadCert()
+		if err != nil {
+			return nil, err
+		}
+		scts, err := loadSCTs(sctFiles)
+		if err != nil {
+			return nil, err
+		}
+		var caPEM []byte
+		if tls.ClientAuthType(*certOpt) > tls.RequestClientCert || *serveCA {
+			if caPEM, err = readCA(*caCert, *caCertEnv, *caCertDir); err != nil {
+				return nil, fmt.Errorf("error loading CA cert: %w", err)
+			}
+		}
+		cfg, err := httpsserver.TLSConfig(httpsserver.Options{
+			Host:                        *host,
+			Certificate:                 &cert,
+			ClientAuth:                  tls.ClientAuthType(*certOpt),
+			CACertPEM:                   caPEM,
+			UseSystemRoots:              *useSystemRoots,
+			Profile:                     profile.Name,
+			CipherSuites:                cipherSuites,
+			CurvePreferences:            curvePrefs,
+			MinVersion:                  minVersion,
+			DisableResumption:           *noResumption,
+			SignedCertificateTimestamps: scts,
+			ClockSkewTolerance:          *clockSkewTolerance,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if *serveCA {
+			if err := ca.set(caPEM); err != nil {
+				return nil, err
+			}
+		}
+		return cfg, nil
+	})
+	if err != nil {
+		logging.Fatalf("%s\n%s", err, usage)
+	}
+
+	if *dryRun {
+		caPEM, err := readCA(*caCert, *caCertEnv, *caCertDir)
+		if err != nil {
+			logging.Fatalf("Check failed: error loading CA cert: %s", err)
+		}
+		addrs := []listenAddr{{":" + *port, "-port"}}
+		if *healthcheckBypass != "" {
+			addrs = append(addrs, listenAddr{*healthcheckBypass, "-healthcheck-bypass"})
+		}
+		if *adminAddr != "" {
+			addrs = append(addrs, listenAddr{*adminAddr, "-admin"})
+		}
+		problems := check(reloader.Current(), *host, caPEM, listen.Config{ReusePort: *reusePort, TCP: tcpOpts}, addrs)
+		for _, p := range problems {
+			logging.Errorf("Check failed: %s", p)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		log.Printf("Check passed, the server's configuration is valid")
+		return
+	}
+
+	// SIGHUP, and file changes if -watch-certs is set, reload the server's
+	// certificate, key, and CA. SIGHUP, and -watch-response, also reload the
+	// -response-file.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Printf("Received SIGHUP, reloading TLS configuration")
+			reloadTLSConfig(reloader)
+			if response != nil {
+				reloadResponse(response)
+			}
+		}
+	}()
+	if *watchResponse {
+		err := certs.Watch(context.Background(), []string{*responseFile}, certs.DefaultWatchDebounce, func() {
+			log.Printf("Response file change detected, reloading %s", *responseFile)
+			reloadResponse(response)
+		})
+		if err != nil {
+			logging.Fatalf("Unable to watch the response file: %s", err)
+		}
+	}
+	if *watchCerts {
+		err := certs.Watch(context.Background(), []string{certFlags.Cert, certFlags.Key, certFlags.Chain, *caCert}, certs.DefaultWatchDebounce, func() {
+			log.Printf("Certificate file change detected, reloading TLS configuration")
+			reloadTLSConfig(reloader)
+		})
+		if err != nil {
+			logging.Fatalf("Unable to watch certificate files: %s", err)
+		}
+	}
+
+	// Without -audit-log and -access-db these stay nil, which their methods
+	// treat as disabled, leaving the TLS config, error log, and handler as
+	// they are
+	var auditLog *audit.Logger
+	if *auditLogFile != "" {
+		auditLog, err = audit.Open(*auditLogFile)
+		if err != nil {
+			logging.Fatalf("%s", err)
+		}
+		defer auditLog.Close()
+	}
+	var accessDB *accessdb.DB
+	if *accessDBFile != "" {
+		accessDB, err = accessdb.Open(*accessDBFile, time.Duration(*accessDBRetention)*24*time.Hour)
+		if err != nil {
+			logging.Fatalf("%s", err)
+		}
+		defer accessDB.Close()
+	}
+	tlsConfig := reloader.TLSConfig()
+	tlsConfig.GetConfigForClient = auditLog.WrapConfigForClient(tlsConfig.GetConfigForClient)
+	if *strictSNI {
+		allowed := append([]string{*host}, sniHosts...)
+		tlsConfig.GetConfigForClient = httpsserver.StrictSNI(allowed, tlsConfig.GetConfigForClient)
+		log.Printf("Only accepting TLS handshakes for %s (-strict-sni)", strings.Join(allowed, ", "))
+	}
+	var handshakes *httpsserver.HandshakeLimiter
+	if *maxHandshakes > 0 {
+		handshakes = httpsserver.NewHandshakeLimiter(*maxHandshakes)
+		tlsConfig.GetConfigForClient = handshakes.Wrap(tlsConfig.GetConfigForClient)
+	}
+	// The failures' ClientHellos are recorded before any of the above can
+	// reject the handshake.
+	var failures *httpsserver.HandshakeFailures
+	errorLogOut := log.Writer()
+	if *failureHistory > 0 && *adminAddr != "" {
+		failures = httpsserver.NewHandshakeFailures(*failureHistory)
+		tlsConfig.GetConfigForClient = failures.Wrap(tlsConfig.GetConfigForClient)
+		errorLogOut = failures.Writer(errorLogOut)
+	}
+
+	requestMetrics := metrics.NewRegistry(*metricsMaxPaths)
+	var tracker inflight.Tracker
+	requestMetrics.AddGauge("gohttps_requests_in_flight", "The number of requests being handled.", func() float64 {
+		return float64(tracker.InFlight())
+	})
+	requestMetrics.AddGauge("gohttps_connections_open", "The number of open connections.", func() float64 {
+		return float64(tracker.Open())
+	})
+	requestMetrics.AddCounterVec("gohttps_tls_handshakes_total", "The number of TLS handshakes of connections that received a request, by whether they resumed a session.", "resumed", func() map[string]float64 {
+		full, resumed := tracker.Handshakes()
+		return map[string]float64{"false": float64(full), "true": float64(resumed)}
+	})
+	if *logResumption || curvePrefs != nil || *requireTLS13 {
+		tracker.OnHandshake = func(r *http.Request) {
+			msg := fmt.Sprintf("TLS handshake from %s: ", r.RemoteAddr)
+			if *logResumption {
+				msg += fmt.Sprintf("resumed=%t, ", r.TLS.DidResume)
+			}
+			msg += "version=" + tls.VersionName(r.TLS.Version)
+			if curvePrefs != nil || *requireTLS13 {
+				msg += ", group=" + tlsutil.CurveName(r.TLS.CurveID)
+			}
+			log.Printf("%s", msg)
+		}
+	}
+	if handshakes != nil {
+		requestMetrics.AddGauge("gohttps_tls_handshakes_in_progress", "The number of TLS handshakes in progress.", func() float64 {
+			return float64(handshakes.InProgress())
+		})
+		requestMetrics.AddCounter("gohttps_tls_handshakes_shed_total", "The number of TLS handshakes aborted because -max-handshakes were in progress.", func() float64 {
+			return float64(handshakes.Shed())
+		})
+	}
+	routes := httpsserver.NewRoutes(httpsserver.Options{
+		MaxBytes:    *maxBytesRoute,
+		MaxDelay:    *maxDelay,
+		FaultRate:   *faultRate,
+		FaultStatus: *faultStatus,
+		RetryAfter:  *retryAfter,
+
+		MaxFormBytes:       *maxFormBytes,
+		MaxMultipartMemory: *maxMultipartMemory,
+
+		Greeting:   greetingTemplate,
+		InstanceID: *instanceID,
+		Port:       *port,
+		Response:   response,
+		Known:      known,
+	})
+	routes.Handle("/metrics", requestMetrics)
+	var healthStatus health.Status
+	routes.Handle(health.LivenessPath, healthStatus.Handler())
+	routes.Handle(health.ReadinessPath, healthStatus.Handler())
+	routes.Handle(version.Path, version.Handler())
+	if *serveCA {
+		routes.Handle(caPEMPath, ca.pemHandler())
+		routes.Handle(caDERPath, ca.derHandler())
+	}
+	if *upstream != "" {
+		upstreamCA := *caCert
+		if upstreamCA == "" {
+			upstreamCA = certs.EnvSourcePrefix + *caCertEnv
+		}
+		upstreamClient, err := httpsclient.NewClient(httpsclient.Config{CACertFile: upstreamCA})
+		if err != nil {
+			logging.Fatalf("Unable to create the -upstream client: %s", err)
+		}
+		routes.HandleMethods("/upstream", httpsserver.Upstream(upstreamClient, *upstream),
+			http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	}
+	var handler http.Handler = routes
+	if *enableCache {
+		responseCache := cache.New(cache.Config{
+			TTL:           *cacheTTL,
+			MaxEntries:    *cacheMaxEntries,
+			Authenticated: *cacheAuthenticated,
+			Exclude:       []string{"/metrics", health.LivenessPath, health.ReadinessPath, version.Path, "/drip", "/delay", "/events", "/ws", "/upstream"},
+		})
+		requestMetrics.AddCounter("gohttps_cache_hits_total", "The number of requests served from the response cache.", func() float64 {
+			return float64(responseCache.Hits())
+		})
+		requestMetrics.AddCounter("gohttps_cache_misses_total", "The number of cacheable requests that weren't in the response cache.", func() float64 {
+			return float64(responseCache.Misses())
+		})
+		requestMetrics.AddGauge("gohttps_cache_entries", "The number of responses in the response cache.", func() float64 {
+			return float64(responseCache.Len())
+		})
+		handler = responseCache.Handler(handler)
+	}
+	if len(routeConstraints) > 0 {
+		handler = middleware.Constraints(routeConstraints, handler)
+	}
+	if len(headerRules.Global) > 0 || len(headerRules.Routes) > 0 {
+		handler = middleware.Headers(headerRules, handler)
+	}
+	if *handlerTimeout > 0 {
+		handler = middleware.Deadline(*handlerTimeout, handler)
+	}
+	if *writeDeadlineMargin > 0 {
+		handler = middleware.Deadline(writeTimeout-*writeDeadlineMargin, handler)
+	}
+	if *debugHeaders {
+		handler = middleware.TLSHeaders(handler)
+	}
+	if *enableGRPC {
+		handler = grpcMux(newGRPCServer(), handler)
+	}
+	if *maxHandlers > 0 {
+		handler = middleware.ConcurrencyLimit(*maxHandlers, *maxHandlersWait, *retryAfter, handler)
+	}
+	var expiry *expiryGuard
+	if *expiryHardStop > 0 {
+		expiry = &expiryGuard{window: *expiryHardStop, reject: *expiryReject, retryAfter: *retryAfter, reloader: reloader, status: &healthStatus}
+		handler = expiry.Handler(handler)
+	}
+	if dumper != nil {
+		handler = middleware.Dump(dumper, handler)
+	}
+	accessLogConfig := middleware.AccessLogConfig{SampleRate: *logSampleRate, SlowThreshold: *logSlowThreshold, InstanceID: *instanceID, Format: accessLogFmt, Output: accessLogOut}
+	if *quietKnownPaths {
+		accessLogConfig.QuietPaths = httpsserver.KnownPaths
+	}
+	handler = tracker.Middleware(middleware.Metrics(requestMetrics, accessDB.Handler(middleware.AccessLog(accessLogConfig, handler))))
+	var h3Server *http3.Server
+	if *enableHTTP3 {
+		h3Server = newHTTP3Server(":"+*port, tlsConfig, handler)
+		handler = altSvc(h3Server, handler)
+	}
+	server := &http.Server{
+		Addr:         ":" + *port,
+		Handler:      handler,
+		ReadTimeout:  5 * time.Minute, // 5 min to allow for delays when 'curl' on OSx prompts for username/password
+		WriteTimeout: writeTimeout,
+		TLSConfig:    tlsConfig,
+		ErrorLog:     auditLog.ErrorLog(errorLogOut),
+		ConnContext:  tracker.ConnContext,
+		ConnState:    tracker.ConnState,
+
+		// The routes answer 'OPTIONS *' with the methods they serve
+		DisableGeneralOptionsHandler: true,
+	}
+
+	if *clockSkewTolerance > 0 {
+		log.Printf("Accepting client certificates that are up to %s outside their validity period (-clock-skew-tolerance)", *clockSkewTolerance)
+	}
+	if *closeConns {
+		server.SetKeepAlivesEnabled(false)
+		log.Printf("Keep-alives are disabled, connections are closed after each response (-close-connections)")
+	}
+	if *noResumption {
+		log.Printf("TLS session resumption is disabled, every connection will perform a full handshake")
+	}
+	profileDesc := "default"
+	if profile.Name != "" {
+		profileDesc = profile.Name
+	}
+	if *printConfig {
+		cli.LogConfig(fs, map[string]string{"certopt": tls.ClientAuthType(*certOpt).String()})
+	}
+	var features []string
+	for _, f := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"watch-certs", *watchCerts},
+		{"audit-log", auditLog != nil},
+		{"access-db", accessDB != nil},
+		{"no-resumption", *noResumption},
+		{"log-resumption", *logResumption},
+		{"require-tls13", *requireTLS13},
+		{"close-connections", *closeConns},
+		{"strict-sni", *strictSNI},
+		{"cache", *enableCache},
+		{"clock-skew-tolerance", *clockSkewTolerance > 0},
+		{"use-system-roots", *useSystemRoots},
+		{"cert-expiry-hard-stop", *expiryHardStop > 0},
+		{"reuseport", *reusePort},
+		{"serve-ca", *serveCA},
+		{"debug-headers", *debugHeaders},
+		{"grpc", *enableGRPC},
+		{"http3", *enableHTTP3},
+		{"healthcheck-bypass", *healthcheckBypass != ""},
+		{"admin", *adminAddr != ""},
+		{"max-concurrent-handlers", *maxHandlers > 0},
+		{"max-handshakes", *maxHandshakes > 0},
+		{"handler-timeout", *handlerTimeout > 0},
+		{"write-deadline", *writeDeadlineMargin > 0},
+		{"long-lived-drain", *longLivedDrainTimeout > 0},
+		{"upstream", *upstream != ""},
+		{"fault-injection", *faultRate > 0},
+		{"greeting", greetingTemplate != nil},
+		{"response-file", response != nil},
+		{"quiet-known-paths", *quietKnownPaths},
+		{"headers", len(headerRules.Global) > 0 || len(headerRules.Routes) > 0},
+		{"route-constraints", len(routeConstraints) > 0},
+		{"log-sampling", *logSampleRate > 1},
+		{"access-log-format", accessLogFmt != nil},
+		{"access-log-file", accessLogOut != nil},
+		{"dump-http", dumper != nil},
+	} {
+		if f.enabled {
+			features = append(features, f.name)
+		}
+	}
+	if len(features) == 0 {
+		features = []string{"none"}
+	}
+	summary := fmt.Sprintf("host=%s port=%s certopt=%d (%s) profile=%s read-timeout=%s write-timeout=%s features=%s",
+		*host, *port, *certOpt, tls.ClientAuthType(*certOpt), profileDesc, server.ReadTimeout, server.WriteTimeout, strings.Join(features, ","))
+	if *instanceID != "" {
+		summary += " instance-id=" + *instanceID
+	}
+	log.Printf("Configuration summary: %s", summary)
+	ln, err := listen.Config{ReusePort: *reusePort, TCP: tcpOpts, RejectPlainHTTP: true}.Listen(server.Addr)
+	if err != nil {
+		msg, status := listen.Explain(err, server.Addr, "-port")
+		logging.Errorf("%s", msg)
+		os.Exit(status)
+	}
+	// The port is logged as listened on, rather than as configured, since
+	// with -port 0 the system chooses it
+	log.Printf("Starting HTTPS server on host %s and port %d with the %s TLS profile", *host, listen.Port(ln), profileDesc)
+	log.Printf("TCP options: %s", tcpOpts)
+	if *portFile != "" {
+		if err := listen.WritePortFile(*portFile, ln); err != nil {
+			logging.Fatalf("%s", err)
+		}
+	}
+
+	var healthServer *http.Server
+	if *healthcheckBypass != "" {
+		healthLn, err := listen.Config{}.Listen(*healthcheckBypass)
+		if err != nil {
+			msg, status := listen.Explain(err, *healthcheckBypass, "-healthcheck-bypass")
+			logging.Errorf("Unable to start the health check listener: %s", msg)
+			os.Exit(status)
+		}
+		healthServer = &http.Server{
+			Handler:      healthStatus.Handler(),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := healthServer.Serve(healthLn); err != http.ErrServerClosed {
+				logging.Fatalf("Health check listener failed: %s", err)
+			}
+		}()
+		log.Printf("Serving %s and %s over HTTP on %s", health.LivenessPath, health.ReadinessPath, healthLn.Addr())
+	}
+
+	var adminServer *http.Server
+	if *adminAddr != "" {
+		adminLn, err := listen.Config{}.Listen(*adminAddr)
+		if err != nil {
+			msg, status := listen.Explain(err, *adminAddr, "-admin")
+			logging.Errorf("Unable to start the admin listener: %s", msg)
+			os.Exit(status)
+		}
+		adminServer = &http.Server{
+			Handler:      adminHandler(failures, *instanceID, routeConstraints),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := adminServer.Serve(adminLn); err != http.ErrServerClosed {
+				logging.Fatalf("Admin listener failed: %s", err)
+			}
+		}()
+		log.Printf("Serving %s and %s over HTTP on %s", statusPath, constraintsPath, adminLn.Addr())
+	}
+
+	if h3Server != nil {
+		go func() {
+			if err := h3Server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logging.Fatalf("HTTP/3 listener failed: %s", err)
+			}
+		}()
+		log.Printf("Serving HTTP/3 (experimental) on UDP port %s", *port)
+	}
+
+	diag := &diagnostics{summary: summary, tracker: &tracker, reloader: reloader, metrics: requestMetrics}
+	diag.handleSignals()
+
+	if expiry != nil {
+		expiry.check(time.Now())
+		go expiry.run()
+	}
+	// SIGTERM and SIGINT stop the server gracefully, after the -pre-stop-delay,
+	// letting in-flight requests finish. With -reuseport a replacement server
+	// may already be accepting connections on the same port. The certificate
+	// is provided by the reloader so no files are passed here.
+	err = srv.RunWithGracefulShutdown(context.Background(), server, "", "", srv.Options{
+		Listener:      ln,
+		PreStopDelay:  *preStopDelay,
+		Health:        &healthStatus,
+		Tracker:       &tracker,
+		DrainAnnounce: *drainAnnounce,
+		// The long-lived /events and /ws responses are signaled to wrap up,
+		// since Shutdown would otherwise wait for, or not track, them.
+		LongLived:        routes.LongLived(),
+		LongLivedTimeout: *longLivedDrainTimeout,
+		AfterShutdown: []func(context.Context){
+			func(ctx context.Context) {
+				if err := shutdownHTTP3(ctx, h3Server); err != nil {
+					log.Printf("Unable to finish in-flight HTTP/3 requests before shutting down: %s", err)
+				}
+			},
+			func(ctx context.Context) {
+				if healthServer != nil {
+					healthServer.Shutdown(ctx)
+				}
+			},
+			func(ctx context.Context) {
+				if adminServer != nil {
+					adminServer.Shutdown(ctx)
+				}
+			},
+		},
+	})
+	if err != nil {
+		logging.Fatalf("%s", err)
+	}
+	log.Printf("Server stopped")
+}
+
+// loadSCTs reads the serialized SCTs in files, checking that they parse.
+func loadSCTs(files []string) ([][]byte, error) {
+	var scts [][]byte
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read SCT file: %w", err)
+		}
+		if _, err := sct.Parse(b); err != nil {
+			return nil, fmt.Errorf("invalid SCT file %s: %w", file, err)
+		}
+		scts = append(scts, b)
+	}
+	return scts, nil
+}
+
+func reloadTLSConfig(reloader *certs.Reloader) {
+	if err := reloader.Reload(); err != nil {
+		log.Printf("Unable to reload TLS configuration, continuing with the current configuration: %s", err)
+	}
+}
+
+func reloadResponse(response *httpsserver.ResponseFile) {
+	if err := response.Reload(); err != nil {
+		log.Printf("Unable to reload the response file, continuing with the current contents: %s", err)
+		return
+	}
+	log.Printf("Reloaded the response file %s, %d bytes", response.Path(), response.Size())
+}
+
+// readCA returns the PEM encoded CA certificates of the caCert source, or of
+// the caCertEnv environment variable, and of the caCertDir directory, logging
+// how many certificates the directory added and the files that failed. It
+// returns nil if none of them are provided, e.g., with -use-system-roots.
+func readCA(caCert, caCertEnv, caCertDir string) ([]byte, error) {
+	var caPEM []byte
+	if caCert != "" || os.Getenv(caCertEnv) != "" {
+		var err error
+		if caPEM, err = certs.ReadPEM(caCert, caCertEnv); err != nil {
+			return nil, err
+		}
+	}
+	if caCertDir == "" {
+		return caPEM, nil
+	}
+	dirPEM, report, err := certs.ReadDir(caCertDir)
+	for _, f := range report.Failed {
+		logging.Warnf("Skipped the CA file %s", f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d CA certificates from %d files in %s (-cacert-dir), %d failed", report.Added, report.Files, caCertDir, len(report.Failed))
+	return append(append(caPEM, '\n'), dirPEM...), nil
+}
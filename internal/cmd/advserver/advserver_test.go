@@ -0,0 +1,43 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSCTs(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.sct")
+	serialized := append(append([]byte{0}, bytes.Repeat([]byte{1}, 32+8)...), 0, 0, 4, 3, 0, 0)
+	if err := ioutil.WriteFile(valid, serialized, 0600); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.sct")
+	if err := ioutil.WriteFile(invalid, serialized[:20], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	scts, err := loadSCTs([]string{valid, valid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scts) != 2 || !bytes.Equal(scts[0], serialized) {
+		t.Errorf("got the SCTs %x, want the file's content twice", scts)
+	}
+	if scts, err := loadSCTs(nil); scts != nil || err != nil {
+		t.Errorf("got %x, %v without -sct-file, want no SCTs", scts, err)
+	}
+	if _, err := loadSCTs([]string{valid, invalid}); err == nil || !strings.Contains(err.Error(), invalid) {
+		t.Errorf("got the error %v, want one naming the invalid file", err)
+	}
+	if _, err := loadSCTs([]string{filepath.Join(dir, "missing.sct")}); err == nil {
+		t.Error("loading a missing file succeeded")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/certs"
+)
+
+// Paths of the -serve-ca routes.
+const (
+	caPEMPath = "/ca.pem"
+	caDERPath = "/ca.der"
+)
+
+// servedCA holds the -cacert CA certificates served by -serve-ca. They're
+// replaced whenever the TLS configuration is reloaded.
+type servedCA struct {
+	certs atomic.Pointer[caCerts]
+}
+
+type caCerts struct {
+	pem      []byte
+	der      []byte
+	modified time.Time
+}
+
+// set replaces the served certificates with those in caPEM. Only the
+// CERTIFICATE blocks are kept, so nothing else in the file is exposed.
+func (c *servedCA) set(caPEM []byte) error {
+	parsed, err := certs.ParseCertificates(caPEM)
+	if err != nil {
+		return fmt.Errorf("unable to serve the CA certificate: %w", err)
+	}
+	var b bytes.Buffer
+	for _, cert := range parsed {
+		pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	c.certs.Store(&caCerts{pem: b.Bytes(), der: parsed[0].Raw, modified: time.Now()})
+	return nil
+}
+
+// pemHandler serves all of the CA certificates, PEM encoded.
+func (c *servedCA) pemHandler() http.Handler {
+	return c.handler("application/x-pem-file", func(cc *caCerts) []byte { return cc.pem })
+}
+
+// derHandler serves the first CA certificate, DER encoded, since there's no
+// standard way of concatenating DER certificates.
+func (c *servedCA) derHandler() http.Handler {
+	return c.handler("application/pkix-cert", func(cc *caCerts) []byte { return cc.der })
+}
+
+func (c *servedCA) handler(contentType string, body func(*caCerts) []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		cc := c.certs.Load()
+		if cc == nil {
+			http.Error(w, "no CA certificate is configured", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		http.ServeContent(w, r, "", cc.modified, bytes.NewReader(body(cc)))
+	})
+}
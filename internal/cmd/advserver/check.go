@@ -0,0 +1,105 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/certs"
+	"github.com/youngkin/gohttps/internal/listen"
+)
+
+// listenAddr is an address the server listens on and the option it's
+// configured with, e.g., '-port'.
+type listenAddr struct {
+	addr string
+	flag string
+}
+
+// check performs the -check dry run once the configuration has been loaded,
+// which has already validated the flags and loaded the certificates. It
+// verifies the server certificate's chain, against the system roots and the
+// -cacert CAs, and its host name, explaining name constraint and path length
+// violations if it doesn't verify, and that each of the addrs can be listened
+// on. It returns the problems found.
+func check(cfg *tls.Config, host string, caPEM []byte, lc listen.Config, addrs []listenAddr) []string {
+	var problems []string
+
+	cert := cfg.Certificates[0]
+	leaf, err := certs.Leaf(cert)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("unable to parse the server certificate: %s", err))
+	} else {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if caPEM != nil {
+			roots.AppendCertsFromPEM(caPEM)
+		}
+		intermediates := x509.NewCertPool()
+		for _, der := range cert.Certificate[1:] {
+			if c, err := x509.ParseCertificate(der); err == nil {
+				intermediates.AddCert(c)
+			}
+		}
+		_, err = leaf.Verify(x509.VerifyOptions{
+			DNSName:       host,
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("the server certificate doesn't verify for host %s: %s", host, err))
+			problems = append(problems, certs.ExplainChain(candidateChain(leaf, cert.Certificate[1:], caPEM), host)...)
+			if validity := certs.ExplainValidity(err, time.Now()); validity != "" {
+				problems = append(problems, validity)
+			}
+		} else {
+			log.Printf("Check: the server certificate for %s verifies, it expires %s", host, leaf.NotAfter.Format("2006-01-02"))
+		}
+	}
+
+	for _, a := range addrs {
+		ln, err := lc.Listen(a.addr)
+		if err != nil {
+			msg, _ := listen.Explain(err, a.addr, a.flag)
+			problems = append(problems, msg)
+			continue
+		}
+		ln.Close()
+		log.Printf("Check: able to listen on %s", a.addr)
+	}
+	return problems
+}
+
+// candidateChain returns the chain, leaf first, that the server presents,
+// followed by the -cacert CA, if any, that issued the last certificate in it.
+func candidateChain(leaf *x509.Certificate, intermediates [][]byte, caPEM []byte) []*x509.Certificate {
+	chain := []*x509.Certificate{leaf}
+	for _, der := range intermediates {
+		if c, err := x509.ParseCertificate(der); err == nil {
+			chain = append(chain, c)
+		}
+	}
+	last := chain[len(chain)-1]
+	for rest := caPEM; len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		ca, err := x509.ParseCertificate(block.Bytes)
+		if err == nil && bytes.Equal(ca.RawSubject, last.RawIssuer) && !bytes.Equal(ca.Raw, last.Raw) {
+			return append(chain, ca)
+		}
+	}
+	return chain
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/listen"
+)
+
+// issue returns a certificate created from tmpl, signed by parent and its
+// key, or self-signed if parent is nil, and the certificate's key.
+func issue(t *testing.T, tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+	}
+	if tmpl.IsCA {
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// encodePEM returns the PEM encoding of certs.
+func encodePEM(certs ...*x509.Certificate) []byte {
+	var b []byte
+	for _, c := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return b
+}
+
+// discardLog discards the standard logger's output until the test completes.
+func discardLog(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(ioutil.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+}
+
+func TestCheck(t *testing.T) {
+	discardLog(t)
+	root, rootKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test Root"}, IsCA: true}, nil, nil)
+	other, _ := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Other Root"}, IsCA: true}, nil, nil)
+	ca, caKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Corp Intermediate"}, IsCA: true, PermittedDNSDomains: []string{"corp.example"}}, root, rootKey)
+	caPEM := encodePEM(other, root)
+
+	inUse, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inUse.Close()
+
+	tests := []struct {
+		name  string
+		host  string
+		addrs []listenAddr
+		want  []string
+	}{
+		{name: "valid", host: "api.corp.example", addrs: []listenAddr{{"127.0.0.1:0", "-port"}}},
+		{
+			name: "name constraint violation",
+			host: "api.other.org",
+			want: []string{
+				"the server certificate doesn't verify for host api.other.org",
+				`intermediate "Corp Intermediate" constrains DNS names to corp.example, presented name was api.other.org`,
+			},
+		},
+		{
+			name:  "address in use",
+			host:  "api.corp.example",
+			addrs: []listenAddr{{inUse.Addr().String(), "-port"}},
+			want:  []string{inUse.Addr().String()},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			leaf, leafKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "api"}, DNSNames: []string{tc.host}}, ca, caKey)
+			cfg := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw, ca.Raw}, PrivateKey: leafKey}}}
+			got := check(cfg, tc.host, caPEM, listen.Config{}, tc.addrs)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got the problems %q, want %d problems", got, len(tc.want))
+			}
+			for i, p := range got {
+				if !strings.Contains(p, tc.want[i]) {
+					t.Errorf("got the problem %q, want one containing %q", p, tc.want[i])
+				}
+			}
+		})
+	}
+}
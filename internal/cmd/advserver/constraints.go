@@ -0,0 +1,83 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"strings"
+
+	"github.com/youngkin/gohttps/internal/middleware"
+)
+
+// constraintsPath is the route that reports the -route-config constraints.
+const constraintsPath = "/constraints"
+
+// routeConfig is the format of the -route-config file, e.g.:
+//
+//	{
+//	  "routes": {
+//	    "/form": {
+//	      "methods": ["POST"],
+//	      "content_types": ["multipart/form-data", "application/x-www-form-urlencoded"],
+//	      "max_body_bytes": 1048576,
+//	      "required_headers": ["X-Request-ID"]
+//	    }
+//	  }
+//	}
+//
+// routes maps path prefixes to the constraints on the matching requests.
+type routeConfig struct {
+	Routes middleware.RouteConstraints `json:"routes"`
+}
+
+// loadRouteConfig reads the -route-config file, returning the constraints of
+// each route prefix.
+func loadRouteConfig(file string) (middleware.RouteConstraints, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the route configuration: %w", err)
+	}
+	var cfg routeConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid route configuration %s: %w", file, err)
+	}
+	for prefix, c := range cfg.Routes {
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("invalid route configuration %s: route %q must start with '/'", file, prefix)
+		}
+		if err := checkConstraint(c); err != nil {
+			return nil, fmt.Errorf("invalid route configuration %s: route %s: %w", file, prefix, err)
+		}
+	}
+	if cfg.Routes == nil {
+		cfg.Routes = middleware.RouteConstraints{}
+	}
+	return cfg.Routes, nil
+}
+
+func checkConstraint(c middleware.RouteConstraint) error {
+	for _, method := range c.Methods {
+		if err := checkHeader(method, ""); err != nil {
+			return fmt.Errorf("invalid method %q", method)
+		}
+	}
+	for _, ct := range c.ContentTypes {
+		if _, params, err := mime.ParseMediaType(ct); err != nil || len(params) > 0 {
+			return fmt.Errorf("invalid content type %q, it must be a media type without parameters, e.g., application/json", ct)
+		}
+	}
+	if c.MaxBodyBytes < 0 {
+		return fmt.Errorf("max_body_bytes must not be negative")
+	}
+	for _, name := range c.RequiredHeaders {
+		if err := checkHeader(name, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/youngkin/gohttps/internal/middleware"
+)
+
+func TestLoadRouteConfig(t *testing.T) {
+	write := func(content string) string {
+		file := filepath.Join(t.TempDir(), "routes.json")
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	got, err := loadRouteConfig(write(`{"routes": {"/form": {
+		"methods": ["POST"],
+		"content_types": ["multipart/form-data"],
+		"max_body_bytes": 1048576,
+		"required_headers": ["X-Request-ID"]
+	}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := middleware.RouteConstraints{"/form": {Methods: []string{"POST"}, ContentTypes: []string{"multipart/form-data"}, MaxBodyBytes: 1 << 20, RequiredHeaders: []string{"X-Request-ID"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got the constraints %+v, want %+v", got, want)
+	}
+	if got, err := loadRouteConfig(write(`{}`)); err != nil || got == nil || len(got) != 0 {
+		t.Errorf("got the constraints %v and the error %v for no routes, want empty constraints", got, err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{"missing", filepath.Join(t.TempDir(), "missing.json"), "unable to read the route configuration"},
+		{"not JSON", write(`routes: {}`), "invalid route configuration"},
+		{"route without '/'", write(`{"routes": {"form": {}}}`), `route "form" must start with '/'`},
+		{"invalid method", write(`{"routes": {"/": {"methods": ["GET POST"]}}}`), `route /: invalid method "GET POST"`},
+		{"content type with parameters", write(`{"routes": {"/": {"content_types": ["text/plain; charset=utf-8"]}}}`), "without parameters"},
+		{"invalid content type", write(`{"routes": {"/": {"content_types": ["text plain"]}}}`), `invalid content type "text plain"`},
+		{"negative size", write(`{"routes": {"/": {"max_body_bytes": -1}}}`), "max_body_bytes must not be negative"},
+		{"invalid header", write(`{"routes": {"/": {"required_headers": ["X Request"]}}}`), `invalid header name "X Request"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := loadRouteConfig(tc.file); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got the error %v, want one containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
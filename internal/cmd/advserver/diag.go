@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/certs"
+	"github.com/youngkin/gohttps/internal/inflight"
+	"github.com/youngkin/gohttps/internal/metrics"
+)
+
+// diagnostics logs a snapshot of the server's state when the process receives
+// diagSignal, SIGUSR1.
+type diagnostics struct {
+	summary  string
+	tracker  *inflight.Tracker
+	reloader *certs.Reloader
+	metrics  *metrics.Registry
+	last     map[string]uint64
+	lastTime time.Time
+}
+
+// handleSignals dumps the diagnostics on every diagSignal. The dumps are done
+// on their own goroutine, and at most one signal is queued while a dump is in
+// progress, the rest are dropped, so a burst of signals can't wedge the server
+// or build up a backlog of dumps.
+func (d *diagnostics) handleSignals() {
+	if diagSignal == nil {
+		return
+	}
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, diagSignal)
+	d.lastTime = time.Now()
+	go func() {
+		for range usr1 {
+			d.dump()
+		}
+	}()
+}
+
+func (d *diagnostics) dump() {
+	log.Printf("Received SIGUSR1, diagnostics follow")
+	log.Printf("  Configuration: %s", d.summary)
+	snap := d.tracker.Snapshot()
+	log.Printf("  Connections: %d open, %d active, %d requests in flight", snap.Open, snap.Active, snap.InFlight)
+	log.Printf("  Goroutines: %d", runtime.NumGoroutine())
+
+	cfg := d.reloader.Current()
+	if leaf, err := certs.Leaf(cfg.Certificates[0]); err == nil {
+		log.Printf("  Server certificate: %s, expires %s (in %s)", leaf.Subject.CommonName,
+			leaf.NotAfter.Format(time.RFC3339), time.Until(leaf.NotAfter).Round(time.Minute))
+	}
+
+	totals := d.metrics.Totals()
+	now := time.Now()
+	log.Printf("  Requests since the last dump, %s ago: %s", now.Sub(d.lastTime).Round(time.Second), formatCounts(totals, d.last))
+	log.Printf("  Requests since the server started: %s", formatCounts(totals, nil))
+	d.last = totals
+	d.lastTime = now
+}
+
+// formatCounts formats the counts, less the corresponding counts in prev, by
+// status code class.
+func formatCounts(counts, prev map[string]uint64) string {
+	classes := make([]string, 0, len(counts))
+	for class := range counts {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	var total uint64
+	parts := make([]string, 0, len(classes))
+	for _, class := range classes {
+		n := counts[class] - prev[class]
+		total += n
+		parts = append(parts, fmt.Sprintf("%s=%d", class, n))
+	}
+	if len(parts) == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%d (%s)", total, strings.Join(parts, " "))
+}
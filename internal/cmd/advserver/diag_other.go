@@ -0,0 +1,13 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build windows || plan9
+
+package advserver
+
+import "os"
+
+// diagSignal is nil because there's no SIGUSR1 on this platform, so
+// diagnostics dumps aren't supported.
+var diagSignal os.Signal
@@ -0,0 +1,15 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows && !plan9
+
+package advserver
+
+import (
+	"os"
+	"syscall"
+)
+
+// diagSignal is the signal that triggers a diagnostics dump.
+var diagSignal os.Signal = syscall.SIGUSR1
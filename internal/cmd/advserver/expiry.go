@@ -0,0 +1,115 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/certs"
+	"github.com/youngkin/gohttps/internal/health"
+	"github.com/youngkin/gohttps/internal/logging"
+	"github.com/youngkin/gohttps/internal/retryafter"
+)
+
+// expiryCheckInterval is how often the expiryGuard checks the certificate.
+const expiryCheckInterval = time.Second
+
+// expiryGuard implements -cert-expiry-hard-stop. Once the server certificate
+// is within window of its expiry, /readyz reports not ready and, if reject is
+// set, new requests are responded to with a 503, while those in flight finish,
+// until the certificate is replaced by a reload. The 503s have a Retry-After
+// of retryAfter, unless it's 0.
+type expiryGuard struct {
+	window     time.Duration
+	reject     bool
+	retryAfter time.Duration
+	reloader   *certs.Reloader
+	status     *health.Status
+
+	stopped atomic.Bool
+	// lastLog is when the countdown was last logged, zero outside the window.
+	lastLog time.Time
+}
+
+// run checks the certificate every expiryCheckInterval, it never returns.
+func (g *expiryGuard) run() {
+	for now := range time.Tick(expiryCheckInterval) {
+		g.check(now)
+	}
+}
+
+// check updates the guard's state for the current certificate at now,
+// logging entering and leaving the window, and the countdown while in it.
+func (g *expiryGuard) check(now time.Time) {
+	leaf, err := certs.Leaf(g.reloader.Current().Certificates[0])
+	if err != nil {
+		return
+	}
+	remaining := leaf.NotAfter.Sub(now)
+	if remaining > g.window {
+		if g.stopped.Swap(false) {
+			log.Printf("The server certificate %s now expires %s, outside the -cert-expiry-hard-stop window, %s reports ready again",
+				leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339), health.ReadinessPath)
+			g.status.SetNotReady("")
+			g.lastLog = time.Time{}
+		}
+		return
+	}
+	var expiry string
+	if remaining > 0 {
+		expiry = fmt.Sprintf("expires in %s", remaining.Round(time.Second))
+	} else {
+		expiry = fmt.Sprintf("expired %s ago", (-remaining).Round(time.Second))
+	}
+	g.status.SetNotReady(fmt.Sprintf("the server certificate %s", expiry))
+	if !g.stopped.Swap(true) {
+		action := fmt.Sprintf("%s reports not ready", health.ReadinessPath)
+		if g.reject {
+			action += " and new requests are rejected with 503"
+		}
+		logging.Warnf("The server certificate %s %s, at %s, within -cert-expiry-hard-stop %s: %s until it's replaced",
+			leaf.Subject.CommonName, expiry, leaf.NotAfter.Format(time.RFC3339), g.window, action)
+		g.lastLog = now
+		return
+	}
+	if now.Sub(g.lastLog) >= countdownInterval(remaining) {
+		logging.Warnf("The server certificate %s %s", leaf.Subject.CommonName, expiry)
+		g.lastLog = now
+	}
+}
+
+// countdownInterval is how often the countdown is logged with remaining
+// until the certificate expires, more often as the expiry nears.
+func countdownInterval(remaining time.Duration) time.Duration {
+	switch {
+	case remaining > 10*time.Minute, remaining <= 0:
+		return time.Minute
+	case remaining > time.Minute:
+		return 30 * time.Second
+	}
+	return 10 * time.Second
+}
+
+// Handler returns a handler that, with reject, responds to requests with a
+// 503 while the certificate is within the window, and calls next otherwise.
+// The health endpoints are always served, so probes can see the state.
+func (g *expiryGuard) Handler(next http.Handler) http.Handler {
+	if !g.reject {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g.stopped.Load() && r.URL.Path != health.LivenessPath && r.URL.Path != health.ReadinessPath {
+			w.Header().Set("Connection", "close")
+			retryafter.Set(w.Header(), g.retryAfter)
+			http.Error(w, "the server's certificate is about to expire, retry once it's been replaced", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/certs"
+	"github.com/youngkin/gohttps/internal/health"
+)
+
+// newExpiryGuard returns a guard with a window of an hour whose reloader
+// loads a certificate expiring at the returned time, and the buffer the log
+// is written to until the test completes.
+func newExpiryGuard(t *testing.T, reject bool) (*expiryGuard, *time.Time, *bytes.Buffer) {
+	t.Helper()
+	notAfter := new(time.Time)
+	reloader, err := certs.NewReloader(func() (*tls.Config, error) {
+		leaf, _ := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "localhost"}, NotAfter: *notAfter}, nil, nil)
+		return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw}, Leaf: leaf}}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	logOut, flags := log.Writer(), log.Flags()
+	log.SetOutput(&out)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(logOut)
+		log.SetFlags(flags)
+	})
+
+	status := &health.Status{}
+	status.SetReady(true)
+	g := &expiryGuard{window: time.Hour, reject: reject, retryAfter: 5 * time.Second, reloader: reloader, status: status}
+	return g, notAfter, &out
+}
+
+func TestExpiryGuard(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	g, notAfter, out := newExpiryGuard(t, true)
+	*notAfter = now.Add(2 * time.Hour)
+	if err := g.reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	h := g.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	g.check(now)
+	if !g.status.Ready() || get("/").Code != http.StatusOK {
+		t.Fatal("the server isn't ready, or rejects requests, outside the window")
+	}
+
+	// The certificate is replaced by one within the window
+	*notAfter = now.Add(30 * time.Minute)
+	if err := g.reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	g.check(now)
+	if g.status.Ready() {
+		t.Error("the server is ready within the window")
+	}
+	if !strings.Contains(out.String(), "WARNING: The server certificate localhost expires in 30m0s") ||
+		!strings.Contains(out.String(), "within -cert-expiry-hard-stop 1h0m0s: /readyz reports not ready and new requests are rejected with 503") {
+		t.Errorf("got the log %q, want the certificate's expiry and the consequences", out)
+	}
+	w := get("/")
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "5" || w.Header().Get("Connection") != "close" {
+		t.Errorf("got %d with the headers %v, want 503 with Retry-After 5 and Connection: close", w.Code, w.Header())
+	}
+	for _, path := range []string{health.LivenessPath, health.ReadinessPath} {
+		if w := get(path); w.Code != http.StatusOK {
+			t.Errorf("got %d for %s, want the health endpoints served", w.Code, path)
+		}
+	}
+
+	// The countdown is logged once a minute, with over 10 minutes remaining
+	out.Reset()
+	g.check(now.Add(30 * time.Second))
+	if out.Len() != 0 {
+		t.Errorf("got the log %q 30s later, want nothing", out)
+	}
+	g.check(now.Add(time.Minute))
+	if want := "WARNING: The server certificate localhost expires in 29m0s\n"; out.String() != want {
+		t.Errorf("got the log %q a minute later, want %q", out, want)
+	}
+
+	// Once expired
+	out.Reset()
+	g.check(now.Add(31 * time.Minute))
+	if want := "WARNING: The server certificate localhost expired 1m0s ago\n"; out.String() != want {
+		t.Errorf("got the log %q after the expiry, want %q", out, want)
+	}
+
+	// A reload with a certificate outside the window makes the server ready
+	*notAfter = now.Add(48 * time.Hour)
+	if err := g.reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	g.check(now.Add(31 * time.Minute))
+	if !g.status.Ready() || get("/").Code != http.StatusOK {
+		t.Error("the server isn't ready, or rejects requests, after the certificate was replaced")
+	}
+	if !strings.Contains(out.String(), "outside the -cert-expiry-hard-stop window, /readyz reports ready again") {
+		t.Errorf("got the log %q, want it to say the server is ready again", out)
+	}
+}
+
+func TestExpiryGuardWithoutReject(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	g, notAfter, out := newExpiryGuard(t, false)
+	*notAfter = now.Add(30 * time.Minute)
+	if err := g.reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	g.check(now)
+	if g.status.Ready() || strings.Contains(out.String(), "rejected") {
+		t.Errorf("got ready %v and the log %q, want not ready without rejecting requests", g.status.Ready(), out)
+	}
+	w := httptest.NewRecorder()
+	g.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got %d without -cert-expiry-reject, want 200", w.Code)
+	}
+}
+
+func TestCountdownInterval(t *testing.T) {
+	tests := []struct {
+		remaining time.Duration
+		want      time.Duration
+	}{
+		{time.Hour, time.Minute},
+		{10 * time.Minute, 30 * time.Second},
+		{2 * time.Minute, 30 * time.Second},
+		{time.Minute, 10 * time.Second},
+		{time.Second, 10 * time.Second},
+		{0, time.Minute},
+		{-time.Hour, time.Minute},
+	}
+	for _, tc := range tests {
+		if got := countdownInterval(tc.remaining); got != tc.want {
+			t.Errorf("got the interval %s with %s remaining, want %s", got, tc.remaining, tc.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+
+	"github.com/youngkin/gohttps/internal/logging"
+)
+
+// grpcRegistrars are the functions, added by RegisterGRPCService, that
+// register services with the gRPC server.
+var grpcRegistrars []func(*grpc.Server)
+
+// RegisterGRPCService adds register to the functions called to register
+// services with the gRPC server mounted by -grpc. It must be called before
+// Main, e.g., from an init function.
+func RegisterGRPCService(register func(*grpc.Server)) {
+	grpcRegistrars = append(grpcRegistrars, register)
+}
+
+// ClientCertificate returns the client certificate of the connection a gRPC
+// request was received on, or nil if the client didn't present one. The
+// certificate has been verified only if -certopt is 3 or 4.
+func ClientCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil
+	}
+	return info.State.PeerCertificates[0]
+}
+
+// newGRPCServer returns a gRPC server with the standard health service and
+// the services added by RegisterGRPCService.
+func newGRPCServer() *grpc.Server {
+	s := grpc.NewServer(grpc.UnaryInterceptor(logGRPCRequest))
+	healthpb.RegisterHealthServer(s, grpchealth.NewServer())
+	for _, register := range grpcRegistrars {
+		register(s)
+	}
+	return s
+}
+
+// logGRPCRequest logs, at debug, each unary gRPC request and the common name
+// of the client's certificate.
+func logGRPCRequest(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	cn := "none"
+	if cert := ClientCertificate(ctx); cert != nil {
+		cn = cert.Subject.CommonName
+	}
+	logging.Debugf("Received gRPC request for %s from client certificate CN %s", info.FullMethod, cn)
+	return handler(ctx, req)
+}
+
+// grpcMux routes gRPC requests, HTTP/2 requests with an application/grpc
+// content type, to grpcServer and all other requests to next.
+func grpcMux(grpcServer *grpc.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// identityService is a gRPC service whose Check method sends the subject of
+// the client certificate its handler sees, "none" without one, to subjects.
+func identityService(subjects chan<- string) *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: "gohttps.test.Identity",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Check",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				if err := dec(new(healthpb.HealthCheckRequest)); err != nil {
+					return nil, err
+				}
+				subject := "none"
+				if cert := ClientCertificate(ctx); cert != nil {
+					subject = cert.Subject.String()
+				}
+				subjects <- subject
+				return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+			},
+		}},
+	}
+}
+
+func TestGRPCClientCertificate(t *testing.T) {
+	discardLog(t)
+	subjects := make(chan string, 1)
+	registrars := grpcRegistrars
+	defer func() { grpcRegistrars = registrars }()
+	RegisterGRPCService(func(s *grpc.Server) { s.RegisterService(identityService(subjects), nil) })
+
+	ca, caKey := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test CA"}, IsCA: true}, nil, nil)
+	srvCert, srvKey := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	clientCert, clientKey := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "gopher", Organization: []string{"Gophers"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	// gRPC requests share the TLS port, and its client certificate
+	// verification, with the routes
+	ts := httptest.NewUnstartedServer(grpcMux(newGRPCServer(), http.NotFoundHandler()))
+	ts.EnableHTTP2 = true
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{srvCert.Raw}, PrivateKey: srvKey}},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    pool,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	tests := []struct {
+		name  string
+		certs []tls.Certificate
+		want  string
+	}{
+		{"client certificate", []tls.Certificate{{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey}}, "CN=gopher,O=Gophers"},
+		{"no client certificate", nil, "none"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			creds := credentials.NewTLS(&tls.Config{RootCAs: pool, Certificates: tc.certs})
+			conn, err := grpc.NewClient(ts.Listener.Addr().String(), grpc.WithTransportCredentials(creds))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var res healthpb.HealthCheckResponse
+			if err := conn.Invoke(ctx, "/gohttps.test.Identity/Check", &healthpb.HealthCheckRequest{}, &res); err != nil {
+				t.Fatalf("the gRPC request failed: %s", err)
+			}
+			if got := <-subjects; got != tc.want {
+				t.Errorf("got the client certificate %q in the handler, want %q", got, tc.want)
+			}
+
+			// The standard health service is registered too
+			health, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+			if err != nil || health.Status != healthpb.HealthCheckResponse_SERVING {
+				t.Errorf("got the health %v and the error %v, want SERVING", health, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// headerFlag is a repeatable flag of 'Name: value' response headers.
+type headerFlag http.Header
+
+func (f headerFlag) String() string {
+	var s []string
+	for name, values := range f {
+		for _, v := range values {
+			s = append(s, name+": "+v)
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
+func (f headerFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return fmt.Errorf("invalid header %q, must be 'Name: value', or 'Name:' to remove it", s)
+	}
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if err := checkHeader(name, value); err != nil {
+		return err
+	}
+	http.Header(f).Add(name, value)
+	return nil
+}
+
+// headerConfig is the format of the -header-config file, e.g.:
+//
+//	{
+//	  "headers": {"X-Frame-Options": "DENY"},
+//	  "routes": {
+//	    "/": {"Content-Security-Policy": "default-src 'self'"},
+//	    "/metrics": {"Cache-Control": "no-store", "X-Frame-Options": ""}
+//	  }
+//	}
+//
+// Headers are added to every response, in addition to the -header flags, and
+// routes maps path prefixes to the headers added to the matching responses.
+type headerConfig struct {
+	Headers map[string]string            `json:"headers"`
+	Routes  map[string]map[string]string `json:"routes"`
+}
+
+// loadHeaderConfig reads the -header-config file, returning its global
+// headers and those of each route prefix.
+func loadHeaderConfig(file string) (http.Header, map[string]http.Header, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read the header configuration: %w", err)
+	}
+	var cfg headerConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, nil, fmt.Errorf("invalid header configuration %s: %w", file, err)
+	}
+	global, err := toHeader(cfg.Headers)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid header configuration %s: %w", file, err)
+	}
+	routes := make(map[string]http.Header, len(cfg.Routes))
+	for prefix, headers := range cfg.Routes {
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, nil, fmt.Errorf("invalid header configuration %s: route %q must start with '/'", file, prefix)
+		}
+		if routes[prefix], err = toHeader(headers); err != nil {
+			return nil, nil, fmt.Errorf("invalid header configuration %s: route %s: %w", file, prefix, err)
+		}
+	}
+	return global, routes, nil
+}
+
+func toHeader(m map[string]string) (http.Header, error) {
+	h := make(http.Header, len(m))
+	for name, value := range m {
+		if err := checkHeader(name, value); err != nil {
+			return nil, err
+		}
+		h.Set(name, value)
+	}
+	return h, nil
+}
+
+// checkHeader returns an error if name isn't a valid header name, a token
+// as defined by RFC 9110, or value contains control characters.
+func checkHeader(name, value string) error {
+	notToken := func(r rune) bool {
+		return r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r)
+	}
+	if name == "" || strings.IndexFunc(name, notToken) >= 0 {
+		return fmt.Errorf("invalid header name %q", name)
+	}
+	if strings.IndexFunc(value, func(r rune) bool { return (r < ' ' && r != '\t') || r == 0x7f }) >= 0 {
+		return fmt.Errorf("invalid value for header %s, it contains control characters", name)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeaderFlag(t *testing.T) {
+	headers := headerFlag{}
+	for _, s := range []string{"Cache-Control: no-store", "x-custom:  one ", "X-Custom: two", "Server:"} {
+		if err := headers.Set(s); err != nil {
+			t.Fatalf("setting %q failed: %s", s, err)
+		}
+	}
+	want := headerFlag{"Cache-Control": {"no-store"}, "X-Custom": {"one", "two"}, "Server": {""}}
+	if !reflect.DeepEqual(headers, want) {
+		t.Errorf("got the headers %v, want %v", headers, want)
+	}
+
+	tests := []struct {
+		value   string
+		wantErr string
+	}{
+		{"Cache-Control no-store", "must be 'Name: value'"},
+		{": no-store", "invalid header name"},
+		{"Cache Control: no-store", "invalid header name"},
+		{"X-(Custom): value", "invalid header name"},
+		{"X-Custom: one\x00two", "contains control characters"},
+	}
+	for _, tc := range tests {
+		if err := (headerFlag{}).Set(tc.value); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("got the error %v setting %q, want one containing %q", err, tc.value, tc.wantErr)
+		}
+	}
+	// Tabs are allowed in values
+	if err := (headerFlag{}).Set("X-Custom: one\ttwo"); err != nil {
+		t.Errorf("setting a value with a tab failed: %s", err)
+	}
+}
+
+func TestLoadHeaderConfig(t *testing.T) {
+	write := func(content string) string {
+		file := filepath.Join(t.TempDir(), "headers.json")
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	global, routes, err := loadHeaderConfig(write(`{
+		"headers": {"x-frame-options": "DENY"},
+		"routes": {
+			"/": {"Content-Security-Policy": "default-src 'self'"},
+			"/metrics": {"Cache-Control": "no-store", "X-Frame-Options": ""}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (http.Header{"X-Frame-Options": {"DENY"}}); !reflect.DeepEqual(global, want) {
+		t.Errorf("got the global headers %v, want %v", global, want)
+	}
+	wantRoutes := map[string]http.Header{
+		"/":        {"Content-Security-Policy": {"default-src 'self'"}},
+		"/metrics": {"Cache-Control": {"no-store"}, "X-Frame-Options": {""}},
+	}
+	if !reflect.DeepEqual(routes, wantRoutes) {
+		t.Errorf("got the route headers %v, want %v", routes, wantRoutes)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{"missing", filepath.Join(t.TempDir(), "missing.json"), "unable to read the header configuration"},
+		{"not JSON", write(`headers: {}`), "invalid header configuration"},
+		{"invalid global header", write(`{"headers": {"X Custom": "value"}}`), `invalid header name "X Custom"`},
+		{"route without '/'", write(`{"routes": {"metrics": {}}}`), `route "metrics" must start with '/'`},
+		{"invalid route header", write(`{"routes": {"/": {"X-Custom": "one\ntwo"}}}`), "route /: invalid value for header X-Custom"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := loadHeaderConfig(tc.file); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got the error %v, want one containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
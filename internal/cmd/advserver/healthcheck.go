@@ -0,0 +1,76 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/youngkin/gohttps/httpsclient"
+	"github.com/youngkin/gohttps/internal/health"
+)
+
+// healthcheckTimeout bounds the -healthcheck request, including connecting
+// and the TLS handshake, so a hung server fails the check quickly.
+const healthcheckTimeout = 2 * time.Second
+
+// healthcheckConfig is what -healthcheck needs to reach the server.
+type healthcheckConfig struct {
+	host     string
+	port     string
+	caCert   string
+	insecure bool
+	// clientCert and clientKey, if set, are presented to servers that require
+	// a client certificate.
+	clientCert    string
+	clientKey     string
+	clientKeyPass []byte
+}
+
+// healthcheck requests /healthz from the server listening on the loopback
+// interface, using the same TLS plumbing as the client command, and returns
+// an error unless it responds with 200. The request is sent for host, so the
+// server certificate's name is verified, but always connects to localhost.
+func healthcheck(cfg healthcheckConfig) error {
+	host := cfg.host
+	if host == "" {
+		host = "localhost"
+	}
+	loopback := net.JoinHostPort("localhost", cfg.port)
+	var dialer net.Dialer
+	client, err := httpsclient.NewClient(httpsclient.Config{
+		CACertFile:          cfg.caCert,
+		ClientCertFile:      cfg.clientCert,
+		ClientKeyFile:       cfg.clientKey,
+		ClientKeyPassphrase: cfg.clientKeyPass,
+		InsecureSkipVerify:  cfg.insecure,
+		Timeout:             healthcheckTimeout,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, loopback)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthcheckTimeout)
+	defer cancel()
+	url := "https://" + net.JoinHostPort(host, cfg.port) + health.LivenessPath
+	res, err := httpsclient.Do(ctx, client, httpsclient.Request{URL: url})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s %s", url, res.Status, body)
+	}
+	return nil
+}
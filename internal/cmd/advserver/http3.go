@@ -0,0 +1,41 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newHTTP3Server returns an HTTP/3 server, for -http3, that serves handler
+// over QUIC on the UDP port addr using tlsConfig, the same configuration, and
+// so certificates, as the TCP listener.
+func newHTTP3Server(addr string, tlsConfig *tls.Config, handler http.Handler) *http3.Server {
+	return &http3.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+	}
+}
+
+// altSvc advertises the HTTP/3 server to the clients of the TCP listener by
+// adding an Alt-Svc header to every response.
+func altSvc(h3 *http3.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h3.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// shutdownHTTP3 gracefully stops h3, if it's running, within ctx's deadline.
+func shutdownHTTP3(ctx context.Context, h3 *http3.Server) error {
+	if h3 == nil {
+		return nil
+	}
+	return h3.Shutdown(ctx)
+}
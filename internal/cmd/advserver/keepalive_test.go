@@ -0,0 +1,63 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// TestCloseConnections checks the server, with keep-alives disabled as by
+// -close-connections, closes HTTP/1.1 connections after their response and
+// doesn't let HTTP/2 clients reuse theirs either.
+func TestCloseConnections(t *testing.T) {
+	for _, proto := range []string{"HTTP/1.1", "HTTP/2.0"} {
+		t.Run(proto, func(t *testing.T) {
+			var conns atomic.Int32
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Proto != proto {
+					t.Errorf("got a %s request, want %s", r.Proto, proto)
+				}
+			}))
+			ts.EnableHTTP2 = proto == "HTTP/2.0"
+			ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					conns.Add(1)
+				}
+			}
+			ts.Config.SetKeepAlivesEnabled(false)
+			ts.StartTLS()
+			defer ts.Close()
+
+			tr := ts.Client().Transport.(*http.Transport).Clone()
+			tr.ForceAttemptHTTP2 = ts.EnableHTTP2
+			if !ts.EnableHTTP2 {
+				tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+			}
+			client := &http.Client{Transport: tr}
+			defer tr.CloseIdleConnections()
+			for i := 0; i < 3; i++ {
+				res, err := client.Get(ts.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				io.Copy(ioutil.Discard, res.Body)
+				res.Body.Close()
+				if proto == "HTTP/1.1" && !res.Close {
+					t.Errorf("got the response headers %v, want 'Connection: close'", res.Header)
+				}
+			}
+			if n := conns.Load(); n != 3 {
+				t.Errorf("got %d connections for 3 requests, want a new one for each", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/youngkin/gohttps/httpsserver"
+	"github.com/youngkin/gohttps/internal/middleware"
+)
+
+// statusPath is the admin route that reports the server's troubleshooting
+// status.
+const statusPath = "/status"
+
+// serverStatus is the format of the statusPath response.
+type serverStatus struct {
+	InstanceID        string                              `json:"instance_id,omitempty"`
+	HandshakeFailures httpsserver.HandshakeFailuresReport `json:"handshake_failures"`
+}
+
+// adminHandler returns the routes of the -admin listener, statusPath and
+// constraintsPath. They include other clients' addresses and ClientHellos,
+// and the server's configuration, so they're served on their own listener,
+// which, unlike the TLS listener, isn't exposed to clients.
+func adminHandler(failures *httpsserver.HandshakeFailures, instanceID string, constraints middleware.RouteConstraints) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(http.MethodGet+" "+statusPath, statusHandler(failures, instanceID))
+	mux.Handle(http.MethodGet+" "+constraintsPath, constraints.Handler())
+	return mux
+}
+
+// statusHandler responds with the server's troubleshooting status, its
+// -instance-id and the recent TLS handshake failures recorded by failures,
+// none if it's nil, as JSON.
+func statusHandler(failures *httpsserver.HandshakeFailures, instanceID string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := serverStatus{InstanceID: instanceID}
+		if failures != nil {
+			status.HandshakeFailures = failures.Report()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(status)
+	})
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package advserver
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youngkin/gohttps/httpsserver"
+	"github.com/youngkin/gohttps/internal/middleware"
+)
+
+// getStatus fetches the admin listener's statusPath from admin.
+func getStatus(t *testing.T, admin *httptest.Server) serverStatus {
+	t.Helper()
+	resp, err := http.Get(admin.URL + statusPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200", resp.StatusCode)
+	}
+	var status serverStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+	return status
+}
+
+func TestAdminStatus(t *testing.T) {
+	failures := httpsserver.NewHandshakeFailures(5)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ErrorLog = log.New(failures.Writer(io.Discard), "", 0)
+	ts.TLS = &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		GetConfigForClient: failures.Wrap(func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return nil, nil
+		}),
+	}
+	ts.StartTLS()
+	defer ts.Close()
+	constraints := middleware.RouteConstraints{"/form": {Methods: []string{http.MethodPost}}}
+	admin := httptest.NewServer(adminHandler(failures, "blue-1", constraints))
+	defer admin.Close()
+
+	if got := getStatus(t, admin).InstanceID; got != "blue-1" {
+		t.Errorf("got the instance ID %q, want -instance-id's", got)
+	}
+	if got := getStatus(t, admin).HandshakeFailures; got.Capacity != 5 || got.Total != 0 || len(got.Failures) != 0 {
+		t.Errorf("got the handshake failures %+v before any handshake, want none", got)
+	}
+
+	// A TLS 1.2 client can't connect to the TLS 1.3 only server
+	conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12, ServerName: "example.com"})
+	if err == nil {
+		conn.Close()
+		t.Fatal("a TLS 1.2 handshake succeeded")
+	}
+	var got httpsserver.HandshakeFailuresReport
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if got = getStatus(t, admin).HandshakeFailures; got.Total > 0 {
+			break
+		}
+	}
+	if got.Total != 1 || len(got.Failures) != 1 {
+		t.Fatalf("got the handshake failures %+v, want the failed handshake", got)
+	}
+	f := got.Failures[0]
+	if f.ServerName != "example.com" || strings.Join(f.Versions, ",") != "TLS 1.2" || !strings.Contains(f.Reason, "unsupported versions") {
+		t.Errorf("got the failure %+v, want the client's SNI, versions, and the reason", f)
+	}
+
+	resp, err := http.Get(admin.URL + constraintsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotConstraints middleware.RouteConstraints
+	err = json.NewDecoder(resp.Body).Decode(&gotConstraints)
+	resp.Body.Close()
+	if err != nil || !reflect.DeepEqual(gotConstraints, constraints) {
+		t.Errorf("got the constraints %+v and the error %v, want %+v", gotConstraints, err, constraints)
+	}
+
+	// Only statusPath and constraintsPath are served, and only to GETs
+	for _, req := range []struct{ method, path string }{{http.MethodGet, "/"}, {http.MethodGet, "/metrics"}, {http.MethodPost, statusPath}, {http.MethodPost, constraintsPath}} {
+		r, err := http.NewRequest(req.method, admin.URL+req.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Errorf("%s %s got a 200, want it not to be served", req.method, req.path)
+		}
+	}
+}
+
+func TestAdminStatusDisabled(t *testing.T) {
+	// With -handshake-failures 0 no failures are recorded
+	admin := httptest.NewServer(adminHandler(nil, "", nil))
+	defer admin.Close()
+	got := getStatus(t, admin)
+	if f := got.HandshakeFailures; f.Capacity != 0 || f.Total != 0 || len(f.Failures) != 0 {
+		t.Errorf("got the handshake failures %+v, want none", f)
+	}
+	if got.InstanceID != "" {
+		t.Errorf("got the instance ID %q without -instance-id, want none", got.InstanceID)
+	}
+}
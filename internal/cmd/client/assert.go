@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+// exitAssertionFailed is the exit status used when an -expect-* assertion
+// fails, so scripts can distinguish failed assertions from other errors.
+const exitAssertionFailed = 3
+
+// headerList is a flag.Value that collects every occurrence of a flag.
+type headerList []string
+
+func (h *headerList) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerList) Set(v string) error {
+	if strings.TrimSpace(strings.SplitN(v, ":", 2)[0]) == "" {
+		return fmt.Errorf("%q must have the form 'Name' or 'Name: value'", v)
+	}
+	*h = append(*h, v)
+	return nil
+}
+
+// assertions are the checks specified by the -expect-* flags. Zero values
+// aren't checked.
+type assertions struct {
+	status       int
+	bodyContains string
+	headers      headerList
+	tlsVersion   uint16
+	certCN       string
+	requireSCT   bool
+}
+
+// check returns a description of each assertion that res and its body fail.
+func (a assertions) check(res httpsclient.Result, body []byte) []string {
+	var failures []string
+	if a.status != 0 && res.StatusCode != a.status {
+		f := fmt.Sprintf("expected status %d, got %d", a.status, res.StatusCode)
+		if advice := retryAdvice(res); advice != "" {
+			f += ", " + advice
+		}
+		failures = append(failures, f)
+	}
+	if a.bodyContains != "" && !bytes.Contains(body, []byte(a.bodyContains)) {
+		failures = append(failures, fmt.Sprintf("expected body to contain %q, got %q", a.bodyContains, body))
+	}
+	for _, h := range a.headers {
+		parts := strings.SplitN(h, ":", 2)
+		name := strings.TrimSpace(parts[0])
+		values, ok := res.Header[http.CanonicalHeaderKey(name)]
+		if !ok {
+			failures = append(failures, fmt.Sprintf("expected header %s, it's missing", name))
+			continue
+		}
+		if len(parts) == 1 {
+			continue
+		}
+		want := strings.TrimSpace(parts[1])
+		if !containsValue(values, want) {
+			failures = append(failures, fmt.Sprintf("expected header %s to contain %q, got %q", name, want, strings.Join(values, ", ")))
+		}
+	}
+	if a.tlsVersion != 0 {
+		got := "none"
+		if res.TLS != nil {
+			got = tls.VersionName(res.TLS.Version)
+		}
+		if res.TLS == nil || res.TLS.Version != a.tlsVersion {
+			failures = append(failures, fmt.Sprintf("expected TLS version %s, got %s", tls.VersionName(a.tlsVersion), got))
+		}
+	}
+	if a.certCN != "" {
+		got := ""
+		if res.TLS != nil && len(res.TLS.PeerCertificates) > 0 {
+			got = res.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		if got != a.certCN {
+			failures = append(failures, fmt.Sprintf("expected server certificate CN %q, got %q", a.certCN, got))
+		}
+	}
+	if a.requireSCT {
+		handshake, embedded, err := serverSCTs(res)
+		switch {
+		case err != nil:
+			failures = append(failures, fmt.Sprintf("expected SCTs, %s", err))
+		case len(handshake) == 0 && len(embedded) == 0:
+			failures = append(failures, "expected SCTs, the server presented none, certificates from private CAs usually don't have any")
+		}
+	}
+	return failures
+}
+
+func containsValue(values []string, want string) bool {
+	for _, v := range values {
+		if strings.Contains(v, want) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+func TestAssertionsCheck(t *testing.T) {
+	res := httpsclient.Result{
+		StatusCode: 200,
+		Header: http.Header{
+			"Content-Type": {"text/plain; charset=utf-8"},
+			"Vary":         {"Accept", "Accept-Encoding"},
+		},
+		TLS: &tls.ConnectionState{
+			Version:          tls.VersionTLS13,
+			PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "myserver"}}},
+		},
+	}
+	body := []byte("Hello, gopher from Advanced Server!")
+
+	tests := []struct {
+		name string
+		a    assertions
+		want []string
+	}{
+		{"none", assertions{}, nil},
+		{"all pass", assertions{
+			status:       200,
+			bodyContains: "Hello",
+			headers:      headerList{"Content-Type: text/plain", "vary: Accept-Encoding", "Vary"},
+			tlsVersion:   tls.VersionTLS13,
+			certCN:       "myserver",
+		}, nil},
+		{"status", assertions{status: 201}, []string{"expected status 201, got 200"}},
+		{"body", assertions{bodyContains: "Goodbye"}, []string{`expected body to contain "Goodbye", got "Hello, gopher from Advanced Server!"`}},
+		{"missing header", assertions{headers: headerList{"X-Request-Id"}}, []string{"expected header X-Request-Id, it's missing"}},
+		{"header value", assertions{headers: headerList{"Content-Type: application/json"}}, []string{`expected header Content-Type to contain "application/json", got "text/plain; charset=utf-8"`}},
+		{"TLS version", assertions{tlsVersion: tls.VersionTLS12}, []string{"expected TLS version TLS 1.2, got TLS 1.3"}},
+		{"certificate CN", assertions{certCN: "otherserver"}, []string{`expected server certificate CN "otherserver", got "myserver"`}},
+		{"every failure is reported", assertions{status: 404, certCN: "otherserver"}, []string{
+			"expected status 404, got 200",
+			`expected server certificate CN "otherserver", got "myserver"`,
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.a.check(res, body); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got the failures %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAssertionsCheckWithoutTLS(t *testing.T) {
+	a := assertions{tlsVersion: tls.VersionTLS13, certCN: "myserver"}
+	want := []string{"expected TLS version TLS 1.3, got none", `expected server certificate CN "myserver", got ""`}
+	if got := a.check(httpsclient.Result{StatusCode: 200}, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("got the failures %q, want %q", got, want)
+	}
+}
+
+func TestHeaderList(t *testing.T) {
+	var h headerList
+	for _, v := range []string{"Content-Type: text/plain", "X-Request-Id"} {
+		if err := h.Set(v); err != nil {
+			t.Errorf("Set(%q) failed: %s", v, err)
+		}
+	}
+	if err := h.Set(": value"); err == nil {
+		t.Error("a header without a name was accepted")
+	}
+	if got := h.String(); got != "Content-Type: text/plain, X-Request-Id" {
+		t.Errorf("got %q, want both headers", got)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+// batchEntry is a request of a -batch file, and what its response is
+// expected to be. Each line of the file is either a JSON object, e.g.,
+//
+//	{"name": "login", "method": "POST", "path": "/form", "header": {"Content-Type": "application/x-www-form-urlencoded"}, "body": "user=me", "expect_status": 200}
+//
+// or, for simple cases, a method, a path, and, optionally, the expected
+// status and a body, separated by whitespace, e.g.,
+//
+//	GET /healthz 200
+//	POST / 200 World
+//
+// Blank lines and lines starting with '#' are skipped.
+type batchEntry struct {
+	Name               string            `json:"name,omitempty"`
+	Method             string            `json:"method"`
+	Path               string            `json:"path"`
+	Header             map[string]string `json:"header,omitempty"`
+	Body               string            `json:"body,omitempty"`
+	Host               string            `json:"host,omitempty"`
+	ExpectStatus       int               `json:"expect_status,omitempty"`
+	ExpectBodyContains string            `json:"expect_body_contains,omitempty"`
+	ExpectHeader       []string          `json:"expect_header,omitempty"`
+
+	// line is the entry's line number in the file.
+	line int
+}
+
+// batchResult is the outcome of a batchEntry, as written by -batch-format
+// json, one JSON object per line.
+type batchResult struct {
+	Line      int      `json:"line"`
+	Name      string   `json:"name,omitempty"`
+	Method    string   `json:"method"`
+	Path      string   `json:"path"`
+	Status    int      `json:"status,omitempty"`
+	LatencyMS float64  `json:"latency_ms"`
+	Pass      bool     `json:"pass"`
+	Failures  []string `json:"failures,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// loadBatch reads the entries of the -batch file path.
+func loadBatch(path string) ([]batchEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the batch file: %w", err)
+	}
+	defer f.Close()
+
+	var entries []batchEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := parseBatchEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch entry on line %d of %s: %w", n, path, err)
+		}
+		e.line = n
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read the batch file: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s doesn't contain any batch entries", path)
+	}
+	return entries, nil
+}
+
+func parseBatchEntry(line string) (batchEntry, error) {
+	var e batchEntry
+	if strings.HasPrefix(line, "{") {
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&e); err != nil {
+			return batchEntry{}, err
+		}
+	} else {
+		// The body is the rest of the line after the method, path, and status
+		var fields []string
+		rest := line
+		for len(fields) < 3 && rest != "" {
+			field := rest
+			if i := strings.IndexAny(rest, " \t"); i >= 0 {
+				field, rest = rest[:i], strings.TrimLeft(rest[i:], " \t")
+			} else {
+				rest = ""
+			}
+			fields = append(fields, field)
+		}
+		if rest != "" {
+			fields = append(fields, rest)
+		}
+		e.Method = fields[0]
+		if len(fields) > 1 {
+			e.Path = fields[1]
+		}
+		if len(fields) > 2 {
+			status, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return batchEntry{}, fmt.Errorf("invalid status %q", fields[2])
+			}
+			e.ExpectStatus = status
+		}
+		if len(fields) > 3 {
+			e.Body = fields[3]
+		}
+	}
+	if e.Method == "" {
+		e.Method = http.MethodGet
+	}
+	e.Method = strings.ToUpper(e.Method)
+	if !strings.HasPrefix(e.Path, "/") {
+		return batchEntry{}, fmt.Errorf("the path %q must start with '/'", e.Path)
+	}
+	for _, h := range e.ExpectHeader {
+		if err := new(headerList).Set(h); err != nil {
+			return batchEntry{}, err
+		}
+	}
+	return e, nil
+}
+
+// request returns the request e describes, sent to base, e.g.,
+// https://localhost:8443.
+func (e batchEntry) request(base string) httpsclient.Request {
+	req := httpsclient.Request{Method: e.Method, URL: base + e.Path, Body: []byte(e.Body), Host: e.Host}
+	if len(e.Header) > 0 {
+		req.Header = http.Header{}
+		for name, value := range e.Header {
+			req.Header.Set(name, value)
+		}
+	}
+	return req
+}
+
+// assertions returns the -expect-* assertions, expect, overridden by e's.
+func (e batchEntry) assertions(expect assertions) assertions {
+	if e.ExpectStatus != 0 {
+		expect.status = e.ExpectStatus
+	}
+	if e.ExpectBodyContains != "" {
+		expect.bodyContains = e.ExpectBodyContains
+	}
+	if len(e.ExpectHeader) > 0 {
+		expect.headers = append(append(headerList{}, expect.headers...), e.ExpectHeader...)
+	}
+	return expect
+}
+
+// runBatch sends the entries to base, parallel at a time, checking each
+// response against the entry's assertions, and writes the result of each,
+// in the entries' order, in format, text or json, to w. It returns whether
+// every entry passed.
+func runBatch(w io.Writer, client *http.Client, base string, entries []batchEntry, expect assertions, parallel int, format string, har *httpsclient.HARRecorder) bool {
+	results := make([]batchResult, len(entries))
+	// done[i] is closed once results[i] is set, so results are written in
+	// order as soon as they, and those before them, are available.
+	done := make([]chan struct{}, len(entries))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func(i int, e batchEntry) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = runBatchEntry(client, base, e, expect, har)
+			close(done[i])
+		}(i, e)
+	}
+
+	passed := 0
+	enc := json.NewEncoder(w)
+	for i := range entries {
+		<-done[i]
+		r := results[i]
+		if r.Pass {
+			passed++
+		}
+		if format == "json" {
+			enc.Encode(r)
+			continue
+		}
+		writeBatchResult(w, r)
+	}
+	wg.Wait()
+	if format != "json" {
+		fmt.Fprintf(w, "\n%d of %d batch entries passed\n", passed, len(entries))
+	}
+	return passed == len(entries)
+}
+
+// runBatchEntry sends e's request, the entries are independent, so one
+// failing doesn't stop the others.
+func runBatchEntry(client *http.Client, base string, e batchEntry, expect assertions, har *httpsclient.HARRecorder) batchResult {
+	r := batchResult{Line: e.line, Name: e.Name, Method: e.Method, Path: e.Path}
+	start := time.Now()
+	res, body, err := doRequest(context.Background(), client, e.request(base), har)
+	r.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Status = res.StatusCode
+	r.Failures = e.assertions(expect).check(res, body)
+	r.Pass = len(r.Failures) == 0
+	return r
+}
+
+func writeBatchResult(w io.Writer, r batchResult) {
+	verdict := "PASS"
+	if !r.Pass {
+		verdict = "FAIL"
+	}
+	name := r.Name
+	if name == "" {
+		name = fmt.Sprintf("line %d", r.Line)
+	}
+	status := "-"
+	if r.Status != 0 {
+		status = strconv.Itoa(r.Status)
+	}
+	fmt.Fprintf(w, "%s  %-20s %-7s %-30s %-3s  %8.1fms\n", verdict, name, r.Method, r.Path, status, r.LatencyMS)
+	if r.Error != "" {
+		fmt.Fprintf(w, "      %s\n", r.Error)
+	}
+	for _, f := range r.Failures {
+		fmt.Fprintf(w, "      %s\n", f)
+	}
+}
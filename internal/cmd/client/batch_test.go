@@ -0,0 +1,237 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeBatch writes a -batch file with content, returning its name.
+func writeBatch(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "batch.txt")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadBatch(t *testing.T) {
+	path := writeBatch(t, `# Smoke tests
+
+GET /healthz 200
+post /	200   Hello, World
+  DELETE /items/1
+GET /
+{"name": "form", "method": "POST", "path": "/form", "header": {"content-type": "text/plain"}, "body": "a b", "host": "example.com", "expect_status": 415, "expect_body_contains": "multipart", "expect_header": ["Allow"]}
+{"path": "/json"}
+`)
+	got, err := loadBatch(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []batchEntry{
+		{Method: "GET", Path: "/healthz", ExpectStatus: 200, line: 3},
+		// The body is the rest of the line, spaces and all
+		{Method: "POST", Path: "/", ExpectStatus: 200, Body: "Hello, World", line: 4},
+		{Method: "DELETE", Path: "/items/1", line: 5},
+		{Method: "GET", Path: "/", line: 6},
+		{Name: "form", Method: "POST", Path: "/form", Header: map[string]string{"content-type": "text/plain"}, Body: "a b", Host: "example.com",
+			ExpectStatus: 415, ExpectBodyContains: "multipart", ExpectHeader: []string{"Allow"}, line: 7},
+		{Method: "GET", Path: "/json", line: 8},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got the entries\n%+v\nwant\n%+v", got, want)
+	}
+
+	req := got[4].request("https://localhost:8443")
+	if req.URL != "https://localhost:8443/form" || req.Header.Get("Content-Type") != "text/plain" || string(req.Body) != "a b" || req.Host != "example.com" {
+		t.Errorf("got the request %+v, want the entry's", req)
+	}
+	expect := got[4].assertions(assertions{status: 200, headers: headerList{"X-Request-ID"}})
+	if expect.status != 415 || expect.bodyContains != "multipart" || !reflect.DeepEqual(expect.headers, headerList{"X-Request-ID", "Allow"}) {
+		t.Errorf("got the assertions %+v, want the entry's added to the -expect-* ones", expect)
+	}
+}
+
+func TestLoadBatchInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"empty", "\n# Nothing to send\n", "doesn't contain any batch entries"},
+		{"invalid status", "GET / OK", `invalid batch entry on line 1 of %s: invalid status "OK"`},
+		{"no path", "\n\nGET", `line 3 of %s: the path "" must start with '/'`},
+		{"relative path", "GET healthz 200", `the path "healthz" must start with '/'`},
+		{"invalid JSON", `{"method": "GET", "path": "/"`, "line 1"},
+		{"unknown field", `{"method": "GET", "path": "/", "status": 200}`, `unknown field "status"`},
+		{"JSON without a path", `{"method": "GET"}`, `the path "" must start with '/'`},
+		{"invalid expected header", `{"path": "/", "expect_header": [": value"]}`, "must have the form 'Name' or 'Name: value'"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeBatch(t, tc.content)
+			// %s is the file's name
+			wantErr := strings.Replace(tc.wantErr, "%s", path, 1)
+			if _, err := loadBatch(path); err == nil || !strings.Contains(err.Error(), wantErr) {
+				t.Errorf("got the error %v, want one containing %q", err, wantErr)
+			}
+		})
+	}
+
+	if _, err := loadBatch(filepath.Join(t.TempDir(), "missing")); err == nil || !strings.Contains(err.Error(), "unable to open the batch file") {
+		t.Errorf("got the error %v for a missing file, want one saying it can't be opened", err)
+	}
+}
+
+// newBatchServer returns a server that responds to /ok with a 200, /teapot
+// with a 418 and /slow with a 200 after a delay, along with the greatest
+// number of requests it handled at once.
+func newBatchServer(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var inflight, maxInflight int32
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInflight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInflight, max, n) {
+				break
+			}
+		}
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(50 * time.Millisecond)
+		case "/teapot":
+			w.WriteHeader(http.StatusTeapot)
+		}
+		w.Header().Set("X-Method", r.Method)
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(append([]byte(r.Method+" "), body...))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &maxInflight
+}
+
+func TestRunBatch(t *testing.T) {
+	ts, _ := newBatchServer(t)
+	entries := []batchEntry{
+		{Name: "ok", Method: "POST", Path: "/ok", Body: "gopher", ExpectBodyContains: "POST gopher", line: 1},
+		{Method: "GET", Path: "/teapot", line: 2},
+		{Method: "GET", Path: "/ok", ExpectStatus: 201, ExpectHeader: []string{"X-Method: POST", "X-Missing"}, line: 3},
+	}
+
+	var out bytes.Buffer
+	if runBatch(&out, ts.Client(), ts.URL, entries, assertions{}, 1, "text", nil) {
+		t.Error("the batch passed, want it to fail")
+	}
+	want := []string{
+		`^PASS  ok +POST +/ok +200 +\d+\.\dms$`,
+		`^PASS  line 2 +GET +/teapot +418 +\d+\.\dms$`,
+		`^FAIL  line 3 +GET +/ok +200 +\d+\.\dms$`,
+		`^      expected status 201, got 200$`,
+		`^      expected header X-Method to contain "POST", got "GET"$`,
+		`^      expected header X-Missing, it's missing$`,
+		`^$`,
+		`^2 of 3 batch entries passed$`,
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got the output\n%s\nwant %d lines", &out, len(want))
+	}
+	for i, re := range want {
+		if !regexp.MustCompile(re).MatchString(lines[i]) {
+			t.Errorf("got the line %q, want it to match %q", lines[i], re)
+		}
+	}
+
+	// The -expect-* assertions apply to the entries without their own
+	out.Reset()
+	if !runBatch(&out, ts.Client(), ts.URL, entries[1:2], assertions{status: http.StatusTeapot}, 1, "text", nil) {
+		t.Errorf("got the output\n%s\nwant the entry to pass", &out)
+	}
+	out.Reset()
+	if runBatch(&out, ts.Client(), ts.URL, entries[:1], assertions{status: http.StatusTeapot}, 1, "text", nil) {
+		t.Errorf("got the output\n%s\nwant the entry to fail the -expect-status assertion", &out)
+	}
+}
+
+func TestRunBatchJSON(t *testing.T) {
+	ts, _ := newBatchServer(t)
+	entries := []batchEntry{
+		{Method: "GET", Path: "/ok", ExpectStatus: 200, line: 1},
+		{Method: "GET", Path: "/teapot", ExpectStatus: 200, line: 2},
+	}
+	var out bytes.Buffer
+	if runBatch(&out, ts.Client(), "https://127.0.0.1:1", entries[:1], assertions{}, 1, "json", nil) {
+		t.Error("the batch passed without a server, want it to fail")
+	}
+	var unreachable batchResult
+	if err := json.Unmarshal(out.Bytes(), &unreachable); err != nil {
+		t.Fatal(err)
+	}
+	if unreachable.Pass || unreachable.Status != 0 || !strings.Contains(unreachable.Error, "connection refused") {
+		t.Errorf("got the result %+v, want it to fail with the connection refused", unreachable)
+	}
+
+	out.Reset()
+	runBatch(&out, ts.Client(), ts.URL, entries, assertions{}, 2, "json", nil)
+	dec := json.NewDecoder(&out)
+	var got []batchResult
+	for dec.More() {
+		var r batchResult
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		r.LatencyMS = 0
+		got = append(got, r)
+	}
+	want := []batchResult{
+		{Line: 1, Method: "GET", Path: "/ok", Status: 200, Pass: true},
+		{Line: 2, Method: "GET", Path: "/teapot", Status: 418, Failures: []string{"expected status 200, got 418"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got the results %+v, want %+v", got, want)
+	}
+}
+
+func TestRunBatchParallel(t *testing.T) {
+	ts, maxInflight := newBatchServer(t)
+	var entries []batchEntry
+	for i := 1; i <= 12; i++ {
+		entries = append(entries, batchEntry{Method: "GET", Path: "/slow", ExpectStatus: 200, line: i})
+	}
+	var out bytes.Buffer
+	if !runBatch(&out, ts.Client(), ts.URL, entries, assertions{}, 3, "json", nil) {
+		t.Errorf("got the results\n%s\nwant them all to pass", &out)
+	}
+	if got := atomic.LoadInt32(maxInflight); got != 3 {
+		t.Errorf("got at most %d requests at once, want -batch-parallel's 3", got)
+	}
+
+	// The results are in the entries' order, however they finish
+	dec := json.NewDecoder(&out)
+	for line := 1; dec.More(); line++ {
+		var r batchResult
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Line != line {
+			t.Fatalf("got the result of line %d, want line %d", r.Line, line)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/youngkin/gohttps/httpsclient"
+	"github.com/youngkin/gohttps/internal/certs"
+	"github.com/youngkin/gohttps/internal/logging"
+)
+
+// etagSuffix is appended to the name of the -cacert-url cache file to name
+// the file its ETag is saved in.
+const etagSuffix = ".etag"
+
+// refreshCABundle fetches the CA bundle published at bundleURL and saves it
+// to cache, so cache can be used as the CA file. If cache, and the ETag it
+// was served with, were saved by an earlier run the bundle is only
+// downloaded again if it has changed. The server is verified against the
+// system's root CAs or, if pin isn't empty, by one of the certificates it
+// presents having the SHA-256 fingerprint pin. If the bundle can't be
+// fetched the cached copy is used, with a warning, unless strict is true or
+// there isn't one, in which case the error is returned. cfg configures the
+// connection, apart from its verification.
+func refreshCABundle(bundleURL, cache, pin string, strict bool, cfg httpsclient.Config) error {
+	err := fetchCABundle(bundleURL, cache, pin, cfg)
+	if err == nil {
+		return nil
+	}
+	if _, statErr := os.Stat(cache); strict || statErr != nil {
+		return err
+	}
+	logging.Warnf("%s, using the cached copy in %s", err, cache)
+	return nil
+}
+
+func fetchCABundle(bundleURL, cache, pin string, cfg httpsclient.Config) error {
+	cfg.CACertFile = ""
+	cfg.UseSystemRoots = pin == ""
+	cfg.InsecureSkipVerify = pin != ""
+	client, err := httpsclient.NewClient(cfg)
+	if err != nil {
+		return err
+	}
+	if pin != "" {
+		httpsclient.TLSClientConfig(client).VerifyConnection = verifyPin(pin)
+	}
+
+	req := httpsclient.Request{URL: bundleURL, Header: http.Header{}}
+	etag, err := ioutil.ReadFile(cache + etagSuffix)
+	if _, statErr := os.Stat(cache); err == nil && statErr == nil {
+		req.Header.Set("If-None-Match", strings.TrimSpace(string(etag)))
+	}
+	res, err := httpsclient.Do(context.Background(), client, req)
+	if err != nil {
+		return fmt.Errorf("unable to fetch the CA bundle from %s: %w", bundleURL, err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxCASize))
+	if err != nil {
+		return fmt.Errorf("unable to read the CA bundle from %s: %w", bundleURL, err)
+	}
+	if res.StatusCode == http.StatusNotModified {
+		log.Printf("The CA bundle at %s hasn't changed, using the cached copy in %s", bundleURL, cache)
+		return nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to fetch the CA bundle from %s: %s %s", bundleURL, res.Status, bytes.TrimSpace(body))
+	}
+	cas, err := certs.ParseCertificates(body)
+	if err != nil {
+		return fmt.Errorf("invalid CA bundle from %s: %w", bundleURL, err)
+	}
+
+	var b bytes.Buffer
+	for _, ca := range cas {
+		pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+	}
+	if err := ioutil.WriteFile(cache, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("unable to save the CA bundle: %w", err)
+	}
+	// Without an ETag the bundle is downloaded again next time
+	os.Remove(cache + etagSuffix)
+	if etag := res.Header.Get("ETag"); etag != "" {
+		if err := ioutil.WriteFile(cache+etagSuffix, []byte(etag+"\n"), 0644); err != nil {
+			logging.Warnf("Unable to save the CA bundle's ETag: %s", err)
+		}
+	}
+	log.Printf("Saved the %d certificate CA bundle from %s to %s", len(cas), bundleURL, cache)
+	return nil
+}
+
+// verifyPin returns a tls.Config.VerifyConnection function that accepts the
+// connection if one of the certificates the server presents has the SHA-256
+// fingerprint pin, in hex, with or without colons.
+func verifyPin(pin string) func(tls.ConnectionState) error {
+	want := normalizeFingerprint(pin)
+	return func(cs tls.ConnectionState) error {
+		for _, cert := range cs.PeerCertificates {
+			if normalizeFingerprint(certs.Fingerprint(cert)) == want {
+				return nil
+			}
+		}
+		return fmt.Errorf("none of the server's certificates has the -cacert-url-pin fingerprint %s", pin)
+	}
+}
+
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+}
+
+// validFingerprint returns whether fp is a SHA-256 fingerprint in hex, with
+// or without colons.
+func validFingerprint(fp string) bool {
+	fp = normalizeFingerprint(fp)
+	if len(fp) != 64 {
+		return false
+	}
+	for _, c := range fp {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/youngkin/gohttps/httpsclient"
+	"github.com/youngkin/gohttps/internal/certs"
+)
+
+const bundleETag = `"v1"`
+
+// newBundleServer returns a server that publishes its own certificate as a
+// CA bundle at /bundle.pem, with an ETag, and how many times the bundle was
+// sent in full. It fails every request while failing is true.
+func newBundleServer(t *testing.T, failing *atomic.Bool) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var sent atomic.Int32
+	var ts *httptest.Server
+	ts = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("ETag", bundleETag)
+		if r.Header.Get("If-None-Match") == bundleETag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		sent.Add(1)
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts, &sent
+}
+
+// captureLog returns the standard logger's output until the test completes.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var b bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&b)
+	t.Cleanup(func() { log.SetOutput(out) })
+	return &b
+}
+
+func TestRefreshCABundle(t *testing.T) {
+	logged := captureLog(t)
+	var failing atomic.Bool
+	ts, sent := newBundleServer(t, &failing)
+	url := ts.URL + "/bundle.pem"
+	pin := certs.Fingerprint(ts.Certificate())
+	cache := filepath.Join(t.TempDir(), "ca.pem")
+
+	// The first run downloads the bundle and saves it with its ETag
+	if err := refreshCABundle(url, cache, pin, false, httpsclient.Config{}); err != nil {
+		t.Fatalf("fetching the bundle failed: %s", err)
+	}
+	saved, err := ioutil.ReadFile(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cas, err := certs.ParseCertificates(saved)
+	if err != nil || len(cas) != 1 || !cas[0].Equal(ts.Certificate()) {
+		t.Errorf("got the cached bundle %q (%v), want the server's certificate", saved, err)
+	}
+	if etag, err := ioutil.ReadFile(cache + etagSuffix); err != nil || strings.TrimSpace(string(etag)) != bundleETag {
+		t.Errorf("got the cached ETag %q (%v), want %s", etag, err, bundleETag)
+	}
+
+	// The next run is told the bundle hasn't changed and reuses the cache
+	if err := refreshCABundle(url, cache, pin, false, httpsclient.Config{}); err != nil {
+		t.Fatalf("refreshing the bundle failed: %s", err)
+	}
+	if n := sent.Load(); n != 1 {
+		t.Errorf("the bundle was sent %d times, want 1 and then 304 Not Modified", n)
+	}
+	if !strings.Contains(logged.String(), "hasn't changed, using the cached copy in "+cache) {
+		t.Errorf("got the log %q, want the cached copy reused", logged.String())
+	}
+	if again, _ := ioutil.ReadFile(cache); !bytes.Equal(again, saved) {
+		t.Errorf("got the cached bundle %q after a 304, want it unchanged", again)
+	}
+
+	// A failed fetch falls back to the cache with a warning
+	failing.Store(true)
+	logged.Reset()
+	if err := refreshCABundle(url, cache, pin, false, httpsclient.Config{}); err != nil {
+		t.Fatalf("got the error %q with a cached copy, want it used", err)
+	}
+	if got := logged.String(); !strings.Contains(got, "WARNING: ") || !strings.Contains(got, "503 Service Unavailable") ||
+		!strings.Contains(got, "using the cached copy in "+cache) {
+		t.Errorf("got the log %q, want a warning that the cached copy is used", got)
+	}
+
+	// -cacert-url-strict fails instead
+	logged.Reset()
+	err = refreshCABundle(url, cache, pin, true, httpsclient.Config{})
+	if err == nil || !strings.Contains(err.Error(), "503 Service Unavailable") {
+		t.Errorf("got the error %v with -cacert-url-strict, want the failed fetch", err)
+	}
+	if strings.Contains(logged.String(), "using the cached copy") {
+		t.Errorf("got the log %q with -cacert-url-strict, want the cached copy not used", logged.String())
+	}
+}
+
+// TestCABundleStrictExit runs the client, in a child process, with
+// -cacert-url-strict and a cached bundle that can't be refreshed.
+func TestCABundleStrictExit(t *testing.T) {
+	if args := os.Getenv("CABUNDLE_STRICT_ARGS"); args != "" {
+		Main("client", strings.Fields(args))
+		return
+	}
+	captureLog(t)
+	var failing atomic.Bool
+	ts, _ := newBundleServer(t, &failing)
+	cache := filepath.Join(t.TempDir(), "ca.pem")
+	if err := refreshCABundle(ts.URL+"/bundle.pem", cache, certs.Fingerprint(ts.Certificate()), false, httpsclient.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	failing.Store(true)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCABundleStrictExit$")
+	cmd.Env = append(os.Environ(), "CABUNDLE_STRICT_ARGS=-cacert-url "+ts.URL+"/bundle.pem -cacert "+cache+
+		" -cacert-url-pin "+certs.Fingerprint(ts.Certificate())+" -cacert-url-strict -srvhost "+ts.Listener.Addr().String())
+	out, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("got %v with -cacert-url-strict, want exit status 1; output:\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "503 Service Unavailable") || strings.Contains(string(out), "using the cached copy") {
+		t.Errorf("got the output %q, want the failed fetch and the cached copy not used", out)
+	}
+}
+
+func TestRefreshCABundleNoCache(t *testing.T) {
+	captureLog(t)
+	failing := &atomic.Bool{}
+	failing.Store(true)
+	ts, _ := newBundleServer(t, failing)
+	cache := filepath.Join(t.TempDir(), "ca.pem")
+	// Without a cached copy there's nothing to fall back to
+	if err := refreshCABundle(ts.URL+"/bundle.pem", cache, certs.Fingerprint(ts.Certificate()), false, httpsclient.Config{}); err == nil {
+		t.Error("a failed fetch with no cached copy succeeded")
+	}
+}
+
+func TestRefreshCABundlePin(t *testing.T) {
+	captureLog(t)
+	var failing atomic.Bool
+	ts, sent := newBundleServer(t, &failing)
+	fp := certs.Fingerprint(ts.Certificate())
+
+	tests := []struct {
+		name string
+		pin  string
+		ok   bool
+	}{
+		{"matching", fp, true},
+		{"matching without colons, in upper case", strings.ToUpper(strings.ReplaceAll(fp, ":", "")), true},
+		{"mismatching", strings.Repeat("00", 32), false},
+	}
+	for _, tc := range tests {
+		cache := filepath.Join(t.TempDir(), "ca.pem")
+		before := sent.Load()
+		err := refreshCABundle(ts.URL+"/bundle.pem", cache, tc.pin, false, httpsclient.Config{})
+		if tc.ok && err != nil {
+			t.Errorf("%s pin: got the error %q, want the bundle fetched", tc.name, err)
+		}
+		if !tc.ok && (err == nil || !strings.Contains(err.Error(), "-cacert-url-pin fingerprint")) {
+			t.Errorf("%s pin: got the error %v, want the server rejected", tc.name, err)
+		}
+		if !tc.ok && sent.Load() != before {
+			t.Errorf("%s pin: the bundle was sent to the client", tc.name)
+		}
+	}
+}
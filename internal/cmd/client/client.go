@@ -0,0 +1,942 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package client implements the client command, which makes a request to
+// one of the servers using the httpsclient package.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/youngkin/gohttps/httpsclient"
+	"github.com/youngkin/gohttps/internal/certs"
+	"github.com/youngkin/gohttps/internal/cli"
+	"github.com/youngkin/gohttps/internal/logging"
+	"github.com/youngkin/gohttps/internal/tlsutil"
+	"github.com/youngkin/gohttps/internal/version"
+)
+
+// envPrefix is the prefix of the environment variables the client's options
+// are read from, e.g., GOHTTPS_CLIENT_SRVHOST for -srvhost.
+const envPrefix = "GOHTTPS_CLIENT_"
+
+// Main runs the client. name is the name the command was invoked as and args
+// are the command line arguments following it.
+func Main(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	help := fs.Bool("help", false, "Optional, prints usage info")
+	showVersion := fs.Bool("version", false, "Optional, prints the build version and exits")
+	configFile := fs.String("config", "", "Optional, the name of a JSON file of option values, command line options override them")
+	configProfile := fs.String("config-profile", "", "Optional, with -config, the name of the profile in the file to use")
+	var srvhosts stringList
+	fs.Var(&srvhosts, "srvhost", "Optional, repeatable, the server's host name, defaults to localhost")
+	var compareHeaders stringList
+	fs.Var(&compareHeaders, "compare-header", "Optional, repeatable, a header compared across the responses from multiple -srvhost servers, defaults to Content-Type")
+	hostHeader := fs.String("host-header", "", "Optional, the Host header sent instead of the -srvhost host, which is still the host connected to")
+	sni := fs.String("sni", "", "Optional, the TLS server name sent, and the server's certificate is verified against, instead of the -srvhost host")
+	requireIdentical := fs.Bool("require-identical", false, "Optional, exit with status 4 if the responses from multiple -srvhost servers differ")
+	caCertFile := fs.String("cacert", "", "Required, the name of the CA that signed the server's certificate")
+	useSystemRoots := fs.Bool("use-system-roots", false, "Optional, trust the system's root CAs in addition to -cacert's")
+	fetchCAURL := fs.String("fetch-ca", "", "Optional, a URL, e.g., https://host:8443/ca.pem, to download the CA certificate from, without verification, and save to -cacert")
+	yes := fs.Bool("yes", false, "Optional, with -fetch-ca, trust the downloaded CA certificate without asking for confirmation")
+	caCertURL := fs.String("cacert-url", "", "Optional, an https URL to fetch the CA bundle from at startup, cached in -cacert and used to verify the server")
+	caCertURLPin := fs.String("cacert-url-pin", "", "Optional, with -cacert-url, the SHA-256 fingerprint of a certificate the bundle's server must present, instead of verifying it with the system's roots")
+	caCertURLStrict := fs.Bool("cacert-url-strict", false, "Optional, with -cacert-url, exit rather than use the cached bundle if it can't be fetched")
+	clientCertFile := fs.String("clientcert", "", "Optional, the name of the client's certificate file")
+	clientKeyFile := fs.String("clientkey", "", "Optional, the file name of the clients's private key file")
+	clientKeyPass := fs.String("clientkey-pass", "", "Optional, the passphrase for an encrypted client private key")
+	clientKeyPassFile := fs.String("clientkey-pass-file", "", "Optional, the name of a file containing the passphrase for an encrypted client private key")
+	requireClientCertUse := fs.Bool("require-client-cert-use", false, "Optional, fail the connection if the server requests a client certificate and none is sent")
+	profile := fs.String("profile", "", "Optional, the TLS profile, one of modern, intermediate, or old, that sets the minimum TLS version, cipher suites, and curves")
+	kex := fs.String("kex", "", "Optional, a comma separated list of the key exchange groups, or curves, the client offers, e.g., 'X25519MLKEM768', overrides -profile")
+	renegotiation := fs.String("renegotiation", "never", "Optional, whether the server may renegotiate the TLS connection, one of never, once, or freely")
+	resumeSessions := fs.Bool("resume-sessions", false, "Optional, cache TLS sessions so new connections resume them instead of performing a full handshake")
+	clockSkewTolerance := fs.Duration("clock-skew-tolerance", 0, "Optional, accept a server certificate that has expired, or isn't valid yet, by at most this much, e.g., 5m, 0 disables")
+	saveRequestFile := fs.String("save-request", "", "Optional, the name of a file to save the requests sent to, for -replay")
+	replayFile := fs.String("replay", "", "Optional, the name of a file of requests, saved by -save-request, to send instead of the default request")
+	replayHost := fs.String("replay-host", "", "Optional, with -replay, the host, and optional port, to send the saved requests to instead of their own")
+	harFile := fs.String("har", "", "Optional, the name of a file to write the requests and responses to in HAR format")
+	harMaxBody := fs.Int("har-max-body", 64*1024, "Optional, the maximum number of bytes of each request and response body recorded in the HAR file")
+	count := fs.Int("n", 1, "Optional, the number of requests to make")
+	clientMetricsPort := fs.Int("client-metrics-port", 0, "Optional, serve Prometheus metrics of the -n requests on this localhost port while they're sent")
+	maxIdleConns := fs.Int("max-idle-conns", httpsclient.DefaultMaxIdleConns, "Optional, the maximum number of idle connections kept for reuse")
+	maxIdleConnsPerHost := fs.Int("max-idle-conns-per-host", httpsclient.DefaultMaxIdleConnsPerHost, "Optional, the maximum number of idle connections per host kept for reuse")
+	noTrace := fs.Bool("no-trace", false, "Optional, don't trace the requests' connections and timings, reducing the overhead of each request, e.g., with a large -n")
+	singleConn := fs.Bool("single-connection", false, "Optional, send every request over a single TLS connection, and fail rather than dial another if it's closed")
+	noKeepalive := fs.Bool("no-keepalive", false, "Optional, use a new connection, and TLS handshake, for every request instead of reusing connections")
+	idleConnTimeout := fs.Duration("idle-conn-timeout", httpsclient.DefaultIdleConnTimeout, "Optional, how long an idle connection is kept before it's closed")
+	var tcpFlags cli.TCPFlags
+	tcpFlags.Register(fs)
+	var logFlags cli.LogFlags
+	logFlags.Register(fs)
+	var dumpFlags cli.DumpFlags
+	dumpFlags.Register(fs)
+	var expect assertions
+	fs.IntVar(&expect.status, "expect-status", 0, "Optional, exit with status 3 unless the response has this HTTP status code")
+	fs.StringVar(&expect.bodyContains, "expect-body-contains", "", "Optional, exit with status 3 unless the response body contains this string")
+	fs.Var(&expect.headers, "expect-header", "Optional, repeatable, exit with status 3 unless the response has this header, given as 'Name' or 'Name: value'")
+	expectTLSVersion := fs.String("expect-tls-version", "", "Optional, exit with status 3 unless this TLS version, e.g., 1.3, was negotiated")
+	doPreflight := fs.Bool("preflight", false, "Optional, check DNS, TCP, TLS, and the server certificate for each server address before sending the requests")
+	preflightOnly := fs.Bool("preflight-only", false, "Optional, only perform the -preflight checks, don't send the requests")
+	checkExpiryMode := fs.Bool("check-expiry", false, "Optional, only check, and print, how many days are left until each server's certificates expire, exiting with a Nagios status")
+	warnDays := fs.Int("warn-days", 30, "Optional, with -check-expiry, warn about certificates that expire in fewer than this many days")
+	expiryFormat := fs.String("expiry-format", "text", "Optional, with -check-expiry, the format of the results, text or json")
+	printCurl := fs.Bool("print-curl", false, "Optional, print the curl command equivalent to each request to standard error before sending it")
+	printCurlOnly := fs.Bool("print-curl-only", false, "Optional, only print the -print-curl commands, don't send the requests")
+	http2PriorKnowledge := fs.Bool("http2-prior-knowledge", false, "Optional, send the requests using HTTP/2 without TLS, h2c, with prior knowledge")
+	probeProtos := fs.Bool("probe-protocols", false, "Optional, probe each server for h2, HTTP/1.1 over TLS, h2c, and cleartext HTTP/1.1 support, print the results, and exit")
+	var formFields, formFiles stringList
+	fs.Var(&formFields, "form", "Optional, repeatable, a name=value field of a multipart form POST to /form")
+	fs.Var(&formFiles, "form-file", "Optional, repeatable, a field=path file of a multipart form POST to /form")
+	batchFile := fs.String("batch", "", "Optional, the name of a file of requests, and their expected responses, to send and check, reporting which passed")
+	batchParallel := fs.Int("batch-parallel", 1, "Optional, with -batch, the number of requests sent at the same time")
+	batchFormat := fs.String("batch-format", "text", "Optional, with -batch, the format of the results, text or json")
+	repl := fs.Bool("repl", false, "Optional, read requests and commands interactively from standard input, type 'help' for the list of commands")
+	var respFmt responseFormat
+	fs.BoolVar(&respFmt.headers, "show-headers", false, "Optional, print the response headers before the body")
+	fs.BoolVar(&respFmt.headers, "i", false, "Optional, the same as -show-headers")
+	head := fs.Bool("head", false, "Optional, send a HEAD request instead of the default GET and print only the response headers")
+	fs.BoolVar(&respFmt.raw, "raw", false, "Optional, don't ask for, or decompress, compressed responses, and print the Content-Encoding and Content-Length they were sent with")
+	fs.BoolVar(&respFmt.hexdump, "hexdump", false, "Optional, print response bodies as a hex dump, e.g., for binary or, with -raw, compressed bodies")
+	showSCT := fs.Bool("show-sct", false, "Optional, print the certificate transparency SCTs the server presents")
+	fs.BoolVar(&expect.requireSCT, "require-sct", false, "Optional, exit with status 3 unless the server presents at least one certificate transparency SCT")
+	fs.StringVar(&expect.certCN, "expect-cert-cn", "", "Optional, exit with status 3 unless the server certificate has this common name")
+	fs.Parse(args)
+
+	usage := fmt.Sprintf(`usage:
+	
+%s -cacert <caFile> [-config <file> -config-profile <name> -use-system-roots -fetch-ca <url> -yes -cacert-url <url> -cacert-url-pin <fingerprint> -cacert-url-strict -clientcert <clientCertificateFile> -clientkey <clientPrivateKeyFile> -clientkey-pass <passphrase> -clientkey-pass-file <passphraseFile> -require-client-cert-use -srvhost <srvHostName>... -host-header <host> -sni <serverName> -profile <tlsProfile> -kex <groups> -renegotiation <policy> -resume-sessions -clock-skew-tolerance <duration> -har <harFile> -har-max-body <bytes>
+	-save-request <file> -replay <file> -replay-host <host[:port]>
+	-form <name=value>... -form-file <field=path>... -batch <file> -batch-parallel <n> -batch-format <format> -repl -http2-prior-knowledge -probe-protocols -preflight -preflight-only -check-expiry -warn-days <days> -expiry-format <format> -print-curl -print-curl-only -n <count> -client-metrics-port <port> -max-idle-conns <n> -max-idle-conns-per-host <n> -idle-conn-timeout <duration> -no-keepalive -single-connection -no-trace
+	-tcp-keepalive <duration> -tcp-nodelay=<bool> -so-rcvbuf <bytes> -so-sndbuf <bytes>
+	-log-level <level> -verbose -quiet -log-format <format> -log-color <mode> -dump-http -dump-http-max-body <bytes> -compare-header <header>... -require-identical
+	-expect-status <code> -expect-body-contains <text> -expect-header <header>... -expect-tls-version <version> -expect-cert-cn <name> -show-sct -require-sct -show-headers -i -head -raw -hexdump -version -help]
+	
+Options:
+  -help       Optional, Prints this message
+  -version    Optional, prints the build version, commit, date, and Go version and exits
+%s
+  -srvhost    Optional, the server's hostname, defaults to 'localhost'. May be repeated to send
+              the same request to several servers at once, e.g., old and new servers during a
+              migration, and compare their responses. A summary of each response and the
+              differences between the first server's response and each of the others' are
+              printed. Status codes, the -compare-header headers, and bodies are compared
+  -compare-header
+              Optional, a header compared across the responses from multiple -srvhost servers.
+              May be repeated, defaults to Content-Type
+  -require-identical
+              Optional, exit with status 4 if the responses from multiple -srvhost servers
+              differ
+  -sni        Optional, the TLS server name to send, and to verify the server's certificate
+              against, instead of the -srvhost host, e.g., '-srvhost 10.0.0.5:8443 -sni
+              api.example.com' tests the certificate a particular server presents for a name
+              before DNS points the name at it. The connection is still made to -srvhost
+  -host-header
+              Optional, the Host header, or HTTP/2 :authority, to send instead of the
+              -srvhost host, e.g., to test a server's virtual hosts. Unlike -sni it doesn't
+              change the TLS server name or which certificate is verified. Applies to
+              -replay and -batch requests too, unless they've got a host of their own.
+              With -verbose the Host header actually sent is logged
+  -clientcert Optional, the name the clients's certificate file
+  -clientkey  Optional, the name the client's key certificate file. PKCS#1 RSA, SEC 1 EC,
+              and PKCS#8 keys, optionally encrypted, are supported
+  -clientkey-pass
+              Optional, the passphrase used to decrypt an encrypted client private key
+  -clientkey-pass-file
+              Optional, the name of a file containing the passphrase used to decrypt an
+              encrypted client private key
+  -require-client-cert-use
+              Optional, fail the connection, rather than send requests anonymously, if the
+              server requests a client certificate and none is sent, because there's no
+              -clientcert or the server doesn't accept it. Without it a notice is logged
+              instead, and with -verbose each such request is logged
+  -cacert     Required unless -use-system-roots is used, the name of the CA that signed the
+              server's certificate
+  -use-system-roots
+              Optional, trust the system's root CAs as well as -cacert's, e.g., to connect
+              to servers with publicly issued certificates too. Without it only -cacert's
+              CAs are trusted. If the system's roots aren't available on this platform a
+              warning is logged and only -cacert's are trusted
+  -fetch-ca   Optional, a URL, e.g., https://myhost:8443/ca.pem served by 'advserver -serve-ca',
+              to bootstrap trust in the server by downloading its CA certificate. The
+              download isn't verified, since that requires the CA, so the certificate's
+              SHA-256 fingerprint is printed for comparison with one obtained out of band,
+              and it's only saved, to -cacert, defaulting to ca.pem, once confirmed. The
+              requests are then sent, and the server verified, as usual. -srvhost defaults
+              to the URL's host. -clientcert and -clientkey are presented if provided
+  -yes        Optional, with -fetch-ca, trust the CA certificate without asking. Only use it
+              where the network path to the server is trusted
+  -cacert-url Optional, an https URL, e.g., where an internal CA publishes its bundle, to
+              fetch the CA certificates from at startup, so scripts don't depend on a local
+              copy that may be stale. The bundle is saved to -cacert, defaulting to
+              ca-bundle.pem, and used to verify the server. Its ETag is saved alongside, to
+              <cacert>.etag, so later runs only download it again if it has changed. The
+              bundle's server is verified against the system's root CAs, or with
+              -cacert-url-pin. If the bundle can't be fetched the saved copy is used, with
+              a warning. Can't be used with -fetch-ca
+  -cacert-url-pin
+              Optional, with -cacert-url, the SHA-256 fingerprint, in hex with or without
+              colons, of a certificate, e.g., the leaf or a CA, the bundle's server must
+              present, instead of verifying it against the system's root CAs. E.g., from
+              'openssl x509 -noout -fingerprint -sha256 -in <certFile>'
+  -cacert-url-strict
+              Optional, with -cacert-url, exit rather than use the saved copy of the bundle
+              if it can't be fetched
+  -profile    Optional, a TLS profile, one of modern, intermediate, or old, that sets the
+              minimum TLS version, cipher suites, and curves. Defaults to Go's settings
+  -kex        Optional, a comma separated list of the key exchange groups, or curves, the
+              client offers, one or more of X25519, P-256, P-384, P-521, and X25519MLKEM768,
+              the post-quantum hybrid, overriding the -profile's. E.g., to check that an
+              'advserver -require-tls13 -kex X25519MLKEM768' accepts X25519MLKEM768 and
+              rejects '-kex P-256'. With -verbose the negotiated group of each new
+              connection is logged
+  -renegotiation
+              Optional, whether a TLS 1.2 or earlier server may renegotiate the connection:
+              never  - renegotiation requests are refused, the default
+              once   - the server may renegotiate once per connection
+              freely - the server may renegotiate any number of times
+              Renegotiation has been the source of several attacks (e.g., CVE-2009-3555 and
+              triple handshake) so only allow it for legacy servers that depend on it, e.g.,
+              for requesting client certificates after the initial handshake
+  -resume-sessions
+              Optional, cache TLS sessions so that new connections to a server resume them,
+              with an abbreviated handshake in which the server doesn't send its certificate
+              chain. Compare the handshake costs, see below, with and without it
+  -clock-skew-tolerance
+              Optional, accept a server certificate chain that only fails verification
+              because a certificate expired, or isn't valid yet, at most this long ago or
+              from now, e.g., 5m, for hosts whose clocks are known to be wrong. Each time a
+              certificate is accepted this way a warning saying how far off the local clock
+              would have to be is logged. Defaults to 0, disabled. Verification failures
+              due to a certificate's validity period always report how far outside it the
+              local time is
+  -har        Optional, the name of a file to write the requests and responses to in HTTP
+              Archive (HAR) 1.2 format, e.g., for loading into browser developer tools. The
+              file is written when the client exits, including on SIGINT. The values of
+              sensitive headers, e.g., Authorization and Cookie, are redacted
+  -har-max-body
+              Optional, the maximum number of bytes of each request and response body
+              recorded in the HAR file, defaults to 65536
+  -save-request
+              Optional, the name of a file to save the requests sent, one per -srvhost, to
+              in a replayable format, one JSON object per line with the method, url, header,
+              and body of a request. Bodies that aren't valid UTF-8 are saved base64 encoded,
+              as body_base64, and bodies larger than 64KiB in their own file, <file>.body.<n>,
+              referenced by body_file, which is relative to the file's directory
+  -replay     Optional, the name of a file of requests, as saved by -save-request or written
+              by hand, to send, one after the other in the order they're in, instead of the
+              default request. Repeated -n times. -srvhost can't be used with -replay
+  -replay-host
+              Optional, with -replay, the host, and optional port, e.g., staging:8443, that
+              the saved requests are sent to instead of the host in their URL
+  -preflight  Optional, before sending the requests check, and print the result of, each
+              step of connecting to each server: resolving all of its addresses, connecting
+              to each address, the TLS handshake, and the server certificate's validity
+              period, chain, and host name. A certificate that isn't valid yet, or only just
+              became valid, indicates the local clock may be skewed. If any check fails the
+              client exits without sending the requests, with status 7 if a DNS lookup
+              failed, 6 if an address couldn't be connected to, or 5 if a TLS check failed
+  -preflight-only
+              Optional, implies -preflight and exits after the checks, with status 0 if
+              they all passed
+  -check-expiry
+              Optional, connect to each -srvhost, without sending a request, print the
+              number of days until each certificate the server presents, its leaf and
+              chain, expires, and exit with the status of a Nagios plugin: 0 if they all
+              expire in -warn-days or more, 1 if one expires sooner, 2 if one has expired,
+              or otherwise 3 if a server couldn't be connected to. The certificates' chain
+              and host name aren't verified, -preflight checks those
+  -warn-days  Optional, with -check-expiry, the number of days within which a certificate's
+              expiry is a warning, defaults to 30
+  -expiry-format
+              Optional, with -check-expiry, the format of the results, text, a Nagios style
+              status line followed by each server's certificates, or json. Defaults to text
+  -print-curl Optional, print the curl command equivalent to each request, quoted for a
+              POSIX shell, to standard error before sending it, including the -cacert,
+              -clientcert, -clientkey, -profile, -kex, -sni, -host-header, -head, -raw,
+              -form, and -form-file options. The key passphrase is never printed, curl
+              prompts for it. File names are printed as given, -use-system-roots isn't
+              expressible when -cacert is set, and a binary body is written to a temporary
+              file for curl to read. -batch and -repl requests aren't printed
+  -print-curl-only
+              Optional, implies -print-curl and exits without sending the requests
+  -n          Optional, the number of requests to make one after the other, defaults to 1
+  -client-metrics-port
+              Optional, serve /metrics, in Prometheus format, on this localhost port while
+              the requests are sent, e.g., to scrape the progress of a long -n run. The
+              metrics are the number of requests sent, responses by status code class,
+              errors by category, e.g., timeout or tls, and a histogram of the request
+              durations. The endpoint stops when the requests complete
+  -max-idle-conns
+              Optional, the maximum number of idle connections, across all servers, kept for
+              reuse by later requests, defaults to 100
+  -max-idle-conns-per-host
+              Optional, the maximum number of idle connections to a single server kept for
+              reuse by later requests, defaults to 100
+  -idle-conn-timeout
+              Optional, how long an idle connection is kept before it's closed, e.g., 30s,
+              defaults to 90s
+  -no-keepalive
+              Optional, close each connection after its request, so every request, e.g., of
+              -n, -replay, or -batch, uses a new connection and pays for a full TCP and TLS
+              setup, isolating the cost of the handshakes from that of the requests. With
+              -verbose the number of handshakes is logged. -resume-sessions still resumes
+              sessions, so the new connections use shorter, resumed, handshakes
+  -no-trace   Optional, don't trace the requests with httptrace, e.g., to reduce the
+              overhead of each request of a large -n. With -n, or multiple -srvhost, the
+              summary otherwise includes the number of new and reused connections, showing
+              whether the -max-idle-conns* settings are effective, and the total time spent
+              on DNS lookups, TCP connects, and TLS handshakes. The bytes transferred over
+              the TLS connections are counted either way. Can't be used with -har or
+              -single-connection
+  -single-connection
+              Optional, dial a single TLS connection and send every request, e.g., of -n,
+              over it, one after the other, without closing it while it's idle. The number
+              of requests, connections, and TLS handshakes are printed, and the client exits
+              with status 3 unless there was exactly 1 handshake. If the server closes the
+              connection, e.g., 'advserver -close-connections', the client reports after
+              how many requests and exits rather than dialing another. Can't be used with
+              -no-keepalive, -http2-prior-knowledge, multiple -srvhost, -replay, -batch, or
+              -repl
+  -show-headers, -i
+              Optional, print the response headers, formatted as in an HTTP response, a
+              status line followed by a line per header, sorted by name, before the body,
+              e.g., to check the headers the server's middleware adds
+  -head       Optional, send a HEAD request, instead of the default GET, and print only the
+              response's status line and headers. Can't be used with -form, -replay,
+              -batch, or -repl
+  -raw        Optional, print the response bodies exactly as received. Go's client otherwise
+              asks for gzip and transparently decompresses the body, removing the
+              Content-Encoding and Content-Length headers, which hides what crossed the
+              wire. With -raw compression isn't requested, though the server may still
+              compress, and the body isn't decompressed. The Content-Encoding and
+              Content-Length the body was sent with are printed with it. With -verbose
+              whether transparent decompression happened is logged
+  -hexdump    Optional, print the response bodies as a hex dump, e.g., for binary or, with
+              -raw, compressed bodies
+  -show-sct   Optional, print the log ID and timestamp of each certificate transparency
+              Signed Certificate Timestamp (SCT) the server presents, either in the TLS
+              handshake or embedded in its certificate. Signatures aren't verified
+  -http2-prior-knowledge
+              Optional, send the requests using HTTP/2 without TLS, h2c, assuming the
+              server supports it rather than asking it to upgrade, e.g., to test a backend
+              behind a TLS terminating proxy. -cacert isn't required, and the TLS options,
+              -preflight, and -fetch-ca don't apply
+  -probe-protocols
+              Optional, instead of sending the requests, probe each -srvhost for each way of
+              speaking HTTP: h2 negotiated using TLS ALPN, HTTP/1.1 over TLS, h2c with prior
+              knowledge, h2c by upgrading an HTTP/1.1 request, and cleartext HTTP/1.1, and
+              print whether each is supported and what the server did otherwise, e.g.,
+              refused the connection, or responded with HTTP/1.1 or TLS. The server's
+              certificate isn't verified, -cacert isn't required
+  -form       Optional, repeatable, a name=value field of a multipart/form-data request.
+              With -form or -form-file the request is a POST to /form, which responds with
+              a summary of the fields and files it received, instead of the default request
+  -form-file  Optional, repeatable, a field=path file, e.g., upload=report.pdf, of a
+              multipart/form-data request, sent with the file's base name
+  -repl       Optional, instead of sending the default request, read commands, e.g.,
+              'get /bytes/10', 'post /path body', 'headers set Name value', 'show tls',
+              'show cookies', and 'timing on', from standard input until 'exit' or the end of
+              input. Every command uses the same connections and keeps the cookies set by
+              the server. Ctrl-C cancels the request in progress. Only the first -srvhost is
+              used, the 'server' command changes it. -replay and -n can't be used with -repl
+  -batch      Optional, the name of a file of requests to send to the first -srvhost,
+              instead of the default request, each checked against its expected response,
+              e.g., to smoke test a deployment. Each line is either a method, a path, and,
+              optionally, the expected status and a body, e.g., 'GET /healthz 200', or a
+              JSON object with a method, path, header object, body, expect_status,
+              expect_body_contains, expect_header list, and a name for the report, e.g.,
+              {"name": "form", "method": "POST", "path": "/form", "expect_status": 415}
+              Blank lines and lines starting with '#' are skipped. The -expect-* flags
+              apply to every request, unless overridden by the request's own expectations.
+              Each request's result, PASS or FAIL, and latency are printed, and the exit
+              status is 3 if any failed
+  -batch-parallel
+              Optional, with -batch, the number of requests sent at the same time, the
+              results are still printed in the order of the file, defaults to 1
+  -batch-format
+              Optional, with -batch, the format of the results, text, the default, or json,
+              a JSON object per request with its line, name, method, path, status,
+              latency_ms, pass, failures, and error
+%s
+%s
+%s
+
+With -verbose, or -log-level debug, whether each request used a new or reused connection,
+and a summary of connection reuse once all requests are done, are logged.
+
+Each response on a new connection is followed by the bytes its TLS handshake cost, read
+and written before the first HTTP byte, and the size of the certificate chain the server
+presented. With -n or multiple servers, the average costs of full and resumed handshakes,
+and the savings from resumption, are printed once all requests are done. The costs are
+also recorded in the -har file's _tlsHandshake fields.
+
+%s
+
+Assertions, for use in test scripts. If any assertion fails for any response the failure
+and the actual value are printed and the client exits with status 3:
+  -expect-status
+              Optional, the expected HTTP status code, e.g., 200
+  -expect-body-contains
+              Optional, a string the response body is expected to contain
+  -expect-header
+              Optional, a header the response is expected to have, either 'Name', which only
+              checks that it's present, or 'Name: value', which also checks that one of its
+              values contains 'value', e.g., 'Content-Type: text/plain'. May be repeated
+  -expect-tls-version
+              Optional, the TLS version expected to be negotiated, one of 1.0, 1.1, 1.2, or 1.3
+  -expect-cert-cn
+              Optional, the expected common name of the server's certificate
+  -require-sct
+              Optional, require the server to present at least one SCT. Certificates issued
+              by public CAs have them, those issued by private CAs usually don't
+
+Certificate, key, and CA options accept a file name, 'env:VARNAME' to read PEM content
+from the VARNAME environment variable, or '-' to read PEM content from stdin. Only one
+option may read from stdin.
+ `, name, cli.ConfigUsage, cli.TCPUsage, cli.LogUsage, cli.DumpUsage, cli.EnvUsage(envPrefix, "srvhost", "cacert", "clientcert", "clientkey", "config"))
+
+	if *help == true {
+		fmt.Println(usage)
+		return
+	}
+	if *showVersion {
+		fmt.Printf("%s %s\n", name, version.Get())
+		return
+	}
+	if err := cli.ApplyEnv(fs, envPrefix); err != nil {
+		log.Fatalf("%s\n%s", err, usage)
+	}
+	if *configFile != "" {
+		if err := cli.ApplyConfig(fs, *configFile, *configProfile); err != nil {
+			log.Fatalf("%s\n%s", err, usage)
+		}
+	} else if *configProfile != "" {
+		log.Fatalf("-config-profile requires -config\n%s", usage)
+	}
+	if err := logFlags.Setup(); err != nil {
+		log.Fatalf("%s\n%s", err, usage)
+	}
+	if *fetchCAURL != "" {
+		if *caCertFile == "" {
+			*caCertFile = "ca.pem"
+		}
+		u, err := url.Parse(*fetchCAURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			logging.Fatalf("Invalid value %q provided for 'fetch-ca' flag, it must be an https URL\n%s", *fetchCAURL, usage)
+		}
+		if len(srvhosts) == 0 {
+			srvhosts = stringList{u.Host}
+		}
+	}
+	if *caCertURL != "" {
+		if *fetchCAURL != "" {
+			logging.Fatalf("-cacert-url can't be used with -fetch-ca:\n%s", usage)
+		}
+		if *caCertFile == "" {
+			*caCertFile = "ca-bundle.pem"
+		}
+		u, err := url.Parse(*caCertURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			logging.Fatalf("Invalid value %q provided for 'cacert-url' flag, it must be an https URL\n%s", *caCertURL, usage)
+		}
+		if *caCertURLPin != "" && !validFingerprint(*caCertURLPin) {
+			logging.Fatalf("Invalid value %q provided for 'cacert-url-pin' flag, it must be a SHA-256 fingerprint in hex\n%s", *caCertURLPin, usage)
+		}
+	} else if *caCertURLPin != "" || *caCertURLStrict {
+		logging.Fatalf("-cacert-url-pin and -cacert-url-strict require -cacert-url:\n%s", usage)
+	}
+	if *http2PriorKnowledge && (*fetchCAURL != "" || *caCertURL != "" || *doPreflight || *preflightOnly) {
+		logging.Fatalf("-fetch-ca, -cacert-url, and -preflight can't be used with -http2-prior-knowledge:\n%s", usage)
+	}
+	if *checkExpiryMode && *http2PriorKnowledge {
+		logging.Fatalf("-check-expiry can't be used with -http2-prior-knowledge, which doesn't use TLS:\n%s", usage)
+	}
+	if *warnDays < 0 {
+		logging.Fatalf("Invalid value %d, provided for 'warn-days' flag. It must be 0 or more\n%s", *warnDays, usage)
+	}
+	if *expiryFormat != "text" && *expiryFormat != "json" {
+		logging.Fatalf("Invalid value %q provided for 'expiry-format' flag, it must be text or json\n%s", *expiryFormat, usage)
+	}
+	if (*printCurl || *printCurlOnly) && (*batchFile != "" || *repl) {
+		logging.Fatalf("-print-curl can't be used with -batch or -repl:\n%s", usage)
+	}
+	if *http2PriorKnowledge && *sni != "" {
+		logging.Fatalf("-sni can't be used with -http2-prior-knowledge, which doesn't use TLS:\n%s", usage)
+	}
+	if *noTrace && (*harFile != "" || *singleConn) {
+		logging.Fatalf("-no-trace can't be used with -har or -single-connection, which need the traced timings and connections:\n%s", usage)
+	}
+	if *singleConn && (*noKeepalive || *http2PriorKnowledge || len(srvhosts) > 1 || *replayFile != "" || *batchFile != "" || *repl) {
+		logging.Fatalf("-single-connection can't be used with -no-keepalive, -http2-prior-knowledge, multiple -srvhost, -replay, -batch, or -repl:\n%s", usage)
+	}
+	if *head && (len(formFields) > 0 || len(formFiles) > 0 || *replayFile != "" || *batchFile != "" || *repl) {
+		logging.Fatalf("-head can't be used with -form, -form-file, -replay, -batch, or -repl:\n%s", usage)
+	}
+	if *caCertFile == "" && !*http2PriorKnowledge && !*probeProtos && !*useSystemRoots {
+		logging.Fatalf("caCert is required but missing:\n%s", usage)
+	}
+
+	renegotiationSupport, err := tlsutil.ParseRenegotiation(*renegotiation)
+	if err != nil {
+		logging.Fatalf("Invalid value provided for 'renegotiation' flag: %s\n%s", err, usage)
+	}
+	curvePrefs, err := tlsutil.ParseCurves(*kex)
+	if err != nil {
+		logging.Fatalf("Invalid value %q provided for 'kex' flag: %s\n%s", *kex, err, usage)
+	}
+
+	if *expectTLSVersion != "" {
+		expect.tlsVersion, err = tlsutil.ParseVersion(*expectTLSVersion)
+		if err != nil {
+			logging.Fatalf("Invalid value provided for 'expect-tls-version' flag: %s\n%s", err, usage)
+		}
+	}
+	if *count < 1 {
+		logging.Fatalf("n must be at least 1:\n%s", usage)
+	}
+	if *clientMetricsPort < 0 || *clientMetricsPort > 65535 {
+		logging.Fatalf("client-metrics-port must be between 1 and 65535:\n%s", usage)
+	}
+	if *clockSkewTolerance < 0 {
+		logging.Fatalf("clock-skew-tolerance must not be negative:\n%s", usage)
+	}
+	if *clockSkewTolerance > 0 {
+		log.Printf("Accepting server certificates that are up to %s outside their validity period (-clock-skew-tolerance)", *clockSkewTolerance)
+	}
+
+	tcpOpts, err := tcpFlags.Options()
+	if err != nil {
+		logging.Fatalf("%s\n%s", err, usage)
+	}
+	logging.Debugf("TCP options: %s", tcpOpts)
+	if _, err := dumpFlags.Writer(); err != nil {
+		logging.Fatalf("%s\n%s", err, usage)
+	}
+	var dumpOut io.Writer
+	if dumpFlags.Enabled {
+		dumpOut = os.Stderr
+	}
+
+	if *probeProtos {
+		if len(srvhosts) == 0 {
+			srvhosts = stringList{"localhost"}
+		}
+		probeProtocols(os.Stdout, srvhosts, tcpOpts.DialContext)
+		return
+	}
+
+	var har *httpsclient.HARRecorder
+	if *harFile != "" {
+		if *harMaxBody < 0 {
+			logging.Fatalf("har-max-body must not be negative:\n%s", usage)
+		}
+		har = httpsclient.NewHARRecorder(*harMaxBody)
+		if !*repl {
+			// The REPL uses Ctrl-C to cancel requests, it writes the HAR
+			// file when it exits instead
+			writeHAROnInterrupt(har, *harFile)
+		}
+	}
+
+	clientKeyPassphrase, err := certs.ReadPassphrase(*clientKeyPass, *clientKeyPassFile)
+	if err != nil {
+		logging.Fatalf("%s:\n%s", err, usage)
+	}
+
+	if *fetchCAURL != "" {
+		err := fetchCA(os.Stdout, os.Stdin, *fetchCAURL, *caCertFile, *yes, httpsclient.Config{
+			ClientCertFile: *clientCertFile,
+			ClientKeyFile:  *clientKeyFile,
+			Profile:        *profile,
+			DialContext:    tcpOpts.DialContext,
+
+			ClientKeyPassphrase: clientKeyPassphrase,
+		})
+		if err != nil {
+			logging.Fatalf("%s", err)
+		}
+	}
+	if *caCertURL != "" {
+		err := refreshCABundle(*caCertURL, *caCertFile, *caCertURLPin, *caCertURLStrict, httpsclient.Config{
+			ClientCertFile: *clientCertFile,
+			ClientKeyFile:  *clientKeyFile,
+			Profile:        *profile,
+			DialContext:    tcpOpts.DialContext,
+
+			ClientKeyPassphrase: clientKeyPassphrase,
+		})
+		if err != nil {
+			logging.Fatalf("%s", err)
+		}
+	}
+
+	log.Printf("CAFile: %s", *caCertFile)
+	var transferred *httpsclient.Transferred
+	if !*http2PriorKnowledge {
+		transferred = new(httpsclient.Transferred)
+	}
+	client, err := httpsclient.NewClient(httpsclient.Config{
+		CACertFile:     *caCertFile,
+		UseSystemRoots: *useSystemRoots,
+		ClientCertFile: *clientCertFile,
+		ClientKeyFile:  *clientKeyFile,
+		Profile:        *profile,
+		Renegotiation:  renegotiationSupport,
+		ServerName:     *sni,
+
+		CurvePreferences: curvePrefs,
+
+		ClientKeyPassphrase:  clientKeyPassphrase,
+		RequireClientCertUse: *requireClientCertUse,
+
+		ClockSkewTolerance: *clockSkewTolerance,
+		ResumeSessions:     *resumeSessions,
+
+		MaxIdleConns:        *maxIdleConns,
+		MaxIdleConnsPerHost: *maxIdleConnsPerHost,
+		IdleConnTimeout:     *idleConnTimeout,
+		DisableKeepAlives:   *noKeepalive,
+		SingleConnection:    *singleConn,
+		Transferred:         transferred,
+		DumpHTTP:            dumpOut,
+		DumpMaxBody:         dumpFlags.MaxBody,
+		DisableCompression:  respFmt.raw,
+		DialContext:         tcpOpts.DialContext,
+
+		HTTP2PriorKnowledge: *http2PriorKnowledge,
+	})
+	if err != nil {
+		logging.Fatalf("unable to create https client: %s", err)
+	}
+	scheme := "https"
+	if *http2PriorKnowledge {
+		scheme = "http"
+	}
+
+	var replayed []httpsclient.Request
+	if *replayFile != "" {
+		if len(srvhosts) > 0 {
+			logging.Fatalf("-srvhost can't be used with -replay, use -replay-host instead:\n%s", usage)
+		}
+		replayed, err = loadRequests(*replayFile, *replayHost)
+		if err != nil {
+			logging.Fatalf("%s", err)
+		}
+		// srvhosts are only used for -preflight, which checks the replay hosts
+		seen := map[string]bool{}
+		for _, r := range replayed {
+			if u, err := url.Parse(r.URL); err == nil && !seen[u.Host] {
+				seen[u.Host] = true
+				srvhosts = append(srvhosts, u.Host)
+			}
+		}
+	} else if *replayHost != "" {
+		logging.Fatalf("-replay-host requires -replay:\n%s", usage)
+	}
+	if len(srvhosts) == 0 {
+		srvhosts = stringList{"localhost"}
+	}
+	if *sni != "" {
+		for _, target := range srvhosts {
+			logging.Debugf("Connecting to %s, with the TLS server name %s", target, *sni)
+		}
+	}
+	if len(compareHeaders) == 0 {
+		compareHeaders = stringList{"Content-Type"}
+	}
+	if *doPreflight || *preflightOnly {
+		tlsConfig := httpsclient.TLSClientConfig(client)
+		if status := preflight(os.Stdout, srvhosts, tlsConfig, tcpOpts.DialContext); status != 0 || *preflightOnly {
+			os.Exit(status)
+		}
+	}
+	if *checkExpiryMode {
+		tlsConfig := httpsclient.TLSClientConfig(client)
+		os.Exit(checkExpiry(os.Stdout, srvhosts, tlsConfig, tcpOpts.DialContext, *warnDays, *expiryFormat))
+	}
+
+	if *batchFile != "" {
+		if replayed != nil || *repl || *count != 1 || len(formFields) > 0 || len(formFiles) > 0 {
+			logging.Fatalf("-replay, -repl, -n, and -form can't be used with -batch:\n%s", usage)
+		}
+		if *batchParallel < 1 {
+			logging.Fatalf("batch-parallel must be at least 1:\n%s", usage)
+		}
+		if *batchFormat != "text" && *batchFormat != "json" {
+			logging.Fatalf("Invalid value %q provided for 'batch-format' flag, it must be text or json\n%s", *batchFormat, usage)
+		}
+		entries, err := loadBatch(*batchFile)
+		if err != nil {
+			logging.Fatalf("%s", err)
+		}
+		for i := range entries {
+			if entries[i].Host == "" {
+				entries[i].Host = *hostHeader
+			}
+		}
+		passed := runBatch(os.Stdout, client, scheme+"://"+srvhosts[0], entries, expect, *batchParallel, *batchFormat, har)
+		if har != nil {
+			writeHAR(har, *harFile)
+		}
+		if !passed {
+			os.Exit(exitAssertionFailed)
+		}
+		return
+	}
+
+	if *repl {
+		if replayed != nil || *count != 1 || *clientMetricsPort != 0 {
+			logging.Fatalf("-replay, -n, and -client-metrics-port can't be used with -repl:\n%s", usage)
+		}
+		err := runREPL(os.Stdin, os.Stdout, client, scheme, srvhosts[0], har, *showSCT, respFmt)
+		if har != nil {
+			writeHAR(har, *harFile)
+		}
+		if err != nil {
+			logging.Fatalf("unable to read commands: %s", err)
+		}
+		return
+	}
+
+	req := httpsclient.Request{
+		Method: http.MethodGet,
+		Body:   []byte("World"),
+	}
+	if len(formFields) > 0 || len(formFiles) > 0 {
+		if replayed != nil {
+			logging.Fatalf("-form and -form-file can't be used with -replay:\n%s", usage)
+		}
+		body, contentType, err := multipartForm(formFields, formFiles)
+		if err != nil {
+			logging.Fatalf("%s:\n%s", err, usage)
+		}
+		req = httpsclient.Request{
+			Method: http.MethodPost,
+			URL:    "/form",
+			Header: http.Header{"Content-Type": {contentType}},
+			Body:   body,
+		}
+	}
+	if *head {
+		req = httpsclient.Request{Method: http.MethodHead}
+		respFmt.headers, respFmt.noBody = true, true
+	}
+	req.Host = *hostHeader
+	req.NoTrace = *noTrace
+	for i := range replayed {
+		if replayed[i].Host == "" {
+			replayed[i].Host = *hostHeader
+		}
+		replayed[i].NoTrace = *noTrace
+	}
+	send := func() []response { return fanOut(client, req, scheme, srvhosts, har) }
+	multiple := len(srvhosts) > 1
+	sent := targetRequests(req, scheme, srvhosts)
+	if replayed != nil {
+		send = func() []response { return replay(client, replayed, har) }
+		multiple = len(replayed) > 1
+		sent = replayed
+	}
+	if *printCurl || *printCurlOnly {
+		opts := curlOptions{
+			caCert:              *caCertFile,
+			clientCert:          *clientCertFile,
+			clientKey:           *clientKeyFile,
+			profile:             *profile,
+			kex:                 *kex,
+			sni:                 *sni,
+			http2PriorKnowledge: *http2PriorKnowledge,
+			raw:                 respFmt.raw,
+		}
+		if replayed == nil {
+			opts.formFields, opts.formFiles = formFields, formFiles
+		}
+		for _, r := range sent {
+			if opts.bodyFile, err = curlBodyFile(r); err != nil {
+				logging.Fatalf("%s", err)
+			}
+			fmt.Fprintln(os.Stderr, curlCommand(r, opts))
+		}
+		if *printCurlOnly {
+			os.Exit(0)
+		}
+	}
+	if *saveRequestFile != "" {
+		if err := saveRequests(*saveRequestFile, sent); err != nil {
+			logging.Fatalf("%s", err)
+		}
+		log.Printf("Saved %d requests to %s", len(sent), *saveRequestFile)
+	}
+
+	var load *loadMetrics
+	if *clientMetricsPort != 0 {
+		if load, err = serveLoadMetrics(*clientMetricsPort); err != nil {
+			logging.Fatalf("%s", err)
+		}
+	}
+	var conns connSummary
+	var handshakes handshakeSummary
+	var failures []string
+	differ := false
+	noticedAnonymous := false
+	for i := 0; i < *count; i++ {
+		responses := send()
+		for _, r := range responses {
+			if load != nil {
+				load.observe(r)
+			}
+			if r.err != nil {
+				if *singleConn && errors.Is(r.err, httpsclient.ErrConnectionClosed) {
+					logging.Fatalf("Request %d of %d: the server closed the connection after %d requests were sent over it, -single-connection doesn't dial another",
+						i+1, *count, i)
+				}
+				if !multiple {
+					logging.Fatalf("%s", r.err)
+				}
+				logging.Errorf("%s: %s", r.target, r.err)
+				continue
+			}
+			for _, f := range expect.check(r.res, r.body) {
+				if multiple {
+					f = fmt.Sprintf("%s: %s", r.target, f)
+				}
+				if *count > 1 {
+					f = fmt.Sprintf("request %d: %s", i+1, f)
+				}
+				failures = append(failures, f)
+			}
+			conns.add(r.res)
+			if anonymous(r.res.Handshake) {
+				logging.Debugf("Request %d of %d to %s: %s", i+1, *count, r.target, httpsclient.ErrClientCertNotSent)
+				if !noticedAnonymous {
+					noticedAnonymous = true
+					logging.Warnf("%s", anonymousNotice(r.target, *clientCertFile))
+				}
+			}
+			logging.Debugf("Request %d of %d to %s: %s connection", i+1, *count, r.target, connKind(r.res.Reused))
+			if !r.res.Reused && r.res.TLS != nil {
+				logging.Debugf("Request %d of %d to %s: negotiated %s, key exchange group %s", i+1, *count, r.target, tls.VersionName(r.res.TLS.Version), tlsutil.CurveName(r.res.TLS.CurveID))
+			}
+			if *hostHeader != "" {
+				logging.Debugf("Request %d of %d to %s: sent Host %s", i+1, *count, r.target, r.res.SentHost)
+			}
+			logging.Debugf("Request %d of %d to %s: %s", i+1, *count, r.target, decompression(r.res))
+			if !multiple {
+				fmt.Printf("\nResponse from server: \n\tHTTP status: %s\n", r.res.Status)
+			} else {
+				fmt.Printf("\nResponse from server %s: \n\tHTTP status: %s\n", r.target, r.res.Status)
+			}
+			respFmt.print(os.Stdout, r.res, r.body)
+			printRetryAdvice(os.Stdout, r.res)
+			printHandshake(os.Stdout, r.res.Handshake)
+			handshakes.add(r.res.Handshake)
+			if *showSCT {
+				printSCTs(os.Stdout, r.res)
+			}
+		}
+		if replayed == nil && len(srvhosts) > 1 && !compare(os.Stdout, responses, compareHeaders) {
+			differ = true
+		}
+	}
+	if load != nil {
+		load.close()
+	}
+	if !*noTrace {
+		logging.Debugf("Connections: %d new, %d reused", conns.new, conns.reused)
+	}
+	if *noKeepalive {
+		logging.Debugf("Keep-alives are disabled, the %d requests took %d TLS handshakes, %d full and %d resumed, instead of sharing connections",
+			conns.new+conns.reused, handshakes.full+handshakes.resumed, handshakes.full, handshakes.resumed)
+	}
+	if *count > 1 || multiple {
+		conns.write(os.Stdout, transferred, !*noTrace)
+		handshakes.write(os.Stdout)
+	}
+	if *singleConn {
+		n := handshakes.full + handshakes.resumed
+		fmt.Printf("\nSingle connection: %d requests over %d connections, %d TLS handshakes\n", conns.new+conns.reused, conns.new, n)
+		if n != 1 {
+			failures = append(failures, fmt.Sprintf("-single-connection: %d TLS handshakes, expected 1", n))
+		}
+	}
+	if har != nil {
+		writeHAR(har, *harFile)
+	}
+	if len(failures) > 0 {
+		for _, f := range failures {
+			fmt.Fprintf(os.Stderr, "Assertion failed: %s\n", f)
+		}
+		os.Exit(exitAssertionFailed)
+	}
+	if differ && *requireIdentical {
+		fmt.Fprintf(os.Stderr, "The servers' responses differ\n")
+		os.Exit(exitResponsesDiffer)
+	}
+}
+
+// doRequest issues req, recording it in har if it isn't nil, and returns the
+// result along with the response body. Canceling ctx cancels the request.
+func doRequest(ctx context.Context, client *http.Client, req httpsclient.Request, har *httpsclient.HARRecorder) (httpsclient.Result, []byte, error) {
+	res, err := httpsclient.Do(ctx, client, req)
+	if err != nil {
+		switch e := err.(type) {
+		case *url.Error:
+			return httpsclient.Result{}, nil, fmt.Errorf("url.Error received on http request: %w", e)
+		default:
+			return httpsclient.Result{}, nil, fmt.Errorf("unexpected error received: %w", err)
+		}
+	}
+
+	readStart := time.Now()
+	body, err := ioutil.ReadAll(res.Body)
+	defer res.Body.Close()
+	if err != nil {
+		return httpsclient.Result{}, nil, fmt.Errorf("unexpected error reading response body: %w", err)
+	}
+	if har != nil {
+		har.Add(req, res, body, time.Since(readStart))
+	}
+	return res, body, nil
+}
+
+func connKind(reused bool) string {
+	if reused {
+		return "reused"
+	}
+	return "new"
+}
+
+// writeHAROnInterrupt writes the HAR file, containing whatever has been
+// recorded so far, and exits if the client is interrupted.
+func writeHAROnInterrupt(har *httpsclient.HARRecorder, file string) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		log.Printf("Interrupted, writing HAR file %s", file)
+		writeHAR(har, file)
+		os.Exit(1)
+	}()
+}
+
+func writeHAR(har *httpsclient.HARRecorder, file string) {
+	if err := har.WriteFile(file); err != nil {
+		log.Printf("Unable to write HAR file: %s", err)
+		return
+	}
+	log.Printf("Wrote %d HAR entries to %s", len(har.HAR().Log.Entries), file)
+}
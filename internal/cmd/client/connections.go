@@ -0,0 +1,54 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+// connSummary accumulates how the repeated requests used the client's
+// connections, and the time spent setting up the new ones.
+type connSummary struct {
+	new, reused       int
+	dns, connect, tls time.Duration
+}
+
+func (s *connSummary) add(res httpsclient.Result) {
+	if res.Reused {
+		s.reused++
+		return
+	}
+	s.new++
+	s.dns += res.Timing.DNS
+	s.connect += res.Timing.Connect
+	s.tls += res.Timing.TLSHandshake
+}
+
+// write writes the number of new and reused connections, the total time
+// spent on DNS lookups, TCP connects, and TLS handshakes, and, if transferred
+// isn't nil, the bytes transferred, to w. traced is false if the requests
+// weren't traced, so only the bytes are known.
+func (s *connSummary) write(w io.Writer, transferred *httpsclient.Transferred, traced bool) {
+	if !traced {
+		fmt.Fprintf(w, "\nConnections: not traced, -no-trace\n")
+	} else {
+		n := s.new + s.reused
+		fmt.Fprintf(w, "\nConnections: %d new, %d reused\n", s.new, s.reused)
+		if n > 0 {
+			fmt.Fprintf(w, "\tReused:  %.0f%% of the requests reused a connection\n", 100*float64(s.reused)/float64(n))
+			total := s.dns + s.connect + s.tls
+			fmt.Fprintf(w, "\tSetup:   %s in total, %s DNS, %s connect, and %s TLS, %s per request\n",
+				total.Round(time.Microsecond), s.dns.Round(time.Microsecond), s.connect.Round(time.Microsecond),
+				s.tls.Round(time.Microsecond), (total / time.Duration(n)).Round(time.Microsecond))
+		}
+	}
+	if transferred != nil {
+		fmt.Fprintf(w, "\tBytes:   %d read and %d written, including the TLS handshakes\n", transferred.Read(), transferred.Written())
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+// curlOptions are the client options that -print-curl renders as curl
+// options, in addition to the request itself.
+type curlOptions struct {
+	caCert, clientCert, clientKey string
+	profile, kex, sni             string
+	http2PriorKnowledge, raw      bool
+	// formFields and formFiles, if any, are rendered as -F options rather
+	// than the encoded multipart body.
+	formFields, formFiles []string
+	// bodyFile is the file curl reads a binary body from, see curlBodyFile.
+	bodyFile string
+}
+
+// curlProfileVersions are the curl options for the minimum TLS version of
+// each TLS profile.
+var curlProfileVersions = map[string]string{
+	"modern":       "--tlsv1.3",
+	"intermediate": "--tlsv1.2",
+	"old":          "--tlsv1.0",
+}
+
+// curlCommand returns a curl command line equivalent to sending req with
+// opts, quoted for a POSIX shell. Passphrases aren't included.
+func curlCommand(req httpsclient.Request, opts curlOptions) string {
+	args := []string{"curl"}
+	add := func(a ...string) { args = append(args, a...) }
+
+	if opts.caCert != "" {
+		add("--cacert", opts.caCert)
+	}
+	if opts.clientCert != "" {
+		add("--cert", opts.clientCert)
+	}
+	if opts.clientKey != "" {
+		add("--key", opts.clientKey)
+	}
+	if v, ok := curlProfileVersions[strings.ToLower(opts.profile)]; ok {
+		add(v)
+	}
+	if opts.kex != "" {
+		add("--curves", strings.ReplaceAll(strings.ReplaceAll(opts.kex, " ", ""), ",", ":"))
+	}
+	if opts.http2PriorKnowledge {
+		add("--http2-prior-knowledge")
+	}
+	if !opts.raw {
+		// Go's client asks for, and decompresses, gzip by default, curl only
+		// does with --compressed
+		add("--compressed")
+	}
+
+	target := req.URL
+	if opts.sni != "" {
+		// curl sends the URL's host as the SNI, so the URL uses the -sni name
+		// and --connect-to sends the connection to the -srvhost
+		if u, err := url.Parse(req.URL); err == nil {
+			port := u.Port()
+			if port == "" {
+				port = "443"
+			}
+			add("--connect-to", opts.sni+":"+port+":"+net.JoinHostPort(u.Hostname(), port))
+			u.Host = net.JoinHostPort(opts.sni, port)
+			target = u.String()
+		}
+	}
+
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	form := len(opts.formFields) > 0 || len(opts.formFiles) > 0
+	switch {
+	case method == http.MethodHead:
+		add("--head")
+	case form && method == http.MethodPost:
+	case method != http.MethodGet || len(req.Body) > 0:
+		add("--request", method)
+	}
+	if req.Host != "" {
+		add("--header", "Host: "+req.Host)
+	}
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		if form && http.CanonicalHeaderKey(name) == "Content-Type" {
+			// curl sets the multipart boundary itself
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range req.Header[name] {
+			add("--header", name+": "+v)
+		}
+	}
+	switch {
+	case form:
+		for _, f := range opts.formFields {
+			add("--form-string", f)
+		}
+		for _, f := range opts.formFiles {
+			field, path, _ := strings.Cut(f, "=")
+			add("--form", field+"=@"+path)
+		}
+	case len(req.Body) > 0 && method != http.MethodHead:
+		if isBinary(req.Body) {
+			add("--data-binary", "@"+opts.bodyFile)
+		} else {
+			add("--data-binary", string(req.Body))
+		}
+	}
+	add(target)
+
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// isBinary returns whether body can't be passed to curl as an argument, it
+// isn't valid UTF-8 or contains a NUL.
+func isBinary(body []byte) bool {
+	return !utf8.Valid(body) || bytes.IndexByte(body, 0) >= 0
+}
+
+// curlBodyFile writes req's body, if it's binary, to a new temporary file for
+// the curl command to read it from, returning the file's name, or "" if the
+// body isn't binary.
+func curlBodyFile(req httpsclient.Request) (string, error) {
+	if !isBinary(req.Body) || req.Method == http.MethodHead {
+		return "", nil
+	}
+	f, err := ioutil.TempFile("", "gohttps-request-body-*.bin")
+	if err != nil {
+		return "", fmt.Errorf("unable to write the request body for -print-curl: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(req.Body); err != nil {
+		return "", fmt.Errorf("unable to write the request body for -print-curl: %w", err)
+	}
+	return f.Name(), nil
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes s for a POSIX shell, in single quotes unless it only
+// contains characters that don't need them.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"https://localhost:8443/path", "https://localhost:8443/path"},
+		{"name=@file.txt", "name=@file.txt"},
+		{"", "''"},
+		{"with spaces", "'with spaces'"},
+		{"it's", `'it'\''s'`},
+		{"''", `''\'''\'''`},
+		{"$HOME", "'$HOME'"},
+		{"`id`", "'`id`'"},
+		{"a\nb", "'a\nb'"},
+		{`back\slash`, `'back\slash'`},
+		{"*", "'*'"},
+	}
+	for _, tc := range tests {
+		if got := shellQuote(tc.s); got != tc.want {
+			t.Errorf("got %s quoting %q, want %s", got, tc.s, tc.want)
+		}
+	}
+}
+
+func TestCurlCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		req  httpsclient.Request
+		opts curlOptions
+		want string
+	}{
+		{"GET", httpsclient.Request{URL: "https://localhost:8443/"}, curlOptions{},
+			"curl --compressed https://localhost:8443/"},
+		{"TLS options", httpsclient.Request{Method: http.MethodGet, URL: "https://localhost:8443/"},
+			curlOptions{caCert: "ca cert.pem", clientCert: "client.pem", clientKey: "client.key", profile: "Modern", kex: "X25519MLKEM768, X25519", http2PriorKnowledge: true, raw: true},
+			"curl --cacert 'ca cert.pem' --cert client.pem --key client.key --tlsv1.3 --curves X25519MLKEM768:X25519 --http2-prior-knowledge https://localhost:8443/"},
+		{"body", httpsclient.Request{Method: http.MethodPost, URL: "https://localhost:8443/", Header: http.Header{"X-Name": {"it's $USER"}}, Body: []byte("line 1\nline 2 'quoted' $HOME")},
+			curlOptions{raw: true},
+			`curl --request POST --header 'X-Name: it'\''s $USER' --data-binary 'line 1` + "\n" + `line 2 '\''quoted'\'' $HOME' https://localhost:8443/`},
+		{"binary body", httpsclient.Request{Method: http.MethodPut, URL: "https://localhost:8443/", Body: []byte{0xff, 0xfe}},
+			curlOptions{raw: true, bodyFile: "/tmp/gohttps-request-body-1.bin"},
+			"curl --request PUT --data-binary @/tmp/gohttps-request-body-1.bin https://localhost:8443/"},
+		{"body with a NUL", httpsclient.Request{Method: http.MethodPost, URL: "https://localhost:8443/", Body: []byte("a\x00b")},
+			curlOptions{raw: true, bodyFile: "body.bin"},
+			"curl --request POST --data-binary @body.bin https://localhost:8443/"},
+		{"HEAD", httpsclient.Request{Method: http.MethodHead, URL: "https://localhost:8443/", Host: "example.com"}, curlOptions{raw: true},
+			"curl --head --header 'Host: example.com' https://localhost:8443/"},
+		{"SNI", httpsclient.Request{URL: "https://127.0.0.1:8443/path?q=1"}, curlOptions{raw: true, sni: "server.example.com"},
+			"curl --connect-to server.example.com:8443:127.0.0.1:8443 'https://server.example.com:8443/path?q=1'"},
+		{"SNI without a port", httpsclient.Request{URL: "https://127.0.0.1/"}, curlOptions{raw: true, sni: "server.example.com"},
+			"curl --connect-to server.example.com:443:127.0.0.1:443 https://server.example.com:443/"},
+		{"SNI with an IPv6 address", httpsclient.Request{URL: "https://[::1]:8443/"}, curlOptions{raw: true, sni: "server.example.com"},
+			"curl --connect-to 'server.example.com:8443:[::1]:8443' https://server.example.com:8443/"},
+		{"form", httpsclient.Request{Method: http.MethodPost, URL: "https://localhost:8443/form", Header: http.Header{"Content-Type": {"multipart/form-data; boundary=x"}}, Body: []byte("--x--")},
+			curlOptions{raw: true, formFields: []string{"name=it's @me", "empty="}, formFiles: []string{"upload=my file.txt"}},
+			`curl --form-string 'name=it'\''s @me' --form-string empty= --form 'upload=@my file.txt' https://localhost:8443/form`},
+		{"form PUT", httpsclient.Request{Method: http.MethodPut, URL: "https://localhost:8443/form"},
+			curlOptions{raw: true, formFields: []string{"name=gopher"}},
+			"curl --request PUT --form-string name=gopher https://localhost:8443/form"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := curlCommand(tc.req, tc.opts); got != tc.want {
+				t.Errorf("got the command\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCurlBodyFile(t *testing.T) {
+	body := []byte{0xff, 0x00, 0xfe}
+	name, err := curlBodyFile(httpsclient.Request{Method: http.MethodPost, Body: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(name)
+	got, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("got the body file's content %q, want %q", got, body)
+	}
+
+	for _, req := range []httpsclient.Request{
+		{Method: http.MethodPost, Body: []byte("text")},
+		{Method: http.MethodGet},
+		{Method: http.MethodHead, Body: body},
+	} {
+		if name, err := curlBodyFile(req); name != "" || err != nil {
+			t.Errorf("got the body file %q and the error %v for %s %q, want none", name, err, req.Method, req.Body)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// The -check-expiry exit statuses, those of a Nagios plugin.
+const (
+	expiryOK = iota
+	expiryWarning
+	expiryCritical
+	expiryUnknown
+)
+
+var expiryStatusNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// worseExpiry returns the worse of the statuses a and b. An expired
+// certificate is worse than a server that couldn't be checked.
+func worseExpiry(a, b int) int {
+	rank := []int{expiryOK: 0, expiryWarning: 1, expiryUnknown: 2, expiryCritical: 3}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// expiryCert is the expiry of a certificate presented by a -check-expiry
+// target.
+type expiryCert struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"not_after"`
+	DaysLeft int       `json:"days_left"`
+	Status   string    `json:"status"`
+}
+
+// expiryTarget is the result of checking a -check-expiry target, Error is
+// set instead of Certificates if the target couldn't be checked.
+type expiryTarget struct {
+	Target       string       `json:"target"`
+	Status       string       `json:"status"`
+	Error        string       `json:"error,omitempty"`
+	Certificates []expiryCert `json:"certificates,omitempty"`
+}
+
+// checkExpiry connects to each target, without sending a request, and writes
+// how many days are left until each certificate the server presents, its
+// leaf and chain, expires to w, in format, text or json. A certificate that
+// expires within warnDays is a warning, one that's expired is critical. It
+// returns the exit status of the worst result, see worseExpiry, which is
+// expiryUnknown if a target couldn't be connected to.
+func checkExpiry(w io.Writer, targets []string, tlsConfig *tls.Config, dial func(ctx context.Context, network, address string) (net.Conn, error), warnDays int, format string) int {
+	now := time.Now()
+	worst := expiryOK
+	results := make([]expiryTarget, len(targets))
+	for i, target := range targets {
+		status := expiryOK
+		results[i] = expiryTarget{Target: target}
+		chain, err := peerCertificates(target, tlsConfig, dial)
+		if err != nil {
+			status = expiryUnknown
+			results[i].Error = err.Error()
+		}
+		for _, cert := range chain {
+			days := int(cert.NotAfter.Sub(now).Hours() / 24)
+			s := expiryOK
+			switch {
+			case !now.Before(cert.NotAfter):
+				s = expiryCritical
+				// A certificate that expired less than a day ago has 0 days left
+				if days == 0 {
+					days = -1
+				}
+			case days < warnDays:
+				s = expiryWarning
+			}
+			status = worseExpiry(status, s)
+			results[i].Certificates = append(results[i].Certificates, expiryCert{
+				Subject:  certName(cert.Subject.CommonName, cert.Subject.String()),
+				Issuer:   certName(cert.Issuer.CommonName, cert.Issuer.String()),
+				NotAfter: cert.NotAfter,
+				DaysLeft: days,
+				Status:   expiryStatusNames[s],
+			})
+		}
+		results[i].Status = expiryStatusNames[status]
+		worst = worseExpiry(worst, status)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(struct {
+			Status   string         `json:"status"`
+			WarnDays int            `json:"warn_days"`
+			Targets  []expiryTarget `json:"targets"`
+		}{expiryStatusNames[worst], warnDays, results})
+		return worst
+	}
+	fmt.Fprintf(w, "EXPIRY %s - %d servers checked, warning within %d days\n", expiryStatusNames[worst], len(targets), warnDays)
+	for _, r := range results {
+		fmt.Fprintf(w, "%s: %s\n", r.Target, r.Status)
+		if r.Error != "" {
+			fmt.Fprintf(w, "\t%s\n", r.Error)
+		}
+		for _, c := range r.Certificates {
+			expires := fmt.Sprintf("expires %s, in %d days", c.NotAfter.Format(time.RFC3339), c.DaysLeft)
+			if c.DaysLeft < 0 {
+				expires = fmt.Sprintf("expired %s, %d days ago", c.NotAfter.Format(time.RFC3339), -c.DaysLeft)
+			}
+			fmt.Fprintf(w, "\t%-8s %s, issued by %s, %s\n", c.Status, c.Subject, c.Issuer, expires)
+		}
+	}
+	return worst
+}
+
+// peerCertificates connects to target, a host and optional port, and returns
+// the certificates the server presents in the TLS handshake, which aren't
+// verified, so expired ones can be reported.
+func peerCertificates(target string, tlsConfig *tls.Config, dial func(ctx context.Context, network, address string) (net.Conn, error)) ([]*x509.Certificate, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		host, port = target, "443"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+	conn, err := dial(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	cfg := tlsConfig.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyConnection = nil
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("handshake failed: %w", err)
+	}
+	return tlsConn.ConnectionState().PeerCertificates, nil
+}
+
+// certName returns cn, or dn if cn is empty.
+func certName(cn, dn string) string {
+	if cn != "" {
+		return cn
+	}
+	return dn
+}
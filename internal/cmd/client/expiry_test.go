@@ -0,0 +1,170 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newExpiryServer returns the address of a server presenting a self-signed
+// certificate, for localhost, that expires at notAfter.
+func newExpiryServer(t *testing.T, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts.Listener.Addr().String()
+}
+
+// unreachable returns the address of a closed listener.
+func unreachable(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+	return ln.Addr().String()
+}
+
+func TestCheckExpiry(t *testing.T) {
+	day := 24 * time.Hour
+	now := time.Now()
+	ok := newExpiryServer(t, now.Add(60*day+time.Hour))
+	warning := newExpiryServer(t, now.Add(10*day+time.Hour))
+	critical := newExpiryServer(t, now.Add(-time.Hour))
+	unknown := unreachable(t)
+
+	tests := []struct {
+		name    string
+		targets []string
+		want    int
+		// wantText is in the text output, in order
+		wantText []string
+	}{
+		{"ok", []string{ok}, expiryOK, []string{
+			"EXPIRY OK - 1 servers checked, warning within 30 days\n",
+			ok + ": OK\n", "\tOK       localhost, issued by localhost, expires ", ", in 60 days\n",
+		}},
+		{"within -warn-days", []string{warning}, expiryWarning, []string{
+			"EXPIRY WARNING - 1 servers checked",
+			warning + ": WARNING\n", "\tWARNING  localhost, issued by localhost, expires ", ", in 10 days\n",
+		}},
+		{"expired", []string{critical}, expiryCritical, []string{
+			"EXPIRY CRITICAL - 1 servers checked",
+			critical + ": CRITICAL\n", "\tCRITICAL localhost, issued by localhost, expired ", ", 1 days ago\n",
+		}},
+		{"unreachable", []string{unknown}, expiryUnknown, []string{
+			"EXPIRY UNKNOWN - 1 servers checked",
+			unknown + ": UNKNOWN\n\t", "connection refused",
+		}},
+		// The worst status is the exit status, an expired certificate is
+		// worse than an unreachable server
+		{"ok and within -warn-days", []string{ok, warning}, expiryWarning, []string{
+			"EXPIRY WARNING - 2 servers checked", ok + ": OK\n", warning + ": WARNING\n",
+		}},
+		{"unreachable and expired", []string{unknown, critical, ok}, expiryCritical, []string{
+			"EXPIRY CRITICAL - 3 servers checked", unknown + ": UNKNOWN\n", critical + ": CRITICAL\n", ok + ": OK\n",
+		}},
+	}
+	dial := (&net.Dialer{}).DialContext
+	for _, tc := range tests {
+		var out bytes.Buffer
+		if got := checkExpiry(&out, tc.targets, &tls.Config{}, dial, 30, "text"); got != tc.want {
+			t.Errorf("%s: got the exit status %d, want %d", tc.name, got, tc.want)
+		}
+		text := out.String()
+		for _, want := range tc.wantText {
+			i := strings.Index(text, want)
+			if i < 0 {
+				t.Errorf("%s: got the output %q, want %q next", tc.name, out.String(), want)
+				break
+			}
+			text = text[i+len(want):]
+		}
+	}
+}
+
+func TestCheckExpiryJSON(t *testing.T) {
+	day := 24 * time.Hour
+	now := time.Now()
+	ok := newExpiryServer(t, now.Add(60*day+time.Hour))
+	warning := newExpiryServer(t, now.Add(10*day+time.Hour))
+	critical := newExpiryServer(t, now.Add(-time.Hour))
+	unknown := unreachable(t)
+
+	var out bytes.Buffer
+	got := checkExpiry(&out, []string{ok, warning, critical, unknown}, &tls.Config{}, (&net.Dialer{}).DialContext, 30, "json")
+	if got != expiryCritical {
+		t.Errorf("got the exit status %d, want %d", got, expiryCritical)
+	}
+	var report struct {
+		Status   string         `json:"status"`
+		WarnDays int            `json:"warn_days"`
+		Targets  []expiryTarget `json:"targets"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("the output %q isn't JSON: %s", out.String(), err)
+	}
+	if report.Status != "CRITICAL" || report.WarnDays != 30 || len(report.Targets) != 4 {
+		t.Fatalf("got the report %+v, want CRITICAL, warning within 30 days, for 4 targets", report)
+	}
+
+	want := []struct {
+		target   string
+		status   string
+		daysLeft int
+	}{
+		{ok, "OK", 60},
+		{warning, "WARNING", 10},
+		{critical, "CRITICAL", -1},
+	}
+	for i, w := range want {
+		r := report.Targets[i]
+		if r.Target != w.target || r.Status != w.status || r.Error != "" || len(r.Certificates) != 1 {
+			t.Errorf("got the result %+v, want %s for %s with its certificate", r, w.status, w.target)
+			continue
+		}
+		if c := r.Certificates[0]; c.Subject != "localhost" || c.Status != w.status || c.DaysLeft != w.daysLeft {
+			t.Errorf("%s: got the certificate %+v, want %s with %d days left", w.target, c, w.status, w.daysLeft)
+		}
+	}
+	if r := report.Targets[3]; r.Target != unknown || r.Status != "UNKNOWN" || r.Error == "" || len(r.Certificates) != 0 {
+		t.Errorf("got the result %+v, want UNKNOWN for %s with the error", r, unknown)
+	}
+}
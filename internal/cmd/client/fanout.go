@@ -0,0 +1,191 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+// exitResponsesDiffer is the exit status used when -require-identical is set
+// and the targets' responses differ.
+const exitResponsesDiffer = 4
+
+// maxDiffCells bounds the size of the table used to diff bodies, larger
+// bodies are only reported as different.
+const maxDiffCells = 4 * 1024 * 1024
+
+// stringList is a flag.Value that collects every occurrence of a flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// response is the outcome of a request to one of the targets.
+type response struct {
+	target string
+	res    httpsclient.Result
+	body   []byte
+	err    error
+	// elapsed is how long it took to send the request and read the response.
+	elapsed time.Duration
+}
+
+// fanOut sends a copy of req to <scheme>://<target> for each of the targets
+// concurrently, returning the responses in the same order as targets.
+func fanOut(client *http.Client, req httpsclient.Request, scheme string, targets []string, har *httpsclient.HARRecorder) []response {
+	responses := make([]response, len(targets))
+	var wg sync.WaitGroup
+	for i, r := range targetRequests(req, scheme, targets) {
+		wg.Add(1)
+		go func(i int, r httpsclient.Request) {
+			defer wg.Done()
+			start := time.Now()
+			res, body, err := doRequest(context.Background(), client, r, har)
+			responses[i] = response{target: targets[i], res: res, body: body, err: err, elapsed: time.Since(start)}
+		}(i, r)
+	}
+	wg.Wait()
+	return responses
+}
+
+// targetRequests returns a copy of req for each of the targets, sent to
+// <scheme>://<target> followed by req's URL, a path, if any.
+func targetRequests(req httpsclient.Request, scheme string, targets []string) []httpsclient.Request {
+	reqs := make([]httpsclient.Request, len(targets))
+	for i, target := range targets {
+		reqs[i] = req
+		reqs[i].URL = scheme + "://" + target + req.URL
+	}
+	return reqs
+}
+
+// compare writes a summary of each response, and the differences between the
+// first response and each of the others, to w. Responses are compared by
+// status code, the values of headers, and body. It returns whether all the
+// responses are identical.
+func compare(w io.Writer, responses []response, headers []string) bool {
+	fmt.Fprintf(w, "\nSummary:\n")
+	for _, r := range responses {
+		if r.err != nil {
+			fmt.Fprintf(w, "\t%s: error: %s\n", r.target, r.err)
+			continue
+		}
+		version := "none"
+		if r.res.TLS != nil {
+			version = tls.VersionName(r.res.TLS.Version)
+		}
+		fmt.Fprintf(w, "\t%s: %s, %d bytes, %s, first byte after %s\n", r.target, r.res.Status, len(r.body), version, r.res.Timing.FirstByte)
+	}
+
+	identical := true
+	base := responses[0]
+	for _, r := range responses[1:] {
+		var diffs []string
+		switch {
+		case base.err != nil || r.err != nil:
+			if base.err == nil || r.err == nil || base.err.Error() != r.err.Error() {
+				diffs = append(diffs, fmt.Sprintf("errors: %s vs %s", errString(base.err), errString(r.err)))
+			}
+		default:
+			if base.res.StatusCode != r.res.StatusCode {
+				diffs = append(diffs, fmt.Sprintf("status: %d vs %d", base.res.StatusCode, r.res.StatusCode))
+			}
+			for _, h := range headers {
+				bv, rv := strings.Join(base.res.Header.Values(h), ", "), strings.Join(r.res.Header.Values(h), ", ")
+				if bv != rv {
+					diffs = append(diffs, fmt.Sprintf("header %s: %q vs %q", http.CanonicalHeaderKey(h), bv, rv))
+				}
+			}
+			if !bytes.Equal(base.body, r.body) {
+				diffs = append(diffs, "body:\n"+diffBodies(base.target, r.target, base.body, r.body))
+			}
+		}
+
+		if len(diffs) == 0 {
+			fmt.Fprintf(w, "\n%s and %s responses are identical\n", base.target, r.target)
+			continue
+		}
+		identical = false
+		fmt.Fprintf(w, "\n%s and %s responses differ:\n", base.target, r.target)
+		for _, d := range diffs {
+			fmt.Fprintf(w, "\t%s\n", d)
+		}
+	}
+	return identical
+}
+
+func errString(err error) string {
+	if err == nil {
+		return "none"
+	}
+	return err.Error()
+}
+
+// diffBodies returns a unified style line diff of text bodies a and b, or a
+// description of how they differ if they aren't text or are too large.
+func diffBodies(aName, bName string, a, b []byte) string {
+	if !utf8.Valid(a) || !utf8.Valid(b) {
+		return fmt.Sprintf("binary bodies differ, %d vs %d bytes", len(a), len(b))
+	}
+	aLines, bLines := strings.SplitAfter(string(a), "\n"), strings.SplitAfter(string(b), "\n")
+	if len(aLines)*len(bLines) > maxDiffCells {
+		return fmt.Sprintf("bodies differ, %d vs %d bytes, too large to diff", len(a), len(b))
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// aLines[i:] and bLines[j:]
+	lcs := make([][]int, len(aLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bLines)+1)
+	}
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "\t--- %s\n\t+++ %s\n", aName, bName)
+	line := func(prefix, text string) {
+		out.WriteString("\t" + prefix + strings.TrimSuffix(text, "\n") + "\n")
+	}
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && j < len(bLines) && aLines[i] == bLines[j]:
+			line(" ", aLines[i])
+			i++
+			j++
+		case i < len(aLines) && (j == len(bLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			line("-", aLines[i])
+			i++
+		default:
+			line("+", bLines[j])
+			j++
+		}
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+func TestFanOut(t *testing.T) {
+	// Every server waits for all of them to receive their request, so the
+	// requests must be sent concurrently
+	const servers = 3
+	var arrived sync.WaitGroup
+	arrived.Add(servers)
+	all := make(chan struct{})
+	go func() {
+		arrived.Wait()
+		close(all)
+	}()
+
+	var counts [servers]int32
+	var targets []string
+	var client *http.Client
+	for i := 0; i < servers; i++ {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&counts[i], 1) == 1 {
+				arrived.Done()
+			}
+			select {
+			case <-all:
+			case <-time.After(5 * time.Second):
+				http.Error(w, "the other requests didn't arrive", http.StatusGatewayTimeout)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			version := "1"
+			if i == 2 {
+				version = "2"
+			}
+			w.Header().Set("X-Version", version)
+			if i == 2 {
+				w.WriteHeader(http.StatusAccepted)
+			}
+			fmt.Fprintf(w, "%s %s\nHello, %s\nversion %s\n", r.Method, r.URL.Path, body, version)
+		}))
+		defer ts.Close()
+		targets = append(targets, strings.TrimPrefix(ts.URL, "https://"))
+		// httptest servers share a certificate, so any of their clients
+		// trusts them all
+		client = ts.Client()
+	}
+
+	req := httpsclient.Request{Method: http.MethodPost, URL: "/echo", Body: []byte("Gopher")}
+	responses := fanOut(client, req, "https", targets, nil)
+	if len(responses) != servers {
+		t.Fatalf("got %d responses, want one per target", len(responses))
+	}
+	for i, r := range responses {
+		if r.err != nil {
+			t.Fatalf("the request to %s failed: %s", targets[i], r.err)
+		}
+		if r.target != targets[i] {
+			t.Errorf("got the response from %s at %d, want the targets' order", r.target, i)
+		}
+		if n := atomic.LoadInt32(&counts[i]); n != 1 {
+			t.Errorf("target %d got %d requests, want 1", i, n)
+		}
+		if want := "POST /echo\nHello, Gopher\n"; !strings.HasPrefix(string(r.body), want) {
+			t.Errorf("got the body %q from %s, want it to start with %q", r.body, r.target, want)
+		}
+	}
+
+	var out bytes.Buffer
+	if compare(&out, responses, []string{"x-version"}) {
+		t.Error("got identical responses, want the third to differ")
+	}
+	want := []string{
+		"\nSummary:\n",
+		"\t" + targets[0] + ": 200 OK, 35 bytes, TLS 1.3, first byte after ",
+		"\t" + targets[2] + ": 202 Accepted, 35 bytes, TLS 1.3, first byte after ",
+		"\n" + targets[0] + " and " + targets[1] + " responses are identical\n",
+		"\n" + targets[0] + " and " + targets[2] + " responses differ:\n" +
+			"\tstatus: 200 vs 202\n" +
+			"\theader X-Version: \"1\" vs \"2\"\n" +
+			"\tbody:\n" +
+			"\t--- " + targets[0] + "\n\t+++ " + targets[2] + "\n" +
+			"\t POST /echo\n\t Hello, Gopher\n\t-version 1\n\t+version 2\n\t \n",
+	}
+	got := out.String()
+	for _, w := range want {
+		i := strings.Index(got, w)
+		if i < 0 {
+			t.Fatalf("got the comparison\n%s\nwant it to contain %q after the preceding output", out.String(), w)
+		}
+		got = got[i+len(w):]
+	}
+}
+
+func TestCompareErrors(t *testing.T) {
+	refused := errors.New("connection refused")
+	ok := httpsclient.Result{}
+	ok.Status, ok.StatusCode = "200 OK", http.StatusOK
+	tests := []struct {
+		name      string
+		responses []response
+		identical bool
+		want      string
+	}{
+		{"same error", []response{{target: "a", err: refused}, {target: "b", err: refused}}, true, "a and b responses are identical"},
+		{"one error", []response{{target: "a", res: ok}, {target: "b", err: refused}}, false, "errors: none vs connection refused"},
+		{"binary bodies", []response{{target: "a", res: ok, body: []byte{0xff, 1}}, {target: "b", res: ok, body: []byte{0xff, 2, 3}}}, false, "binary bodies differ, 2 vs 3 bytes"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if got := compare(&out, tc.responses, nil); got != tc.identical {
+				t.Errorf("got identical %t, want %t", got, tc.identical)
+			}
+			if !strings.Contains(out.String(), tc.want) {
+				t.Errorf("got the comparison\n%s\nwant it to contain %q", &out, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/youngkin/gohttps/httpsclient"
+	"github.com/youngkin/gohttps/internal/certs"
+)
+
+// maxCASize limits the size of the -fetch-ca download.
+const maxCASize = 1 << 20
+
+// errCANotTrusted is returned by fetchCA when the user declines the CA.
+var errCANotTrusted = errors.New("the CA certificate wasn't trusted, nothing was saved")
+
+// fetchCA downloads the CA certificates from caURL, e.g., served by
+// 'advserver -serve-ca', without verifying the server, since verifying it
+// requires the CA being downloaded. The certificates' fingerprints are printed
+// to out so they can be compared with ones obtained out of band, and they're
+// only saved to dest once the user confirms, reading the answer from in,
+// unless yes is true. cfg configures the connection, apart from the CA.
+func fetchCA(out io.Writer, in io.Reader, caURL, dest string, yes bool, cfg httpsclient.Config) error {
+	fmt.Fprintf(out, "Fetching the CA certificate from %s WITHOUT verifying the server's identity.\n", caURL)
+	fmt.Fprintf(out, "Anyone able to intercept this connection could substitute their own CA, which this client\n")
+	fmt.Fprintf(out, "would then trust. Compare the fingerprints below with ones obtained out of band, e.g., from\n")
+	fmt.Fprintf(out, "'openssl x509 -noout -fingerprint -sha256 -in <caFile>' on the server, before trusting it.\n\n")
+
+	cfg.CACertFile = ""
+	cfg.InsecureSkipVerify = true
+	client, err := httpsclient.NewClient(cfg)
+	if err != nil {
+		return err
+	}
+	res, err := httpsclient.Do(context.Background(), client, httpsclient.Request{URL: caURL})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxCASize))
+	if err != nil {
+		return fmt.Errorf("unable to read the CA certificate from %s: %w", caURL, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to fetch the CA certificate from %s: %s %s", caURL, res.Status, bytes.TrimSpace(body))
+	}
+	cas, err := certs.ParseCertificates(body)
+	if err != nil {
+		return fmt.Errorf("invalid CA certificate from %s: %w", caURL, err)
+	}
+
+	var b bytes.Buffer
+	for i, ca := range cas {
+		fmt.Fprintf(out, "CA certificate %d of %d: %s\n", i+1, len(cas), ca.Subject)
+		fmt.Fprintf(out, "  Valid:   %s to %s\n", ca.NotBefore.Format("2006-01-02"), ca.NotAfter.Format("2006-01-02"))
+		fmt.Fprintf(out, "  SHA-256: %s\n", certs.Fingerprint(ca))
+		if !ca.IsCA {
+			fmt.Fprintf(out, "  Not a CA certificate, it can only be trusted as itself, e.g., a self-signed server certificate\n")
+		}
+		pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+	}
+
+	if yes {
+		fmt.Fprintf(out, "\nTrusting the CA certificate without confirmation (-yes)\n")
+	} else {
+		fmt.Fprintf(out, "\nTrust the CA certificate and save it to %s? [y/N] ", dest)
+		answer, _ := bufio.NewReader(in).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			return errCANotTrusted
+		}
+	}
+	if err := ioutil.WriteFile(dest, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("unable to save the CA certificate: %w", err)
+	}
+	fmt.Fprintf(out, "Saved the CA certificate to %s, the requests below verify the server against it\n", dest)
+	return nil
+}
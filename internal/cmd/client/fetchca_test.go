@@ -0,0 +1,135 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/youngkin/gohttps/httpsclient"
+	"github.com/youngkin/gohttps/internal/certs"
+)
+
+// newCAServer returns a fresh server with a self-signed certificate that
+// serves it, as its CA, at /ca.pem.
+func newCAServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var ts *httptest.Server
+	ts = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ca.pem" {
+			w.Write([]byte("Hello"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// TestFetchCA bootstraps trust in a fresh self-signed server, without
+// sharing any files with it beforehand.
+func TestFetchCA(t *testing.T) {
+	ts := newCAServer(t)
+	dest := filepath.Join(t.TempDir(), "ca.pem")
+
+	// Without the CA the server can't be verified
+	if _, err := httpsclient.NewClient(httpsclient.Config{CACertFile: dest}); err == nil {
+		t.Fatal("creating a client with the CA not yet fetched succeeded")
+	}
+
+	var out strings.Builder
+	if err := fetchCA(&out, strings.NewReader("y\n"), ts.URL+"/ca.pem", dest, false, httpsclient.Config{}); err != nil {
+		t.Fatalf("fetching the CA failed: %s", err)
+	}
+	for _, want := range []string{
+		"WITHOUT verifying the server's identity",
+		"SHA-256: " + certs.Fingerprint(ts.Certificate()),
+		"Trust the CA certificate and save it to " + dest + "? [y/N]",
+		"Saved the CA certificate to " + dest,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("got the output %q, want it to include %q", out.String(), want)
+		}
+	}
+
+	// The saved CA verifies the server
+	client, err := httpsclient.NewClient(httpsclient.Config{CACertFile: dest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := httpsclient.Do(context.Background(), client, httpsclient.Request{URL: ts.URL})
+	if err != nil {
+		t.Fatalf("the request verifying the server with the fetched CA failed: %s", err)
+	}
+	res.Body.Close()
+}
+
+func TestFetchCAConfirmation(t *testing.T) {
+	ts := newCAServer(t)
+	tests := []struct {
+		name   string
+		answer string
+		yes    bool
+		saved  bool
+	}{
+		{"yes", "yes\n", false, true},
+		{"no", "n\n", false, false},
+		{"no answer", "", false, false},
+		{"-yes", "", true, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "ca.pem")
+			var out strings.Builder
+			err := fetchCA(&out, strings.NewReader(tc.answer), ts.URL+"/ca.pem", dest, tc.yes, httpsclient.Config{})
+			_, statErr := os.Stat(dest)
+			if tc.saved {
+				if err != nil || statErr != nil {
+					t.Errorf("got the error %v, and %v saving the CA, want it saved", err, statErr)
+				}
+				return
+			}
+			if err != errCANotTrusted || statErr == nil {
+				t.Errorf("got the error %v, and the saved file's %v, want %v and nothing saved", err, statErr, errCANotTrusted)
+			}
+		})
+	}
+}
+
+func TestFetchCAErrors(t *testing.T) {
+	ts := newCAServer(t)
+	dest := filepath.Join(t.TempDir(), "ca.pem")
+	tests := []struct {
+		path    string
+		wantErr string
+	}{
+		{"/", "invalid CA certificate"},
+	}
+	for _, tc := range tests {
+		err := fetchCA(ioutil.Discard, strings.NewReader("y\n"), ts.URL+tc.path, dest, false, httpsclient.Config{})
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("got the error %v fetching %s, want one containing %q", err, tc.path, tc.wantErr)
+		}
+	}
+	missing := httptest.NewTLSServer(http.NotFoundHandler())
+	defer missing.Close()
+	if err := fetchCA(ioutil.Discard, strings.NewReader("y\n"), missing.URL+"/ca.pem", dest, true, httpsclient.Config{}); err == nil || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("got the error %v for a 404, want one including the status", err)
+	}
+	if _, err := os.Stat(dest); err == nil {
+		t.Error("the CA was saved despite the errors")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// multipartForm returns a multipart/form-data body, and its Content-Type,
+// of the fields, given as name=value, and the files, given as field=path.
+func multipartForm(fields, files []string) ([]byte, string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, f := range fields {
+		name, value, ok := strings.Cut(f, "=")
+		if !ok || name == "" {
+			return nil, "", fmt.Errorf("invalid -form %q, must be name=value", f)
+		}
+		if err := mw.WriteField(name, value); err != nil {
+			return nil, "", err
+		}
+	}
+	for _, f := range files {
+		field, path, ok := strings.Cut(f, "=")
+		if !ok || field == "" || path == "" {
+			return nil, "", fmt.Errorf("invalid -form-file %q, must be field=path", f)
+		}
+		if err := addFile(mw, field, path); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), mw.FormDataContentType(), nil
+}
+
+func addFile(mw *multipart.Writer, field, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to read the -form-file: %w", err)
+	}
+	defer file.Close()
+	part, err := mw.CreateFormFile(field, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return fmt.Errorf("unable to read the -form-file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+// printHandshake writes the cost of the TLS handshake hs, if the request
+// used a new connection, to w.
+func printHandshake(w io.Writer, hs *httpsclient.HandshakeStats) {
+	if hs == nil {
+		return
+	}
+	chain := fmt.Sprintf("certificate chain %d bytes in %d certificate", hs.ChainSize, hs.ChainCerts)
+	if hs.ChainCerts != 1 {
+		chain += "s"
+	}
+	if hs.Resumed {
+		chain = "resumed, no certificate chain sent"
+	}
+	fmt.Fprintf(w, "\tTLS handshake: %d bytes, %d read and %d written, %s\n", hs.Total(), hs.BytesRead, hs.BytesWritten, chain)
+}
+
+// anonymous returns whether the server requested a client certificate during
+// the TLS handshake hs but none was sent.
+func anonymous(hs *httpsclient.HandshakeStats) bool {
+	return hs != nil && hs.ClientCertRequested && !hs.ClientCertSent
+}
+
+// anonymousNotice is the warning, for the first request to target made
+// anonymously, that the server requested a client certificate but none was
+// sent, given the -clientcert file.
+func anonymousNotice(target, clientCertFile string) string {
+	return fmt.Sprintf("%s: %s, %s, the requests are sent anonymously. Use -require-client-cert-use to fail instead",
+		target, httpsclient.ErrClientCertNotSent, anonymousReason(clientCertFile))
+}
+
+// anonymousReason returns why no client certificate was sent, given the
+// -clientcert file.
+func anonymousReason(clientCertFile string) string {
+	if clientCertFile == "" {
+		return "there's no -clientcert"
+	}
+	return "the server doesn't accept the -clientcert certificate, e.g., it isn't issued by a CA the server trusts"
+}
+
+// handshakeSummary accumulates the costs of the full and resumed TLS
+// handshakes of the repeated requests.
+type handshakeSummary struct {
+	full, resumed           int
+	fullBytes, resumedBytes int64
+	chainBytes              int64
+}
+
+func (s *handshakeSummary) add(hs *httpsclient.HandshakeStats) {
+	if hs == nil {
+		return
+	}
+	if hs.Resumed {
+		s.resumed++
+		s.resumedBytes += hs.Total()
+		return
+	}
+	s.full++
+	s.fullBytes += hs.Total()
+	s.chainBytes += int64(hs.ChainSize)
+}
+
+// write writes the average cost of full and resumed handshakes, and how much
+// resumption saved, to w.
+func (s *handshakeSummary) write(w io.Writer) {
+	if s.full+s.resumed == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nTLS handshakes: %d full, %d resumed\n", s.full, s.resumed)
+	if s.full > 0 {
+		fmt.Fprintf(w, "\tFull:    %d bytes on average, including a %d byte certificate chain\n", s.fullBytes/int64(s.full), s.chainBytes/int64(s.full))
+	}
+	if s.resumed > 0 {
+		fmt.Fprintf(w, "\tResumed: %d bytes on average\n", s.resumedBytes/int64(s.resumed))
+	}
+	if s.full > 0 && s.resumed > 0 {
+		full, resumed := s.fullBytes/int64(s.full), s.resumedBytes/int64(s.resumed)
+		fmt.Fprintf(w, "\tResuming saved %d bytes, %.0f%%, per handshake\n", full-resumed, 100*float64(full-resumed)/float64(full))
+	}
+}
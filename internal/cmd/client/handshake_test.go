@@ -0,0 +1,47 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+func TestAnonymous(t *testing.T) {
+	tests := []struct {
+		name string
+		hs   *httpsclient.HandshakeStats
+		want bool
+	}{
+		{"reused connection", nil, false},
+		{"not requested", &httpsclient.HandshakeStats{}, false},
+		{"requested and sent", &httpsclient.HandshakeStats{ClientCertRequested: true, ClientCertSent: true}, false},
+		{"requested and not sent", &httpsclient.HandshakeStats{ClientCertRequested: true}, true},
+	}
+	for _, tc := range tests {
+		if got := anonymous(tc.hs); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAnonymousNotice(t *testing.T) {
+	tests := []struct {
+		clientCertFile string
+		want           string
+	}{
+		{"", "there's no -clientcert"},
+		{"client.crt", "the server doesn't accept the -clientcert certificate"},
+	}
+	for _, tc := range tests {
+		got := anonymousNotice("https://localhost:8443/", tc.clientCertFile)
+		if !strings.HasPrefix(got, "https://localhost:8443/: "+httpsclient.ErrClientCertNotSent.Error()) ||
+			!strings.Contains(got, tc.want) || !strings.HasSuffix(got, "Use -require-client-cert-use to fail instead") {
+			t.Errorf("got the notice %q with -clientcert %q, want one explaining %q", got, tc.clientCertFile, tc.want)
+		}
+	}
+}
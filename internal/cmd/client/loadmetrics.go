@@ -0,0 +1,134 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/logging"
+	"github.com/youngkin/gohttps/internal/metrics"
+)
+
+// loadMetrics are the metrics of the requests sent with -n, served on
+// localhost by -client-metrics-port while they're sent. It's safe for
+// concurrent use.
+type loadMetrics struct {
+	mu      sync.Mutex
+	sent    uint64
+	classes map[string]uint64
+	errors  map[string]uint64
+	latency *metrics.Histogram
+	server  *http.Server
+}
+
+// serveLoadMetrics starts serving the load metrics on localhost:port/metrics.
+func serveLoadMetrics(port int) (*loadMetrics, error) {
+	m := &loadMetrics{
+		classes: map[string]uint64{},
+		errors:  map[string]uint64{},
+		latency: metrics.NewHistogram(metrics.DurationBuckets),
+	}
+	registry := metrics.NewRegistry(0)
+	registry.AddCounter("gohttps_client_requests_total", "The number of requests sent.", func() float64 {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return float64(m.sent)
+	})
+	registry.AddCounterVec("gohttps_client_responses_total", "The number of responses by status code class.", "class", func() map[string]float64 {
+		return m.snapshot(m.classes)
+	})
+	registry.AddCounterVec("gohttps_client_errors_total", "The number of requests that failed without a response, by the category of the error.", "category", func() map[string]float64 {
+		return m.snapshot(m.errors)
+	})
+	registry.AddHistogram("gohttps_client_request_duration_seconds", "The time taken by requests, from sending them until their response body is read.", m.latency)
+
+	ln, err := net.Listen("tcp", net.JoinHostPort("localhost", strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to serve the client metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	m.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := m.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logging.Errorf("Unable to serve the client metrics: %s", err)
+		}
+	}()
+	log.Printf("Serving the load metrics on http://%s/metrics until the requests complete", ln.Addr())
+	return m, nil
+}
+
+func (m *loadMetrics) snapshot(counts map[string]uint64) map[string]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	values := make(map[string]float64, len(counts))
+	for k, n := range counts {
+		values[k] = float64(n)
+	}
+	return values
+}
+
+// observe records the outcome of a request.
+func (m *loadMetrics) observe(r response) {
+	m.mu.Lock()
+	m.sent++
+	if r.err != nil {
+		m.errors[errorCategory(r.err)]++
+	} else {
+		m.classes[fmt.Sprintf("%dxx", r.res.StatusCode/100)]++
+	}
+	m.mu.Unlock()
+	if r.err == nil {
+		m.latency.Observe(r.elapsed.Seconds())
+	}
+}
+
+// close stops serving the metrics, letting an in-flight scrape finish.
+func (m *loadMetrics) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m.server.Shutdown(ctx)
+}
+
+// errorCategory returns a short label for the kind of err, e.g., timeout, for
+// the gohttps_client_errors_total category label.
+func errorCategory(err error) string {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var alertErr tls.AlertError
+	switch {
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.As(err, &netErr) && netErr.Timeout(), errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return "certificate"
+	case errors.As(err, &recordErr), errors.As(err, &alertErr):
+		return "tls"
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET):
+		return "closed"
+	}
+	return "other"
+}
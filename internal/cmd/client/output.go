@@ -0,0 +1,95 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+// responseFormat is how responses are printed, as set by -show-headers,
+// -head, -raw, and -hexdump.
+type responseFormat struct {
+	// headers prints the response headers, formatted as in an HTTP/1.1
+	// response, before the body.
+	headers bool
+	// noBody prints only the headers, e.g., for -head.
+	noBody bool
+	// raw prints the Content-Encoding and Content-Length the body was sent
+	// with, decompression being disabled so the body is as sent.
+	raw bool
+	// hexdump prints the body as a hex dump, e.g., for binary or compressed
+	// bodies.
+	hexdump bool
+}
+
+// print writes res's headers, if f.headers is set, and then body, and with
+// raw, the headers describing its encoding, to w.
+func (f responseFormat) print(w io.Writer, res httpsclient.Result, body []byte) {
+	if f.headers {
+		printHeaders(w, res)
+	}
+	if f.noBody {
+		return
+	}
+	if f.raw {
+		encoding := res.Header.Get("Content-Encoding")
+		if encoding == "" {
+			encoding = "none"
+		}
+		length := "none"
+		if res.ContentLength >= 0 {
+			length = strconv.FormatInt(res.ContentLength, 10)
+		}
+		fmt.Fprintf(w, "\tContent-Encoding: %s\n\tContent-Length: %s\n", encoding, length)
+	}
+	if !f.hexdump {
+		fmt.Fprintf(w, "\tBody: %s\n", body)
+		return
+	}
+	fmt.Fprintf(w, "\tBody: %d bytes\n", len(body))
+	dump := strings.TrimSuffix(hex.Dump(body), "\n")
+	if dump != "" {
+		fmt.Fprintf(w, "\t\t%s\n", strings.ReplaceAll(dump, "\n", "\n\t\t"))
+	}
+}
+
+// decompression describes whether res's body was transparently decompressed,
+// for -verbose.
+func decompression(res httpsclient.Result) string {
+	switch {
+	case res.Uncompressed:
+		return "the gzip encoded body was transparently decompressed, -raw shows it as sent"
+	case res.Header.Get("Content-Encoding") != "":
+		return fmt.Sprintf("the body was received %s encoded, as sent", res.Header.Get("Content-Encoding"))
+	}
+	return "the body wasn't compressed"
+}
+
+// printHeaders writes res's status line and headers, sorted by name, to w,
+// e.g.,
+//
+//	HTTP/2.0 200 OK
+//	Content-Type: text/plain; charset=utf-8
+//	Strict-Transport-Security: max-age=63072000
+func printHeaders(w io.Writer, res httpsclient.Result) {
+	fmt.Fprintf(w, "\tHeaders:\n\t\t%s %s\n", res.Proto, res.Status)
+	names := make([]string, 0, len(res.Header))
+	for name := range res.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range res.Header[name] {
+			fmt.Fprintf(w, "\t\t%s: %s\n", name, v)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+const gzipped = "Hello, Gopher from Advanced Server!"
+
+// newGzipServer returns a server that gzips its response, whether or not
+// the client accepts gzip, the bytes it sends, and the Accept-Encoding header
+// of each request it's sent.
+func newGzipServer(t *testing.T) (*httptest.Server, []byte, *[]string) {
+	t.Helper()
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(gzipped))
+	zw.Close()
+
+	var accepted []string
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted = append(accepted, r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(compressed.Len()))
+		w.Write(compressed.Bytes())
+	}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts, compressed.Bytes(), &accepted
+}
+
+// TestRaw requests a body the server gzips, with and without -raw, printing
+// it as the client does.
+func TestRaw(t *testing.T) {
+	for _, raw := range []bool{false, true} {
+		ts, compressed, accepted := newGzipServer(t)
+		client, err := httpsclient.NewClient(httpsclient.Config{InsecureSkipVerify: true, DisableCompression: raw})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, body, err := doRequest(context.Background(), client, httpsclient.Request{URL: ts.URL}, nil)
+		if err != nil {
+			t.Fatalf("the request with -raw %t failed: %s", raw, err)
+		}
+		var out bytes.Buffer
+		responseFormat{headers: true, raw: raw}.print(&out, res, body)
+
+		if !raw {
+			// Go's client asks for gzip, and decompresses the body
+			if len(*accepted) != 1 || (*accepted)[0] != "gzip" {
+				t.Errorf("got the Accept-Encoding headers %q without -raw, want gzip", *accepted)
+			}
+			if string(body) != gzipped || !res.Uncompressed {
+				t.Errorf("got the body %q, decompressed %t, without -raw, want %q decompressed", body, res.Uncompressed, gzipped)
+			}
+			if got := res.Header.Get("Content-Encoding"); got != "" {
+				t.Errorf("got Content-Encoding %q without -raw, want it removed", got)
+			}
+			if got := out.String(); !strings.Contains(got, "\tBody: "+gzipped+"\n") || strings.Contains(got, "Content-Encoding") {
+				t.Errorf("got the output %q without -raw, want the decompressed body and no Content-Encoding", got)
+			}
+			continue
+		}
+
+		// With -raw gzip isn't asked for, and a body the server compresses
+		// anyway is printed as sent
+		if len(*accepted) != 1 || (*accepted)[0] != "" {
+			t.Errorf("got the Accept-Encoding headers %q with -raw, want none", *accepted)
+		}
+		if !bytes.Equal(body, compressed) || res.Uncompressed {
+			t.Errorf("got the body %q, decompressed %t, with -raw, want the %d compressed bytes", body, res.Uncompressed, len(compressed))
+		}
+		for _, want := range []string{
+			"\t\tContent-Encoding: gzip\n",
+			"\tContent-Encoding: gzip\n\tContent-Length: " + strconv.Itoa(len(compressed)) + "\n\tBody: " + string(compressed) + "\n",
+		} {
+			if got := out.String(); !strings.Contains(got, want) {
+				t.Errorf("got the output %q with -raw, want %q", got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/certs"
+	"github.com/youngkin/gohttps/internal/tlsutil"
+)
+
+// Exit statuses used when a -preflight check fails. When several checks
+// fail the status of the worst, the earliest in the order below, is used.
+const (
+	exitPreflightTLS     = 5
+	exitPreflightConnect = 6
+	exitPreflightDNS     = 7
+)
+
+const (
+	preflightTimeout = 5 * time.Second
+	// recentlyIssued is how recently a certificate must have become valid for
+	// its NotBefore to be reported as a possible sign of clock skew.
+	recentlyIssued = 10 * time.Minute
+)
+
+// preflight resolves each target, connects to each of its addresses,
+// handshakes, and verifies the server certificate using tlsConfig, printing
+// the result of each check to w. Warnings don't fail. It returns the exit
+// status of the worst failure, or 0 if every check passed.
+func preflight(w io.Writer, targets []string, tlsConfig *tls.Config, dial func(ctx context.Context, network, address string) (net.Conn, error)) int {
+	status := 0
+	fail := func(code int) {
+		if code > status {
+			status = code
+		}
+	}
+	report := func(result, check, format string, args ...interface{}) {
+		fmt.Fprintf(w, "%-4s %-8s %s\n", result, check, fmt.Sprintf(format, args...))
+	}
+
+	fmt.Fprintf(w, "\nPreflight checks:\n")
+	for _, target := range targets {
+		host, port, err := net.SplitHostPort(target)
+		if err != nil {
+			host, port = target, "443"
+		}
+		// The certificate is verified against -sni, if it's set, rather than
+		// the host connected to.
+		name := host
+		if tlsConfig.ServerName != "" {
+			name = tlsConfig.ServerName
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		cancel()
+		if err != nil {
+			report("FAIL", "dns", "%s: %s", host, err)
+			fail(exitPreflightDNS)
+			continue
+		}
+		ips := make([]string, len(addrs))
+		for i, a := range addrs {
+			ips[i] = a.String()
+		}
+		report("PASS", "dns", "%s resolves to %s", host, strings.Join(ips, ", "))
+
+		for _, ip := range ips {
+			addr := net.JoinHostPort(ip, port)
+			ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+			start := time.Now()
+			conn, err := dial(ctx, "tcp", addr)
+			cancel()
+			if err != nil {
+				report("FAIL", "tcp", "%s: %s", addr, err)
+				fail(exitPreflightConnect)
+				continue
+			}
+			report("PASS", "tcp", "%s connected in %s", addr, time.Since(start).Round(time.Microsecond))
+
+			cfg := tlsConfig.Clone()
+			cfg.ServerName = name
+			// The certificate is verified below so each problem can be reported
+			// separately instead of only the first the handshake runs into.
+			cfg.InsecureSkipVerify = true
+			cfg.VerifyConnection = nil
+			tlsConn := tls.Client(conn, cfg)
+			tlsConn.SetDeadline(time.Now().Add(preflightTimeout))
+			err = tlsConn.Handshake()
+			if err != nil {
+				conn.Close()
+				report("FAIL", "tls", "%s: handshake failed: %s", addr, err)
+				fail(exitPreflightTLS)
+				continue
+			}
+			cs := tlsConn.ConnectionState()
+			tlsConn.Close()
+			report("PASS", "tls", "%s negotiated %s, %s", addr, tlsutil.VersionName(cs.Version), tlsutil.CipherSuiteName(cs.CipherSuite))
+			if !checkCertificate(report, addr, name, cs.PeerCertificates, tlsConfig.RootCAs) {
+				fail(exitPreflightTLS)
+			}
+		}
+	}
+	return status
+}
+
+// checkCertificate reports on the validity period, chain, and host name of
+// the server's certificate chain, returning false if any check fails.
+func checkCertificate(report func(result, check, format string, args ...interface{}), addr, host string, chain []*x509.Certificate, roots *x509.CertPool) bool {
+	if len(chain) == 0 {
+		report("FAIL", "cert", "%s: the server didn't present a certificate", addr)
+		return false
+	}
+	ok := true
+	leaf := chain[0]
+	now := time.Now()
+	switch {
+	case now.Before(leaf.NotBefore):
+		report("FAIL", "clock", "%s: the certificate isn't valid until %s, %s from now, the local clock may be behind",
+			addr, leaf.NotBefore.Format(time.RFC3339), leaf.NotBefore.Sub(now).Round(time.Second))
+		ok = false
+	case now.Sub(leaf.NotBefore) < recentlyIssued:
+		report("WARN", "clock", "%s: the certificate only became valid %s ago, clients with clocks that are behind will reject it",
+			addr, now.Sub(leaf.NotBefore).Round(time.Second))
+	default:
+		report("PASS", "clock", "%s: the certificate has been valid since %s", addr, leaf.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		report("FAIL", "expiry", "%s: the certificate expired %s", addr, leaf.NotAfter.Format(time.RFC3339))
+		ok = false
+	} else {
+		report("PASS", "expiry", "%s: the certificate expires %s, in %s", addr, leaf.NotAfter.Format(time.RFC3339), leaf.NotAfter.Sub(now).Round(time.Minute))
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+		report("FAIL", "chain", "%s: %s", addr, err)
+		for _, p := range certs.ExplainChain(chain, host) {
+			report("FAIL", "chain", "%s: %s", addr, p)
+		}
+		ok = false
+	} else {
+		report("PASS", "chain", "%s: issued by %s", addr, leaf.Issuer.CommonName)
+	}
+	if err := leaf.VerifyHostname(host); err != nil {
+		report("FAIL", "hostname", "%s: %s", addr, err)
+		ok = false
+	} else {
+		report("PASS", "hostname", "%s: the certificate is valid for %s", addr, host)
+	}
+	return ok
+}
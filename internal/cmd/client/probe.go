@@ -0,0 +1,202 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const probeTimeout = 5 * time.Second
+
+// http2Preface is the client connection preface of an HTTP/2 connection,
+// followed by an empty SETTINGS frame, as sent with prior knowledge.
+var http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n\x00\x00\x00\x04\x00\x00\x00\x00\x00")
+
+// probeResult is the outcome of probing a target for one of the protocols.
+type probeResult struct {
+	supported bool
+	// detail is what the server did, e.g., the protocol it negotiated, or why
+	// the probe failed, e.g., the connection was refused.
+	detail string
+}
+
+// probe is a way of speaking HTTP to a server.
+type probe struct {
+	name string
+	// alpn are the protocols offered in the TLS handshake performed before
+	// run is called, nil if the probe uses a cleartext connection.
+	alpn []string
+	run  func(conn net.Conn, host string) probeResult
+}
+
+var probes = []probe{
+	{"h2 over TLS (ALPN)", []string{"h2", "http/1.1"}, probeALPN},
+	{"HTTP/1.1 over TLS", []string{"http/1.1"}, probeHTTP1},
+	{"h2c prior knowledge", nil, probePriorKnowledge},
+	{"h2c upgrade", nil, probeUpgrade},
+	{"HTTP/1.1 cleartext", nil, probeHTTP1},
+}
+
+// probeProtocols tries each of the probes against each target, printing a
+// matrix of the protocols each supports to w. The TLS probes don't verify
+// the server's certificate, they only check what the server speaks.
+func probeProtocols(w io.Writer, targets []string, dial func(ctx context.Context, network, address string) (net.Conn, error)) {
+	for _, target := range targets {
+		host, _, err := net.SplitHostPort(target)
+		if err != nil {
+			host, target = target, net.JoinHostPort(target, "443")
+		}
+		fmt.Fprintf(w, "\nProtocol support of %s:\n", target)
+		for _, p := range probes {
+			res := runProbe(p, target, host, dial)
+			supported := "no"
+			if res.supported {
+				supported = "yes"
+			}
+			fmt.Fprintf(w, "  %-20s %-3s  %s\n", p.name, supported, res.detail)
+		}
+	}
+}
+
+func runProbe(p probe, target, host string, dial func(ctx context.Context, network, address string) (net.Conn, error)) probeResult {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	conn, err := dial(ctx, "tcp", target)
+	if err != nil {
+		return probeResult{detail: classify(err)}
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(probeTimeout))
+	if p.alpn == nil {
+		return p.run(conn, host)
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host, NextProtos: p.alpn, InsecureSkipVerify: true})
+	if err := tlsConn.Handshake(); err != nil {
+		return probeResult{detail: classify(err)}
+	}
+	return p.run(tlsConn, host)
+}
+
+// probeALPN reports whether the server negotiated h2 in the TLS handshake,
+// which runProbe has already performed.
+func probeALPN(conn net.Conn, host string) probeResult {
+	switch proto := conn.(*tls.Conn).ConnectionState().NegotiatedProtocol; proto {
+	case "h2":
+		return probeResult{supported: true, detail: "negotiated h2"}
+	case "":
+		return probeResult{detail: "no protocol negotiated, the server only speaks HTTP/1.1"}
+	default:
+		return probeResult{detail: "negotiated " + proto}
+	}
+}
+
+// probeHTTP1 sends an HTTP/1.1 HEAD request.
+func probeHTTP1(conn net.Conn, host string) probeResult {
+	fmt.Fprintf(conn, "HEAD / HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", host)
+	return readHTTP1(conn, func(res *http.Response) probeResult {
+		return probeResult{supported: true, detail: res.Proto + " " + res.Status}
+	})
+}
+
+// probePriorKnowledge sends the HTTP/2 connection preface, to which an h2c
+// server responds with its SETTINGS frame.
+func probePriorKnowledge(conn net.Conn, host string) probeResult {
+	if _, err := conn.Write(http2Preface); err != nil {
+		return probeResult{detail: classify(err)}
+	}
+	br := bufio.NewReader(conn)
+	header, err := br.Peek(9)
+	if err != nil && len(header) == 0 {
+		return probeResult{detail: classify(err)}
+	}
+	// A frame header is a 3 byte length, the type, SETTINGS is 4, the flags,
+	// and a 4 byte stream ID, 0 for SETTINGS
+	if len(header) == 9 && header[3] == 0x4 && bytes.Equal(header[5:9], []byte{0, 0, 0, 0}) {
+		return probeResult{supported: true, detail: "the server sent its SETTINGS frame"}
+	}
+	return readHTTP1(br, nil)
+}
+
+// probeUpgrade sends an HTTP/1.1 request asking to upgrade to h2c, to which
+// a server that supports it responds with a 101.
+func probeUpgrade(conn net.Conn, host string) probeResult {
+	fmt.Fprintf(conn, "HEAD / HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: \r\n\r\n", host)
+	return readHTTP1(conn, func(res *http.Response) probeResult {
+		if res.StatusCode == http.StatusSwitchingProtocols && strings.EqualFold(res.Header.Get("Upgrade"), "h2c") {
+			return probeResult{supported: true, detail: "101 Switching Protocols to h2c"}
+		}
+		return probeResult{detail: fmt.Sprintf("the upgrade was ignored, spoke %s, %s", res.Proto, res.Status)}
+	})
+}
+
+// readHTTP1 reads the server's response to a cleartext probe, returning the
+// result of ok if it's an HTTP/1.x response, other than the 400 TLS servers
+// send to cleartext requests. With a nil ok any HTTP/1.x
+// response means the probed protocol isn't supported.
+func readHTTP1(r io.Reader, ok func(*http.Response) probeResult) probeResult {
+	br, isBuffered := r.(*bufio.Reader)
+	if !isBuffered {
+		br = bufio.NewReader(r)
+	}
+	first, err := br.Peek(1)
+	if err != nil {
+		return probeResult{detail: classify(err)}
+	}
+	// 0x15 is a TLS alert record, 0x16 a handshake record
+	if first[0] == 0x15 || first[0] == 0x16 {
+		return probeResult{detail: "the server only speaks TLS, it responded with a TLS record"}
+	}
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		return probeResult{detail: fmt.Sprintf("unrecognized response: %s", err)}
+	}
+	// Only a 400's body is read, the others needn't be delimited, e.g., a
+	// keep-alive response to HEAD without a Content-Length, and reading them
+	// would wait for the probe to time out. Go's servers say "Client sent an
+	// HTTP request to an HTTPS server", and advserver "This port expects HTTPS"
+	if res.StatusCode == http.StatusBadRequest {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		if bytes.Contains(body, []byte("HTTPS")) {
+			return probeResult{detail: "the server only speaks TLS, it rejected the cleartext request"}
+		}
+	}
+	if ok == nil {
+		return probeResult{detail: fmt.Sprintf("spoke %s instead, %s", res.Proto, res.Status)}
+	}
+	return ok(res)
+}
+
+// classify describes why a probe's connection failed, distinguishing a
+// server that isn't listening from one that speaks another protocol.
+func classify(err error) string {
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused, nothing is listening"
+	case errors.As(err, &netErr) && netErr.Timeout(), errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return "timed out"
+	case errors.As(err, &recordErr):
+		if bytes.HasPrefix(recordErr.RecordHeader[:], []byte("HTTP/")) {
+			return "not TLS, the server responded with cleartext HTTP/1.x"
+		}
+		return "not TLS, the server responded with something else"
+	case errors.Is(err, io.EOF), errors.Is(err, syscall.ECONNRESET):
+		return "the server closed the connection"
+	}
+	return err.Error()
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// probeLines probes target, returning the lines of the matrix, keyed by
+// probe name, with the probe name removed.
+func probeLines(t *testing.T, target string) map[string]string {
+	t.Helper()
+	var out strings.Builder
+	probeProtocols(&out, []string{target}, (&net.Dialer{}).DialContext)
+	lines := map[string]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		for _, p := range probes {
+			if strings.HasPrefix(line, "  "+p.name) {
+				lines[p.name] = strings.Join(strings.Fields(strings.TrimPrefix(line, "  "+p.name)), " ")
+			}
+		}
+	}
+	if len(lines) != len(probes) {
+		t.Fatalf("got the output %q, want a line for each probe", out.String())
+	}
+	return lines
+}
+
+func TestProbeProtocols(t *testing.T) {
+	tlsServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tlsServer.EnableHTTP2 = true
+	tlsServer.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	h2cServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h2cServer.Config.Protocols = new(http.Protocols)
+	h2cServer.Config.Protocols.SetHTTP1(true)
+	h2cServer.Config.Protocols.SetUnencryptedHTTP2(true)
+	h2cServer.Start()
+	defer h2cServer.Close()
+
+	http1Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer http1Server.Close()
+
+	refused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused.Close()
+
+	const onlyTLS = "no the server only speaks TLS, it rejected the cleartext request"
+	const notTLS = "no not TLS, the server responded with cleartext HTTP/1.x"
+	tests := []struct {
+		name   string
+		target string
+		want   map[string]string
+	}{
+		{"TLS", tlsServer.Listener.Addr().String(), map[string]string{
+			"h2 over TLS (ALPN)":  "yes negotiated h2",
+			"HTTP/1.1 over TLS":   "yes HTTP/1.1 200 OK",
+			"h2c prior knowledge": "no the server closed the connection",
+			"h2c upgrade":         onlyTLS,
+			"HTTP/1.1 cleartext":  onlyTLS,
+		}},
+		{"h2c", h2cServer.Listener.Addr().String(), map[string]string{
+			"h2 over TLS (ALPN)":  notTLS,
+			"HTTP/1.1 over TLS":   notTLS,
+			"h2c prior knowledge": "yes the server sent its SETTINGS frame",
+			"h2c upgrade":         "no the upgrade was ignored, spoke HTTP/1.1, 200 OK",
+			"HTTP/1.1 cleartext":  "yes HTTP/1.1 200 OK",
+		}},
+		{"HTTP/1.1", http1Server.Listener.Addr().String(), map[string]string{
+			"h2c prior knowledge": "no spoke HTTP/1.1 instead, 200 OK",
+			"HTTP/1.1 cleartext":  "yes HTTP/1.1 200 OK",
+		}},
+		{"refused", refused.Addr().String(), map[string]string{
+			"h2 over TLS (ALPN)": "no connection refused, nothing is listening",
+			"HTTP/1.1 cleartext": "no connection refused, nothing is listening",
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Now()
+			lines := probeLines(t, tc.target)
+			// No probe waits for its timeout, e.g., to read a response body
+			if elapsed := time.Since(start); elapsed >= probeTimeout {
+				t.Errorf("probing took %s, want less than the %s timeout", elapsed, probeTimeout)
+			}
+			for name, want := range tc.want {
+				if lines[name] != want {
+					t.Errorf("got %q for %s, want %q", lines[name], name, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/youngkin/gohttps/httpsclient"
+	"github.com/youngkin/gohttps/internal/tlsutil"
+)
+
+const replHelp = `Commands:
+  get|head|delete|options <path>  Send a request, <path> is relative to the server, e.g., /bytes/10,
+                                  or a full URL
+  post|put|patch <path> [body]    Send a request with the rest of the line as its body
+  headers                         List the headers sent with every request
+  headers set <name> <value>      Send a header with every request
+  headers unset <name>            Stop sending a header
+  show tls                        Describe the TLS connection of the last response
+  show cookies                    List the cookies stored for the server
+  timing on|off                   Print the timing of each request, off by default
+  server <host[:port]>            Send the following requests to another server
+  history                         List the commands entered so far
+  !<n>                            Repeat command n from the history
+  help                            Print this message
+  exit, quit                      Exit, as does end of input, e.g., Ctrl-D
+Ctrl-C cancels the request in progress, it doesn't exit.`
+
+// repl is the state of the interactive mode, -repl. Every command uses the
+// same http.Client, so connections are reused, and cookies kept, across
+// commands.
+type repl struct {
+	client  *http.Client
+	har     *httpsclient.HARRecorder
+	scheme  string
+	server  string
+	header  http.Header
+	timing  bool
+	showSCT bool
+	format  responseFormat
+	history []string
+	last    *httpsclient.Result
+
+	out io.Writer
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// runREPL reads commands from in, writing prompts and responses to out,
+// until the end of in or an exit command. server is the initial server's
+// host and optional port, requests are sent to it using scheme, https or,
+// with -http2-prior-knowledge, http.
+func runREPL(in io.Reader, out io.Writer, client *http.Client, scheme, server string, har *httpsclient.HARRecorder, showSCT bool, format responseFormat) error {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	// The client is shared with nothing else once the REPL starts, so it's
+	// safe to give it a cookie jar
+	client.Jar = jar
+	r := &repl{client: client, har: har, scheme: scheme, server: server, header: http.Header{}, showSCT: showSCT, format: format, out: out}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+	go func() {
+		for range sigs {
+			r.interrupt()
+		}
+	}()
+
+	fmt.Fprintf(out, "Connected to %s, type 'help' for the list of commands\n", server)
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "%s> ", r.server)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			n, err := strconv.Atoi(line[1:])
+			if err != nil || n < 1 || n > len(r.history) {
+				fmt.Fprintf(out, "No command %s in the history\n", line[1:])
+				continue
+			}
+			line = r.history[n-1]
+			fmt.Fprintln(out, line)
+		}
+		r.history = append(r.history, line)
+		if line == "exit" || line == "quit" {
+			return nil
+		}
+		if err := r.run(line); err != nil {
+			fmt.Fprintf(out, "%s\n", err)
+		}
+	}
+}
+
+// interrupt cancels the request in progress, if any.
+func (r *repl) interrupt() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		r.cancel()
+		return
+	}
+	fmt.Fprintf(r.out, "\nType 'exit' or Ctrl-D to exit\n%s> ", r.server)
+}
+
+// run runs the command line.
+func (r *repl) run(line string) error {
+	cmd, args, _ := strings.Cut(line, " ")
+	args = strings.TrimSpace(args)
+	switch strings.ToLower(cmd) {
+	case "get", "head", "delete", "options":
+		if args == "" || strings.Contains(args, " ") {
+			return fmt.Errorf("usage: %s <path>", cmd)
+		}
+		return r.send(strings.ToUpper(cmd), args, "")
+	case "post", "put", "patch":
+		path, body, _ := strings.Cut(args, " ")
+		if path == "" {
+			return fmt.Errorf("usage: %s <path> [body]", cmd)
+		}
+		return r.send(strings.ToUpper(cmd), path, strings.TrimSpace(body))
+	case "headers":
+		return r.headers(args)
+	case "show":
+		switch args {
+		case "tls":
+			r.showTLS()
+		case "cookies":
+			r.showCookies()
+		default:
+			return fmt.Errorf("usage: show tls|cookies")
+		}
+	case "timing":
+		switch args {
+		case "on", "off":
+			r.timing = args == "on"
+		default:
+			return fmt.Errorf("usage: timing on|off")
+		}
+	case "server":
+		if args == "" || strings.Contains(args, "/") {
+			return fmt.Errorf("usage: server <host[:port]>")
+		}
+		r.server = args
+	case "history":
+		for i, h := range r.history {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, h)
+		}
+	case "help":
+		fmt.Fprintln(r.out, replHelp)
+	default:
+		return fmt.Errorf("unknown command %q, type 'help' for the list of commands", cmd)
+	}
+	return nil
+}
+
+func (r *repl) url(path string) string {
+	if strings.HasPrefix(path, r.scheme+"://") {
+		return path
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return r.scheme + "://" + r.server + path
+}
+
+// send sends a request and prints the response, or why it failed.
+func (r *repl) send(method, path, body string) error {
+	req := httpsclient.Request{Method: method, URL: r.url(path), Header: r.header.Clone()}
+	if body != "" {
+		req.Body = []byte(body)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.mu.Lock()
+	r.cancel = cancel
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.cancel = nil
+		r.mu.Unlock()
+		cancel()
+	}()
+
+	res, resBody, err := doRequest(ctx, r.client, req, r.har)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("request canceled")
+		}
+		return err
+	}
+	r.last = &res
+	fmt.Fprintf(r.out, "\nResponse from server: \n\tHTTP status: %s\n", res.Status)
+	r.format.print(r.out, res, resBody)
+	printRetryAdvice(r.out, res)
+	printHandshake(r.out, res.Handshake)
+	if r.showSCT {
+		printSCTs(r.out, res)
+	}
+	if r.timing {
+		t := res.Timing
+		fmt.Fprintf(r.out, "\tTiming: %s connection, DNS %s, connect %s, TLS handshake %s, send %s, wait %s, first byte after %s\n",
+			connKind(res.Reused), t.DNS, t.Connect, t.TLSHandshake, t.Send, t.Wait, t.FirstByte)
+	}
+	return nil
+}
+
+// headers runs the headers command.
+func (r *repl) headers(args string) error {
+	sub, rest, _ := strings.Cut(args, " ")
+	switch sub {
+	case "":
+		if len(r.header) == 0 {
+			fmt.Fprintln(r.out, "No headers are set")
+		}
+		names := make([]string, 0, len(r.header))
+		for name := range r.header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(r.out, "%s: %s\n", name, strings.Join(r.header[name], ", "))
+		}
+	case "set":
+		name, value, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		if name == "" {
+			return fmt.Errorf("usage: headers set <name> <value>")
+		}
+		r.header.Set(name, strings.TrimSpace(value))
+	case "unset":
+		if rest == "" {
+			return fmt.Errorf("usage: headers unset <name>")
+		}
+		r.header.Del(strings.TrimSpace(rest))
+	default:
+		return fmt.Errorf("usage: headers [set <name> <value> | unset <name>]")
+	}
+	return nil
+}
+
+// showTLS describes the TLS connection of the last response.
+func (r *repl) showTLS() {
+	if r.last == nil || r.last.TLS == nil {
+		fmt.Fprintln(r.out, "No response received yet")
+		return
+	}
+	cs := r.last.TLS
+	fmt.Fprintf(r.out, "Version:      %s\n", tlsutil.VersionName(cs.Version))
+	fmt.Fprintf(r.out, "Cipher suite: %s\n", tlsutil.CipherSuiteName(cs.CipherSuite))
+	fmt.Fprintf(r.out, "ALPN:         %s\n", orNone(cs.NegotiatedProtocol))
+	fmt.Fprintf(r.out, "Server name:  %s\n", cs.ServerName)
+	fmt.Fprintf(r.out, "Resumed:      %t\n", cs.DidResume)
+	fmt.Fprintf(r.out, "Reused:       %t\n", r.last.Reused)
+	for i, cert := range cs.PeerCertificates {
+		fmt.Fprintf(r.out, "Certificate %d: %s, issued by %s, expires %s\n", i, cert.Subject, cert.Issuer, cert.NotAfter.Format("2006-01-02"))
+	}
+	if cs.Version == tls.VersionTLS13 && cs.DidResume {
+		fmt.Fprintln(r.out, "The certificates are from the resumed session, they weren't sent again")
+	}
+}
+
+// showCookies lists the cookies stored for the current server.
+func (r *repl) showCookies() {
+	u, err := url.Parse(r.url("/"))
+	if err != nil {
+		fmt.Fprintf(r.out, "%s\n", err)
+		return
+	}
+	cookies := r.client.Jar.Cookies(u)
+	if len(cookies) == 0 {
+		fmt.Fprintf(r.out, "No cookies are stored for %s\n", r.server)
+	}
+	for _, c := range cookies {
+		fmt.Fprintf(r.out, "%s=%s\n", c.Name, c.Value)
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
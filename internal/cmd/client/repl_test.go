@@ -0,0 +1,173 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newREPLServer returns a server that responds with the request's method,
+// path, X-Test header, session cookie and body, and sets the session cookie
+// on /login.
+func newREPLServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "gopher", Path: "/"})
+		}
+		session := "none"
+		if c, err := r.Cookie("session"); err == nil {
+			session = c.Value
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s X-Test=%q session=%s %s", r.Method, r.URL.Path, r.Header.Get("X-Test"), session, body)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// runScript runs the REPL with the commands of script, returning its output.
+func runScript(t *testing.T, ts *httptest.Server, script string) string {
+	t.Helper()
+	var out bytes.Buffer
+	server := strings.TrimPrefix(ts.URL, "https://")
+	if err := runREPL(strings.NewReader(script), &out, ts.Client(), "https", server, nil, false, responseFormat{}); err != nil {
+		t.Fatalf("the REPL failed: %s", err)
+	}
+	return out.String()
+}
+
+// wantInOrder checks that out contains each of want, in order.
+func wantInOrder(t *testing.T, out string, want ...string) {
+	t.Helper()
+	rest := out
+	for _, w := range want {
+		i := strings.Index(rest, w)
+		if i < 0 {
+			t.Fatalf("got the output\n%s\nwant it to contain %q after the preceding output", out, w)
+		}
+		rest = rest[i+len(w):]
+	}
+}
+
+func TestREPL(t *testing.T) {
+	ts := newREPLServer(t)
+	server := strings.TrimPrefix(ts.URL, "https://")
+	out := runScript(t, ts, `get /
+headers
+headers set X-Test a value
+headers set Accept text/plain
+headers
+post /echo  Hello, World
+headers unset X-Test
+put echo
+get /login
+show cookies
+get /
+show tls
+timing on
+delete /
+history
+!2
+`)
+	wantInOrder(t, out,
+		"Connected to "+server+", type 'help' for the list of commands\n"+server+"> ",
+		"\tHTTP status: 200 OK\n\tBody: GET / X-Test=\"\" session=none \n",
+		"No headers are set\n",
+		"Accept: text/plain\nX-Test: a value\n",
+		// The rest of the line is the body, the headers are sent with every request
+		"\tBody: POST /echo X-Test=\"a value\" session=none Hello, World\n",
+		"\tBody: PUT /echo X-Test=\"\" session=none \n",
+		// The cookie is kept across commands
+		"\tBody: GET /login X-Test=\"\" session=none \n",
+		"session=gopher\n",
+		"\tBody: GET / X-Test=\"\" session=gopher \n",
+		"Version:      TLS1.3\n",
+		"Reused:       true\n",
+		"Certificate 0: O=Acme Co, issued by O=Acme Co",
+		"\tBody: DELETE / X-Test=\"\" session=gopher \n",
+		"\tTiming: reused connection, DNS ",
+		"   1  get /\n   2  headers\n",
+		"  15  history\n",
+		// !2 is printed before it's run, X-Test was unset
+		"headers\nAccept: text/plain\n"+server+"> ",
+	)
+}
+
+func TestREPLErrors(t *testing.T) {
+	ts := newREPLServer(t)
+	server := strings.TrimPrefix(ts.URL, "https://")
+	out := runScript(t, ts, `show tls
+show cookies
+fetch /
+get
+get / extra
+post
+headers set
+headers unset
+headers clear
+show
+timing maybe
+server https://localhost/
+!99
+!x
+help
+quit
+get /
+`)
+	wantInOrder(t, out,
+		"No response received yet\n",
+		"No cookies are stored for "+server+"\n",
+		`unknown command "fetch", type 'help' for the list of commands`+"\n",
+		"usage: get <path>\n",
+		"usage: get <path>\n",
+		"usage: post <path> [body]\n",
+		"usage: headers set <name> <value>\n",
+		"usage: headers unset <name>\n",
+		"usage: headers [set <name> <value> | unset <name>]\n",
+		"usage: show tls|cookies\n",
+		"usage: timing on|off\n",
+		"usage: server <host[:port]>\n",
+		"No command 99 in the history\n",
+		"No command x in the history\n",
+		replHelp,
+	)
+	// quit stops reading commands
+	if strings.Contains(out, "HTTP status") {
+		t.Errorf("got the output\n%s\nwant no request sent after quit", out)
+	}
+}
+
+func TestREPLServer(t *testing.T) {
+	named := func(name string) *httptest.Server {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", name, r.URL.Path)
+		}))
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	first, second := named("first"), named("second")
+	secondServer := strings.TrimPrefix(second.URL, "https://")
+	// httptest servers share a certificate, so the first's client trusts the
+	// second
+	out := runScript(t, first, "get /a\nserver "+secondServer+"\nget /b\nget "+first.URL+"/c\nget /d\nserver 127.0.0.1:1\nget /\n")
+	wantInOrder(t, out,
+		"\tBody: first /a\n",
+		secondServer+"> ",
+		"\tBody: second /b\n",
+		// A full URL is sent as is, without changing the server
+		"\tBody: first /c\n",
+		secondServer+"> ",
+		"\tBody: second /d\n",
+		"127.0.0.1:1> ",
+		"connection refused",
+	)
+}
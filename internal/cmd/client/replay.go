@@ -0,0 +1,150 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+// maxInlineBody is the size of the largest body -save-request writes inline,
+// larger bodies are written to their own file and referenced by BodyFile.
+const maxInlineBody = 64 * 1024
+
+// savedRequest is a request as written by -save-request and read by -replay,
+// one JSON object per line. At most one of Body, BodyBase64, and BodyFile is
+// set. BodyFile is relative to the directory of the file it's read from,
+// unless it's absolute, so large payloads can be shared by many requests.
+type savedRequest struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 string      `json:"body_base64,omitempty"`
+	BodyFile   string      `json:"body_file,omitempty"`
+	Host       string      `json:"host,omitempty"`
+}
+
+// saveRequests writes reqs to path, replacing its contents. Bodies larger
+// than maxInlineBody are written to path.body.<n> instead.
+func saveRequests(path string, reqs []httpsclient.Request) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for i, req := range reqs {
+		method := req.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		saved := savedRequest{Method: method, URL: req.URL, Header: req.Header, Host: req.Host}
+		switch {
+		case len(req.Body) > maxInlineBody:
+			bodyFile := fmt.Sprintf("%s.body.%d", path, i+1)
+			if err := ioutil.WriteFile(bodyFile, req.Body, 0644); err != nil {
+				return fmt.Errorf("unable to save the request body: %w", err)
+			}
+			saved.BodyFile = filepath.Base(bodyFile)
+		case utf8.Valid(req.Body):
+			saved.Body = string(req.Body)
+		default:
+			saved.BodyBase64 = base64.StdEncoding.EncodeToString(req.Body)
+		}
+		if err := enc.Encode(saved); err != nil {
+			return fmt.Errorf("unable to encode request %d: %w", i+1, err)
+		}
+	}
+	if err := ioutil.WriteFile(path, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("unable to save the requests: %w", err)
+	}
+	return nil
+}
+
+// loadRequests reads the requests saved in path, in order. If host isn't
+// empty it replaces the host, and port, of each request's URL.
+func loadRequests(path, host string) ([]httpsclient.Request, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the saved requests: %w", err)
+	}
+	defer f.Close()
+
+	var reqs []httpsclient.Request
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var saved savedRequest
+		if err := dec.Decode(&saved); err != nil {
+			return nil, fmt.Errorf("invalid saved request %d in %s: %w", len(reqs)+1, path, err)
+		}
+		req, err := saved.request(filepath.Dir(path), host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid saved request %d in %s: %w", len(reqs)+1, path, err)
+		}
+		reqs = append(reqs, req)
+	}
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("%s doesn't contain any requests", path)
+	}
+	return reqs, nil
+}
+
+func (s savedRequest) request(dir, host string) (httpsclient.Request, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return httpsclient.Request{}, err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return httpsclient.Request{}, fmt.Errorf("the URL %q must be an https URL", s.URL)
+	}
+	if host != "" {
+		u.Host = host
+	}
+
+	req := httpsclient.Request{Method: s.Method, URL: u.String(), Header: s.Header, Host: s.Host}
+	switch {
+	case s.BodyFile != "":
+		bodyFile := s.BodyFile
+		if !filepath.IsAbs(bodyFile) {
+			bodyFile = filepath.Join(dir, bodyFile)
+		}
+		if req.Body, err = ioutil.ReadFile(bodyFile); err != nil {
+			return httpsclient.Request{}, fmt.Errorf("unable to read the body: %w", err)
+		}
+	case s.BodyBase64 != "":
+		if req.Body, err = base64.StdEncoding.DecodeString(s.BodyBase64); err != nil {
+			return httpsclient.Request{}, fmt.Errorf("invalid body_base64: %w", err)
+		}
+	default:
+		req.Body = []byte(s.Body)
+	}
+	return req, nil
+}
+
+// replay sends reqs one after the other, in order, returning their responses.
+// Each response's target is the host its request was sent to.
+func replay(client *http.Client, reqs []httpsclient.Request, har *httpsclient.HARRecorder) []response {
+	responses := make([]response, len(reqs))
+	for i, req := range reqs {
+		target := req.URL
+		if u, err := url.Parse(req.URL); err == nil {
+			target = u.Host
+		}
+		start := time.Now()
+		res, body, err := doRequest(context.Background(), client, req, har)
+		responses[i] = response{target: target, res: res, body: body, err: err, elapsed: time.Since(start)}
+	}
+	return responses
+}
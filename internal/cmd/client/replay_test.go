@@ -0,0 +1,129 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+func TestSaveAndLoadRequests(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), maxInlineBody+1)
+	reqs := []httpsclient.Request{
+		{Method: http.MethodGet, URL: "https://localhost:8443/"},
+		{Method: http.MethodPost, URL: "https://localhost:8443/echo", Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("Gopher")},
+		{Method: http.MethodPut, URL: "https://localhost:8443/bin", Body: []byte{0xff, 0x00, 0xfe}},
+		{Method: http.MethodPost, URL: "https://localhost:8443/large", Body: large, Host: "example.com"},
+	}
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	if err := saveRequests(path, reqs); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(saved)), "\n")
+	if len(lines) != len(reqs) {
+		t.Fatalf("got %d saved lines, want one per request", len(lines))
+	}
+	for i, want := range []string{`"body":"Gopher"`, `"body_base64":"/wD+"`, `"body_file":"requests.jsonl.body.4"`} {
+		if !strings.Contains(lines[i+1], want) {
+			t.Errorf("got the saved request %s, want it to include %s", lines[i+1], want)
+		}
+	}
+
+	// The body file is found relative to the saved requests, wherever
+	// they're moved to
+	dir := t.TempDir()
+	for _, name := range []string{"requests.jsonl", "requests.jsonl.body.4"} {
+		if err := os.Rename(filepath.Join(filepath.Dir(path), name), filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := loadRequests(filepath.Join(dir, "requests.jsonl"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs[0].Body = []byte{}
+	if !reflect.DeepEqual(got, reqs) {
+		t.Errorf("got the loaded requests %+v, want the saved ones %+v", got, reqs)
+	}
+
+	got, err = loadRequests(filepath.Join(dir, "requests.jsonl"), "127.0.0.1:9443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[1].URL != "https://127.0.0.1:9443/echo" || got[3].Host != "example.com" {
+		t.Errorf("got the URL %s and Host %q with -replay-host, want the host replaced and the Host header kept", got[1].URL, got[3].Host)
+	}
+}
+
+func TestLoadRequestsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"empty", "", "doesn't contain any requests"},
+		{"not JSON", `{"method":"GET","url":"https://localhost/"}` + "\nGET /\n", "invalid saved request 2"},
+		{"http URL", `{"method":"GET","url":"http://localhost/"}`, "must be an https URL"},
+		{"invalid base64", `{"method":"POST","url":"https://localhost/","body_base64":"!"}`, "invalid body_base64"},
+		{"missing body file", `{"method":"POST","url":"https://localhost/","body_file":"missing"}`, "unable to read the body"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "requests.jsonl")
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadRequests(path, ""); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got the error %v, want one containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var got []string
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got = append(got, r.Method+" "+r.URL.Path+" "+string(body))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	err := saveRequests(path, []httpsclient.Request{
+		{URL: "https://localhost:1/first"},
+		{Method: http.MethodPost, URL: "https://localhost:1/second", Body: []byte("Gopher")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs, err := loadRequests(path, strings.TrimPrefix(ts.URL, "https://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := replay(ts.Client(), reqs, nil)
+	for _, res := range responses {
+		if res.err != nil || res.res.StatusCode != http.StatusOK || res.target != strings.TrimPrefix(ts.URL, "https://") {
+			t.Errorf("got the response %+v, want 200 from %s", res, ts.URL)
+		}
+	}
+	// The requests are sent in order, a saved request without a method is a GET
+	if want := []string{"GET /first ", "POST /second Gopher"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got the requests %q, want %q", got, want)
+	}
+}
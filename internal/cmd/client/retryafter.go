@@ -0,0 +1,39 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/youngkin/gohttps/httpsclient"
+	"github.com/youngkin/gohttps/internal/retryafter"
+)
+
+// retryAdvice describes the Retry-After of a 503 or 429 res, e.g., "the
+// server advises retrying in 5s", "" if it isn't one or hasn't got one.
+func retryAdvice(res httpsclient.Result) string {
+	if !retryafter.Applies(res.StatusCode) {
+		return ""
+	}
+	d, ok, err := retryafter.Get(res.Header, time.Now())
+	switch {
+	case !ok:
+		return ""
+	case err != nil:
+		return fmt.Sprintf("the server's advice on when to retry is unusable: %s", err)
+	case d == 0:
+		return "the server advises retrying now"
+	}
+	return fmt.Sprintf("the server advises retrying in %s", d.Round(time.Second))
+}
+
+// printRetryAdvice prints res's retryAdvice, if it's got one, to w.
+func printRetryAdvice(w io.Writer, res httpsclient.Result) {
+	if advice := retryAdvice(res); advice != "" {
+		fmt.Fprintf(w, "\tRetry-After: %s\n", advice)
+	}
+}
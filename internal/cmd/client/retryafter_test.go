@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youngkin/gohttps/httpsclient"
+)
+
+func TestRetryAdvice(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   int
+		value  string
+		want   string
+		assert bool
+	}{
+		{"503", http.StatusServiceUnavailable, "5", "the server advises retrying in 5s", true},
+		// An HTTP-date is only precise to the second, so it's 2m0s or 1m59s
+		{"429 date", http.StatusTooManyRequests, time.Now().Add(2 * time.Minute).UTC().Format(http.TimeFormat), "the server advises retrying in ", false},
+		{"now", http.StatusServiceUnavailable, "0", "the server advises retrying now", false},
+		{"malformed", http.StatusServiceUnavailable, "soon", `the server's advice on when to retry is unusable: invalid Retry-After "soon"`, false},
+		{"missing", http.StatusServiceUnavailable, "", "", false},
+		{"not a 503 or 429", http.StatusInternalServerError, "5", "", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := httpsclient.Result{StatusCode: tc.code, Header: http.Header{}}
+			if tc.value != "" {
+				res.Header.Set("Retry-After", tc.value)
+			}
+			got := retryAdvice(res)
+			if !strings.HasPrefix(got, tc.want) || (tc.want == "") != (got == "") {
+				t.Errorf("got the advice %q, want %q", got, tc.want)
+			}
+
+			var out strings.Builder
+			printRetryAdvice(&out, res)
+			if want := "\tRetry-After: " + got + "\n"; got == "" && out.Len() != 0 || got != "" && out.String() != want {
+				t.Errorf("got %q printed, want %q", out.String(), want)
+			}
+
+			// A failed status assertion includes the advice
+			if tc.assert {
+				failures := assertions{status: http.StatusOK}.check(res, nil)
+				if len(failures) != 1 || strings.Contains(failures[0], "advises") != (tc.want != "") {
+					t.Errorf("got the failures %q, want the advice included only if there is one", failures)
+				}
+			}
+		})
+	}
+}
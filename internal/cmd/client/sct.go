@@ -0,0 +1,51 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/youngkin/gohttps/httpsclient"
+	"github.com/youngkin/gohttps/internal/sct"
+)
+
+// serverSCTs returns the SCTs the server presented in the TLS handshake and
+// those embedded in its certificate.
+func serverSCTs(res httpsclient.Result) (handshake, embedded []sct.SCT, err error) {
+	if res.TLS == nil {
+		return nil, nil, nil
+	}
+	handshake, err = sct.FromConnection(res.TLS.SignedCertificateTimestamps)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse the SCTs from the TLS handshake: %w", err)
+	}
+	if len(res.TLS.PeerCertificates) > 0 {
+		embedded, err = sct.FromCertificate(res.TLS.PeerCertificates[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to parse the SCTs embedded in the server certificate: %w", err)
+		}
+	}
+	return handshake, embedded, nil
+}
+
+// printSCTs prints the SCTs presented by the server, for -show-sct.
+func printSCTs(w io.Writer, res httpsclient.Result) {
+	handshake, embedded, err := serverSCTs(res)
+	if err != nil {
+		fmt.Fprintf(w, "\tSCTs: %s\n", err)
+		return
+	}
+	if len(handshake) == 0 && len(embedded) == 0 {
+		fmt.Fprintf(w, "\tSCTs: none\n")
+		return
+	}
+	for _, s := range handshake {
+		fmt.Fprintf(w, "\tSCT from the TLS handshake: %s\n", s)
+	}
+	for _, s := range embedded {
+		fmt.Fprintf(w, "\tSCT embedded in the certificate: %s\n", s)
+	}
+}
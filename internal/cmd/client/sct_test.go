@@ -0,0 +1,76 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/youngkin/gohttps/httpsclient"
+	"github.com/youngkin/gohttps/internal/sct"
+)
+
+// serializedSCT is an SCT from the log whose ID is all 1s, timestamped
+// 2020-09-13T12:26:40Z.
+var serializedSCT = append(append(append([]byte{sct.Version1}, bytes.Repeat([]byte{1}, 32)...),
+	0, 0, 1, 0x74, 0x87, 0x6e, 0x80, 0x7b, // timestamp
+	0, 0, // extensions
+	4, 3, // sha256, ecdsa
+	0, 3), "sig"...)
+
+// embedSCT returns a certificate with serializedSCT embedded in it.
+func embedSCT(t *testing.T) *x509.Certificate {
+	t.Helper()
+	list := append([]byte{0, byte(len(serializedSCT) + 2), 0, byte(len(serializedSCT))}, serializedSCT...)
+	value, err := asn1.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &x509.Certificate{Extensions: []pkix.Extension{{Id: sct.OIDExtension, Value: value}}}
+}
+
+func TestPrintSCTs(t *testing.T) {
+	const want = "log ID AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=, timestamp 2020-09-13T12:26:40Z"
+	tests := []struct {
+		name  string
+		state *tls.ConnectionState
+		want  []string
+	}{
+		{"plain HTTP", nil, []string{"\tSCTs: none"}},
+		{"none", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{}}}, []string{"\tSCTs: none"}},
+		{"handshake", &tls.ConnectionState{SignedCertificateTimestamps: [][]byte{serializedSCT}}, []string{"\tSCT from the TLS handshake: " + want}},
+		{"both", &tls.ConnectionState{SignedCertificateTimestamps: [][]byte{serializedSCT}, PeerCertificates: []*x509.Certificate{embedSCT(t)}}, []string{
+			"\tSCT from the TLS handshake: " + want,
+			"\tSCT embedded in the certificate: " + want,
+		}},
+		{"malformed", &tls.ConnectionState{SignedCertificateTimestamps: [][]byte{serializedSCT[:10]}}, []string{"\tSCTs: unable to parse the SCTs from the TLS handshake: truncated SCT"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var b strings.Builder
+			printSCTs(&b, httpsclient.Result{TLS: tc.state})
+			if got := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got the lines %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAssertionsRequireSCT(t *testing.T) {
+	a := assertions{requireSCT: true}
+	if got := a.check(httpsclient.Result{TLS: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{embedSCT(t)}}}, nil); got != nil {
+		t.Errorf("got the failures %q for an embedded SCT, want none", got)
+	}
+	got := a.check(httpsclient.Result{TLS: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{}}}}, nil)
+	if len(got) != 1 || !strings.Contains(got[0], "the server presented none") {
+		t.Errorf("got the failures %q without SCTs, want one explaining there are none", got)
+	}
+}
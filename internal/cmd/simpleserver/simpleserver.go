@@ -0,0 +1,148 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package simpleserver implements the simple server command, an HTTPS server
+// with a minimal TLS configuration. Like the advanced server it shuts down
+// gracefully on SIGTERM or SIGINT.
+package simpleserver
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/certs"
+	"github.com/youngkin/gohttps/internal/cli"
+	"github.com/youngkin/gohttps/internal/listen"
+	"github.com/youngkin/gohttps/internal/logging"
+	"github.com/youngkin/gohttps/internal/middleware"
+	"github.com/youngkin/gohttps/internal/srv"
+	"github.com/youngkin/gohttps/internal/version"
+)
+
+// Main runs the simple server. name is the name the command was invoked as
+// and args are the command line arguments following it.
+func Main(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	help := fs.Bool("help", false, "Optional, prints usage info")
+	showVersion := fs.Bool("version", false, "Optional, prints the build version and exits")
+	host := fs.String("host", "", "Required flag, must be the hostname that is resolvable via DNS, or 'localhost'")
+	port := fs.String("port", "443", "The https port, defaults to 443")
+	portFile := fs.String("port-file", "", "Optional, the name of a file to write the port the server is listening on to, e.g., with -port 0")
+	var certFlags cli.ServerCertFlags
+	certFlags.Register(fs)
+	var logFlags cli.LogFlags
+	logFlags.Register(fs)
+	var dumpFlags cli.DumpFlags
+	dumpFlags.Register(fs)
+	fs.Parse(args)
+
+	usage := fmt.Sprintf(`usage:
+	
+%s -host <hostname> -srvcert <serverCertFile> -srvkey <serverPrivateKeyFile> [-chain <chainFile> -port <port> -port-file <file> -srvkey-pass <passphrase> -srvkey-pass-file <passphraseFile> -log-level <level> -verbose -quiet
+	-log-format <format> -log-color <mode> -dump-http -dump-http-max-body <bytes> -version -help]
+	
+Options:
+  -help       Prints this message
+  -version    Optional, prints the build version, commit, date, and Go version and exits
+  -host       Required, a DNS resolvable host name or 'localhost'
+  -port       Optional, the https port for the server to listen on, defaults to 443. 0
+              listens on a free port chosen by the system, which is logged, e.g., for tests
+  -port-file  Optional, the name of a file to write the port the server is listening on to,
+              followed by a newline, once it's listening, e.g., for a test harness using
+              -port 0 to read. The file is replaced, not partially written, so it can be
+              polled for
+%s
+%s
+%s
+
+%s
+
+%s
+  `, name, cli.ServerCertUsage, cli.LogUsage, cli.DumpUsage, cli.SourceUsage, cli.ListenExitUsage)
+
+	if *help == true {
+		fmt.Println(usage)
+		return
+	}
+	if *showVersion {
+		fmt.Printf("%s %s\n", name, version.Get())
+		return
+	}
+	if err := logFlags.Setup(); err != nil {
+		log.Fatalf("%s\n%s", err, usage)
+	}
+	if *host == "" {
+		logging.Fatalf("One or more required fields missing:\n%s", usage)
+	}
+	dumper, err := dumpFlags.Writer()
+	if err != nil {
+		logging.Fatalf("%s\n%s", err, usage)
+	}
+
+	if err := certs.CheckSources(certFlags.Cert, certFlags.Key, certFlags.Chain); err != nil {
+		logging.Fatalf("%s\n%s", err, usage)
+	}
+	loadCert, err := certFlags.Loader()
+	if err != nil {
+		logging.Fatalf("%s\n%s", err, usage)
+	}
+	cert, err := loadCert()
+	if err != nil {
+		logging.Fatalf("%s\n%s", err, usage)
+	}
+
+	mux := http.NewServeMux()
+	var handler http.Handler = mux
+	if dumper != nil {
+		handler = middleware.Dump(dumper, handler)
+	}
+	server := &http.Server{
+		Addr:         ":" + *port,
+		Handler:      handler,
+		ReadTimeout:  5 * time.Minute, // 5 min to allow for delays when 'curl' on OSx prompts for username/password
+		WriteTimeout: 10 * time.Second,
+		TLSConfig:    &tls.Config{ServerName: *host, Certificates: []tls.Certificate{cert}},
+	}
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		logging.Debugf("Received %s request for host %s from IP address %s and X-FORWARDED-FOR %s",
+			r.Method, r.Host, r.RemoteAddr, r.Header.Get("X-FORWARDED-FOR"))
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			body = []byte(fmt.Sprintf("error reading request body: %s", err))
+		}
+		resp := fmt.Sprintf("Hello, %s from Simple Server!", body)
+		w.Write([]byte(resp))
+		logging.Debugf("SimpleServer: Sent response %s", resp)
+	})
+
+	// The listener is created first so failures can be explained, and the
+	// port chosen by the system for -port 0 logged
+	ln, err := listen.Config{}.Listen(server.Addr)
+	if err != nil {
+		msg, status := listen.Explain(err, server.Addr, "-port")
+		logging.Errorf("%s", msg)
+		os.Exit(status)
+	}
+	log.Printf("Starting HTTPS server on host %s and port %d", *host, listen.Port(ln))
+	if *portFile != "" {
+		if err := listen.WritePortFile(*portFile, ln); err != nil {
+			logging.Fatalf("%s", err)
+		}
+	}
+	// SIGTERM and SIGINT stop the server gracefully, letting in-flight requests
+	// finish. The certificate is already in TLSConfig so no files are passed
+	// here.
+	if err := srv.RunWithGracefulShutdown(context.Background(), server, "", "", srv.Options{Listener: ln}); err != nil {
+		logging.Fatalf("%s", err)
+	}
+	log.Printf("Server stopped")
+}
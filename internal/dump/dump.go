@@ -0,0 +1,196 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package dump writes HTTP messages, as they're sent on the wire, for people
+// to read, e.g., to show what a client and server actually exchange. The
+// values of sensitive headers are redacted, bodies are truncated, and bodies
+// that wouldn't be readable, i.e., compressed or binary ones, are labeled
+// rather than written.
+package dump
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/youngkin/gohttps/internal/redact"
+)
+
+// DefaultMaxBody is the default number of bytes of each body written.
+const DefaultMaxBody = 4096
+
+// Writer writes dumps of HTTP messages to an io.Writer. It's safe for
+// concurrent use, each message is written in one piece so the dumps of
+// concurrent requests don't interleave.
+type Writer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	maxBody int
+}
+
+// NewWriter returns a Writer that writes to w, and writes at most maxBody
+// bytes of each body, DefaultMaxBody if maxBody isn't positive.
+func NewWriter(w io.Writer, maxBody int) *Writer {
+	if maxBody <= 0 {
+		maxBody = DefaultMaxBody
+	}
+	return &Writer{w: w, maxBody: maxBody}
+}
+
+// MaxBody returns the maximum number of bytes of each body written.
+func (d *Writer) MaxBody() int {
+	return d.maxBody
+}
+
+// Peek reads the start of body, up to one byte more than MaxBody so whether
+// it's truncated can be told, and returns it along with a replacement for
+// body that reads the whole body, starting with the bytes already read. An
+// error reading body is returned by the replacement's Read once the bytes
+// read before it are.
+func (d *Writer) Peek(body io.ReadCloser) ([]byte, io.ReadCloser) {
+	start, err := io.ReadAll(io.LimitReader(body, int64(d.maxBody)+1))
+	var rest io.Reader = body
+	if err != nil {
+		rest = errReader{err}
+	}
+	return start, peekedBody{io.MultiReader(bytes.NewReader(start), rest), body}
+}
+
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// Request writes r, a request received by a server or, if out is true, one
+// sent by a client, headed by title. body is the start of its body, see
+// Peek. Outgoing requests include the headers the http.Transport adds, e.g.,
+// User-Agent and Accept-Encoding, and are shown in HTTP/1.1 form even if
+// they're sent using HTTP/2.
+func (d *Writer) Request(title string, r *http.Request, out bool, body []byte) {
+	// Dumping an outgoing request sends it to a fake connection, so it's done
+	// without r's context, which may trace the real request's connection
+	c := r.Clone(context.Background())
+	c.Header = redact.Header(r.Header)
+	var head []byte
+	var err error
+	if out {
+		head, err = httputil.DumpRequestOut(c, false)
+	} else {
+		head, err = httputil.DumpRequest(c, false)
+	}
+	if err != nil {
+		head = []byte(fmt.Sprintf("[unable to dump the request: %s]\r\n\r\n", err))
+	}
+	d.write(title, head, d.body(r.Header, len(r.TransferEncoding) > 0, false, body))
+}
+
+// Response writes resp, a response received by a client, headed by title.
+// body is the start of its body, see Peek.
+func (d *Writer) Response(title string, resp *http.Response, body []byte) {
+	c := *resp
+	c.Header = redact.Header(resp.Header)
+	head, err := httputil.DumpResponse(&c, false)
+	if err != nil {
+		head = []byte(fmt.Sprintf("[unable to dump the response: %s]\r\n\r\n", err))
+	}
+	d.write(title, head, d.body(resp.Header, len(resp.TransferEncoding) > 0, resp.Uncompressed, body))
+}
+
+// Written writes a response written by a server's handler, headed by title.
+// proto is the request's protocol, status and header are what the handler
+// wrote, and body is the start of what it wrote, at least one byte more than
+// MaxBody if it wrote more. Headers net/http adds as the response is sent,
+// e.g., Date, aren't included.
+func (d *Writer) Written(title, proto string, status int, header http.Header, body []byte) {
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "%s %03d %s\r\n", proto, status, http.StatusText(status))
+	redact.Header(header).Write(&head)
+	head.WriteString("\r\n")
+	d.write(title, head.Bytes(), d.body(header, false, false, body))
+}
+
+// body formats body, the start of a message body with header, for display.
+// chunked is whether it was sent chunked, and so has had the chunk framing
+// removed, and uncompressed whether it was transparently decompressed.
+func (d *Writer) body(header http.Header, chunked, uncompressed bool, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	truncated := len(body) > d.maxBody
+	size := fmt.Sprintf("%d bytes", len(body))
+	if truncated {
+		body = body[:d.maxBody]
+		size = fmt.Sprintf("more than %d bytes", d.maxBody)
+	}
+
+	var b strings.Builder
+	if enc := header.Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") {
+		fmt.Fprintf(&b, "[%s of %s encoded body not shown]\n", size, enc)
+		return b.String()
+	}
+	if !printable(body, truncated) {
+		fmt.Fprintf(&b, "[%s of binary body not shown]\n", size)
+		return b.String()
+	}
+	if chunked {
+		b.WriteString("[chunked body, shown without its chunk framing]\n")
+	}
+	if uncompressed {
+		b.WriteString("[gzip encoded body, shown decompressed]\n")
+	}
+	b.Write(body)
+	if body[len(body)-1] != '\n' {
+		b.WriteString("\n")
+	}
+	if truncated {
+		fmt.Fprintf(&b, "[truncated at %d bytes]\n", d.maxBody)
+	}
+	return b.String()
+}
+
+// printable returns whether body is text, i.e., valid UTF-8 without control
+// characters other than whitespace. If body is truncated a partial rune at
+// its end is allowed.
+func printable(body []byte, truncated bool) bool {
+	if truncated {
+		i := len(body) - 1
+		for i > 0 && i > len(body)-utf8.UTFMax && !utf8.RuneStart(body[i]) {
+			i--
+		}
+		if !utf8.FullRune(body[i:]) {
+			body = body[:i]
+		}
+	}
+	if !utf8.Valid(body) {
+		return false
+	}
+	for _, c := range body {
+		if c < ' ' && c != '\t' && c != '\n' && c != '\r' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Writer) write(title string, head []byte, body string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "---- %s ----\n", title)
+	b.WriteString(strings.ReplaceAll(string(head), "\r\n", "\n"))
+	b.WriteString(body)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	io.WriteString(d.w, b.String())
+}
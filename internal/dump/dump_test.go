@@ -0,0 +1,114 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package dump
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// checkDump checks that got contains each of want and none of notWant.
+func checkDump(t *testing.T, got string, want, notWant []string) {
+	t.Helper()
+	for _, s := range want {
+		if !strings.Contains(got, s) {
+			t.Errorf("the dump doesn't contain %q:\n%s", s, got)
+		}
+	}
+	for _, s := range notWant {
+		if strings.Contains(got, s) {
+			t.Errorf("the dump contains %q:\n%s", s, got)
+		}
+	}
+}
+
+func TestRequest(t *testing.T) {
+	var out bytes.Buffer
+	d := NewWriter(&out, 10)
+	r := httptest.NewRequest(http.MethodPost, "/items?color=blue", strings.NewReader("0123456789abcdef"))
+	r.Header.Set("Content-Type", "text/plain")
+	r.Header.Set("Authorization", "Bearer s3cret-token")
+	r.Header.Set("Cookie", "session=c00kie")
+	var body []byte
+	body, r.Body = d.Peek(r.Body)
+	d.Request("request 1", r, false, body)
+
+	checkDump(t, out.String(), []string{
+		"---- request 1 ----\n",
+		"POST /items?color=blue HTTP/1.1\n",
+		"Content-Type: text/plain\n",
+		"Authorization: [REDACTED]\n",
+		"Cookie: [REDACTED]\n",
+		"\n0123456789\n[truncated at 10 bytes]\n",
+	}, []string{"s3cret-token", "c00kie", "abcdef", "\r\n"})
+
+	// The whole body can still be read
+	if b, err := io.ReadAll(r.Body); err != nil || string(b) != "0123456789abcdef" {
+		t.Errorf("got the body %q and the error %v after peeking, want the whole body", b, err)
+	}
+}
+
+func TestRequestOut(t *testing.T) {
+	var out bytes.Buffer
+	d := NewWriter(&out, DefaultMaxBody)
+	r, err := http.NewRequest(http.MethodGet, "https://example.com/items", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("X-Api-Key", "k3y")
+	d.Request("request", r, true, nil)
+	checkDump(t, out.String(), []string{"GET /items HTTP/1.1\n", "Host: example.com\n", "X-Api-Key: [REDACTED]\n"}, []string{"k3y"})
+}
+
+func TestResponse(t *testing.T) {
+	var out bytes.Buffer
+	d := NewWriter(&out, 8)
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Set-Cookie": {"session=c00kie"}, "Content-Type": {"text/plain"}},
+		Body:       io.NopCloser(strings.NewReader("Hello, Gopher")),
+	}
+	var body []byte
+	body, resp.Body = d.Peek(resp.Body)
+	d.Response("response 1", resp, body)
+	checkDump(t, out.String(), []string{
+		"---- response 1 ----\n",
+		"HTTP/1.1 200 OK\n",
+		"Set-Cookie: [REDACTED]\n",
+		"\nHello, G\n[truncated at 8 bytes]\n",
+	}, []string{"c00kie", "Gopher"})
+}
+
+func TestWrittenBodies(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		want   string
+	}{
+		{"text", http.Header{}, "Hello", "\nHello\n"},
+		{"truncated", http.Header{}, "Hello, Gopher", "\nHello, G\n[truncated at 8 bytes]\n"},
+		{"encoded", http.Header{"Content-Encoding": {"gzip"}}, "\x1f\x8b\x08\x00", "[4 bytes of gzip encoded body not shown]\n"},
+		{"binary", http.Header{}, "\x00\x01\x02", "[3 bytes of binary body not shown]\n"},
+		{"truncated binary", http.Header{}, "\x00\x01\x02\x03\x04\x05\x06\x07\x08", "[more than 8 bytes of binary body not shown]\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			NewWriter(&out, 8).Written("response", "HTTP/2.0", http.StatusOK, tc.header, []byte(tc.body))
+			if got := out.String(); !strings.HasPrefix(got, "---- response ----\nHTTP/2.0 200 OK\n") || !strings.HasSuffix(got, tc.want) {
+				t.Errorf("got the dump %q, want it to end with %q", got, tc.want)
+			}
+		})
+	}
+}
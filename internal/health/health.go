@@ -0,0 +1,84 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package health serves the /healthz and /readyz endpoints used by load
+// balancers and orchestrators to probe the servers.
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// Paths of the health endpoints.
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// Status tracks whether the server is ready to receive requests. The zero
+// value is not ready.
+type Status struct {
+	ready     atomic.Bool
+	remaining atomic.Pointer[func() int]
+	reason    atomic.Pointer[string]
+}
+
+// SetReady sets whether the server is ready, e.g., false while it's shutting down.
+func (s *Status) SetReady(ready bool) {
+	s.ready.Store(ready)
+}
+
+// SetDraining marks the server as not ready because it's shutting down.
+// remaining returns the number of connections still being drained, which
+// /readyz includes in its response so orchestrators can watch the drain.
+func (s *Status) SetDraining(remaining func() int) {
+	s.remaining.Store(&remaining)
+	s.ready.Store(false)
+}
+
+// SetNotReady marks the server as not ready for reason, e.g., its
+// certificate is about to expire, which /readyz includes in its response,
+// until it's called with an empty reason. Unlike SetReady(false) it's
+// independent of the server's own readiness, which applies again once the
+// reason is cleared.
+func (s *Status) SetNotReady(reason string) {
+	if reason == "" {
+		s.reason.Store(nil)
+		return
+	}
+	s.reason.Store(&reason)
+}
+
+// Ready returns whether the server is ready.
+func (s *Status) Ready() bool {
+	return s.ready.Load() && s.reason.Load() == nil
+}
+
+// Handler returns a handler serving only the health endpoints. /healthz
+// responds with 200 as long as the server is running, and /readyz with 200 if
+// the server is ready or 503 if it isn't, including the number of connections
+// remaining if it's draining. Every other path is a 404, so the
+// handler can be exposed without exposing any of the server's other routes.
+func (s *Status) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(LivenessPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc(ReadinessPath, func(w http.ResponseWriter, r *http.Request) {
+		if !s.Ready() {
+			msg := "not ready"
+			if remaining := s.remaining.Load(); remaining != nil {
+				msg = fmt.Sprintf("not ready, draining, %d connections remaining", (*remaining)())
+			} else if reason := s.reason.Load(); reason != nil {
+				msg = "not ready, " + *reason
+			}
+			http.Error(w, msg, http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ready\n"))
+	})
+	return mux
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package health
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// get requests path from ts, returning the status code and body.
+func get(t *testing.T, ts *httptest.Server, method, path string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(body)
+}
+
+// TestHandlerOnlyServesHealth serves the handler the way -healthcheck-bypass
+// does, on a plain HTTP listener of its own, and checks none of the server's
+// other routes are reachable through it.
+func TestHandlerOnlyServesHealth(t *testing.T) {
+	var s Status
+	s.SetReady(true)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	for _, path := range []string{LivenessPath, ReadinessPath} {
+		if code, _ := get(t, ts, http.MethodGet, path); code != http.StatusOK {
+			t.Errorf("got status %d for %s, want 200", code, path)
+		}
+	}
+	for _, path := range []string{"/", "/echo", "/status", "/metrics", "/handshake-failures", "/healthz/", "/healthz/../echo", "/readyz/x"} {
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			if code, _ := get(t, ts, method, path); code != http.StatusNotFound {
+				t.Errorf("got status %d for %s %s, want 404", code, method, path)
+			}
+		}
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	var s Status
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		update func()
+		code   int
+		body   string
+	}{
+		{"not ready initially", func() {}, http.StatusServiceUnavailable, "not ready"},
+		{"ready", func() { s.SetReady(true) }, http.StatusOK, "ready"},
+		{"not ready for a reason", func() { s.SetNotReady("the certificate expires in 1h") }, http.StatusServiceUnavailable, "not ready, the certificate expires in 1h"},
+		{"the reason cleared", func() { s.SetNotReady("") }, http.StatusOK, "ready"},
+		{"draining", func() { s.SetDraining(func() int { return 3 }) }, http.StatusServiceUnavailable, "not ready, draining, 3 connections remaining"},
+	}
+	for _, tc := range tests {
+		tc.update()
+		code, body := get(t, ts, http.MethodGet, ReadinessPath)
+		if code != tc.code || strings.TrimSpace(body) != tc.body {
+			t.Errorf("%s: got %d %q, want %d %q", tc.name, code, body, tc.code, tc.body)
+		}
+		if code, _ := get(t, ts, http.MethodGet, LivenessPath); code != http.StatusOK {
+			t.Errorf("%s: got status %d for %s, want 200 while the server's running", tc.name, code, LivenessPath)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package inflight keeps track of a server's connections and the requests in
+// progress on them, for readiness and drain reporting, connection limits, and
+// metrics, including how often TLS sessions are resumed. A Tracker is installed as an http.Server's ConnContext and
+// ConnState hooks and as middleware:
+//
+//	var t inflight.Tracker
+//	srv := &http.Server{Handler: t.Middleware(h), ConnContext: t.ConnContext, ConnState: t.ConnState}
+package inflight
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tracker counts the requests in flight and keeps a registry of the open
+// connections. It's safe for concurrent use, the zero value is ready to use.
+// Connections are removed from the registry when they're closed, including
+// by the server's timeouts, or hijacked, e.g., by a WebSocket upgrade; a
+// hijacked connection's request remains in flight until its handler returns.
+type Tracker struct {
+	// OnHandshake, if not nil, is called with the first request of each TLS
+	// connection, e.g., to log whether r.TLS.DidResume. It must be set before
+	// the server starts.
+	OnHandshake func(r *http.Request)
+
+	inFlight atomic.Int64
+	// full and resumed count the TLS connections whose first request was seen
+	// by Middleware, by whether their handshake resumed a session.
+	full    atomic.Uint64
+	resumed atomic.Uint64
+
+	mu      sync.Mutex
+	conns   map[net.Conn]*conn
+	waiters []chan struct{}
+}
+
+// conn is the registry entry of a connection. The entry is also stored in
+// the connection's context so requests can find it without a map lookup,
+// and keep using it after it's been removed from the registry.
+type conn struct {
+	remoteAddr string
+	opened     time.Time
+	state      atomic.Int32
+	requests   atomic.Int64
+	inFlight   atomic.Int64
+}
+
+type connKey struct{}
+
+// ConnSnapshot describes an open connection.
+type ConnSnapshot struct {
+	RemoteAddr string
+	Opened     time.Time
+	State      http.ConnState
+	// Requests is the number of requests received on the connection, and
+	// InFlight how many of those are in progress.
+	Requests int64
+	InFlight int64
+}
+
+// Snapshot is the state of a Tracker at a point in time.
+type Snapshot struct {
+	// InFlight is the number of requests in progress, across all
+	// connections, including those on hijacked connections.
+	InFlight int64
+	// Open is the number of open connections, of which Active have a
+	// request in progress.
+	Open   int
+	Active int
+	// Conns are the open connections, sorted by remote address.
+	Conns []ConnSnapshot
+}
+
+// ConnContext is an http.Server.ConnContext hook that registers c.
+func (t *Tracker) ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, t.register(c))
+}
+
+// ConnState is an http.Server.ConnState hook that records c's state,
+// removing it from the registry once it's closed or hijacked.
+func (t *Tracker) ConnState(c net.Conn, state http.ConnState) {
+	if state == http.StateClosed || state == http.StateHijacked {
+		t.mu.Lock()
+		delete(t.conns, c)
+		t.mu.Unlock()
+		return
+	}
+	t.register(c).state.Store(int32(state))
+}
+
+// register returns c's entry, adding it to the registry if necessary.
+func (t *Tracker) register(c net.Conn) *conn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conns == nil {
+		t.conns = map[net.Conn]*conn{}
+	}
+	e, ok := t.conns[c]
+	if !ok {
+		e = &conn{remoteAddr: c.RemoteAddr().String(), opened: time.Now()}
+		t.conns[c] = e
+	}
+	return e
+}
+
+// Middleware returns a handler that counts the requests in flight while next
+// handles them, and the TLS handshakes, by whether they resumed a session,
+// when the first request of their connection arrives, since the handshake
+// state is only available on requests. Requests whose context doesn't come
+// from ConnContext, e.g., HTTP/3 requests, are only included in the total.
+func (t *Tracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := r.Context().Value(connKey{}).(*conn)
+		t.inFlight.Add(1)
+		if c != nil {
+			if c.requests.Add(1) == 1 && r.TLS != nil {
+				t.handshake(r)
+			}
+			c.inFlight.Add(1)
+		}
+		defer func() {
+			if c != nil {
+				c.inFlight.Add(-1)
+			}
+			if t.inFlight.Add(-1) == 0 {
+				t.notifyWaiters()
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *Tracker) handshake(r *http.Request) {
+	if r.TLS.DidResume {
+		t.resumed.Add(1)
+	} else {
+		t.full.Add(1)
+	}
+	if t.OnHandshake != nil {
+		t.OnHandshake(r)
+	}
+}
+
+// Handshakes returns the number of TLS connections, that received a request,
+// whose handshake was a full one, and the number whose handshake resumed a
+// session.
+func (t *Tracker) Handshakes() (full, resumed uint64) {
+	return t.full.Load(), t.resumed.Load()
+}
+
+// InFlight returns the number of requests in progress.
+func (t *Tracker) InFlight() int64 {
+	return t.inFlight.Load()
+}
+
+// Open returns the number of open connections.
+func (t *Tracker) Open() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.conns)
+}
+
+// Snapshot returns the current state of the tracker.
+func (t *Tracker) Snapshot() Snapshot {
+	t.mu.Lock()
+	s := Snapshot{InFlight: t.inFlight.Load(), Open: len(t.conns), Conns: make([]ConnSnapshot, 0, len(t.conns))}
+	for _, c := range t.conns {
+		cs := ConnSnapshot{
+			RemoteAddr: c.remoteAddr,
+			Opened:     c.opened,
+			State:      http.ConnState(c.state.Load()),
+			Requests:   c.requests.Load(),
+			InFlight:   c.inFlight.Load(),
+		}
+		if cs.State == http.StateActive {
+			s.Active++
+		}
+		s.Conns = append(s.Conns, cs)
+	}
+	t.mu.Unlock()
+	sort.Slice(s.Conns, func(i, j int) bool { return s.Conns[i].RemoteAddr < s.Conns[j].RemoteAddr })
+	return s
+}
+
+// Wait waits until no requests are in flight, e.g., for hijacked connections
+// to finish after http.Server.Shutdown, which doesn't track them, returns.
+// It returns ctx.Err() if ctx is done first.
+func (t *Tracker) Wait(ctx context.Context) error {
+	t.mu.Lock()
+	if t.inFlight.Load() == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	done := make(chan struct{})
+	t.waiters = append(t.waiters, done)
+	t.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// notifyWaiters wakes the callers of Wait. It's called after the count
+// reaches 0, and Wait checks the count while holding mu, so a waiter can't
+// miss its notification.
+func (t *Tracker) notifyWaiters() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.inFlight.Load() != 0 {
+		return
+	}
+	for _, done := range t.waiters {
+		close(done)
+	}
+	t.waiters = nil
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package inflight
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newServer returns a server tracked by t handling requests with h.
+func newServer(tb testing.TB, t *Tracker, h http.Handler) *httptest.Server {
+	tb.Helper()
+	ts := httptest.NewUnstartedServer(t.Middleware(h))
+	ts.Config.ConnContext = t.ConnContext
+	ts.Config.ConnState = t.ConnState
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	return ts
+}
+
+// waitFor waits for cond to become true.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+// get sends a GET request to url with client, returning its error.
+func get(client *http.Client, url string) error {
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	return res.Body.Close()
+}
+
+func TestTracker(t *testing.T) {
+	var tracker Tracker
+	release := make(chan struct{})
+	ts := newServer(t, &tracker, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/wait" {
+			<-release
+		}
+	}))
+	ts.Start()
+	defer ts.Close()
+
+	// Two connections, each with a request in progress
+	clients := []*http.Client{{Transport: &http.Transport{}}, {Transport: &http.Transport{}}}
+	errs := make(chan error, len(clients))
+	for _, client := range clients {
+		defer client.CloseIdleConnections()
+		go func(client *http.Client) { errs <- get(client, ts.URL+"/wait") }(client)
+	}
+	waitFor(t, "2 requests in flight", func() bool { return tracker.InFlight() == 2 })
+
+	s := tracker.Snapshot()
+	if s.InFlight != 2 || s.Open != 2 || s.Active != 2 || len(s.Conns) != 2 {
+		t.Fatalf("got %d in flight, %d open and %d active connections, want 2 of each", s.InFlight, s.Open, s.Active)
+	}
+	if s.Conns[0].RemoteAddr > s.Conns[1].RemoteAddr {
+		t.Errorf("got the connections %s and %s, want them sorted by remote address", s.Conns[0].RemoteAddr, s.Conns[1].RemoteAddr)
+	}
+	for _, c := range s.Conns {
+		if c.State != http.StateActive || c.Requests != 1 || c.InFlight != 1 || c.Opened.IsZero() {
+			t.Errorf("got the connection %+v, want an active one with 1 request in flight", c)
+		}
+	}
+
+	close(release)
+	for range clients {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "the requests to complete", func() bool { return tracker.InFlight() == 0 })
+	// The connections are kept alive, the next request is the second on one
+	if err := get(clients[0], ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the connections to be idle", func() bool { return tracker.Snapshot().Active == 0 })
+	s = tracker.Snapshot()
+	if s.Open != 2 || s.Conns[0].Requests+s.Conns[1].Requests != 3 {
+		t.Errorf("got %d open connections with %d and %d requests, want 2 with 3 in total", s.Open, s.Conns[0].Requests, s.Conns[1].Requests)
+	}
+	for _, c := range s.Conns {
+		if c.State != http.StateIdle || c.InFlight != 0 {
+			t.Errorf("got the connection %+v, want an idle one", c)
+		}
+	}
+
+	for _, client := range clients {
+		client.CloseIdleConnections()
+	}
+	waitFor(t, "the closed connections to be removed", func() bool { return tracker.Open() == 0 })
+}
+
+func TestTrackerWait(t *testing.T) {
+	var tracker Tracker
+	if err := tracker.Wait(context.Background()); err != nil {
+		t.Fatalf("waiting without requests in flight failed: %s", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	<-started
+
+	// A request without a connection from ConnContext is only in the total
+	if s := tracker.Snapshot(); s.InFlight != 1 || s.Open != 0 {
+		t.Errorf("got %d in flight and %d open connections, want 1 and 0", s.InFlight, s.Open)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := tracker.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got %v waiting with a request in flight, want %v", err, context.DeadlineExceeded)
+	}
+
+	waited := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { waited <- tracker.Wait(context.Background()) }()
+	}
+	select {
+	case err := <-waited:
+		t.Fatalf("Wait returned %v with a request in flight", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-done
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-waited:
+			if err != nil {
+				t.Errorf("got %v waiting, want nil", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Wait didn't return after the request completed")
+		}
+	}
+}
+
+// TestTrackerHijack checks a hijacked connection leaves the registry while
+// its request remains in flight until the handler returns.
+func TestTrackerHijack(t *testing.T) {
+	var tracker Tracker
+	hijacked := make(chan struct{})
+	release := make(chan struct{})
+	ts := newServer(t, &tracker, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		close(hijacked)
+		<-release
+	}))
+	ts.Start()
+	defer ts.Close()
+
+	go get(ts.Client(), ts.URL)
+	<-hijacked
+	waitFor(t, "the hijacked connection to be removed", func() bool { return tracker.Open() == 0 })
+	if n := tracker.InFlight(); n != 1 {
+		t.Errorf("got %d requests in flight on the hijacked connection, want 1", n)
+	}
+
+	waited := make(chan error, 1)
+	go func() { waited <- tracker.Wait(context.Background()) }()
+	select {
+	case <-waited:
+		t.Fatal("Wait returned while the hijacked connection's handler was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Errorf("got %v waiting, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait didn't return after the hijacked connection's handler returned")
+	}
+}
+
+func TestTrackerHandshakes(t *testing.T) {
+	var tracker Tracker
+	seen := make(chan bool, 4)
+	tracker.OnHandshake = func(r *http.Request) { seen <- r.TLS.DidResume }
+	ts := newServer(t, &tracker, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.StartTLS()
+	defer ts.Close()
+
+	// Each connection sends two requests, only its first is counted, and
+	// the second connection resumes the first one's session
+	tr := ts.Client().Transport.(*http.Transport).Clone()
+	tr.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	client := &http.Client{Transport: tr}
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			if err := get(client, ts.URL); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tr.CloseIdleConnections()
+	}
+
+	if full, resumed := tracker.Handshakes(); full != 1 || resumed != 1 {
+		t.Errorf("got %d full and %d resumed handshakes, want 1 of each", full, resumed)
+	}
+	close(seen)
+	var got []bool
+	for didResume := range seen {
+		got = append(got, didResume)
+	}
+	if len(got) != 2 || got[0] || !got[1] {
+		t.Errorf("got OnHandshake calls with DidResume %v, want [false true]", got)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package listen
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// Exit statuses the servers use when they can't listen, see Explain.
+const (
+	ExitAddrInUse        = 10
+	ExitPermissionDenied = 11
+)
+
+// privilegedPorts is the number of ports, starting at 0, that only
+// privileged processes may listen on.
+const privilegedPorts = 1024
+
+// Explain returns a message explaining why Listen failed to listen on addr
+// with err, suggesting how to fix it, and the exit status a server should use.
+// flag is the option addr was configured with, e.g., '-port', for use in the
+// suggestions. Errors other than the address being in use or permission being
+// denied are returned as is, with an exit status of 1.
+func Explain(err error, addr, flag string) (string, int) {
+	_, port, splitErr := net.SplitHostPort(addr)
+	if splitErr != nil {
+		port = addr
+	}
+	switch {
+	case errors.Is(err, syscall.EADDRINUSE):
+		return fmt.Sprintf("%s. Another program, possibly another instance of this server, is already listening on port %s. "+
+			"Find it with 'lsof -i :%s' or 'ss -ltnp' and stop it, or use %s to pick another port", err, port, port, flag), ExitAddrInUse
+	case errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EPERM) || errors.Is(err, os.ErrPermission):
+		msg := err.Error()
+		if n, convErr := strconv.Atoi(port); convErr == nil && n < privilegedPorts {
+			msg += fmt.Sprintf(". Ports below %d can only be listened on by privileged processes. Use %s to pick a port of %d or higher, "+
+				"or allow the server to listen on low ports, on Linux, with 'sudo setcap cap_net_bind_service=+ep <serverBinary>'",
+				privilegedPorts, flag, privilegedPorts)
+		}
+		return msg, ExitPermissionDenied
+	}
+	return err.Error(), 1
+}
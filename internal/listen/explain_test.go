@@ -0,0 +1,51 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package listen
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	listenErr := func(errno syscall.Errno) error {
+		return &net.OpError{Op: "listen", Net: "tcp", Err: os.NewSyscallError("bind", errno)}
+	}
+	tests := []struct {
+		name     string
+		err      error
+		addr     string
+		want     []string
+		dontWant string
+		status   int
+	}{
+		{"in use", listenErr(syscall.EADDRINUSE), ":8443", []string{"already listening on port 8443", "lsof -i :8443", "use -port to pick"}, "", ExitAddrInUse},
+		{"privileged port", listenErr(syscall.EACCES), "127.0.0.1:443", []string{"permission denied", "Ports below 1024", "setcap cap_net_bind_service"}, "", ExitPermissionDenied},
+		{"unprivileged port", listenErr(syscall.EACCES), ":8443", []string{"permission denied"}, "Ports below 1024", ExitPermissionDenied},
+		{"EPERM", listenErr(syscall.EPERM), ":80", []string{"Ports below 1024"}, "", ExitPermissionDenied},
+		{"port only", listenErr(syscall.EADDRINUSE), "8443", []string{"port 8443"}, "", ExitAddrInUse},
+		{"other", errors.New("address foo: missing port in address"), "foo", []string{"address foo: missing port in address"}, "-port", 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			msg, status := Explain(tc.err, tc.addr, "-port")
+			if status != tc.status {
+				t.Errorf("got the exit status %d, want %d", status, tc.status)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(msg, want) {
+					t.Errorf("got the message %q, want it to include %q", msg, want)
+				}
+			}
+			if tc.dontWant != "" && strings.Contains(msg, tc.dontWant) {
+				t.Errorf("got the message %q, want it not to include %q", msg, tc.dontWant)
+			}
+		})
+	}
+}
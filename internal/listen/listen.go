@@ -0,0 +1,111 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package listen creates the TCP listeners used by the servers, applying
+// socket options that net.Listen doesn't expose.
+package listen
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/youngkin/gohttps/internal/tcpopt"
+)
+
+// Port returns the port ln is listening on, e.g., the one the system chose
+// for port 0.
+func Port(ln net.Listener) int {
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
+}
+
+// WritePortFile writes the port ln is listening on, followed by a newline, to
+// the file name, e.g., for a test harness that starts a server on port 0. The
+// file is written under a temporary name and then renamed, so a harness
+// polling for it never reads it partially written.
+func WritePortFile(name string, ln net.Listener) error {
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(fmt.Sprintf("%d\n", Port(ln))), 0644); err != nil {
+		return fmt.Errorf("unable to write the port file: %w", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("unable to write the port file: %w", err)
+	}
+	return nil
+}
+
+// Config specifies the socket options of the listeners created by Listen.
+type Config struct {
+	// ReusePort sets SO_REUSEPORT on the listening socket, allowing other
+	// processes that also set it to listen on the same address. The kernel
+	// distributes incoming connections among them. It's only supported on
+	// Linux and the BSDs, including macOS.
+	ReusePort bool
+	// TCP are the options applied to the listening socket and the
+	// connections it accepts.
+	TCP tcpopt.Options
+	// RejectPlainHTTP responds to clients that send a plain HTTP request,
+	// instead of starting a TLS handshake, with a 400 response explaining
+	// that the port expects HTTPS, then closes the connection. The TLS
+	// handshake fails with ErrPlainHTTP.
+	RejectPlainHTTP bool
+}
+
+// Listen announces on the TCP address addr using the options in cfg.
+func (cfg Config) Listen(addr string) (net.Listener, error) {
+	lc := net.ListenConfig{Control: cfg.control, KeepAlive: cfg.TCP.KeepAlive}
+	ln, err := lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", addr, err)
+	}
+	if cfg.TCP.Nagle {
+		ln = &listener{Listener: ln, tcp: cfg.TCP}
+	}
+	if cfg.RejectPlainHTTP {
+		ln = &plainHTTPListener{Listener: ln}
+	}
+	return ln, nil
+}
+
+func (cfg Config) control(network, address string, c syscall.RawConn) error {
+	if cfg.ReusePort {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = setReusePort(fd)
+		})
+		if err != nil {
+			return err
+		}
+		if sockErr != nil {
+			return sockErr
+		}
+	}
+	return cfg.TCP.Control(network, address, c)
+}
+
+// listener applies the TCP options that can only be set on established
+// connections to each accepted connection.
+type listener struct {
+	net.Listener
+	tcp tcpopt.Options
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if err := l.tcp.Apply(conn); err != nil {
+		log.Printf("Unable to set TCP options on the connection from %s: %s", conn.RemoteAddr(), err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package listen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenPort(t *testing.T) {
+	ln, err := Config{}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if got, want := Port(ln), ln.Addr().(*net.TCPAddr).Port; got != want || got == 0 {
+		t.Errorf("got the port %d, want %d", got, want)
+	}
+}
+
+func TestWritePortFile(t *testing.T) {
+	ln, err := Config{}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	name := filepath.Join(t.TempDir(), "port")
+	if err := WritePortFile(name, ln); err != nil {
+		t.Fatalf("got the error %s, want nil", err)
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%d\n", Port(ln)); string(b) != want {
+		t.Errorf("got the port file %q, want %q", b, want)
+	}
+	if _, err := os.Stat(name + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("got the error %v for the temporary file, want it renamed", err)
+	}
+
+	if err := WritePortFile(filepath.Join(name, "port"), ln); err == nil {
+		t.Error("writing the port file to a missing directory succeeded")
+	}
+}
+
+func TestListenInUse(t *testing.T) {
+	ln, err := Config{}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if _, err := (Config{}).Listen(ln.Addr().String()); err == nil {
+		t.Error("listening on an address in use succeeded")
+	}
+}
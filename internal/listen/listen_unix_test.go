@@ -0,0 +1,70 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package listen
+
+import (
+	"net"
+	"testing"
+
+	"github.com/youngkin/gohttps/internal/tcpopt"
+	"golang.org/x/sys/unix"
+)
+
+func TestListenInUseExplained(t *testing.T) {
+	ln, err := Config{}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, err = Config{}.Listen(ln.Addr().String())
+	if err == nil {
+		t.Fatal("listening on an address in use succeeded")
+	}
+	if _, status := Explain(err, ln.Addr().String(), "-port"); status != ExitAddrInUse {
+		t.Errorf("got the exit status %d for %q, want %d", status, err, ExitAddrInUse)
+	}
+}
+
+func TestListenTCPOptions(t *testing.T) {
+	ln, err := Config{TCP: tcpopt.Options{Nagle: true, RecvBuffer: 32 << 10}}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodelay, rcvbuf int
+	var sockErr error
+	raw.Control(func(fd uintptr) {
+		if nodelay, sockErr = unix.GetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_NODELAY); sockErr == nil {
+			rcvbuf, sockErr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF)
+		}
+	})
+	if sockErr != nil {
+		t.Fatal(sockErr)
+	}
+	if nodelay != 0 {
+		t.Error("got TCP_NODELAY set on the accepted connection, want it cleared")
+	}
+	// Accepted sockets inherit the listener's buffer sizes
+	if rcvbuf < 32<<10 {
+		t.Errorf("got SO_RCVBUF %d on the accepted connection, want at least %d", rcvbuf, 32<<10)
+	}
+}
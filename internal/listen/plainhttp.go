@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package listen
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrPlainHTTP is returned by the first read from a connection, accepted by
+// a listener with RejectPlainHTTP set, whose client sent a plain HTTP
+// request. The connection has been sent a 400 response and closed.
+var ErrPlainHTTP = errors.New("client sent a plain HTTP request to the HTTPS port, responded with 400 Bad Request")
+
+// plainHTTPMessage is the body of the response sent to plain HTTP clients.
+const plainHTTPMessage = "This port expects HTTPS, use https:// instead of http://\n"
+
+var plainHTTPResponse = fmt.Sprintf("HTTP/1.0 400 Bad Request\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+	len(plainHTTPMessage), plainHTTPMessage)
+
+// httpMethods are the request line prefixes that identify plain HTTP.
+var httpMethods = []string{"GET ", "HEAD ", "POST ", "PUT ", "DELETE ", "OPTIONS ", "PATCH ", "CONNECT ", "TRACE "}
+
+// maxMethodLen is the length of the longest of httpMethods.
+const maxMethodLen = len("OPTIONS ")
+
+// plainHTTPListener wraps the connections it accepts in sniffConns.
+type plainHTTPListener struct {
+	net.Listener
+}
+
+func (l *plainHTTPListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &sniffConn{Conn: conn}, nil
+}
+
+// sniffConn checks whether the first bytes read from the connection are a
+// plain HTTP request line instead of a TLS handshake. The check happens on
+// the first Read, not in Accept, so a slow client can't hold up accepting
+// other connections, and is subject to the same read deadline as the TLS
+// handshake. The bytes read while checking are returned by later Reads.
+type sniffConn struct {
+	net.Conn
+	sniffed bool
+	// buf holds the bytes read while sniffing that haven't been returned yet.
+	buf []byte
+	// err is the error, if any, encountered while sniffing. It's returned
+	// once buf has been drained.
+	err error
+}
+
+func (c *sniffConn) Read(p []byte) (int, error) {
+	if !c.sniffed {
+		c.sniffed = true
+		c.sniff()
+	}
+	if len(c.buf) > 0 {
+		n := copy(p, c.buf)
+		c.buf = c.buf[n:]
+		return n, nil
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.Conn.Read(p)
+}
+
+// sniff reads until there are enough bytes to tell whether they're the
+// start of an HTTP request, or there's an error. A read can return as little
+// as a single byte, e.g., when the client's writes are split by the network.
+func (c *sniffConn) sniff() {
+	b := make([]byte, 0, maxMethodLen)
+	for {
+		n, err := c.Conn.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		isHTTP, decided := looksLikeHTTP(b)
+		if decided && isHTTP {
+			c.Conn.Write([]byte(plainHTTPResponse))
+			c.Conn.Close()
+			c.err = ErrPlainHTTP
+			return
+		}
+		if decided || err != nil {
+			c.buf = b
+			c.err = err
+			return
+		}
+	}
+}
+
+// looksLikeHTTP returns whether b starts with an HTTP method, and whether
+// that can be decided yet. It can't be decided while b is a prefix of a
+// method, e.g., 'PO'.
+func looksLikeHTTP(b []byte) (isHTTP, decided bool) {
+	s := string(b)
+	undecided := false
+	for _, m := range httpMethods {
+		if strings.HasPrefix(s, m) {
+			return true, true
+		}
+		if strings.HasPrefix(m, s) {
+			undecided = true
+		}
+	}
+	return false, !undecided
+}
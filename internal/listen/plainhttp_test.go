@@ -0,0 +1,210 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package listen
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLooksLikeHTTP(t *testing.T) {
+	tests := []struct {
+		b       string
+		isHTTP  bool
+		decided bool
+	}{
+		{"", false, false},
+		{"G", false, false},
+		{"GET", false, false},
+		{"GET ", true, true},
+		{"GET /index.html HTTP/1.1", true, true},
+		{"OPTIONS * HTTP/1.1", true, true},
+		{"PO", false, false},
+		{"POX", false, true},
+		{"get ", false, true},
+		{"\x16\x03\x01\x02\x00", false, true},
+		{"\x00", false, true},
+	}
+	for _, tc := range tests {
+		isHTTP, decided := looksLikeHTTP([]byte(tc.b))
+		if isHTTP != tc.isHTTP || decided != tc.decided {
+			t.Errorf("got %t, %t for %q, want %t, %t", isHTTP, decided, tc.b, tc.isHTTP, tc.decided)
+		}
+	}
+}
+
+// syncBuffer is a concurrency safe buffer for a server's ErrorLog.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+// waitFor reports whether the buffer contains s within 5 seconds. The server
+// logs an error after the response has been written, so the log can lag it.
+func (b *syncBuffer) waitFor(s string) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(b.String(), s) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// newRejectingServer returns an HTTPS server listening with RejectPlainHTTP,
+// and its error log.
+func newRejectingServer(t *testing.T) (*httptest.Server, *syncBuffer) {
+	t.Helper()
+	ln, err := Config{RejectPlainHTTP: true}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorLog := &syncBuffer{}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "Hello over HTTPS")
+	}))
+	ts.Listener.Close()
+	ts.Listener = ln
+	ts.Config.ErrorLog = log.New(errorLog, "", 0)
+	ts.Config.ReadTimeout = 200 * time.Millisecond
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts, errorLog
+}
+
+// send writes the chunks to a plain TCP connection to ts, pausing between
+// them, and returns everything read back until the server closes it.
+func send(t *testing.T, ts *httptest.Server, chunks ...string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, c := range chunks {
+		if _, err := conn.Write([]byte(c)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	got, err := ioutil.ReadAll(conn)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatalf("the server didn't close the connection, read %q", got)
+	}
+	return string(got)
+}
+
+func TestRejectPlainHTTP(t *testing.T) {
+	ts, errorLog := newRejectingServer(t)
+
+	res, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatalf("the HTTPS request failed: %s", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "Hello over HTTPS" {
+		t.Errorf("got the HTTPS response %q, want the handler's", body)
+	}
+
+	plainURL := strings.Replace(ts.URL, "https://", "http://", 1)
+	res, err = http.Get(plainURL + "/hello")
+	if err != nil {
+		t.Fatalf("the plain HTTP request failed: %s", err)
+	}
+	body, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest || string(body) != plainHTTPMessage {
+		t.Errorf("got the plain HTTP response %d %q, want 400 %q", res.StatusCode, body, plainHTTPMessage)
+	}
+	if !errorLog.waitFor(ErrPlainHTTP.Error()) {
+		t.Errorf("got the error log %q, want it to include %q", errorLog, ErrPlainHTTP)
+	}
+}
+
+func TestRejectPlainHTTPPartialReads(t *testing.T) {
+	ts, _ := newRejectingServer(t)
+
+	// The request line is split across several TCP segments
+	got := send(t, ts, "P", "OS", "T /", " HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	res, err := http.ReadResponse(bufio.NewReader(strings.NewReader(got)), nil)
+	if err != nil {
+		t.Fatalf("got %q, want an HTTP response: %s", got, err)
+	}
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("got the status %d, want 400", res.StatusCode)
+	}
+
+	// A TLS handshake split the same way still succeeds
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConn := tls.Client(&oneByteWriter{Conn: conn}, &tls.Config{InsecureSkipVerify: true})
+	defer tlsConn.Close()
+	if err := tlsConn.Handshake(); err != nil {
+		t.Errorf("the handshake written a byte at a time failed: %s", err)
+	}
+}
+
+// oneByteWriter writes a byte at a time.
+type oneByteWriter struct {
+	net.Conn
+}
+
+func (c *oneByteWriter) Write(p []byte) (int, error) {
+	for i := range p {
+		if _, err := c.Conn.Write(p[i : i+1]); err != nil {
+			return i, err
+		}
+	}
+	return len(p), nil
+}
+
+func TestRejectPlainHTTPOther(t *testing.T) {
+	ts, _ := newRejectingServer(t)
+	tests := []struct {
+		name   string
+		chunks []string
+	}{
+		// Garbage fails the TLS handshake, without the 400 response
+		{"garbage", []string{"\x00\x01garbage\r\n\r\n"}},
+		{"lowercase method", []string{"get / HTTP/1.1\r\n\r\n"}},
+		// A prefix of a method that's never completed times out
+		{"partial method", []string{"PO"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := send(t, ts, tc.chunks...); strings.Contains(got, "400 Bad Request") {
+				t.Errorf("got the response %q, want the connection closed without one", got)
+			}
+		})
+	}
+}
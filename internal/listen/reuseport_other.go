@@ -0,0 +1,16 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package listen
+
+import (
+	"errors"
+	"runtime"
+)
+
+func setReusePort(fd uintptr) error {
+	return errors.New("SO_REUSEPORT isn't supported on " + runtime.GOOS)
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package logging adds levels, JSON output, and colorized console output to
+// the standard library's log package. Setup installs a writer as the output of
+// the standard logger so existing log.Printf calls are logged at the Info
+// level, while Debugf logs at a lower level and Warnf, Errorf, and Fatalf log
+// at higher levels. Messages below the level passed to Setup are discarded.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log message.
+type Level int
+
+// The supported levels, in increasing order of severity.
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = map[string]Level{
+	"debug": Debug,
+	"info":  Info,
+	"warn":  Warn,
+	"error": Error,
+}
+
+// ParseLevel parses a level name, one of debug, info, warn, or error.
+func ParseLevel(name string) (Level, error) {
+	l, ok := levelNames[strings.ToLower(name)]
+	if !ok {
+		return Info, fmt.Errorf("unknown log level %q, it must be one of debug, info, warn, or error", name)
+	}
+	return l, nil
+}
+
+func (l Level) String() string {
+	switch l {
+	case Debug:
+		return "DEBUG"
+	case Warn:
+		return "WARN"
+	case Error:
+		return "ERROR"
+	}
+	return "INFO"
+}
+
+// Output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Color modes.
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+// The messages logged by Debugf, Warnf, and Errorf are prefixed with the name
+// of their level so the writer installed by Setup can recover it. 'WARNING: '
+// is the prefix used by warnings before levels were introduced.
+var levelPrefixes = []struct {
+	prefix string
+	level  Level
+}{
+	{"DEBUG: ", Debug},
+	{"WARNING: ", Warn},
+	{"ERROR: ", Error},
+}
+
+// Debugf logs a message at the Debug level.
+func Debugf(format string, v ...interface{}) {
+	log.Output(2, "DEBUG: "+fmt.Sprintf(format, v...))
+}
+
+// Warnf logs a message at the Warn level.
+func Warnf(format string, v ...interface{}) {
+	log.Output(2, "WARNING: "+fmt.Sprintf(format, v...))
+}
+
+// Errorf logs a message at the Error level.
+func Errorf(format string, v ...interface{}) {
+	log.Output(2, "ERROR: "+fmt.Sprintf(format, v...))
+}
+
+// Fatalf logs a message at the Error level and exits with status 1.
+func Fatalf(format string, v ...interface{}) {
+	log.Output(2, "ERROR: "+fmt.Sprintf(format, v...))
+	os.Exit(1)
+}
+
+// Setup makes the standard logger write messages at level or above to out in
+// the given format, one of FormatText or FormatJSON. color, one of ColorAuto,
+// ColorAlways, or ColorNever, controls whether text output is colorized.
+// ColorAuto colorizes only if out is a terminal and the NO_COLOR environment
+// variable isn't set. JSON output is never colorized.
+func Setup(out *os.File, format, color string, level Level) error {
+	w := &writer{out: out, level: level}
+	switch format {
+	case FormatText:
+	case FormatJSON:
+		w.json = true
+	default:
+		return fmt.Errorf("unknown log format %q, it must be %s or %s", format, FormatText, FormatJSON)
+	}
+	switch color {
+	case ColorAuto:
+		w.color = isTerminal(out) && os.Getenv("NO_COLOR") == ""
+	case ColorAlways:
+		w.color = true
+	case ColorNever:
+	default:
+		return fmt.Errorf("unknown log color mode %q, it must be %s, %s, or %s", color, ColorAuto, ColorAlways, ColorNever)
+	}
+	w.color = w.color && !w.json
+
+	log.SetFlags(0)
+	log.SetOutput(w)
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// writer formats each message written by the standard logger, which calls
+// Write exactly once per message.
+type writer struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level Level
+	json  bool
+	color bool
+}
+
+type jsonLine struct {
+	Time  string `json:"time"`
+	Level string `json:"level"`
+	Msg   string `json:"msg"`
+}
+
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorBlue   = "\x1b[34m"
+	colorCyan   = "\x1b[36m"
+)
+
+var levelColors = map[Level]string{
+	Debug: colorCyan,
+	Info:  colorBlue,
+	Warn:  colorYellow,
+	Error: colorRed,
+}
+
+// statusCode matches the status codes in access log lines.
+var statusCode = regexp.MustCompile(`status ([1-5])\d\d`)
+
+func (w *writer) Write(p []byte) (int, error) {
+	now := time.Now()
+	msg := strings.TrimSuffix(string(p), "\n")
+	level := Info
+	for _, lp := range levelPrefixes {
+		if strings.HasPrefix(msg, lp.prefix) {
+			level = lp.level
+			msg = strings.TrimPrefix(msg, lp.prefix)
+			break
+		}
+	}
+	if level < w.level {
+		return len(p), nil
+	}
+
+	var line []byte
+	switch {
+	case w.json:
+		b, err := json.Marshal(jsonLine{Time: now.Format(time.RFC3339Nano), Level: level.String(), Msg: msg})
+		if err != nil {
+			return 0, err
+		}
+		line = append(b, '\n')
+	case w.color:
+		msg = statusCode.ReplaceAllStringFunc(msg, colorStatus)
+		line = []byte(fmt.Sprintf("%s %s%-5s%s %s\n", now.Format("2006/01/02 15:04:05"), levelColors[level], level, colorReset, msg))
+	default:
+		line = []byte(fmt.Sprintf("%s %-5s %s\n", now.Format("2006/01/02 15:04:05"), level, msg))
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.out.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// colorStatus colors a 'status NNN' match by the status code's class.
+func colorStatus(s string) string {
+	c := colorGreen
+	switch s[len("status ")] {
+	case '1', '3':
+		c = colorCyan
+	case '4':
+		c = colorYellow
+	case '5':
+		c = colorRed
+	}
+	return c + s + colorReset
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setup sets up logging to a temporary file, restoring the standard logger's
+// output when the test completes, and returns a function returning the lines
+// logged.
+func setup(t *testing.T, format, color string, level Level) func() []string {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags := log.Flags()
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+		f.Close()
+	})
+	if err := Setup(f, format, color, level); err != nil {
+		t.Fatal(err)
+	}
+	return func() []string {
+		b, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	}
+}
+
+// logAll logs a message at each level.
+func logAll() {
+	Debugf("Received request %d", 1)
+	log.Printf("Starting server")
+	Warnf("Certificate expires soon")
+	Errorf("Handshake failed")
+}
+
+func TestLevels(t *testing.T) {
+	tests := []struct {
+		level Level
+		want  []string
+	}{
+		{Debug, []string{"DEBUG Received request 1", "INFO  Starting server", "WARN  Certificate expires soon", "ERROR Handshake failed"}},
+		{Info, []string{"INFO  Starting server", "WARN  Certificate expires soon", "ERROR Handshake failed"}},
+		{Warn, []string{"WARN  Certificate expires soon", "ERROR Handshake failed"}},
+		{Error, []string{"ERROR Handshake failed"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.level.String(), func(t *testing.T) {
+			lines := setup(t, FormatText, ColorNever, tc.level)
+			logAll()
+			got := lines()
+			if len(got) != len(tc.want) {
+				t.Fatalf("got the lines %q, want %d lines", got, len(tc.want))
+			}
+			for i, line := range got {
+				// Strip the date and time
+				if fields := strings.SplitN(line, " ", 3); len(fields) != 3 || fields[2] != tc.want[i] {
+					t.Errorf("got the line %q, want it to end with %q", line, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDebugSuppressedAtInfo(t *testing.T) {
+	lines := setup(t, FormatText, ColorNever, Info)
+	Debugf("Received request from %s", "127.0.0.1")
+	log.Printf("Listening on :8443")
+	got := lines()
+	if len(got) != 1 || !strings.HasSuffix(got[0], "INFO  Listening on :8443") {
+		t.Errorf("got the lines %q, want only the INFO line", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	lines := setup(t, FormatJSON, ColorAlways, Debug)
+	logAll()
+	wantLevels := []string{"DEBUG", "INFO", "WARN", "ERROR"}
+	got := lines()
+	if len(got) != len(wantLevels) {
+		t.Fatalf("got the lines %q, want %d lines", got, len(wantLevels))
+	}
+	for i, line := range got {
+		var l jsonLine
+		if err := json.Unmarshal([]byte(line), &l); err != nil {
+			t.Fatalf("got the line %q, want JSON: %s", line, err)
+		}
+		if l.Level != wantLevels[i] || l.Time == "" || strings.Contains(l.Msg, ": ") {
+			t.Errorf("got the line %+v, want level %s, a time, and no level prefix in the message", l, wantLevels[i])
+		}
+	}
+}
+
+func TestColor(t *testing.T) {
+	lines := setup(t, FormatText, ColorAlways, Info)
+	log.Printf("GET / status 503 in 1ms")
+	got := lines()
+	if len(got) != 1 || !strings.Contains(got[0], colorBlue+"INFO "+colorReset) || !strings.Contains(got[0], colorRed+"status 503"+colorReset) {
+		t.Errorf("got the line %q, want a blue level and a red status", got)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]Level{"debug": Debug, "INFO": Info, "Warn": Warn, "error": Error} {
+		if got, err := ParseLevel(name); err != nil || got != want {
+			t.Errorf("got %v, %v parsing %q, want %v", got, err, name, want)
+		}
+	}
+	if _, err := ParseLevel("trace"); err == nil {
+		t.Error("parsing the unknown level trace succeeded")
+	}
+}
+
+func TestSetupInvalid(t *testing.T) {
+	if err := Setup(os.Stderr, "xml", ColorNever, Info); err == nil {
+		t.Error("setting up the unknown format xml succeeded")
+	}
+	if err := Setup(os.Stderr, FormatText, "sometimes", Info); err == nil {
+		t.Error("setting up the unknown color mode sometimes succeeded")
+	}
+}
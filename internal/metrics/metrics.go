@@ -0,0 +1,314 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package metrics collects the server's request metrics, and the client's
+// load metrics, and serves them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxPaths is the default maximum number of distinct paths tracked.
+const DefaultMaxPaths = 100
+
+// OtherPath is the path label used for requests to paths that aren't
+// tracked individually because the maximum number of paths was reached.
+const OtherPath = "other"
+
+// Registry accumulates per path request metrics. It's safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	maxPaths int
+	paths    map[string]*pathStats
+	gauges   []gauge
+}
+
+// gauge is a value, read when the metrics are written, added by AddGauge or,
+// if typ is counter, AddCounter. Gauges added by AddCounterVec have values
+// instead, one for each value of label, and those added by AddHistogram hist.
+type gauge struct {
+	name   string
+	help   string
+	typ    string
+	value  func() float64
+	label  string
+	values func() map[string]float64
+	hist   *Histogram
+}
+
+type pathStats struct {
+	codes        map[int]uint64
+	count        uint64
+	duration     time.Duration
+	requestSize  histogram
+	responseSize histogram
+}
+
+// sizeBuckets are the upper bounds, in bytes, of the request and response
+// size histogram buckets, from 64 bytes to 64MiB in powers of 4.
+var sizeBuckets = [...]float64{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20}
+
+// histogram counts observations in the sizeBuckets. counts[i] is the number
+// of observations no larger than sizeBuckets[i] that aren't in an earlier
+// bucket, the cumulative counts are computed when the metrics are written.
+type histogram struct {
+	counts [len(sizeBuckets)]uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range sizeBuckets {
+		if v <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// write writes h as the histogram name with the given path label.
+func (h *histogram) write(b *bytes.Buffer, name, path string) {
+	var cumulative uint64
+	for i, le := range sizeBuckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(b, "%s_bucket{path=\"%s\",le=\"%s\"} %d\n", name, escape(path), strconv.FormatFloat(le, 'f', -1, 64), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{path=\"%s\",le=\"+Inf\"} %d\n", name, escape(path), h.count)
+	fmt.Fprintf(b, "%s_sum{path=\"%s\"} %g\n", name, escape(path), h.sum)
+	fmt.Fprintf(b, "%s_count{path=\"%s\"} %d\n", name, escape(path), h.count)
+}
+
+// DurationBuckets are the upper bounds, in seconds, of the buckets of a
+// request duration Histogram, from 5ms to 10s.
+var DurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations in buckets, for metrics added to a Registry
+// by AddHistogram. It's safe for concurrent use.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	// counts[i] is the number of observations no larger than buckets[i] that
+	// aren't in an earlier bucket, like histogram's.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram returns a Histogram with the given bucket upper bounds, in
+// increasing order, e.g., DurationBuckets.
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe records an observation of v.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) write(b *bytes.Buffer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cumulative uint64
+	for i, le := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(b, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(le, 'f', -1, 64), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(b, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(b, "%s_count %d\n", name, h.count)
+}
+
+// NewRegistry returns a Registry that tracks at most maxPaths distinct
+// paths. Requests for paths beyond the first maxPaths are combined under
+// OtherPath, so clients requesting many different paths, e.g., scanners,
+// can't create an unbounded number of metrics. A Registry with a maxPaths of
+// 0 doesn't track requests, it only writes the metrics added to it, e.g., the
+// client's.
+func NewRegistry(maxPaths int) *Registry {
+	return &Registry{maxPaths: maxPaths, paths: map[string]*pathStats{}}
+}
+
+// ObserveRequest records a request for path, with a body of requestBytes,
+// that completed with status code after duration d, with a response body of
+// responseBytes.
+func (r *Registry) ObserveRequest(path string, code int, d time.Duration, requestBytes, responseBytes int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ps, ok := r.paths[path]
+	if !ok {
+		if len(r.paths) >= r.maxPaths {
+			path = OtherPath
+			ps = r.paths[path]
+		}
+		if ps == nil {
+			ps = &pathStats{codes: map[int]uint64{}}
+			r.paths[path] = ps
+		}
+	}
+	ps.codes[code]++
+	ps.count++
+	ps.duration += d
+	ps.requestSize.observe(float64(requestBytes))
+	ps.responseSize.observe(float64(responseBytes))
+}
+
+// AddGauge adds a gauge named name, e.g., gohttps_requests_in_flight, whose
+// value is read by calling value whenever the metrics are written, so state
+// kept elsewhere, e.g., by an inflight.Tracker, can be exposed without
+// being copied into the registry. value must be safe for concurrent use.
+func (r *Registry) AddGauge(name, help string, value func() float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges = append(r.gauges, gauge{name: name, help: help, typ: "gauge", value: value})
+}
+
+// AddCounter is like AddGauge except that the value is a counter, i.e., it
+// only increases, e.g., the number of cache hits.
+func (r *Registry) AddCounter(name, help string, value func() float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges = append(r.gauges, gauge{name: name, help: help, typ: "counter", value: value})
+}
+
+// AddCounterVec is like AddCounter except that it adds a counter for each
+// of the values of label, e.g., class, returned by values, keyed by the label
+// value, e.g., "2xx".
+func (r *Registry) AddCounterVec(name, help, label string, values func() map[string]float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges = append(r.gauges, gauge{name: name, help: help, typ: "counter", label: label, values: values})
+}
+
+// AddHistogram adds the histogram h named name, e.g.,
+// gohttps_client_request_duration_seconds.
+func (r *Registry) AddHistogram(name, help string, h *Histogram) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges = append(r.gauges, gauge{name: name, help: help, typ: "histogram", hist: h})
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	r.mu.Lock()
+	paths := make([]string, 0, len(r.paths))
+	for path := range r.paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	if r.maxPaths > 0 {
+		r.writePaths(&b, paths)
+	}
+	gauges := r.gauges
+	r.mu.Unlock()
+
+	// The gauges are read without holding mu since value may take locks of its own
+	for _, g := range gauges {
+		fmt.Fprintf(&b, "# HELP %s %s\n", g.name, g.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", g.name, g.typ)
+		switch {
+		case g.hist != nil:
+			g.hist.write(&b, g.name)
+		case g.values != nil:
+			values := g.values()
+			keys := make([]string, 0, len(values))
+			for k := range values {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				fmt.Fprintf(&b, "%s{%s=\"%s\"} %g\n", g.name, g.label, escape(k), values[k])
+			}
+		default:
+			fmt.Fprintf(&b, "%s %g\n", g.name, g.value())
+		}
+	}
+
+	return b.WriteTo(w)
+}
+
+// writePaths writes the per path request metrics of paths to b, r.mu must be
+// held.
+func (r *Registry) writePaths(b *bytes.Buffer, paths []string) {
+	b.WriteString("# HELP gohttps_requests_total The number of requests by path and status code.\n")
+	b.WriteString("# TYPE gohttps_requests_total counter\n")
+	for _, path := range paths {
+		ps := r.paths[path]
+		codes := make([]int, 0, len(ps.codes))
+		for code := range ps.codes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(b, "gohttps_requests_total{path=\"%s\",code=\"%d\"} %d\n", escape(path), code, ps.codes[code])
+		}
+	}
+	b.WriteString("# HELP gohttps_request_duration_seconds The time taken to handle requests by path.\n")
+	b.WriteString("# TYPE gohttps_request_duration_seconds summary\n")
+	for _, path := range paths {
+		ps := r.paths[path]
+		fmt.Fprintf(b, "gohttps_request_duration_seconds_sum{path=\"%s\"} %g\n", escape(path), ps.duration.Seconds())
+		fmt.Fprintf(b, "gohttps_request_duration_seconds_count{path=\"%s\"} %d\n", escape(path), ps.count)
+	}
+	b.WriteString("# HELP gohttps_request_size_bytes The size of the request bodies by path.\n")
+	b.WriteString("# TYPE gohttps_request_size_bytes histogram\n")
+	for _, path := range paths {
+		r.paths[path].requestSize.write(b, "gohttps_request_size_bytes", path)
+	}
+	b.WriteString("# HELP gohttps_response_size_bytes The size of the response bodies by path.\n")
+	b.WriteString("# TYPE gohttps_response_size_bytes histogram\n")
+	for _, path := range paths {
+		r.paths[path].responseSize.write(b, "gohttps_response_size_bytes", path)
+	}
+}
+
+// ServeHTTP serves the metrics.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escape escapes a label value as required by the exposition format.
+func escape(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// Totals returns the total number of requests by status code class, e.g.,
+// "2xx", across all paths.
+func (r *Registry) Totals() map[string]uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totals := map[string]uint64{}
+	for _, ps := range r.paths {
+		for code, n := range ps.codes {
+			totals[fmt.Sprintf("%dxx", code/100)] += n
+		}
+	}
+	return totals
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistryMaxPaths(t *testing.T) {
+	r := NewRegistry(2)
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				r.ObserveRequest(fmt.Sprintf("/path/%d", i%10), 200+g%2*200, time.Millisecond, 0, 10)
+				if i%25 == 0 {
+					// Writing the metrics while they're observed is safe too
+					r.WriteTo(&bytes.Buffer{})
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	paths := len(r.paths)
+	other := r.paths[OtherPath]
+	r.mu.Unlock()
+	if paths != 3 || other == nil {
+		t.Fatalf("got %d paths, want 2 and %s", paths, OtherPath)
+	}
+	if other.count != 16*80 {
+		t.Errorf("got %d requests for %s, want those for the 8 untracked paths, %d", other.count, OtherPath, 16*80)
+	}
+	if totals := r.Totals(); totals["2xx"] != 800 || totals["4xx"] != 800 {
+		t.Errorf("got the totals %v, want 800 2xx and 800 4xx", totals)
+	}
+}
+
+func TestRegistryWithoutPaths(t *testing.T) {
+	r := NewRegistry(0)
+	r.ObserveRequest("/", 200, time.Millisecond, 0, 0)
+	r.AddGauge("gohttps_test_gauge", "A test gauge.", func() float64 { return 1.5 })
+	r.AddCounterVec("gohttps_test_total", "A test counter.", "class", func() map[string]float64 {
+		return map[string]float64{"5xx": 1, "2xx": 2}
+	})
+	var b bytes.Buffer
+	r.WriteTo(&b)
+	want := `# HELP gohttps_test_gauge A test gauge.
+# TYPE gohttps_test_gauge gauge
+gohttps_test_gauge 1.5
+# HELP gohttps_test_total A test counter.
+# TYPE gohttps_test_total counter
+gohttps_test_total{class="2xx"} 2
+gohttps_test_total{class="5xx"} 1
+`
+	if b.String() != want {
+		t.Errorf("got the metrics\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestRegistryEscapesPaths(t *testing.T) {
+	r := NewRegistry(10)
+	r.ObserveRequest("/\"quoted\"\n", 200, time.Millisecond, 0, 0)
+	var b bytes.Buffer
+	r.WriteTo(&b)
+	if want := `gohttps_requests_total{path="/\"quoted\"\n",code="200"} 1`; !strings.Contains(b.String(), want) {
+		t.Errorf("the metrics don't contain %s:\n%s", want, b.String())
+	}
+}
+
+func TestRegistryGauges(t *testing.T) {
+	r := NewRegistry(10)
+	var n float64 = 1
+	r.AddGauge("gohttps_requests_in_flight", "The number of requests in progress.", func() float64 { return n })
+	r.AddGauge("gohttps_open_connections", "The number of open connections.", func() float64 {
+		// The registry isn't locked while a gauge is read
+		r.AddGauge("gohttps_unused", "", func() float64 { return 0 })
+		return 3
+	})
+
+	// A gauge's value is read each time the metrics are written
+	n = 2
+	var b bytes.Buffer
+	r.WriteTo(&b)
+	for _, want := range []string{
+		"# HELP gohttps_requests_in_flight The number of requests in progress.\n# TYPE gohttps_requests_in_flight gauge\ngohttps_requests_in_flight 2\n",
+		"gohttps_open_connections 3\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("got the metrics %q, want them to include %q", b.String(), want)
+		}
+	}
+}
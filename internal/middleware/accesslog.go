@@ -0,0 +1,92 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/logging"
+)
+
+// AccessLogConfig configures the AccessLog middleware.
+type AccessLogConfig struct {
+	// SampleRate logs 1 in every SampleRate successful requests. Values less
+	// than 2 log every request.
+	SampleRate uint64
+	// SlowThreshold, if greater than 0, is the duration above which requests
+	// are always logged regardless of SampleRate.
+	SlowThreshold time.Duration
+	// InstanceID, if not empty, is logged with every request, to tell the
+	// logs of the instances behind a load balancer apart.
+	InstanceID string
+	// QuietPaths are the paths, e.g., /favicon.ico, requests for which are
+	// only logged at the debug level, whatever their status, and aren't
+	// counted by SampleRate.
+	QuietPaths []string
+	// Format, if not nil, is the format of the log lines, see
+	// ParseAccessLogFormat, instead of the default sentence.
+	Format *AccessLogFormat
+	// Output, if not nil, is written every request's line, in Format, without
+	// the log's timestamp and level prefix, or sampling, e.g., for a log
+	// analyzer that reads the combined log format.
+	Output *log.Logger
+}
+
+// AccessLog returns a handler that calls next and then logs the request.
+// Failed requests, i.e., those with a 4xx or 5xx status code, and slow
+// requests are always logged at the info level. Other requests are logged at
+// the debug level and sampled as specified by cfg.
+func AccessLog(cfg AccessLogConfig, next http.Handler) http.Handler {
+	var successes atomic.Uint64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := NewResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+		elapsed := time.Since(start)
+
+		status := rec.StatusCode()
+		var entry *accessLogEntry
+		if cfg.Format != nil {
+			entry = &accessLogEntry{r: r, status: status, bytes: rec.Bytes, start: start, elapsed: elapsed, instance: cfg.InstanceID}
+		}
+		if cfg.Output != nil && entry != nil {
+			cfg.Output.Print(cfg.Format.format(entry))
+		}
+		slow := cfg.SlowThreshold > 0 && elapsed > cfg.SlowThreshold
+		logf := log.Printf
+		if quiet(cfg.QuietPaths, r.URL.Path) {
+			logf = logging.Debugf
+		} else if status < http.StatusBadRequest && !slow {
+			// Log the first of every SampleRate successful requests
+			if cfg.SampleRate > 1 && (successes.Add(1)-1)%cfg.SampleRate != 0 {
+				return
+			}
+			logf = logging.Debugf
+		}
+		if entry != nil {
+			logf("%s", cfg.Format.format(entry))
+			return
+		}
+		instance := ""
+		if cfg.InstanceID != "" {
+			instance = ", instance " + cfg.InstanceID
+		}
+		logf("Received %s request for host %s from IP address %s and X-FORWARDED-FOR %s: status %d, %d bytes in %s%s",
+			r.Method, r.Host, r.RemoteAddr, r.Header.Get("X-FORWARDED-FOR"), status, rec.Bytes, elapsed, instance)
+	})
+}
+
+// quiet returns whether path is one of paths.
+func quiet(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logBuffer is a concurrency safe buffer the standard logger writes to.
+type logBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+// lines returns the lines logged, split into those logged at the debug level
+// and the others.
+func (b *logBuffer) lines() (debug, other []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimSpace(b.b.String()), "\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "DEBUG: "):
+			debug = append(debug, line)
+		default:
+			other = append(other, line)
+		}
+	}
+	return debug, other
+}
+
+// captureLog makes the standard logger write to the returned buffer until
+// the test ends.
+func captureLog(t *testing.T) *logBuffer {
+	t.Helper()
+	buf := &logBuffer{}
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	})
+	return buf
+}
+
+// hammer sends n requests for each of paths to h from concurrent goroutines.
+func hammer(h http.Handler, n int, paths ...string) {
+	var wg sync.WaitGroup
+	for _, path := range paths {
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(path string) {
+				defer wg.Done()
+				for i := 0; i < n/8; i++ {
+					h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+				}
+			}(path)
+		}
+	}
+	wg.Wait()
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	buf := captureLog(t)
+	h := AccessLog(AccessLogConfig{SampleRate: 10, SlowThreshold: 20 * time.Millisecond, QuietPaths: []string{"/favicon.ico"}},
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The path isn't logged, so the requests are told apart by size
+			switch r.URL.Path {
+			case "/missing":
+				http.NotFound(w, r)
+			case "/favicon.ico":
+				w.Write([]byte("icon"))
+			case "/slow":
+				time.Sleep(30 * time.Millisecond)
+			}
+		}))
+
+	hammer(h, 400, "/", "/missing", "/favicon.ico")
+	hammer(h, 8, "/slow")
+
+	debug, other := buf.lines()
+	var sampled, quiet int
+	for _, line := range debug {
+		switch {
+		case strings.Contains(line, "status 200, 0 bytes"):
+			sampled++
+		case strings.Contains(line, "status 200, 4 bytes"):
+			quiet++
+		default:
+			t.Errorf("got the line %q at debug, want only successful requests", line)
+		}
+	}
+	// The quiet requests aren't counted by the sampling, so exactly 1 in 10 of
+	// the others are logged
+	if sampled != 40 {
+		t.Errorf("got %d of the 400 successful requests logged, want 1 in 10", sampled)
+	}
+	if quiet != 400 {
+		t.Errorf("got %d of the 400 quiet requests logged at debug, want all of them", quiet)
+	}
+	var failed, slow int
+	for _, line := range other {
+		switch {
+		case strings.Contains(line, "status 404"):
+			failed++
+		case strings.Contains(line, "status 200"):
+			slow++
+		}
+	}
+	if failed != 400 {
+		t.Errorf("got %d failed requests logged, want all 400", failed)
+	}
+	if slow != 8 {
+		t.Errorf("got %d slow requests logged, want all 8", slow)
+	}
+}
+
+func TestAccessLogNoSampling(t *testing.T) {
+	buf := captureLog(t)
+	h := AccessLog(AccessLogConfig{InstanceID: "instance-1"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	hammer(h, 80, "/")
+	debug, other := buf.lines()
+	if len(debug) != 80 || len(other) != 0 {
+		t.Fatalf("got %d lines at debug and %d others, want every request logged at debug", len(debug), len(other))
+	}
+	if !strings.Contains(debug[0], "status 200, 5 bytes") || !strings.Contains(debug[0], "instance instance-1") {
+		t.Errorf("got the line %q, want the status, size, and instance", debug[0])
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccessLogPresets are the named access log formats ParseAccessLogFormat
+// accepts in addition to templates: Apache's Common and Combined Log Formats,
+// with the client certificate's Common Name as the user, and a JSON object of
+// every field.
+var AccessLogPresets = map[string]string{
+	"common":   `{ip} - {cn} [{time}] "{method} {uri} {proto}" {status} {bytes_clf}`,
+	"combined": `{ip} - {cn} [{time}] "{method} {uri} {proto}" {status} {bytes_clf} "{referer}" "{user_agent}"`,
+	"json":     "",
+}
+
+// accessLogEntry is what's logged about a request.
+type accessLogEntry struct {
+	r        *http.Request
+	status   int
+	bytes    int64
+	start    time.Time
+	elapsed  time.Duration
+	instance string
+}
+
+// accessLogFields are the fields, the placeholders of an access log format,
+// and their values, "-" if they're empty or unknown.
+var accessLogFields = map[string]func(e *accessLogEntry) string{
+	"method": func(e *accessLogEntry) string { return e.r.Method },
+	"path":   func(e *accessLogEntry) string { return e.r.URL.Path },
+	"query":  func(e *accessLogEntry) string { return e.r.URL.RawQuery },
+	"uri":    func(e *accessLogEntry) string { return e.r.URL.RequestURI() },
+	"proto":  func(e *accessLogEntry) string { return e.r.Proto },
+	"host":   func(e *accessLogEntry) string { return e.r.Host },
+	"status": func(e *accessLogEntry) string { return strconv.Itoa(e.status) },
+	"bytes":  func(e *accessLogEntry) string { return strconv.FormatInt(e.bytes, 10) },
+	"bytes_clf": func(e *accessLogEntry) string {
+		if e.bytes == 0 {
+			return ""
+		}
+		return strconv.FormatInt(e.bytes, 10)
+	},
+	"latency": func(e *accessLogEntry) string { return e.elapsed.String() },
+	"latency_ms": func(e *accessLogEntry) string {
+		return strconv.FormatFloat(float64(e.elapsed.Microseconds())/1000, 'f', 3, 64)
+	},
+	"ip":          func(e *accessLogEntry) string { return remoteIP(e.r.RemoteAddr) },
+	"remote_addr": func(e *accessLogEntry) string { return e.r.RemoteAddr },
+	"xff":         func(e *accessLogEntry) string { return e.r.Header.Get("X-Forwarded-For") },
+	"cn":          func(e *accessLogEntry) string { return clientCN(e.r) },
+	"user_agent":  func(e *accessLogEntry) string { return e.r.UserAgent() },
+	"referer":     func(e *accessLogEntry) string { return e.r.Referer() },
+	"time":        func(e *accessLogEntry) string { return e.start.Format("02/Jan/2006:15:04:05 -0700") },
+	"instance":    func(e *accessLogEntry) string { return e.instance },
+}
+
+// AccessLogFormat is a parsed access log format, see ParseAccessLogFormat.
+type AccessLogFormat struct {
+	// segments alternate between literal text, at even indexes, and field
+	// names, at odd ones.
+	segments []string
+	json     bool
+}
+
+// ParseAccessLogFormat parses format, either the name of one of the
+// AccessLogPresets or a template of literal text and {field} placeholders,
+// e.g., '{method} {path} {status} {latency} {ip} {cn}'. '{{' is a literal '{'.
+// The fields are:
+//
+//	method, path, query, uri (the path and query), proto, host, status, bytes,
+//	bytes_clf (bytes, but '-' rather than 0), latency (e.g., 1.5ms),
+//	latency_ms, ip, remote_addr (the IP address and port), xff
+//	(X-Forwarded-For), cn (the client certificate's Common Name), user_agent,
+//	referer, time (when the request was received, in Apache's format), and
+//	instance (AccessLogConfig.InstanceID)
+//
+// Empty values are logged as '-', and quotes, backslashes, and control
+// characters in values are escaped, so each request is logged on one line.
+func ParseAccessLogFormat(format string) (*AccessLogFormat, error) {
+	if preset, ok := AccessLogPresets[format]; ok {
+		if format == "json" {
+			return &AccessLogFormat{json: true}, nil
+		}
+		format = preset
+	}
+	f := &AccessLogFormat{}
+	var literal strings.Builder
+	for rest := format; rest != ""; {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			literal.WriteString(rest)
+			break
+		}
+		literal.WriteString(rest[:i])
+		rest = rest[i+1:]
+		if strings.HasPrefix(rest, "{") {
+			literal.WriteByte('{')
+			rest = rest[1:]
+			continue
+		}
+		j := strings.IndexByte(rest, '}')
+		if j < 0 {
+			return nil, errors.New("a '{' isn't closed by a '}', use '{{' for a literal '{'")
+		}
+		name := rest[:j]
+		if _, ok := accessLogFields[name]; !ok {
+			return nil, fmt.Errorf("unknown field {%s}, the fields are %s", name, strings.Join(accessLogFieldNames(), ", "))
+		}
+		f.segments = append(f.segments, literal.String(), name)
+		literal.Reset()
+		rest = rest[j+1:]
+	}
+	if len(f.segments) == 0 {
+		return nil, fmt.Errorf("the format doesn't contain any fields, e.g., {status}, or name a preset, one of %s", strings.Join(accessLogPresetNames(), ", "))
+	}
+	f.segments = append(f.segments, literal.String())
+	return f, nil
+}
+
+// format returns the log line for e.
+func (f *AccessLogFormat) format(e *accessLogEntry) string {
+	if f.json {
+		fields := make(map[string]interface{}, len(accessLogFields))
+		for name, value := range accessLogFields {
+			if v := value(e); v != "" {
+				fields[name] = v
+			}
+		}
+		fields["status"] = e.status
+		fields["bytes"] = e.bytes
+		fields["latency_ms"] = float64(e.elapsed.Microseconds()) / 1000
+		fields["time"] = e.start.Format(time.RFC3339Nano)
+		b, _ := json.Marshal(fields)
+		return string(b)
+	}
+	var b strings.Builder
+	for i, s := range f.segments {
+		if i%2 == 0 {
+			b.WriteString(s)
+			continue
+		}
+		v := accessLogFields[s](e)
+		if v == "" {
+			v = "-"
+		}
+		b.WriteString(escapeLogValue(v))
+	}
+	return b.String()
+}
+
+// escapeLogValue escapes the quotes, backslashes, and control characters in
+// v, as Go string literals do.
+func escapeLogValue(v string) string {
+	if !strings.ContainsAny(v, `"\`) && strings.IndexFunc(v, func(r rune) bool { return r < ' ' || r == 0x7f }) < 0 {
+		return v
+	}
+	q := strconv.Quote(v)
+	return q[1 : len(q)-1]
+}
+
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+func clientCN(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return r.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func accessLogFieldNames() []string {
+	names := make([]string, 0, len(accessLogFields))
+	for name := range accessLogFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func accessLogPresetNames() []string {
+	names := make([]string, 0, len(AccessLogPresets))
+	for name := range AccessLogPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
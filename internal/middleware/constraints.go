@@ -0,0 +1,121 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RouteConstraint is what requests to a route must satisfy to be handled.
+// Zero values don't constrain the request.
+type RouteConstraint struct {
+	// Methods are the allowed methods, HEAD is allowed if GET is. Other
+	// methods get a 405.
+	Methods []string `json:"methods,omitempty"`
+	// ContentTypes are the media types allowed for request bodies, e.g.,
+	// application/json, ignoring parameters such as charset. Requests with a
+	// body of another type get a 415, requests without a body aren't checked.
+	ContentTypes []string `json:"content_types,omitempty"`
+	// MaxBodyBytes is the maximum size of the request body, larger bodies get
+	// a 413. A body of unknown size is read through http.MaxBytesReader, so
+	// the handler gets an *http.MaxBytesError once it reads too much.
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+	// RequiredHeaders are headers the request must have, requests missing any
+	// of them get a 400.
+	RequiredHeaders []string `json:"required_headers,omitempty"`
+}
+
+// RouteConstraints map path prefixes, e.g., "/form" or "/bytes/", to the
+// constraint on requests whose path has the prefix. Only the longest
+// matching prefix's constraint applies.
+type RouteConstraints map[string]RouteConstraint
+
+// Constraints returns a handler that rejects requests that don't satisfy the
+// constraint of their route, with the status described by RouteConstraint,
+// before calling next.
+func Constraints(constraints RouteConstraints, next http.Handler) http.Handler {
+	prefixes := make([]string, 0, len(constraints))
+	for prefix := range constraints {
+		prefixes = append(prefixes, prefix)
+	}
+	// Longest first, so the first match is the most specific
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				c := constraints[prefix]
+				if !c.check(w, r) {
+					return
+				}
+				if c.MaxBodyBytes > 0 {
+					r.Body = http.MaxBytesReader(w, r.Body, c.MaxBodyBytes)
+				}
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// check responds with the status of the first constraint r violates, if any,
+// and returns whether r satisfies c.
+func (c RouteConstraint) check(w http.ResponseWriter, r *http.Request) bool {
+	if len(c.Methods) > 0 && !c.allowsMethod(r.Method) {
+		w.Header().Set("Allow", strings.Join(c.Methods, ", "))
+		http.Error(w, fmt.Sprintf("method %s not allowed, %s only allows %s", r.Method, r.URL.Path, strings.Join(c.Methods, ", ")), http.StatusMethodNotAllowed)
+		return false
+	}
+	if len(c.ContentTypes) > 0 && r.ContentLength != 0 {
+		mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if !containsFold(c.ContentTypes, mt) {
+			http.Error(w, fmt.Sprintf("unsupported content type %q, %s only accepts %s", r.Header.Get("Content-Type"), r.URL.Path, strings.Join(c.ContentTypes, ", ")), http.StatusUnsupportedMediaType)
+			return false
+		}
+	}
+	if c.MaxBodyBytes > 0 && r.ContentLength > c.MaxBodyBytes {
+		http.Error(w, fmt.Sprintf("the request body of %d bytes exceeds the maximum of %d bytes", r.ContentLength, c.MaxBodyBytes), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	for _, name := range c.RequiredHeaders {
+		if r.Header.Get(name) == "" {
+			http.Error(w, fmt.Sprintf("missing required header %s", name), http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+func (c RouteConstraint) allowsMethod(method string) bool {
+	if containsFold(c.Methods, method) {
+		return true
+	}
+	return method == http.MethodHead && containsFold(c.Methods, http.MethodGet)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler returns a handler that responds with the constraints as JSON, so
+// the routes' requirements can be inspected.
+func (constraints RouteConstraints) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(constraints)
+	})
+}
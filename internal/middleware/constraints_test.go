@@ -0,0 +1,100 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConstraints(t *testing.T) {
+	constraints := RouteConstraints{
+		"/form": {
+			Methods:         []string{"POST"},
+			ContentTypes:    []string{"application/x-www-form-urlencoded", "multipart/form-data"},
+			MaxBodyBytes:    16,
+			RequiredHeaders: []string{"X-Request-ID"},
+		},
+		// Only the longest matching prefix applies
+		"/form/open": {},
+		"/bytes/":    {Methods: []string{"GET"}},
+	}
+	h := Constraints(constraints, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		header http.Header
+		status int
+		allow  string
+	}{
+		{"valid", "POST", "/form", "a=1", http.Header{"Content-Type": {"application/x-www-form-urlencoded; charset=utf-8"}, "X-Request-Id": {"1"}}, http.StatusOK, ""},
+		{"method", "PUT", "/form", "", nil, http.StatusMethodNotAllowed, "POST"},
+		{"content type", "POST", "/form", "{}", http.Header{"Content-Type": {"application/json"}, "X-Request-Id": {"1"}}, http.StatusUnsupportedMediaType, ""},
+		{"no body", "POST", "/form", "", http.Header{"X-Request-Id": {"1"}}, http.StatusOK, ""},
+		{"too large", "POST", "/form", strings.Repeat("a", 17), http.Header{"Content-Type": {"multipart/form-data"}, "X-Request-Id": {"1"}}, http.StatusRequestEntityTooLarge, ""},
+		{"missing header", "POST", "/form", "a=1", http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}, http.StatusBadRequest, ""},
+		{"longer prefix", "PUT", "/form/open", "{}", nil, http.StatusOK, ""},
+		{"HEAD allowed by GET", "HEAD", "/bytes/10", "", nil, http.StatusOK, ""},
+		{"GET only", "POST", "/bytes/10", "", nil, http.StatusMethodNotAllowed, "GET"},
+		{"unconstrained", "DELETE", "/", "", nil, http.StatusOK, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			for name, values := range tc.header {
+				r.Header[name] = values
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Errorf("got the status %d, want %d: %s", w.Code, tc.status, w.Body)
+			}
+			if got := w.Header().Get("Allow"); got != tc.allow {
+				t.Errorf("got Allow %q, want %q", got, tc.allow)
+			}
+		})
+	}
+}
+
+// TestConstraintsBodyOfUnknownSize checks a body without a Content-Length
+// can only be read up to MaxBodyBytes by the handler.
+func TestConstraintsBodyOfUnknownSize(t *testing.T) {
+	var readErr error
+	h := Constraints(RouteConstraints{"/": {MaxBodyBytes: 16}}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = ioutil.ReadAll(r.Body)
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/", ioutil.NopCloser(strings.NewReader(strings.Repeat("a", 17))))
+	r.ContentLength = -1
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	var maxErr *http.MaxBytesError
+	if !errors.As(readErr, &maxErr) || maxErr.Limit != 16 {
+		t.Errorf("got the error %v reading the body, want an *http.MaxBytesError for 16 bytes", readErr)
+	}
+}
+
+func TestRouteConstraintsHandler(t *testing.T) {
+	constraints := RouteConstraints{"/form": {Methods: []string{"POST"}, MaxBodyBytes: 16}}
+	w := httptest.NewRecorder()
+	constraints.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/constraints", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got the content type %q, want application/json", ct)
+	}
+	var got RouteConstraints
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, constraints) {
+		t.Errorf("got the constraints %+v, want %+v", got, constraints)
+	}
+}
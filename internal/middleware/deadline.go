@@ -0,0 +1,33 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Deadline returns a handler that calls next with a request whose context
+// has a deadline of timeout from now, unless the context already has an
+// earlier one. Handlers should make their outbound calls with r.Context(),
+// e.g., using http.NewRequestWithContext, so the calls are canceled when the
+// deadline passes or the client goes away, instead of outliving the request.
+func Deadline(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := WithDeadline(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// WithDeadline returns a copy of ctx with a deadline of timeout from now, or
+// ctx's own deadline if that's earlier, so a deadline is never extended.
+func WithDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// deadlineOf returns the deadline of the context h calls its handler with,
+// and whether it has one.
+func deadlineOf(h func(next http.Handler) http.Handler, r *http.Request) (time.Time, bool) {
+	var deadline time.Time
+	var ok bool
+	h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	return deadline, ok
+}
+
+func TestDeadline(t *testing.T) {
+	// Without the middleware the handler's context has no deadline
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, ok := deadlineOf(func(next http.Handler) http.Handler { return next }, r); ok {
+		t.Error("got a deadline without the middleware, want none")
+	}
+
+	start := time.Now()
+	deadline, ok := deadlineOf(func(next http.Handler) http.Handler { return Deadline(5*time.Second, next) }, r)
+	if !ok {
+		t.Fatal("got no deadline with the middleware")
+	}
+	if d := deadline.Sub(start); d < 5*time.Second || d > 6*time.Second {
+		t.Errorf("got a deadline %s from now, want 5s", d)
+	}
+}
+
+func TestDeadlineNotExtended(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	earlier, _ := ctx.Deadline()
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+	// An earlier deadline, e.g., from -handler-timeout, is kept
+	deadline, ok := deadlineOf(func(next http.Handler) http.Handler { return Deadline(5*time.Second, next) }, r)
+	if !ok || !deadline.Equal(earlier) {
+		t.Errorf("got the deadline %s, %v, want the earlier %s", deadline, ok, earlier)
+	}
+	// A later one is replaced
+	deadline, ok = deadlineOf(func(next http.Handler) http.Handler { return Deadline(100*time.Millisecond, next) }, r)
+	if !ok || !deadline.Before(earlier) {
+		t.Errorf("got the deadline %s, %v, want one before %s", deadline, ok, earlier)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/dump"
+)
+
+// Dump returns a handler that writes each request to d as it arrives, and,
+// once next returns, the response next wrote. The requests are numbered so
+// their responses can be matched up with them.
+func Dump(d *dump.Writer, next http.Handler) http.Handler {
+	var requests atomic.Uint64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		var body []byte
+		if r.Body != nil && r.Body != http.NoBody {
+			body, r.Body = d.Peek(r.Body)
+		}
+		d.Request(fmt.Sprintf("request %d from %s", n, r.RemoteAddr), r, false, body)
+
+		start := time.Now()
+		rec := &dumpRecorder{ResponseRecorder: NewResponseRecorder(w), max: d.MaxBody() + 1}
+		next.ServeHTTP(rec, r)
+		if rec.header == nil {
+			rec.header = rec.Header().Clone()
+		}
+		title := fmt.Sprintf("response %d to %s, %d bytes in %s", n, r.RemoteAddr, rec.Bytes, time.Since(start).Round(time.Microsecond))
+		d.Written(title, r.Proto, rec.StatusCode(), rec.header, rec.body)
+	})
+}
+
+// dumpRecorder is a ResponseRecorder that also records the header, as it was
+// when the response was first written, and the first max bytes of the body.
+type dumpRecorder struct {
+	*ResponseRecorder
+	max    int
+	header http.Header
+	body   []byte
+}
+
+func (r *dumpRecorder) WriteHeader(code int) {
+	if r.header == nil {
+		r.header = r.Header().Clone()
+	}
+	r.ResponseRecorder.WriteHeader(code)
+}
+
+func (r *dumpRecorder) Write(b []byte) (int, error) {
+	if r.header == nil {
+		r.header = r.Header().Clone()
+	}
+	if len(r.body) < r.max {
+		r.body = append(r.body, b[:min(len(b), r.max-len(r.body))]...)
+	}
+	return r.ResponseRecorder.Write(b)
+}
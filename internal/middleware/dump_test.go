@@ -0,0 +1,74 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/youngkin/gohttps/internal/dump"
+)
+
+func TestDump(t *testing.T) {
+	var out bytes.Buffer
+	var received string
+	h := Dump(dump.NewWriter(&out, 8), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received = string(b)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "c00kie"})
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "Hello, Gopher from the server")
+	}))
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/items/1", strings.NewReader("0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Basic czNjcmV0")
+	req.Header.Set("Cookie", "theme=d4rk")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	// The dump doesn't change what the handler and client see
+	if received != "0123456789abcdef" || string(body) != "Hello, Gopher from the server" {
+		t.Errorf("the handler received %q and the client %q, want the whole bodies", received, body)
+	}
+
+	// The response is dumped once the handler returns, which Close waits for
+	ts.Close()
+	got := out.String()
+	for _, want := range []string{
+		"---- request 1 from 127.0.0.1:",
+		"PUT /items/1 HTTP/1.1\n",
+		"Authorization: [REDACTED]\n",
+		"Cookie: [REDACTED]\n",
+		"\n01234567\n[truncated at 8 bytes]\n",
+		"---- response 1 to 127.0.0.1:",
+		", 29 bytes in ",
+		"HTTP/1.1 201 Created\n",
+		"Content-Type: text/plain\n",
+		"Set-Cookie: [REDACTED]\n",
+		"\nHello, G\n[truncated at 8 bytes]\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("the dump doesn't contain %q:\n%s", want, got)
+		}
+	}
+	for _, secret := range []string{"czNjcmV0", "d4rk", "c00kie", "89abcdef", "Gopher"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("the dump contains %q:\n%s", secret, got)
+		}
+	}
+}
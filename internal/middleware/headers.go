@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// HeaderRules are the response headers added by Headers. A header with an
+// empty value removes the header instead, including one added by a rule
+// applied before it or by an earlier handler, and suppresses the headers the
+// server adds automatically, such as Date.
+type HeaderRules struct {
+	// Global headers are added to every response.
+	Global http.Header
+	// Routes maps path prefixes to the headers added to the responses to
+	// requests whose path has the prefix, e.g., "/metrics" or "/bytes/".
+	Routes map[string]http.Header
+}
+
+// Headers returns a handler that adds the headers in rules to the response
+// and then calls next, so next can still override them. The global headers
+// are applied first, then those of each matching route prefix from the
+// shortest to the longest, so a more specific prefix takes precedence.
+func Headers(rules HeaderRules, next http.Handler) http.Handler {
+	prefixes := make([]string, 0, len(rules.Routes))
+	for prefix := range rules.Routes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) < len(prefixes[j]) })
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		applyHeaders(h, rules.Global)
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				applyHeaders(h, rules.Routes[prefix])
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func applyHeaders(dst, src http.Header) {
+	for name, values := range src {
+		if len(values) == 1 && values[0] == "" {
+			// A nil value suppresses automatic headers too, see
+			// http.ResponseWriter
+			dst[name] = nil
+			continue
+		}
+		dst[name] = append([]string(nil), values...)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	rules := HeaderRules{
+		Global: http.Header{"X-Frame-Options": {"DENY"}, "Date": {""}, "Vary": {"Accept", "Cookie"}},
+		Routes: map[string]http.Header{
+			"/":            {"Cache-Control": {"no-cache"}},
+			"/metrics":     {"Cache-Control": {"no-store"}, "X-Frame-Options": {""}},
+			"/metrics/raw": {"Cache-Control": {"private"}},
+		},
+	}
+	ts := httptest.NewServer(Headers(rules, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The handler can still override the headers
+		if r.URL.Path == "/override" {
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+	})))
+	defer ts.Close()
+
+	tests := []struct {
+		path string
+		want http.Header
+	}{
+		{"/", http.Header{"X-Frame-Options": {"DENY"}, "Vary": {"Accept", "Cookie"}, "Cache-Control": {"no-cache"}}},
+		{"/metrics", http.Header{"Vary": {"Accept", "Cookie"}, "Cache-Control": {"no-store"}}},
+		{"/metrics/raw", http.Header{"Vary": {"Accept", "Cookie"}, "Cache-Control": {"private"}}},
+		{"/override", http.Header{"X-Frame-Options": {"DENY"}, "Vary": {"Accept", "Cookie"}, "Cache-Control": {"max-age=60"}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			res, err := http.Get(ts.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			got := http.Header{}
+			for _, name := range []string{"X-Frame-Options", "Vary", "Cache-Control", "Date"} {
+				if values := res.Header.Values(name); len(values) > 0 {
+					got[name] = values
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got the headers %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestHeadersCopiesValues checks a handler modifying a header added by the
+// rules doesn't modify the rules, e.g., for the next request.
+func TestHeadersCopiesValues(t *testing.T) {
+	rules := HeaderRules{Global: http.Header{"Vary": {"Accept"}}}
+	h := Headers(rules, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Cookie")
+		w.Header()["Vary"][0] = "Origin"
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if want := (http.Header{"Vary": {"Accept"}}); !reflect.DeepEqual(rules.Global, want) {
+		t.Errorf("got the rules' headers %v after a request, want %v", rules.Global, want)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/retryafter"
+)
+
+// DefaultConcurrencyWait is how long ConcurrencyLimit waits, by default, for a
+// running handler to finish before rejecting a request.
+const DefaultConcurrencyWait = 100 * time.Millisecond
+
+// ConcurrencyLimit returns a handler that runs at most max calls of next at a
+// time. A request that can't start within wait, because max others are
+// already running, is rejected with a 503, with a Retry-After of retryAfter
+// unless it's 0. Unlike a connection limit this
+// bounds the work done in handlers, idle keep-alive connections don't count.
+func ConcurrencyLimit(max int, wait, retryAfter time.Duration, next http.Handler) http.Handler {
+	sem := make(chan struct{}, max)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+		default:
+			timer := time.NewTimer(wait)
+			select {
+			case sem <- struct{}{}:
+				timer.Stop()
+			case <-timer.C:
+				retryafter.Set(w.Header(), retryAfter)
+				http.Error(w, "server busy, try again later", http.StatusServiceUnavailable)
+				return
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
+		defer func() { <-sem }()
+		next.ServeHTTP(w, r)
+	})
+}
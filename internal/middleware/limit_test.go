@@ -0,0 +1,124 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingHandler is a handler whose calls block until release is closed,
+// counting those running.
+type blockingHandler struct {
+	running atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (h *blockingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.running.Add(1)
+	defer h.running.Add(-1)
+	h.started <- struct{}{}
+	<-h.release
+}
+
+func TestConcurrencyLimitShedsExcess(t *testing.T) {
+	const max = 3
+	next := newBlockingHandler()
+	h := ConcurrencyLimit(max, 20*time.Millisecond, 5*time.Second, next)
+
+	var wg sync.WaitGroup
+	codes := make(chan int, max)
+	for i := 0; i < max; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			codes <- rec.Code
+		}()
+		<-next.started
+	}
+
+	// The N+1th request is shed once the wait is over
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d for request %d, want 503", rec.Code, max+1)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("got the Retry-After %q, want 5", got)
+	}
+	if got := next.running.Load(); got != max {
+		t.Errorf("got %d handlers running, want %d", got, max)
+	}
+
+	close(next.release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("got status %d for a request within the limit, want 200", code)
+		}
+	}
+}
+
+func TestConcurrencyLimitWaits(t *testing.T) {
+	next := newBlockingHandler()
+	h := ConcurrencyLimit(1, time.Second, 0, next)
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		close(done)
+	}()
+	<-next.started
+
+	// The second request starts once the first finishes, within the wait
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(next.release)
+	}()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	<-done
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d for the request that waited, want 200", rec.Code)
+	}
+}
+
+func TestConcurrencyLimitCanceled(t *testing.T) {
+	next := newBlockingHandler()
+	defer close(next.release)
+	h := ConcurrencyLimit(1, time.Minute, 0, next)
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-next.started
+
+	// A client that goes away while waiting stops waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	finished := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the canceled request kept waiting")
+	}
+	if got := next.running.Load(); got != 1 {
+		t.Errorf("got %d handlers running, want 1", got)
+	}
+}
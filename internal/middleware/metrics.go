@@ -0,0 +1,49 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/metrics"
+)
+
+// Metrics returns a handler that calls next and records the request in m.
+// The request's size is its Content-Length or, if that's unknown, e.g., for
+// a chunked body, the number of bytes next read from the body.
+func Metrics(m *metrics.Registry, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := NewResponseRecorder(w)
+		var body *countingBody
+		if r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody {
+			body = &countingBody{ReadCloser: r.Body}
+			r.Body = body
+		}
+		next.ServeHTTP(rec, r)
+		requestBytes := r.ContentLength
+		if body != nil {
+			requestBytes = body.n.Load()
+		}
+		m.ObserveRequest(r.URL.Path, rec.StatusCode(), time.Since(start), requestBytes, rec.Bytes)
+	})
+}
+
+// countingBody counts the bytes read from the request body it wraps. Errors
+// are returned unchanged, so a handler wrapping it with http.MaxBytesReader
+// still gets an *http.MaxBytesError once the limit is exceeded.
+type countingBody struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/youngkin/gohttps/internal/metrics"
+)
+
+func TestMetricsMaxPaths(t *testing.T) {
+	m := metrics.NewRegistry(3)
+	h := Metrics(m, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// A scanner requesting many paths, concurrently
+	var paths []string
+	for i := 0; i < 20; i++ {
+		paths = append(paths, fmt.Sprintf("/scan/%d", i))
+	}
+	hammer(h, 16, paths...)
+
+	var b bytes.Buffer
+	m.WriteTo(&b)
+	tracked := map[string]bool{}
+	for _, line := range strings.Split(b.String(), "\n") {
+		if strings.HasPrefix(line, "gohttps_requests_total{") {
+			tracked[line[strings.Index(line, `path="`)+6:strings.Index(line, `",`)]] = true
+		}
+	}
+	if len(tracked) != 4 || !tracked[metrics.OtherPath] {
+		t.Errorf("got the paths %v, want 3 paths and %s", tracked, metrics.OtherPath)
+	}
+	if total := m.Totals()["2xx"]; total != 20*16 {
+		t.Errorf("got a total of %d requests, want %d", total, 20*16)
+	}
+}
+
+func TestMetricsRequestSize(t *testing.T) {
+	m := metrics.NewRegistry(10)
+	h := Metrics(m, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("ok"))
+	}))
+
+	// A chunked body has no Content-Length, so the bytes read are counted
+	req := httptest.NewRequest(http.MethodPost, "/upload", io.MultiReader(strings.NewReader(strings.Repeat("x", 300))))
+	req.ContentLength = -1
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var b bytes.Buffer
+	m.WriteTo(&b)
+	for _, want := range []string{
+		`gohttps_request_size_bytes_sum{path="/upload"} 300`,
+		`gohttps_request_size_bytes_bucket{path="/upload",le="256"} 0`,
+		`gohttps_request_size_bytes_bucket{path="/upload",le="1024"} 1`,
+		`gohttps_response_size_bytes_sum{path="/upload"} 2`,
+		`gohttps_requests_total{path="/upload",code="200"} 1`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("the metrics are missing %q:\n%s", want, b.String())
+		}
+	}
+}
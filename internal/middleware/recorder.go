@@ -0,0 +1,79 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package middleware contains the http.Handler wrappers used by the servers
+// for access logging and metrics.
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// ResponseRecorder wraps an http.ResponseWriter, recording the status code
+// and number of body bytes written through it.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	Status int
+	Bytes  int64
+}
+
+// NewResponseRecorder returns a ResponseRecorder wrapping w.
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	if rec, ok := w.(*ResponseRecorder); ok {
+		return rec
+	}
+	return &ResponseRecorder{ResponseWriter: w}
+}
+
+// WriteHeader records and writes the status code.
+func (r *ResponseRecorder) WriteHeader(code int) {
+	if r.Status == 0 {
+		r.Status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes b, recording an implicit 200 status if WriteHeader wasn't called.
+func (r *ResponseRecorder) Write(b []byte) (int, error) {
+	if r.Status == 0 {
+		r.Status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += int64(n)
+	return n, err
+}
+
+// StatusCode returns the recorded status code, 200 if nothing was written.
+func (r *ResponseRecorder) StatusCode() int {
+	if r.Status == 0 {
+		return http.StatusOK
+	}
+	return r.Status
+}
+
+// Flush flushes the wrapped http.ResponseWriter if it supports flushing. It's
+// provided, in addition to Unwrap, for handlers that require an http.Flusher,
+// e.g., grpc.Server's ServeHTTP.
+func (r *ResponseRecorder) Flush() {
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// Hijack hijacks the wrapped http.ResponseWriter's connection if it supports
+// hijacking, for handlers that require an http.Hijacker, e.g., WebSocket
+// upgraders. The recorded status is 101 Switching Protocols.
+func (r *ResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil && r.Status == 0 {
+		r.Status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, for use by
+// http.ResponseController, e.g., to flush streaming responses.
+func (r *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
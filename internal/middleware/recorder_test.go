@@ -0,0 +1,51 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseRecorderHijack(t *testing.T) {
+	statuses := make(chan int, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := NewResponseRecorder(w)
+		conn, rw, err := rec.Hijack()
+		if err != nil {
+			t.Errorf("hijacking through the recorder failed: %s", err)
+			statuses <- 0
+			return
+		}
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		conn.Close()
+		statuses <- rec.StatusCode()
+	}))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("got the status %d from the hijacked connection, want 101", res.StatusCode)
+	}
+	if status := <-statuses; status != http.StatusSwitchingProtocols {
+		t.Errorf("got the recorded status %d, want 101", status)
+	}
+}
+
+func TestResponseRecorderHijackUnsupported(t *testing.T) {
+	rec := NewResponseRecorder(httptest.NewRecorder())
+	if _, _, err := rec.Hijack(); err == nil {
+		t.Error("hijacking a ResponseWriter that doesn't support it succeeded")
+	}
+	if rec.Status != 0 {
+		t.Errorf("got the recorded status %d after the failed hijack, want none", rec.Status)
+	}
+}
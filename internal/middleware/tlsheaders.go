@@ -0,0 +1,44 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/youngkin/gohttps/internal/tlsutil"
+)
+
+// Names of the headers added by TLSHeaders.
+const (
+	HeaderTLSVersion   = "X-TLS-Version"
+	HeaderTLSCipher    = "X-TLS-Cipher"
+	HeaderTLSResumed   = "X-TLS-Resumed"
+	HeaderALPN         = "X-ALPN"
+	HeaderClientCertCN = "X-Client-Cert-CN"
+)
+
+// TLSHeaders returns a handler that adds the parameters of the request's TLS
+// connection, the version, cipher suite, whether the session was resumed,
+// the negotiated ALPN protocol, and the client certificate's common name, if
+// any, to the response headers and then calls next. It's meant for
+// debugging since it reveals the server's configuration to every client.
+func TLSHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cs := r.TLS; cs != nil {
+			h := w.Header()
+			h.Set(HeaderTLSVersion, tlsutil.VersionName(cs.Version))
+			h.Set(HeaderTLSCipher, tlsutil.CipherSuiteName(cs.CipherSuite))
+			h.Set(HeaderTLSResumed, strconv.FormatBool(cs.DidResume))
+			if cs.NegotiatedProtocol != "" {
+				h.Set(HeaderALPN, cs.NegotiatedProtocol)
+			}
+			if len(cs.PeerCertificates) > 0 {
+				h.Set(HeaderClientCertCN, cs.PeerCertificates[0].Subject.CommonName)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
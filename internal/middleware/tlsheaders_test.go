@@ -0,0 +1,102 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// clientCert returns a self-signed client certificate for cn.
+func clientCert(t *testing.T, cn string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+var tlsHeaderNames = []string{HeaderTLSVersion, HeaderTLSCipher, HeaderTLSResumed, HeaderALPN, HeaderClientCertCN}
+
+// TestTLSHeaders forces a TLS 1.2 handshake, with a client certificate, over
+// HTTP/2, checking the headers use the standard names, and that they're only
+// added by the middleware, i.e., with -debug-headers.
+func TestTLSHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name    string
+		handler http.Handler
+		want    map[string]string
+	}{
+		{"without -debug-headers", ok, map[string]string{}},
+		{"with -debug-headers", TLSHeaders(ok), map[string]string{
+			HeaderTLSVersion:   "TLS1.2",
+			HeaderTLSCipher:    "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+			HeaderTLSResumed:   "false",
+			HeaderALPN:         "h2",
+			HeaderClientCertCN: "gopher",
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewUnstartedServer(tc.handler)
+			ts.EnableHTTP2 = true
+			ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+			ts.TLS = &tls.Config{
+				MaxVersion:   tls.VersionTLS12,
+				CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+				ClientAuth:   tls.RequestClientCert,
+			}
+			ts.StartTLS()
+			defer ts.Close()
+			client := ts.Client()
+			client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{clientCert(t, "gopher")}
+
+			res, err := client.Get(ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			for _, name := range tlsHeaderNames {
+				got, want := res.Header.Get(name), tc.want[name]
+				if got != want {
+					t.Errorf("got the %s header %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTLSHeadersPlainHTTP(t *testing.T) {
+	rec := httptest.NewRecorder()
+	TLSHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	for _, name := range tlsHeaderNames {
+		if got := rec.Header().Get(name); got != "" {
+			t.Errorf("got the %s header %q for a plain HTTP request, want none", name, got)
+		}
+	}
+}
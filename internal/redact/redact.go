@@ -0,0 +1,48 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package redact removes sensitive values, such as credentials, from data
+// before it's logged or written to a file.
+package redact
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Placeholder replaces redacted values.
+const Placeholder = "[REDACTED]"
+
+// sensitiveHeaders are the canonical names of headers whose values are redacted.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+	"X-Auth-Token":        true,
+}
+
+// IsSensitiveHeader returns true if the value of the named header should be redacted.
+func IsSensitiveHeader(name string) bool {
+	return sensitiveHeaders[http.CanonicalHeaderKey(strings.TrimSpace(name))]
+}
+
+// Header returns a copy of h with the values of sensitive headers replaced by
+// Placeholder.
+func Header(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		if IsSensitiveHeader(name) {
+			redacted := make([]string, len(values))
+			for i := range redacted {
+				redacted[i] = Placeholder
+			}
+			out[name] = redacted
+			continue
+		}
+		out[name] = append([]string(nil), values...)
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package redact
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	h := http.Header{
+		"Authorization": {"Bearer token"},
+		"Cookie":        {"a=1", "b=2"},
+		"X-Api-Key":     {"key"},
+		"Accept":        {"text/plain"},
+	}
+	got := Header(h)
+	want := http.Header{
+		"Authorization": {Placeholder},
+		"Cookie":        {Placeholder, Placeholder},
+		"X-Api-Key":     {Placeholder},
+		"Accept":        {"text/plain"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if h.Get("Authorization") != "Bearer token" {
+		t.Error("the original header was modified")
+	}
+}
+
+func TestIsSensitiveHeader(t *testing.T) {
+	for name, want := range map[string]bool{
+		"authorization":  true,
+		" set-cookie ":   true,
+		"X-AUTH-TOKEN":   true,
+		"Content-Type":   false,
+		"X-Api-Key-Hint": false,
+	} {
+		if got := IsSensitiveHeader(name); got != want {
+			t.Errorf("IsSensitiveHeader(%q) = %t, want %t", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package retryafter sets and parses the Retry-After header, RFC 9110 section
+// 10.2.3, of 503 and 429 responses, in either of its forms, a number of
+// seconds, e.g., 120, or an HTTP-date, e.g., Wed, 21 Oct 2026 07:28:00 GMT.
+package retryafter
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header is the name of the Retry-After header.
+const Header = "Retry-After"
+
+// Applies returns whether Retry-After is meaningful for a response with code,
+// i.e., it's 503 Service Unavailable or 429 Too Many Requests.
+func Applies(code int) bool {
+	return code == http.StatusServiceUnavailable || code == http.StatusTooManyRequests
+}
+
+// Set sets h's Retry-After to d, in seconds, rounded up so it's never less
+// than d. It does nothing if d isn't positive.
+func Set(h http.Header, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	seconds := (d + time.Second - 1) / time.Second
+	h.Set(Header, strconv.FormatInt(int64(seconds), 10))
+}
+
+// SetTime sets h's Retry-After to the HTTP-date of t, e.g., for a maintenance
+// window ending at t.
+func SetTime(h http.Header, t time.Time) {
+	h.Set(Header, t.UTC().Format(http.TimeFormat))
+}
+
+// Parse returns how long to wait, from now, before retrying, as advised by
+// the Retry-After value. Dates in the past are 0. It's an error if value is
+// neither a non-negative number of seconds nor an HTTP-date.
+func Parse(value string, now time.Time) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("empty %s", Header)
+	}
+	if value[0] >= '0' && value[0] <= '9' {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds > int64(1<<63-1)/int64(time.Second) {
+			return 0, fmt.Errorf("invalid %s %q, it must be a number of seconds or an HTTP-date", Header, value)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q, it must be a number of seconds or an HTTP-date", Header, value)
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, nil
+	}
+	return 0, nil
+}
+
+// Get returns the delay advised by h's Retry-After, see Parse, and whether h
+// has one. The error is for a malformed value.
+func Get(h http.Header, now time.Time) (time.Duration, bool, error) {
+	value := h.Get(Header)
+	if value == "" {
+		return 0, false, nil
+	}
+	d, err := Parse(value, now)
+	return d, true, err
+}
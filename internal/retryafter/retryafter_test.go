@@ -0,0 +1,96 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package retryafter
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{5 * time.Second, "5"},
+		{1500 * time.Millisecond, "2"},
+		{time.Millisecond, "1"},
+		{2 * time.Minute, "120"},
+		{0, ""},
+		{-time.Second, ""},
+	}
+	for _, tc := range tests {
+		h := http.Header{}
+		Set(h, tc.d)
+		if got := h.Get(Header); got != tc.want {
+			t.Errorf("got %s %q for %s, want %q", Header, got, tc.d, tc.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	now := time.Date(2026, 10, 21, 7, 28, 0, 0, time.UTC)
+	h := http.Header{}
+	SetTime(h, now.Add(90*time.Second).In(time.FixedZone("PDT", -7*60*60)))
+	if got, want := h.Get(Header), "Wed, 21 Oct 2026 07:29:30 GMT"; got != want {
+		t.Fatalf("got the date %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "120", want: 2 * time.Minute},
+		{value: " 0 ", want: 0},
+		{value: h.Get(Header), want: 90 * time.Second},
+		{value: "Wed, 21 Oct 2026 07:00:00 GMT", want: 0},
+		// The obsolete date formats are accepted too
+		{value: "Wednesday, 21-Oct-26 07:29:00 GMT", want: time.Minute},
+		{value: "", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "1.5", wantErr: true},
+		{value: "9223372037", wantErr: true},
+		{value: "99999999999999999999", wantErr: true},
+		{value: "Wed, 21 Oct 2026", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := Parse(tc.value, now)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("got %s parsing %q, want an error", got, tc.value)
+			} else if tc.value != "" && !strings.Contains(err.Error(), "must be a number of seconds or an HTTP-date") {
+				t.Errorf("got the error %q parsing %q, want it to describe the valid forms", err, tc.value)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("got %s and the error %v parsing %q, want %s", got, err, tc.value, tc.want)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	if _, ok, err := Get(http.Header{}, time.Now()); ok || err != nil {
+		t.Errorf("got %v and the error %v without a %s, want false", ok, err, Header)
+	}
+	if d, ok, err := Get(http.Header{Header: {"5"}}, time.Now()); !ok || err != nil || d != 5*time.Second {
+		t.Errorf("got %s, %v, and the error %v, want 5s", d, ok, err)
+	}
+	if _, ok, err := Get(http.Header{Header: {"soon"}}, time.Now()); !ok || err == nil {
+		t.Errorf("got %v and the error %v for a malformed value, want true and an error", ok, err)
+	}
+}
+
+func TestApplies(t *testing.T) {
+	for code, want := range map[int]bool{503: true, 429: true, 200: false, 500: false, 301: false} {
+		if got := Applies(code); got != want {
+			t.Errorf("got %v for %d, want %v", got, code, want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package sct parses the Signed Certificate Timestamps (SCTs), defined by
+// RFC 6962, that certificate transparency logs issue for certificates. SCTs
+// are delivered in the TLS handshake, tls.ConnectionState's
+// SignedCertificateTimestamps, or embedded in the certificate itself.
+// Signatures aren't verified, that requires the logs' public keys.
+package sct
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OIDExtension is the object identifier of the certificate extension
+// containing embedded SCTs.
+var OIDExtension = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// Version1 is the only SCT version defined.
+const Version1 = 0
+
+// SCT is a parsed Signed Certificate Timestamp.
+type SCT struct {
+	Version uint8
+	// LogID is the SHA-256 hash of the log's public key.
+	LogID      [32]byte
+	Timestamp  time.Time
+	Extensions []byte
+	// HashAlgorithm and SignatureAlgorithm are the TLS HashAlgorithm and
+	// SignatureAlgorithm values, e.g., 4 (sha256) and 3 (ecdsa).
+	HashAlgorithm      uint8
+	SignatureAlgorithm uint8
+	Signature          []byte
+}
+
+// String returns a human readable representation of s, suitable for logging.
+func (s SCT) String() string {
+	return fmt.Sprintf("log ID %s, timestamp %s", base64.StdEncoding.EncodeToString(s.LogID[:]), s.Timestamp.UTC().Format(time.RFC3339))
+}
+
+var errTruncated = errors.New("truncated SCT")
+
+// Parse parses a single serialized SCT.
+func Parse(b []byte) (SCT, error) {
+	var s SCT
+	r := reader(b)
+	version, ok := r.uint8()
+	if !ok {
+		return SCT{}, errTruncated
+	}
+	if version != Version1 {
+		return SCT{}, fmt.Errorf("unsupported SCT version %d", version)
+	}
+	s.Version = version
+	id, ok := r.bytes(len(s.LogID))
+	if !ok {
+		return SCT{}, errTruncated
+	}
+	copy(s.LogID[:], id)
+	ts, ok := r.bytes(8)
+	if !ok {
+		return SCT{}, errTruncated
+	}
+	s.Timestamp = time.UnixMilli(int64(binary.BigEndian.Uint64(ts)))
+	if s.Extensions, ok = r.vector16(); !ok {
+		return SCT{}, errTruncated
+	}
+	if s.HashAlgorithm, ok = r.uint8(); !ok {
+		return SCT{}, errTruncated
+	}
+	if s.SignatureAlgorithm, ok = r.uint8(); !ok {
+		return SCT{}, errTruncated
+	}
+	if s.Signature, ok = r.vector16(); !ok {
+		return SCT{}, errTruncated
+	}
+	if len(r) != 0 {
+		return SCT{}, fmt.Errorf("%d bytes of trailing data after SCT", len(r))
+	}
+	return s, nil
+}
+
+// ParseList parses a SignedCertificateTimestampList, the TLS encoding of a
+// list of serialized SCTs used by the certificate extension and the TLS
+// extension.
+func ParseList(b []byte) ([]SCT, error) {
+	r := reader(b)
+	list, ok := r.vector16()
+	if !ok || len(r) != 0 {
+		return nil, errors.New("malformed SCT list")
+	}
+	var scts []SCT
+	for l := reader(list); len(l) > 0; {
+		serialized, ok := l.vector16()
+		if !ok {
+			return nil, errors.New("malformed SCT list")
+		}
+		s, err := Parse(serialized)
+		if err != nil {
+			return nil, err
+		}
+		scts = append(scts, s)
+	}
+	return scts, nil
+}
+
+// FromConnection parses the serialized SCTs delivered in the TLS handshake,
+// e.g., tls.ConnectionState's SignedCertificateTimestamps.
+func FromConnection(serialized [][]byte) ([]SCT, error) {
+	var scts []SCT
+	for _, b := range serialized {
+		s, err := Parse(b)
+		if err != nil {
+			return nil, err
+		}
+		scts = append(scts, s)
+	}
+	return scts, nil
+}
+
+// FromCertificate parses the SCTs embedded in cert, returning nil if it
+// doesn't have any.
+func FromCertificate(cert *x509.Certificate) ([]SCT, error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(OIDExtension) {
+			continue
+		}
+		var list []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &list); err != nil || len(rest) != 0 {
+			return nil, errors.New("malformed embedded SCT extension")
+		}
+		return ParseList(list)
+	}
+	return nil, nil
+}
+
+// reader consumes TLS presentation language encoded values.
+type reader []byte
+
+func (r *reader) uint8() (uint8, bool) {
+	b, ok := r.bytes(1)
+	if !ok {
+		return 0, false
+	}
+	return b[0], true
+}
+
+func (r *reader) bytes(n int) ([]byte, bool) {
+	if len(*r) < n {
+		return nil, false
+	}
+	b := (*r)[:n]
+	*r = (*r)[n:]
+	return b, true
+}
+
+// vector16 reads a variable length value preceded by its 2 byte length.
+func (r *reader) vector16() ([]byte, bool) {
+	l, ok := r.bytes(2)
+	if !ok {
+		return nil, false
+	}
+	return r.bytes(int(binary.BigEndian.Uint16(l)))
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package sct
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serialize returns the TLS encoding of s.
+func serialize(s SCT) []byte {
+	b := []byte{s.Version}
+	b = append(b, s.LogID[:]...)
+	b = binary.BigEndian.AppendUint64(b, uint64(s.Timestamp.UnixMilli()))
+	b = appendVector16(b, s.Extensions)
+	b = append(b, s.HashAlgorithm, s.SignatureAlgorithm)
+	return appendVector16(b, s.Signature)
+}
+
+// serializeList returns the SignedCertificateTimestampList of scts.
+func serializeList(scts ...SCT) []byte {
+	var list []byte
+	for _, s := range scts {
+		list = appendVector16(list, serialize(s))
+	}
+	return appendVector16(nil, list)
+}
+
+func appendVector16(b, v []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(v)))
+	return append(b, v...)
+}
+
+// testSCT returns an SCT from a log whose ID starts with id.
+func testSCT(id byte) SCT {
+	s := SCT{
+		Timestamp:          time.UnixMilli(1600000000123),
+		Extensions:         []byte{},
+		HashAlgorithm:      4,
+		SignatureAlgorithm: 3,
+		Signature:          []byte("signature"),
+	}
+	s.LogID[0] = id
+	return s
+}
+
+func TestParse(t *testing.T) {
+	want := testSCT(1)
+	want.Extensions = []byte{1, 2, 3}
+	got, err := Parse(serialize(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got the SCT %+v, want %+v", got, want)
+	}
+	if s := got.String(); s != "log ID AQAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=, timestamp 2020-09-13T12:26:40Z" {
+		t.Errorf("got the string %q", s)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	b := serialize(testSCT(1))
+	// Every truncation is detected, not only those at field boundaries
+	for n := 0; n < len(b); n++ {
+		if _, err := Parse(b[:n]); err == nil {
+			t.Fatalf("parsing the SCT truncated to %d of %d bytes succeeded", n, len(b))
+		}
+	}
+
+	if _, err := Parse(append(b, 0)); err == nil || !strings.Contains(err.Error(), "trailing data") {
+		t.Errorf("got the error %v for trailing data, want one describing it", err)
+	}
+	v2 := append([]byte{1}, b[1:]...)
+	if _, err := Parse(v2); err == nil || !strings.Contains(err.Error(), "unsupported SCT version 1") {
+		t.Errorf("got the error %v for version 2, want one describing it", err)
+	}
+}
+
+func TestParseList(t *testing.T) {
+	want := []SCT{testSCT(1), testSCT(2)}
+	got, err := ParseList(serializeList(want...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got the SCTs %+v, want %+v", got, want)
+	}
+
+	empty, err := ParseList(serializeList())
+	if err != nil || len(empty) != 0 {
+		t.Errorf("got %v, %v for an empty list, want no SCTs", empty, err)
+	}
+
+	good := serializeList(testSCT(1))
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"empty", nil},
+		{"list length too long", append([]byte{0xff}, good[1:]...)},
+		{"trailing data", append(good, 0)},
+		{"SCT length too long", append(append([]byte{}, good[:2]...), append([]byte{0xff}, good[3:]...)...)},
+		{"invalid SCT", appendVector16(nil, appendVector16(nil, []byte{0}))},
+	}
+	for _, tc := range tests {
+		if _, err := ParseList(tc.b); err == nil {
+			t.Errorf("parsing the %s list succeeded", tc.name)
+		}
+	}
+}
+
+// newCertificate returns a self-signed certificate with the extensions.
+func newCertificate(t *testing.T, exts ...pkix.Extension) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: "localhost"},
+		IPAddresses:     []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: exts,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+}
+
+func TestFromCertificate(t *testing.T) {
+	want := []SCT{testSCT(1), testSCT(2)}
+	value, err := asn1.Marshal(serializeList(want...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := FromCertificate(newCertificate(t, pkix.Extension{Id: OIDExtension, Value: value}).Leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got the SCTs %+v, want %+v", got, want)
+	}
+
+	if got, err := FromCertificate(newCertificate(t).Leaf); got != nil || err != nil {
+		t.Errorf("got %v, %v for a certificate without SCTs, want none", got, err)
+	}
+	if _, err := FromCertificate(newCertificate(t, pkix.Extension{Id: OIDExtension, Value: []byte("not DER")}).Leaf); err == nil {
+		t.Error("parsing a malformed extension succeeded")
+	}
+}
+
+func TestFromConnection(t *testing.T) {
+	want := []SCT{testSCT(1), testSCT(2)}
+	cert := newCertificate(t)
+	cert.SignedCertificateTimestamps = [][]byte{serialize(want[0]), serialize(want[1])}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	for _, version := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, MaxVersion: version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := FromConnection(conn.ConnectionState().SignedCertificateTimestamps)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got the SCTs %+v from a %s handshake, want %+v", got, tls.VersionName(version), want)
+		}
+	}
+
+	if _, err := FromConnection([][]byte{{0}}); err == nil {
+		t.Error("parsing a malformed SCT succeeded")
+	}
+}
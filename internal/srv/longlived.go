@@ -0,0 +1,106 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package srv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// ErrShuttingDown is the cause of the contexts returned by LongLived.Register
+// once the server starts shutting down.
+var ErrShuttingDown = errors.New("server shutting down")
+
+// LongLived coordinates the shutdown of long-lived handlers, e.g., streaming,
+// Server-Sent Events, and WebSocket ones, which wouldn't finish within the
+// shutdown's timeout on their own. Rather than having their connections
+// closed when it expires, each is signaled to wrap up, e.g., by telling its
+// client the server is going away, when the shutdown starts, and given its
+// own timeout to do so.
+type LongLived struct {
+	mu       sync.Mutex
+	handlers map[uint64]*longLivedHandler
+	next     uint64
+	shutdown bool
+	drained  chan struct{}
+}
+
+type longLivedHandler struct {
+	cancel context.CancelCauseFunc
+	abort  func()
+}
+
+// NewLongLived returns a LongLived with no handlers registered.
+func NewLongLived() *LongLived {
+	return &LongLived{handlers: map[uint64]*longLivedHandler{}, drained: make(chan struct{})}
+}
+
+// Register registers a long-lived handler serving a request with the context
+// ctx. The returned context is canceled, with the cause ErrShuttingDown,
+// when the shutdown starts, signaling the handler to wrap up, and done must
+// be called once the handler has finished. If it hasn't finished when the
+// shutdown's timeout expires abort, if it isn't nil, is called, e.g., to
+// close a hijacked connection, which http.Server.Close doesn't. If the
+// shutdown has already started the returned context is already canceled.
+func (l *LongLived) Register(ctx context.Context, abort func()) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.shutdown {
+		cancel(ErrShuttingDown)
+		return ctx, func() {}
+	}
+	id := l.next
+	l.next++
+	l.handlers[id] = &longLivedHandler{cancel: cancel, abort: abort}
+	return ctx, func() {
+		cancel(context.Canceled)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.handlers, id)
+		if l.shutdown && len(l.handlers) == 0 {
+			close(l.drained)
+		}
+	}
+}
+
+// Shutdown signals the registered handlers to wrap up and waits until they
+// have, or ctx is done, in which case the remaining handlers are aborted and
+// an error saying how many there were is returned. Handlers registered
+// afterwards are signaled to wrap up immediately.
+func (l *LongLived) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	if l.shutdown {
+		l.mu.Unlock()
+		return errors.New("already shut down")
+	}
+	l.shutdown = true
+	if len(l.handlers) == 0 {
+		close(l.drained)
+	} else {
+		log.Printf("Signaling %d long-lived handlers, e.g., streams and WebSockets, to wrap up", len(l.handlers))
+	}
+	for _, h := range l.handlers {
+		h.cancel(ErrShuttingDown)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-l.drained:
+		return nil
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, h := range l.handlers {
+		if h.abort != nil {
+			h.abort()
+		}
+	}
+	return fmt.Errorf("%d long-lived handlers didn't wrap up in time: %w", len(l.handlers), ctx.Err())
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package srv
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLongLivedWrapsUp(t *testing.T) {
+	captureLog(t)
+	l := NewLongLived()
+	ctx, done := l.Register(context.Background(), func() { t.Error("a handler that wrapped up was aborted") })
+	go func() {
+		<-ctx.Done()
+		done()
+	}()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := l.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("got the error %s shutting down, want nil", err)
+	}
+	if cause := context.Cause(ctx); !errors.Is(cause, ErrShuttingDown) {
+		t.Errorf("got the cause %v, want ErrShuttingDown", cause)
+	}
+
+	// Handlers registered once the shutdown started wrap up immediately
+	late, done := l.Register(context.Background(), nil)
+	defer done()
+	if cause := context.Cause(late); !errors.Is(cause, ErrShuttingDown) {
+		t.Errorf("got the cause %v registering after the shutdown, want ErrShuttingDown", cause)
+	}
+	if err := l.Shutdown(shutdownCtx); err == nil {
+		t.Error("shutting down twice succeeded")
+	}
+}
+
+func TestLongLivedAborts(t *testing.T) {
+	captureLog(t)
+	l := NewLongLived()
+	aborted := make(chan struct{})
+	_, done := l.Register(context.Background(), func() { close(aborted) })
+	defer done()
+	// A handler that finished before the shutdown isn't waited for
+	_, finished := l.Register(context.Background(), func() { t.Error("a finished handler was aborted") })
+	finished()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := l.Shutdown(ctx)
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got the error %v, want the handler didn't wrap up in time", err)
+	}
+	select {
+	case <-aborted:
+	default:
+		t.Error("the handler that didn't wrap up wasn't aborted")
+	}
+}
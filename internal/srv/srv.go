@@ -0,0 +1,233 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package srv runs the servers' http.Servers, shutting them down gracefully
+// when they're signaled to stop:
+//
+//	err := srv.RunWithGracefulShutdown(context.Background(), server, "", "", srv.Options{Listener: ln})
+package srv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/health"
+	"github.com/youngkin/gohttps/internal/inflight"
+)
+
+// DefaultTimeout is how long in-flight requests are given to finish, by
+// default, once the server starts shutting down.
+const DefaultTimeout = 30 * time.Second
+
+// Options configure RunWithGracefulShutdown. Zero values are the defaults.
+type Options struct {
+	// Listener, if not nil, is served instead of listening on the server's Addr,
+	// e.g., so listen errors can be explained before the server is run.
+	Listener net.Listener
+	// Signals are the signals that stop the server, defaults to SIGTERM and
+	// os.Interrupt.
+	Signals []os.Signal
+	// PreStopDelay, if positive, is how long the server keeps serving, while
+	// Health reports not ready, after the first signal, e.g., so a load
+	// balancer stops sending it requests first. A second signal ends it early.
+	PreStopDelay time.Duration
+	// Timeout is how long in-flight requests are given to finish before the
+	// remaining connections are closed, defaults to DefaultTimeout.
+	Timeout time.Duration
+	// Health, if not nil, is set ready once the server is serving and
+	// reports draining, with Tracker's open connections, while it shuts down.
+	Health *health.Status
+	// Tracker, if not nil, is the server's inflight.Tracker. The shutdown also
+	// waits for the requests of hijacked connections, which http.Server doesn't
+	// track, and the remaining connections are logged if it times out.
+	Tracker *inflight.Tracker
+	// DrainAnnounce, if positive and Tracker isn't nil, is how often the number
+	// of connections and requests remaining is logged while draining.
+	DrainAnnounce time.Duration
+	// OnShutdown are called, concurrently with the server's Shutdown, when the
+	// shutdown starts, e.g., to end long-lived responses Shutdown would
+	// otherwise wait for. AfterShutdown are called once the in-flight requests
+	// are done, or the timeout expired, e.g., to stop the servers that report
+	// the drain. Both are passed a context that's done when the timeout
+	// expires, and are waited for.
+	OnShutdown    []func(ctx context.Context)
+	AfterShutdown []func(ctx context.Context)
+	// LongLived, if not nil, are the server's long-lived handlers. They're
+	// signaled to wrap up when the shutdown starts, concurrently with the
+	// server's Shutdown, and given LongLivedTimeout, which defaults to
+	// Timeout, to do so. The shutdown lasts at most the longer of the two.
+	LongLived        *LongLived
+	LongLivedTimeout time.Duration
+}
+
+// RunWithGracefulShutdown serves server, with TLS using certFile and keyFile,
+// which may be empty if the server's TLSConfig has a certificate, until one of
+// the Options' Signals is received or ctx is done. The server then stops
+// accepting connections, after the PreStopDelay, and in-flight requests are
+// given the Timeout to finish, after which the remaining connections are
+// closed. It returns once the server has stopped, with the error serving
+// failed with, or nil if it was shut down.
+func RunWithGracefulShutdown(ctx context.Context, server *http.Server, certFile, keyFile string, opts Options) error {
+	ln := opts.Listener
+	if ln == nil {
+		var err error
+		if ln, err = net.Listen("tcp", server.Addr); err != nil {
+			return err
+		}
+	}
+	signals := opts.Signals
+	if signals == nil {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, signals...)
+	defer signal.Stop(stop)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ServeTLS(ln, certFile, keyFile)
+	}()
+	if opts.Health != nil {
+		opts.Health.SetReady(true)
+	}
+
+	var reason string
+	select {
+	case err := <-served:
+		return err
+	case sig := <-stop:
+		reason = sig.String()
+	case <-ctx.Done():
+		reason = ctx.Err().Error()
+	}
+	shutdown(server, reason, stop, opts)
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// shutdown shuts server down, as described by RunWithGracefulShutdown, for
+// reason, e.g., the signal received. Another signal on stop ends the
+// PreStopDelay.
+func shutdown(server *http.Server, reason string, stop <-chan os.Signal, opts Options) {
+	received := time.Now()
+	since := func() time.Duration { return time.Since(received).Round(time.Millisecond) }
+	if opts.PreStopDelay > 0 {
+		if opts.Health != nil {
+			opts.Health.SetReady(false)
+		}
+		log.Printf("Received %s, pre-stop: %s now reports not ready, serving for another %s before shutting down", reason, health.ReadinessPath, opts.PreStopDelay)
+		select {
+		case <-time.After(opts.PreStopDelay):
+			log.Printf("Pre-stop delay over after %s, shutting down", since())
+		case sig := <-stop:
+			log.Printf("Received %s during the pre-stop delay, shutting down after %s", sig, since())
+		}
+	} else {
+		log.Printf("Received %s, shutting down", reason)
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	if opts.Health != nil && opts.Tracker != nil {
+		opts.Health.SetDraining(opts.Tracker.Open)
+	} else if opts.Health != nil {
+		opts.Health.SetReady(false)
+	}
+	longLivedTimeout := opts.LongLivedTimeout
+	if longLivedTimeout == 0 {
+		longLivedTimeout = timeout
+	}
+	if opts.LongLived != nil && longLivedTimeout != timeout {
+		log.Printf("Draining in-flight requests, the remaining connections are closed in %s, or %s for long-lived handlers", timeout, longLivedTimeout)
+	} else {
+		log.Printf("Draining in-flight requests, the remaining connections are closed in %s", timeout)
+	}
+	// The server's Shutdown waits for the long-lived handlers' connections too,
+	// so it's given the longer of the timeouts
+	ctx, cancel := context.WithTimeout(context.Background(), max(timeout, longLivedTimeout))
+	defer cancel()
+	announceCtx, stopAnnouncing := context.WithCancel(ctx)
+	if opts.DrainAnnounce > 0 && opts.Tracker != nil {
+		go announceDrain(announceCtx, opts.DrainAnnounce, opts.Tracker)
+	}
+	var wg sync.WaitGroup
+	if opts.LongLived != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			llCtx, cancel := context.WithTimeout(ctx, longLivedTimeout)
+			defer cancel()
+			if err := opts.LongLived.Shutdown(llCtx); err != nil {
+				log.Printf("Closing the connections of long-lived handlers: %s", err)
+			}
+		}()
+	}
+	for _, f := range opts.OnShutdown {
+		wg.Add(1)
+		go func(f func(context.Context)) {
+			defer wg.Done()
+			f(ctx)
+		}(f)
+	}
+	err := server.Shutdown(ctx)
+	if err == nil && opts.Tracker != nil {
+		// Shutdown doesn't wait for the handlers of hijacked connections
+		err = opts.Tracker.Wait(ctx)
+	}
+	wg.Wait()
+	stopAnnouncing()
+	if err != nil {
+		remaining := "the remaining connections"
+		if opts.Tracker != nil {
+			var addrs []string
+			for _, c := range opts.Tracker.Snapshot().Conns {
+				addrs = append(addrs, c.RemoteAddr)
+			}
+			remaining = fmt.Sprintf("the %d remaining connections from %s", len(addrs), strings.Join(addrs, ", "))
+		}
+		log.Printf("Unable to finish in-flight requests before shutting down: %s, closing %s, %s after %s",
+			err, remaining, since(), reason)
+		server.Close()
+	} else {
+		log.Printf("All connections drained, %s after %s", since(), reason)
+	}
+	for _, f := range opts.AfterShutdown {
+		f(ctx)
+	}
+}
+
+// announceDrain logs the number of connections and requests remaining every
+// interval while the server is shutting down, until ctx is done or none remain.
+func announceDrain(ctx context.Context, interval time.Duration, tracker *inflight.Tracker) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			snap := tracker.Snapshot()
+			if snap.Open == 0 && snap.InFlight == 0 {
+				return
+			}
+			deadline, _ := ctx.Deadline()
+			log.Printf("Draining: %d connections remaining, %d active, %d requests in flight, force closing them in %s",
+				snap.Open, snap.Active, snap.InFlight, time.Until(deadline).Round(time.Second))
+		}
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package srv
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/youngkin/gohttps/internal/health"
+	"github.com/youngkin/gohttps/internal/inflight"
+)
+
+// logBuffer is a concurrency safe buffer the standard logger writes to.
+type logBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *logBuffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Split(strings.TrimSpace(b.b.String()), "\n")
+}
+
+// captureLog makes the standard logger write to the returned buffer until
+// the test ends.
+func captureLog(t *testing.T) *logBuffer {
+	t.Helper()
+	buf := &logBuffer{}
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	})
+	return buf
+}
+
+// waitFor waits for cond to become true.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+// newCert returns a self-signed certificate for 127.0.0.1.
+func newCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// server is a server run by RunWithGracefulShutdown.
+type server struct {
+	url string
+	// stop starts the shutdown
+	stop func()
+	// done receives RunWithGracefulShutdown's result
+	done chan error
+}
+
+// run runs a server for h with RunWithGracefulShutdown and opts, tracking its
+// connections with opts.Tracker if it's set.
+func run(t *testing.T, h http.Handler, opts Options) *server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := &http.Server{
+		Handler:   h,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{newCert(t)}},
+		ErrorLog:  log.New(ioutil.Discard, "", 0),
+	}
+	if opts.Tracker != nil {
+		hs.Handler = opts.Tracker.Middleware(h)
+		hs.ConnContext = opts.Tracker.ConnContext
+		hs.ConnState = opts.Tracker.ConnState
+	}
+	opts.Listener = ln
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &server{url: "https://" + ln.Addr().String(), stop: cancel, done: make(chan error, 1)}
+	go func() {
+		s.done <- RunWithGracefulShutdown(ctx, hs, "", "", opts)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		hs.Close()
+	})
+	return s
+}
+
+// get sends a GET request for path, on a connection of its own, returning its
+// error.
+func (s *server) get(path string) error {
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}}
+	res, err := client.Get(s.url + path)
+	if err != nil {
+		return err
+	}
+	_, err = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	return err
+}
+
+// result waits for RunWithGracefulShutdown to return.
+func (s *server) result(t *testing.T) error {
+	t.Helper()
+	select {
+	case err := <-s.done:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the server to shut down")
+		return nil
+	}
+}
+
+// sleeper sleeps for the duration in the request's 'd' query parameter.
+var sleeper = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	d, _ := time.ParseDuration(r.URL.Query().Get("d"))
+	time.Sleep(d)
+})
+
+var remainingLine = regexp.MustCompile(`^Draining: (\d+) connections remaining, \d+ active, (\d+) requests in flight, force closing them in \d+s$`)
+
+// TestShutdownAnnouncesDrain shuts down a server with two requests of
+// different durations in flight, checking the announced number remaining
+// counts down to zero before the deadline, and /readyz reports the drain.
+func TestShutdownAnnouncesDrain(t *testing.T) {
+	logs := captureLog(t)
+	var tracker inflight.Tracker
+	var status health.Status
+	s := run(t, sleeper, Options{Tracker: &tracker, Health: &status, DrainAnnounce: 20 * time.Millisecond, Timeout: 5 * time.Second})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, d := range []string{"100ms", "300ms"} {
+		wg.Add(1)
+		go func(d string) {
+			defer wg.Done()
+			errs <- s.get("/?d=" + d)
+		}(d)
+	}
+	waitFor(t, "the requests to be in flight", func() bool { return tracker.InFlight() == 2 })
+	start := time.Now()
+	s.stop()
+
+	waitFor(t, "the server to report it's draining", func() bool { return !status.Ready() })
+	readyz := httptest.NewRecorder()
+	status.Handler().ServeHTTP(readyz, httptest.NewRequest(http.MethodGet, health.ReadinessPath, nil))
+	if got := readyz.Body.String(); readyz.Code != http.StatusServiceUnavailable || !strings.Contains(got, "connections remaining") {
+		t.Errorf("got the /readyz response %d %q while draining, want 503 with the connections remaining", readyz.Code, got)
+	}
+
+	if err := s.result(t); err != nil {
+		t.Fatalf("the server returned the error %s, want nil", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the drain took %s, longer than the timeout", elapsed)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("an in-flight request failed: %s", err)
+		}
+	}
+
+	prev, seen := 3, map[int]bool{}
+	var drained bool
+	for _, line := range logs.lines() {
+		if strings.HasPrefix(line, "All connections drained") {
+			drained = true
+		}
+		m := remainingLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[2])
+		if n > prev {
+			t.Errorf("got %d requests in flight announced after %d", n, prev)
+		}
+		prev, seen[n] = n, true
+	}
+	if !seen[2] || !seen[1] || !drained {
+		t.Errorf("got the lines %q, want 2 and then 1 requests in flight announced, and then the connections drained", logs.lines())
+	}
+}
+
+// TestShutdownFinishesRequest shuts down a server, without a Tracker, while a
+// slow request is in flight, checking it's answered before
+// RunWithGracefulShutdown returns.
+func TestShutdownFinishesRequest(t *testing.T) {
+	captureLog(t)
+	started := make(chan struct{})
+	var finished atomic.Bool
+	s := run(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+		finished.Store(true)
+	}), Options{Timeout: 5 * time.Second})
+
+	type response struct {
+		status int
+		body   string
+		err    error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+		res, err := client.Get(s.url + "/")
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		responses <- response{res.StatusCode, string(body), err}
+	}()
+	<-started
+	s.stop()
+
+	if err := s.result(t); err != nil {
+		t.Fatalf("the server returned the error %s, want nil", err)
+	}
+	if !finished.Load() {
+		t.Error("RunWithGracefulShutdown returned before the in-flight request finished")
+	}
+	if r := <-responses; r.err != nil || r.status != http.StatusOK || r.body != "done" {
+		t.Errorf("got the response %d %q, error %v, to the in-flight request, want 200 \"done\"", r.status, r.body, r.err)
+	}
+}
+
+func TestShutdownForceCloses(t *testing.T) {
+	logs := captureLog(t)
+	var tracker inflight.Tracker
+	release := make(chan struct{})
+	defer close(release)
+	s := run(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }), Options{Tracker: &tracker, Timeout: 100 * time.Millisecond})
+
+	errs := make(chan error, 1)
+	go func() { errs <- s.get("/") }()
+	waitFor(t, "the request to be in flight", func() bool { return tracker.InFlight() == 1 })
+	addr := tracker.Snapshot().Conns[0].RemoteAddr
+	s.stop()
+
+	if err := s.result(t); err != nil {
+		t.Fatalf("the server returned the error %s, want nil", err)
+	}
+	if err := <-errs; err == nil {
+		t.Error("the request cut off by the deadline succeeded")
+	}
+	var found bool
+	for _, line := range logs.lines() {
+		if strings.HasPrefix(line, "Unable to finish in-flight requests before shutting down: context deadline exceeded, closing the 1 remaining connections from "+addr) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("got the lines %q, want one naming the connection from %s that was cut off", logs.lines(), addr)
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package tcpopt
+
+import (
+	"errors"
+	"runtime"
+)
+
+func setRecvBuffer(fd uintptr, size int) error {
+	return errors.New("setting SO_RCVBUF isn't supported on " + runtime.GOOS)
+}
+
+func setSendBuffer(fd uintptr, size int) error {
+	return errors.New("setting SO_SNDBUF isn't supported on " + runtime.GOOS)
+}
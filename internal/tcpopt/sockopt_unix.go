@@ -0,0 +1,27 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package tcpopt
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+func setRecvBuffer(fd uintptr, size int) error {
+	if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF, size); err != nil {
+		return fmt.Errorf("unable to set SO_RCVBUF to %d: %w", size, err)
+	}
+	return nil
+}
+
+func setSendBuffer(fd uintptr, size int) error {
+	if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_SNDBUF, size); err != nil {
+		return fmt.Errorf("unable to set SO_SNDBUF to %d: %w", size, err)
+	}
+	return nil
+}
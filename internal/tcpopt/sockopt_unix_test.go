@@ -0,0 +1,51 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package tcpopt
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// sockopt returns the value of the socket option opt of conn.
+func sockopt(t *testing.T, conn net.Conn, level, opt int) int {
+	t.Helper()
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v int
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) { v, sockErr = unix.GetsockoptInt(int(fd), level, opt) }); err != nil {
+		t.Fatal(err)
+	}
+	if sockErr != nil {
+		t.Fatal(sockErr)
+	}
+	return v
+}
+
+func TestDialContext(t *testing.T) {
+	conn := dial(t, Options{})
+	if got := sockopt(t, conn, unix.IPPROTO_TCP, unix.TCP_NODELAY); got == 0 {
+		t.Error("got TCP_NODELAY cleared by default, want Go's default of set")
+	}
+
+	conn = dial(t, Options{Nagle: true, RecvBuffer: 32 << 10, SendBuffer: 48 << 10})
+	if got := sockopt(t, conn, unix.IPPROTO_TCP, unix.TCP_NODELAY); got != 0 {
+		t.Error("got TCP_NODELAY set, want it cleared for Nagle's algorithm")
+	}
+	// The system may adjust the sizes, e.g., Linux doubles them
+	if got := sockopt(t, conn, unix.SOL_SOCKET, unix.SO_RCVBUF); got < 32<<10 {
+		t.Errorf("got SO_RCVBUF %d, want at least %d", got, 32<<10)
+	}
+	if got := sockopt(t, conn, unix.SOL_SOCKET, unix.SO_SNDBUF); got < 48<<10 {
+		t.Errorf("got SO_SNDBUF %d, want at least %d", got, 48<<10)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package tcpopt applies TCP tuning options, e.g., keep-alive and socket
+// buffer sizes, to the connections made by the client and accepted by the
+// servers.
+package tcpopt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// dialTimeout is the connect timeout used by Options.DialContext, the same
+// as http.DefaultTransport's.
+const dialTimeout = 30 * time.Second
+
+// Options are TCP socket options. The zero value leaves Go's defaults, i.e.,
+// 15 second keep-alives, TCP_NODELAY set, and the system's buffer sizes.
+type Options struct {
+	// KeepAlive is the keep-alive period, 0 uses Go's default and a negative
+	// value disables keep-alives.
+	KeepAlive time.Duration
+	// Nagle enables Nagle's algorithm by clearing TCP_NODELAY, which Go sets
+	// on every TCP connection by default.
+	Nagle bool
+	// RecvBuffer and SendBuffer, if greater than 0, set SO_RCVBUF and
+	// SO_SNDBUF respectively. Setting them is only supported on Linux and
+	// the BSDs, including macOS.
+	RecvBuffer int
+	SendBuffer int
+}
+
+// String describes the options, e.g., for logging at startup.
+func (o Options) String() string {
+	var opts []string
+	switch {
+	case o.KeepAlive < 0:
+		opts = append(opts, "keep-alive disabled")
+	case o.KeepAlive == 0:
+		opts = append(opts, "keep-alive default")
+	default:
+		opts = append(opts, fmt.Sprintf("keep-alive %s", o.KeepAlive))
+	}
+	opts = append(opts, fmt.Sprintf("TCP_NODELAY %t", !o.Nagle))
+	if o.RecvBuffer > 0 {
+		opts = append(opts, fmt.Sprintf("SO_RCVBUF %d", o.RecvBuffer))
+	}
+	if o.SendBuffer > 0 {
+		opts = append(opts, fmt.Sprintf("SO_SNDBUF %d", o.SendBuffer))
+	}
+	return strings.Join(opts, ", ")
+}
+
+// Control is a net.Dialer or net.ListenConfig Control function that sets the
+// socket buffer sizes. Sockets accepted by a listener inherit its sizes.
+func (o Options) Control(network, address string, c syscall.RawConn) error {
+	if o.RecvBuffer <= 0 && o.SendBuffer <= 0 {
+		return nil
+	}
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if o.RecvBuffer > 0 {
+			if sockErr = setRecvBuffer(fd, o.RecvBuffer); sockErr != nil {
+				return
+			}
+		}
+		if o.SendBuffer > 0 {
+			sockErr = setSendBuffer(fd, o.SendBuffer)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// Apply sets the options that can only be set once a connection is
+// established, i.e., TCP_NODELAY which Go sets on every new connection.
+func (o Options) Apply(conn net.Conn) error {
+	if !o.Nagle {
+		return nil
+	}
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if err := tc.SetNoDelay(false); err != nil {
+		return fmt.Errorf("unable to clear TCP_NODELAY: %w", err)
+	}
+	return nil
+}
+
+// DialContext dials address using the options, for use as
+// http.Transport.DialContext.
+func (o Options) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d := net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: o.KeepAlive,
+		Control:   o.Control,
+	}
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.Apply(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
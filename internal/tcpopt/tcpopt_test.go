@@ -0,0 +1,59 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tcpopt
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestOptionsString(t *testing.T) {
+	tests := []struct {
+		opts Options
+		want string
+	}{
+		{Options{}, "keep-alive default, TCP_NODELAY true"},
+		{Options{KeepAlive: -1, Nagle: true}, "keep-alive disabled, TCP_NODELAY false"},
+		{Options{KeepAlive: 30 * time.Second, RecvBuffer: 1 << 16, SendBuffer: 1 << 17}, "keep-alive 30s, TCP_NODELAY true, SO_RCVBUF 65536, SO_SNDBUF 131072"},
+	}
+	for _, tc := range tests {
+		if got := tc.opts.String(); got != tc.want {
+			t.Errorf("got %q for %+v, want %q", got, tc.opts, tc.want)
+		}
+	}
+}
+
+// dial connects to a new listener using opts, returning the client's
+// connection.
+func dial(t *testing.T, opts Options) net.Conn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	conn, err := opts.DialContext(context.Background(), "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestApplyIgnoresOtherConns(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	if err := (Options{Nagle: true}).Apply(client); err != nil {
+		t.Errorf("applying the options to a connection that isn't TCP failed: %s", err)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tlsutil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile is a named bundle of TLS settings modeled on Mozilla's server side
+// TLS recommendations (https://wiki.mozilla.org/Security/Server_Side_TLS).
+// Go doesn't implement the finite field DHE cipher suites so they're omitted,
+// and TLS 1.3 cipher suites aren't configurable in Go so none are listed for
+// the modern profile.
+type Profile struct {
+	Name         string
+	MinVersion   uint16
+	CipherSuites []uint16
+	Curves       []tls.CurveID
+}
+
+var profileCurves = []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}
+
+var profiles = map[string]Profile{
+	"modern": {
+		Name:       "modern",
+		MinVersion: tls.VersionTLS13,
+		Curves:     profileCurves,
+	},
+	"intermediate": {
+		Name:       "intermediate",
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		Curves: profileCurves,
+	},
+	"old": {
+		Name:       "old",
+		MinVersion: tls.VersionTLS10,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+			tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+		},
+		Curves: profileCurves,
+	},
+}
+
+// ProfileNames returns the names of the supported profiles.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupProfile returns the profile with the given name, ignoring case.
+func LookupProfile(name string) (Profile, error) {
+	p, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown TLS profile %q, supported profiles are %s", name, strings.Join(ProfileNames(), ", "))
+	}
+	return p, nil
+}
+
+// Apply sets cfg's minimum version, cipher suites, and curve preferences from p.
+func (p Profile) Apply(cfg *tls.Config) {
+	cfg.MinVersion = p.MinVersion
+	cfg.CipherSuites = append([]uint16(nil), p.CipherSuites...)
+	cfg.CurvePreferences = append([]tls.CurveID(nil), p.Curves...)
+}
+
+// ParseCipherSuites parses a comma separated list of cipher suite names, e.g.,
+// 'TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384',
+// into a list suitable for tls.Config.CipherSuites. Names are those used by
+// crypto/tls, and include the suites crypto/tls considers insecure. An empty
+// list returns nil, which leaves the choice of cipher suites to crypto/tls.
+func ParseCipherSuites(list string) ([]uint16, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	known := map[string]uint16{}
+	for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[cs.Name] = cs.ID
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := known[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tlsutil
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+)
+
+// TestProfileApply asserts the exact settings of each profile, so a change
+// to one is deliberate.
+func TestProfileApply(t *testing.T) {
+	curves := []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}
+	intermediate := []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+	}
+	tests := []struct {
+		name       string
+		minVersion uint16
+		ciphers    []uint16
+	}{
+		{"modern", tls.VersionTLS13, nil},
+		{"intermediate", tls.VersionTLS12, intermediate},
+		{"old", tls.VersionTLS10,
+			append(append([]uint16(nil), intermediate...),
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+				tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+				tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+				tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+				tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+			),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := LookupProfile(tc.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var cfg tls.Config
+			p.Apply(&cfg)
+			if cfg.MinVersion != tc.minVersion {
+				t.Errorf("got the minimum version %s, want %s", tls.VersionName(cfg.MinVersion), tls.VersionName(tc.minVersion))
+			}
+			if len(cfg.CipherSuites) != 0 || len(tc.ciphers) != 0 {
+				if !reflect.DeepEqual(cfg.CipherSuites, tc.ciphers) {
+					t.Errorf("got the cipher suites %v, want %v", cfg.CipherSuites, tc.ciphers)
+				}
+			}
+			if !reflect.DeepEqual(cfg.CurvePreferences, curves) {
+				t.Errorf("got the curves %v, want %v", cfg.CurvePreferences, curves)
+			}
+
+			// The config's settings are copies, changing them leaves the
+			// profile unchanged
+			if len(cfg.CurvePreferences) > 0 {
+				cfg.CurvePreferences[0] = tls.CurveP521
+				if again, _ := LookupProfile(tc.name); again.Curves[0] == tls.CurveP521 {
+					t.Error("changing the config's curves changed the profile")
+				}
+			}
+		})
+	}
+}
+
+func TestLookupProfile(t *testing.T) {
+	if p, err := LookupProfile("Modern"); err != nil || p.Name != "modern" {
+		t.Errorf("got %+v, %v for Modern, want the modern profile", p, err)
+	}
+	if _, err := LookupProfile("strict"); err == nil {
+		t.Error("looking up an unknown profile succeeded")
+	}
+	if got, want := ProfileNames(), []string{"intermediate", "modern", "old"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got the profile names %v, want %v", got, want)
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []uint16
+		wantErr bool
+	}{
+		{"", nil, false},
+		{" ", nil, false},
+		{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, false},
+		{"tls_ecdhe_rsa_with_aes_128_gcm_sha256, TLS_RSA_WITH_3DES_EDE_CBC_SHA", []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA}, false},
+		{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,ECDHE-RSA-AES128-GCM-SHA256", nil, true},
+	}
+	for _, tc := range tests {
+		got, err := ParseCipherSuites(tc.list)
+		if (err != nil) != tc.wantErr || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseCipherSuites(%q) = %v, %v, want %v, an error: %t", tc.list, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package tlsutil contains helpers for converting between the names of TLS
+// parameters used in flags and logs and their crypto/tls equivalents.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// curves maps the accepted curve names to their tls.CurveID. The lookup is
+// case insensitive. Both the common names (e.g., P-256) and the crypto/tls
+// constant names (e.g., CurveP256) are accepted.
+var curves = map[string]tls.CurveID{
+	"x25519":         tls.X25519,
+	"p-256":          tls.CurveP256,
+	"curvep256":      tls.CurveP256,
+	"p-384":          tls.CurveP384,
+	"curvep384":      tls.CurveP384,
+	"p-521":          tls.CurveP521,
+	"curvep521":      tls.CurveP521,
+	"x25519mlkem768": tls.X25519MLKEM768,
+	"x25519mlkem":    tls.X25519MLKEM768,
+}
+
+// unavailableCurves maps the names of the key exchange groups that crypto/tls
+// has supported, but no longer does, to why, for a clearer error than an
+// unknown name.
+var unavailableCurves = map[string]string{
+	"x25519kyber768draft00": "X25519Kyber768Draft00 was only supported by Go 1.23, it was replaced by X25519MLKEM768, which requires Go 1.24 or later",
+	"x25519kyber768":        "X25519Kyber768Draft00 was only supported by Go 1.23, it was replaced by X25519MLKEM768, which requires Go 1.24 or later",
+}
+
+// ParseCurves parses a comma separated list of curve names, e.g.,
+// 'X25519,P-256', into a list suitable for tls.Config.CurvePreferences. An
+// empty list returns nil, which leaves the choice of curves to crypto/tls.
+// Groups this build of Go doesn't support, including X25519MLKEM768 when
+// it's disabled by GODEBUG=tlsmlkem=0, are an error naming the Go version
+// required.
+func ParseCurves(list string) ([]tls.CurveID, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	var ids []tls.CurveID
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if why, ok := unavailableCurves[strings.ToLower(name)]; ok {
+			return nil, fmt.Errorf("unsupported curve %q, %s", name, why)
+		}
+		id, ok := curves[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %q, supported curves are X25519, P-256, P-384, P-521, and X25519MLKEM768", name)
+		}
+		if id == tls.X25519MLKEM768 && godebug("tlsmlkem") == "0" {
+			return nil, fmt.Errorf("unsupported curve %q, it's disabled by GODEBUG=tlsmlkem=0", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// CurveName returns the name of a curve, or key exchange group, e.g.,
+// X25519MLKEM768, "none" for 0, e.g., for resumed TLS 1.2 sessions, which
+// don't perform a key exchange.
+func CurveName(id tls.CurveID) string {
+	if id == 0 {
+		return "none"
+	}
+	return id.String()
+}
+
+// godebug returns the value of the GODEBUG setting name, "" if it isn't set.
+func godebug(name string) string {
+	value := ""
+	for _, kv := range strings.Split(os.Getenv("GODEBUG"), ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(kv), "="); ok && k == name {
+			value = v
+		}
+	}
+	return value
+}
+
+var renegotiation = map[string]tls.RenegotiationSupport{
+	"never":  tls.RenegotiateNever,
+	"once":   tls.RenegotiateOnceAsClient,
+	"freely": tls.RenegotiateFreelyAsClient,
+}
+
+// ParseRenegotiation parses the name of a client renegotiation policy, one
+// of never, once, or freely. An empty name is the same as never.
+func ParseRenegotiation(name string) (tls.RenegotiationSupport, error) {
+	if name == "" {
+		return tls.RenegotiateNever, nil
+	}
+	r, ok := renegotiation[strings.ToLower(name)]
+	if !ok {
+		return tls.RenegotiateNever, fmt.Errorf("unknown renegotiation policy %q, it must be one of never, once, or freely", name)
+	}
+	return r, nil
+}
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseVersion parses a TLS version number, e.g., '1.3' or 'TLS1.3', into its
+// crypto/tls constant.
+func ParseVersion(name string) (uint16, error) {
+	v := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "tls")
+	version, ok := versions[strings.TrimSpace(v)]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, it must be one of 1.0, 1.1, 1.2, or 1.3", name)
+	}
+	return version, nil
+}
+
+// VersionName returns the compact name of a TLS version, e.g., 'TLS1.3', used
+// in headers and other places where spaces are inconvenient. Unknown versions
+// are returned in hex, e.g., '0x0305'.
+func VersionName(version uint16) string {
+	for name, v := range versions {
+		if v == version {
+			return "TLS" + name
+		}
+	}
+	return fmt.Sprintf("0x%04X", version)
+}
+
+// CipherSuiteName returns the standard name of a cipher suite, e.g.,
+// 'TLS_AES_128_GCM_SHA256', or its ID in hex if it's unknown.
+func CipherSuiteName(id uint16) string {
+	return tls.CipherSuiteName(id)
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tlsutil
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    uint16
+		wantErr bool
+	}{
+		{"1.3", tls.VersionTLS13, false},
+		{" TLS1.2 ", tls.VersionTLS12, false},
+		{"tls 1.0", tls.VersionTLS10, false},
+		{"1.4", 0, true},
+		{"SSL3", 0, true},
+	}
+	for _, tc := range tests {
+		got, err := ParseVersion(tc.name)
+		if got != tc.want || (err != nil) != tc.wantErr {
+			t.Errorf("ParseVersion(%q) = %x, %v, want %x, an error: %t", tc.name, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestVersionName(t *testing.T) {
+	tests := []struct {
+		version uint16
+		want    string
+	}{
+		{tls.VersionTLS10, "TLS1.0"},
+		{tls.VersionTLS11, "TLS1.1"},
+		{tls.VersionTLS12, "TLS1.2"},
+		{tls.VersionTLS13, "TLS1.3"},
+		{0x0305, "0x0305"},
+	}
+	for _, tc := range tests {
+		if got := VersionName(tc.version); got != tc.want {
+			t.Errorf("got %q for %#04x, want %q", got, tc.version, tc.want)
+		}
+	}
+	if got := CipherSuiteName(tls.TLS_AES_128_GCM_SHA256); got != "TLS_AES_128_GCM_SHA256" {
+		t.Errorf("got %q for TLS_AES_128_GCM_SHA256", got)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2020 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package version reports the build the commands were built from, for their
+// -version flags and advserver's /version endpoint. Release builds set the
+// version, commit, and date with the linker:
+//
+//	go build -ldflags "-X github.com/youngkin/gohttps/internal/version.version=v1.2.0 \
+//	    -X github.com/youngkin/gohttps/internal/version.commit=$(git rev-parse HEAD) \
+//	    -X github.com/youngkin/gohttps/internal/version.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./...
+//
+// Otherwise they come from the module and VCS information the go command
+// embeds in the binary, if any.
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Path is the path of the version endpoint.
+const Path = "/version"
+
+// Set with -ldflags -X, see the package documentation.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// Info describes a build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information of the running binary.
+func Get() Info {
+	info := Info{Version: version, Commit: commit, Date: date, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		modified := false
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && date == "":
+				info.Date = s.Value
+			case s.Key == "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if modified && commit == "" && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
+
+// String returns info on a single line, e.g., for -version.
+func (info Info) String() string {
+	s := info.Version
+	if info.Commit != "" {
+		s += ", commit " + info.Commit
+	}
+	if info.Date != "" {
+		s += ", built " + info.Date
+	}
+	return s + ", " + info.GoVersion
+}
+
+// Handler returns a handler serving the build information, as JSON or, if the
+// request's Accept header prefers it, as text.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		info := Get()
+		w.Header().Set("Vary", "Accept")
+		if prefersText(r.Header.Get("Accept")) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprintf(w, "version: %s\ncommit: %s\ndate: %s\ngo: %s\n", info.Version, info.Commit, info.Date, info.GoVersion)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	})
+}
+
+// prefersText returns true if accept, an Accept header, gives text/plain a
+// higher quality than application/json. JSON is preferred on a tie, including
+// when there's no Accept header.
+func prefersText(accept string) bool {
+	return quality(accept, "text", "plain") > quality(accept, "application", "json")
+}
+
+// quality returns the quality accept gives to the media type typ/subtype,
+// taken from the most specific media range matching it.
+func quality(accept, typ, subtype string) float64 {
+	if strings.TrimSpace(accept) == "" {
+		return 1
+	}
+	q, specificity := 0.0, -1
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		t, st, _ := strings.Cut(mt, "/")
+		s := -1
+		switch {
+		case t == typ && st == subtype:
+			s = 2
+		case t == typ && st == "*":
+			s = 1
+		case t == "*" && st == "*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, q = s, 1
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+	}
+	return q
+}